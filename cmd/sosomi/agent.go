@@ -0,0 +1,351 @@
+// Tool calling loop for 'sosomi llm --tools'
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/peterh/liner"
+
+	"github.com/sonemaro/sosomi/internal/ai"
+	"github.com/sonemaro/sosomi/internal/config"
+	"github.com/sonemaro/sosomi/internal/conversation"
+	"github.com/sonemaro/sosomi/internal/mcp"
+	"github.com/sonemaro/sosomi/internal/safety"
+	"github.com/sonemaro/sosomi/internal/types"
+	"github.com/sonemaro/sosomi/internal/ui"
+)
+
+// maxToolIterations bounds the model round trips made for a single user message
+const maxToolIterations = 20
+
+// maxToolOutputLines limits the tool output shown on screen (the model gets all of it)
+const maxToolOutputLines = 20
+
+// toolAgent runs the model, executing the tools it requests until it answers
+type toolAgent struct {
+	cfg      *config.Config
+	provider ai.Provider
+	manager  *mcp.Manager
+	store    *conversation.Store
+	convID   string
+	line     *liner.State
+	context  *contextFitter
+
+	// Usage billed for the last reply, to count what the next prompt adds
+	lastUsage ai.TokenUsage
+}
+
+// run sends messages, ending with the user's message, to the model and
+// executes requested tools, feeding their results back until the model
+// produces a final answer. The user's message, assistant tool calls and tool
+// results are persisted as they happen. Returns the updated messages and the
+// final answer.
+func (a *toolAgent) run(messages []ai.Message) ([]ai.Message, string, error) {
+	tools := a.manager.AvailableTools()
+
+	// The user's message is stored with the prompt tokens it added, known
+	// from the usage of the first reply
+	input := messages[len(messages)-1].Content
+	inputStored := false
+	storeInput := func(usage ai.TokenUsage) {
+		if !inputStored {
+			a.store.AddMessage(a.convID, "user", input, promptGrowth(usage, a.lastUsage))
+			inputStored = true
+		}
+	}
+
+	for i := 0; i < maxToolIterations; i++ {
+		request := a.context.fit(messages)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(a.cfg.Model.TimeoutSeconds)*time.Second)
+		resp, err := a.provider.ChatWithTools(ctx, request, tools)
+		cancel()
+		if err != nil {
+			storeInput(ai.TokenUsage{})
+			return messages, "", err
+		}
+		storeInput(resp.Usage)
+		if resp.Usage.PromptTokens > 0 {
+			a.lastUsage = resp.Usage
+		}
+
+		if len(resp.ToolCalls) == 0 {
+			messages = append(messages, ai.Message{Role: "assistant", Content: resp.Content})
+			a.store.AddReply(a.convID, resp.Content, nil, resp.Usage)
+			return messages, resp.Content, nil
+		}
+
+		if resp.Content != "" {
+			fmt.Printf("assistant> %s\n", resp.Content)
+		}
+		messages = append(messages, ai.Message{Role: "assistant", Content: resp.Content, ToolCalls: resp.ToolCalls})
+		a.store.AddReply(a.convID, resp.Content, toStoredToolCalls(resp.ToolCalls), resp.Usage)
+
+		for _, call := range resp.ToolCalls {
+			result := a.runTool(call)
+			messages = append(messages, ai.Message{
+				Role:       "tool",
+				Content:    result.Content,
+				ToolCallID: call.ID,
+				ToolName:   call.Name,
+				IsError:    result.IsError,
+			})
+			a.store.AddToolResultMessage(a.convID, call.ID, call.Name, result.Content, result.IsError)
+		}
+	}
+
+	return messages, "", fmt.Errorf("stopped after %d tool rounds without a final answer", maxToolIterations)
+}
+
+// runTool analyzes and confirms a single tool call, then executes it.
+// Refusals and failures are returned as error results so the model can react.
+func (a *toolAgent) runTool(call ai.ToolCall) *types.MCPToolResult {
+	fmt.Printf("\n%s %s\n", ui.Bold("🔧 Tool:"), ui.Cyan(describeToolCall(call)))
+
+	if call.Arguments == nil {
+		fmt.Println(ui.Error("✗ Invalid tool arguments"))
+		return &types.MCPToolResult{Content: "Invalid tool arguments: " + call.RawArguments, IsError: true}
+	}
+
+	// Tools that cannot be analyzed are always confirmed
+	verdict := safety.Verdict{Decision: safety.DecisionConfirm}
+	var risk types.RiskLevel
+	var analysis *types.CommandAnalysis
+	command, workdir, analyzable := toolShellEquivalent(call)
+	if analyzable {
+		analysis, _ = analyzeCommandIn(a.cfg, command, workdir)
+		if call.Name == "read_file" {
+			// cat is safe, but the contents go to the model
+			path, _ := call.Arguments["path"].(string)
+			newAnalyzer(a.cfg).CheckSensitiveRead(analysis, path)
+		}
+		risk = analysis.RiskLevel
+		fmt.Printf("%s %s\n", analysis.RiskLevel.Emoji(), analysis.RiskLevel.String())
+		for _, reason := range analysis.RiskReasons {
+			fmt.Printf("   %s\n", ui.Dim(reason))
+		}
+		if analysis.FileCount > 0 {
+			fmt.Printf("   %s\n", ui.Dim(fmt.Sprintf("📊 %s", ui.FormatFileScope(analysis))))
+		}
+		ui.PrintTargets(analysis.Targets)
+		ui.PrintGitLoss(analysis.GitLoss)
+		verdict = decide(a.cfg, analysis, false)
+	} else {
+		fmt.Printf("%s %s\n", ui.Dim("⚪"), ui.Dim("External tool - cannot be analyzed"))
+	}
+
+	// Tool calls that change files are snapshotted and recorded for 'sosomi undo'
+	changes := call.Name == "execute_command" || call.Name == "write_file"
+	var ask gitSafetyAsker
+
+	switch verdict.Decision {
+	case safety.DecisionBlock:
+		fmt.Println(ui.Error("⛔ Tool call blocked: " + verdict.Reason))
+		return &types.MCPToolResult{Content: "Blocked by safety policy: " + verdict.Reason, IsError: true}
+	case safety.DecisionDryRunOnly:
+		fmt.Println(ui.Warning("🔍 Not run: ") + verdict.Reason)
+		return &types.MCPToolResult{Content: "Not run, the safety policy only allows a dry run: " + verdict.Reason, IsError: true}
+	case safety.DecisionAllow:
+		fmt.Println(ui.Dim(fmt.Sprintf("[auto-executing - %s]", risk)))
+	default:
+		answer, err := a.line.Prompt("[y] run  [n] skip > ")
+		answer = strings.TrimSpace(strings.ToLower(answer))
+		confirmed := err == nil && (answer == "y" || answer == "yes")
+		if confirmed && verdict.Decision == safety.DecisionTypedConfirm {
+			confirmed = typedConfirmLine(a.line, risk)
+		}
+		if !confirmed {
+			fmt.Println(ui.Dim("Skipped"))
+			return &types.MCPToolResult{Content: "The user declined to run this tool call", IsError: true}
+		}
+		ask = lineGitSafetyAsker(a.line)
+	}
+
+	var snap *types.Backup
+	if changes && analyzable {
+		snap = snapshotBeforeExecIn(command, workdir, analysis, ask)
+	}
+
+	var result *types.MCPToolResult
+	var err error
+	start := time.Now()
+	if mcp.IsBuiltinTool(call.Name) {
+		// Already analyzed and confirmed above
+		result, err = mcp.ExecuteBuiltinTool(call.Name, call.Arguments)
+	} else {
+		// Ctrl+C cancels the call on the server instead of killing sosomi
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		ctx, cancel := context.WithTimeout(ctx, time.Duration(a.cfg.Model.TimeoutSeconds)*time.Second)
+		result, err = a.manager.CallTool(ctx, call.Name, call.Arguments)
+		cancel()
+		stop()
+	}
+	if err != nil {
+		result = &types.MCPToolResult{Content: err.Error(), IsError: true}
+	}
+	if changes && analyzable {
+		a.record(call.Name, command, workdir, risk, result, time.Since(start).Milliseconds(), snap)
+	}
+
+	if output := truncateOutput(strings.TrimRight(result.Content, "\n"), maxToolOutputLines); output != "" {
+		fmt.Println(ui.Dim("─── Output ───"))
+		fmt.Println(output)
+		fmt.Println(ui.Dim("──────────────"))
+	}
+	if result.IsError {
+		fmt.Println(ui.Error("✗ Tool failed"))
+	} else {
+		fmt.Println(ui.Success("✓"))
+	}
+	return result
+}
+
+// record adds an executed tool call to the history and links the snapshot
+// taken before it ran. Built-in tools report no exit code, so failed calls
+// are recorded with exit code 1.
+func (a *toolAgent) record(tool, command, workdir string, risk types.RiskLevel, result *types.MCPToolResult, durationMs int64, snap *types.Backup) {
+	if historyStore == nil {
+		return
+	}
+	if workdir == "" {
+		workdir, _ = os.Getwd()
+	}
+	entry := &types.HistoryEntry{
+		Prompt:       "[agent] " + tool,
+		GeneratedCmd: command,
+		RiskLevel:    risk,
+		Executed:     true,
+		DurationMs:   durationMs,
+		WorkingDir:   workdir,
+		Provider:     a.cfg.Provider.Name,
+		Model:        a.cfg.Model.Name,
+	}
+	if result.IsError {
+		entry.ExitCode = 1
+	}
+	if err := historyStore.AddCommand(entry); err != nil {
+		ui.PrintWarning(fmt.Sprintf("Could not record command in history: %v", err))
+		return
+	}
+	recordBackup(entry.ID, snap)
+}
+
+// toolShellEquivalent returns a shell command with the same effect as a
+// built-in tool call, so it can go through the safety analyzer.
+// ok is false for tools provided by MCP servers.
+func toolShellEquivalent(call ai.ToolCall) (command, workdir string, ok bool) {
+	path, _ := call.Arguments["path"].(string)
+
+	switch call.Name {
+	case "execute_command":
+		command, _ = call.Arguments["command"].(string)
+		workdir, _ = call.Arguments["workdir"].(string)
+		return command, workdir, true
+	case "read_file":
+		return "cat " + shellQuote(path), "", true
+	case "write_file":
+		return "cat > " + shellQuote(path), "", true
+	case "list_directory":
+		if path == "" {
+			path = "."
+		}
+		return "ls " + shellQuote(path), "", true
+	}
+	return "", "", false
+}
+
+// describeToolCall renders a tool call for display
+func describeToolCall(call ai.ToolCall) string {
+	switch call.Name {
+	case "execute_command":
+		if command, ok := call.Arguments["command"].(string); ok {
+			return command
+		}
+	case "write_file":
+		path, _ := call.Arguments["path"].(string)
+		content, _ := call.Arguments["content"].(string)
+		return fmt.Sprintf("write_file %s (%s)", path, ui.FormatSize(int64(len(content))))
+	}
+
+	args := call.RawArguments
+	if args == "" {
+		data, _ := json.Marshal(call.Arguments)
+		args = string(data)
+	}
+	return fmt.Sprintf("%s %s", call.Name, truncate(args, 200))
+}
+
+// shellQuote quotes s as a single shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// toStoredToolCalls converts tool calls for the conversation store
+func toStoredToolCalls(calls []ai.ToolCall) []types.MCPToolCall {
+	stored := make([]types.MCPToolCall, len(calls))
+	for i, call := range calls {
+		stored[i] = types.MCPToolCall{ID: call.ID, Name: call.Name, Arguments: call.Arguments}
+	}
+	return stored
+}
+
+// toMessages converts stored conversation messages for the provider. Without
+// tools, tool results and tool-only assistant turns are dropped since the
+// provider is not given the tool definitions they refer to.
+func toMessages(stored []*types.ConversationMessage, withTools bool) []ai.Message {
+	messages, summary, body, _ := conversationContext(stored, withTools)
+	if summary != "" {
+		messages = append(messages, ai.SummaryMessage(summary))
+	}
+	return append(messages, body...)
+}
+
+// conversationContext splits stored messages into the system prompt, the
+// latest summary and the messages it does not replace. rows holds the
+// index in stored of each message of body.
+func conversationContext(stored []*types.ConversationMessage, withTools bool) (system []ai.Message, summary string, body []ai.Message, rows []int) {
+	from := 0
+	for _, msg := range stored {
+		if msg.Role == "summary" {
+			summary, from = msg.Content, msg.SummaryOf
+		}
+	}
+
+	for i, msg := range stored {
+		switch {
+		case msg.Role == "system":
+			system = append(system, ai.Message{Role: "system", Content: msg.Content})
+			continue
+		case msg.Role == "summary" || i < from:
+			continue
+		}
+
+		if !withTools {
+			if msg.Role == "tool" || (len(msg.ToolCalls) > 0 && msg.Content == "") {
+				continue
+			}
+			body = append(body, ai.Message{Role: msg.Role, Content: msg.Content})
+			rows = append(rows, i)
+			continue
+		}
+
+		m := ai.Message{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			ToolCallID: msg.ToolCallID,
+			ToolName:   msg.ToolName,
+			IsError:    msg.ToolError,
+		}
+		for _, call := range msg.ToolCalls {
+			m.ToolCalls = append(m.ToolCalls, ai.ToolCall{ID: call.ID, Name: call.Name, Arguments: call.Arguments})
+		}
+		body = append(body, m)
+		rows = append(rows, i)
+	}
+	return system, summary, body, rows
+}
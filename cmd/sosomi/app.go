@@ -8,6 +8,7 @@ import (
 	"github.com/sonemaro/sosomi/internal/ai"
 	"github.com/sonemaro/sosomi/internal/config"
 	"github.com/sonemaro/sosomi/internal/history"
+	"github.com/sonemaro/sosomi/internal/usage"
 )
 
 var (
@@ -22,9 +23,11 @@ var (
 	explainOnly bool
 	silent      bool
 	profileName string
+	candidates  int
 
 	// Global instances
 	historyStore *history.Store
+	usageLedger  *usage.Ledger
 )
 
 // initializeApp sets up the application configuration and stores
@@ -58,15 +61,29 @@ func initializeApp() error {
 		}
 	}
 
+	// Initialize usage ledger
+	if cfg.Usage.DBPath != "" {
+		var err error
+		usageLedger, err = usage.NewLedger(cfg.Usage.DBPath)
+		if err != nil {
+			// Non-fatal, continue without usage accounting
+			fmt.Fprintf(os.Stderr, "Warning: Could not initialize usage ledger: %v\n", err)
+		}
+	}
+
 	return nil
 }
 
 // getAIProvider creates a new AI provider from the current configuration.
-// This centralizes AI provider creation and error handling.
+// This centralizes AI provider creation and error handling. Requests are
+// recorded in the usage ledger and checked against the budget.
 func getAIProvider() (ai.Provider, error) {
 	provider, err := ai.NewProviderFromConfig()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create AI provider: %w", err)
 	}
+	if usageLedger != nil {
+		provider = ai.NewMeteredProvider(provider, newUsageMeter(config.Get(), usageLedger))
+	}
 	return provider, nil
 }
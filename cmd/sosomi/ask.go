@@ -58,6 +58,7 @@ General-purpose LLM chat client (not shell-focused)
 Flags:
   -s, --system      Set system prompt
   -c, --continue    Continue existing conversation (by ID or name)
+  --tools           Let the model call tools; each call is safety-analyzed and confirmed
 
 LLM Subcommands:
   sosomi llm list          List all conversations
@@ -73,6 +74,7 @@ In-conversation commands:
   /history   Show conversation history
   /system    View/edit system prompt
   /tokens    Show token usage
+  /compact   Summarize older messages to free up context
   /clear     Clear screen
   /quit      Exit
 
@@ -85,6 +87,25 @@ In-conversation commands:
   sosomi history stats         Show history statistics
   sosomi history search <q>    Search history
 
+#### sosomi undo
+  sosomi undo                  Restore files from the latest pre-execution snapshot
+  sosomi undo <history-id>     Restore the snapshot taken for a specific command
+                               (and uncommitted git work kept under refs/sosomi/)
+  sosomi undo --list           List available snapshots
+
+#### sosomi rules
+  sosomi rules test "<cmd>"    Show which built-in and custom safety rules fire
+  sosomi rules tools           List tool analyzers (git, kubectl, terraform, ...) and check their corpora
+
+#### sosomi mcp
+  sosomi mcp list              List configured MCP servers (mcp.servers; local command or remote url)
+  sosomi mcp tools [server]    Start servers and list their tools (named server.tool)
+  sosomi mcp call <server.tool> '<json>'  Call a server tool directly
+  sosomi mcp logs <server>     Show server stderr and restart events
+  sosomi mcp resources [server]  List server resources; 'sosomi mcp read <server> <uri>' reads one
+  sosomi mcp prompts [server]  List server prompts; 'sosomi mcp prompt <server.prompt> k=v' renders one
+  sosomi mcp serve             Run sosomi as an MCP server (generate/analyze/execute_command, history_search)
+
 #### sosomi models
   sosomi models                List available models for current provider
 
@@ -106,6 +127,8 @@ This command - get AI help about sosomi usage
 
 ## PROVIDERS
 - openai: OpenAI API (GPT-4, GPT-3.5, etc.)
+- anthropic: Anthropic Messages API (Claude)
+- azure: Azure OpenAI (provider.deployment, provider.api_version, provider.auth_type api_key|entra)
 - ollama: Local Ollama server
 - lmstudio: LM Studio local server
 - llamacpp: llama.cpp server
@@ -115,6 +138,8 @@ This command - get AI help about sosomi usage
 Config file: ~/.config/sosomi/config.yaml
 Environment variables:
   OPENAI_API_KEY or SOSOMI_API_KEY: API key
+  ANTHROPIC_API_KEY: API key for the anthropic provider
+  AZURE_OPENAI_API_KEY: API key for the azure provider
   SOSOMI_PROVIDER: Default provider
   SOSOMI_MODEL: Default model
 
@@ -131,14 +156,40 @@ sosomi -p ollama "your prompt"
 sosomi config set provider ollama
 sosomi config set model llama3.2
 
+### Retries and fallback providers
+sosomi config set model.max_retries 3               # retries on 429, 5xx, refused connections
+sosomi config set provider.fallbacks openai:gpt-4o-mini,anthropic   # tried in order when the provider fails
+
+### Tuning model parameters
+sosomi config set model.max_tokens 512
+sosomi config set model.repeat_penalty 1.1          # Ollama only
+sosomi config set model.modes.command.temperature 0 # modes: command, chat, title, summary
+sosomi config set model.context_windows.qwen2.5-coder 32768  # when the server does not report it
+sosomi config set model.context_strategy trim       # drop old messages instead of summarizing
+sosomi config set model.auto_compact 0.8            # compact once 80% of the window is used
+
+### Usage and budgets
+sosomi usage                                        # tokens and cost by day
+sosomi usage --by model --days 7                    # by day, model, profile or mode
+sosomi config set usage.budget.daily_hard 2         # refuse requests after $2 a day
+sosomi config set usage.pricing.gpt-4o 2.5,10       # USD per million input,output tokens
+
 ### Conversation management
 sosomi llm                    # New conversation
 sosomi llm "Topic Name"       # New with name
 sosomi llm -c "Topic Name"    # Continue by name
 sosomi llm pick               # Interactive picker
+sosomi llm --tools            # Agent mode: model runs confirmed tool calls
 
 ### Safety features
 sosomi "command" --dry-run    # Preview without executing
+sosomi config set safety.level normal            # What runs, asks or is only simulated
+sosomi config set safety.confirm_threshold caution  # Always ask at or above a risk
+sosomi config set safety.production_action confirm  # Type the risk level for prod* kube contexts, profiles, hosts
+sosomi config set safety.git_safety_net ref         # Keep uncommitted work before git reset --hard, git clean, ...
+Levels: strict, cautious, moderate (default), normal, relaxed, permissive, dangerous.
+Critical commands are always blocked. Some levels ask to type the risk level
+(e.g. "dangerous") to run, or only dry-run risky commands.
 
 ---
 
@@ -168,6 +219,9 @@ func runAskCommand(question string) error {
 		fmt.Println("  sosomi llm pick     Interactive conversation picker")
 		fmt.Println("  sosomi config       Manage configuration")
 		fmt.Println("  sosomi history      View command history")
+		fmt.Println("  sosomi undo         Restore files changed by a command")
+		fmt.Println("  sosomi rules        Test safety rules against a command")
+		fmt.Println("  sosomi mcp          Manage and debug MCP servers")
 		fmt.Println("  sosomi models       List available models")
 		fmt.Println("  sosomi profile      Manage profiles")
 		fmt.Println("  sosomi init         Setup wizard")
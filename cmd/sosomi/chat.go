@@ -329,6 +329,7 @@ func runChat(sessName, continueID string) error {
 	}
 
 	fmt.Printf("🤖 Model: %s (%s)\n", cfg.Model.Name, cfg.Provider.Name)
+
 	fmt.Println("Type /help for commands, /quit to exit")
 	fmt.Println()
 
@@ -356,10 +357,35 @@ func runChat(sessName, continueID string) error {
 
 	isFirstExchange := sess.MessageCount == 0
 
+	// Usage billed for the last reply, to count what the next prompt adds
+	var lastUsage ai.TokenUsage
+	for _, msg := range storedMsgs {
+		if msg.PromptTokens > 0 {
+			lastUsage = ai.TokenUsage{PromptTokens: msg.PromptTokens, CompletionTokens: msg.CompletionTokens}
+		}
+	}
+
 	// Build system prompt with shell context
 	sysContext := shell.GetSystemContext()
 	systemPrompt := buildChatSystemPrompt(sysContext)
 	contextMsgs = append([]ai.Message{{Role: "system", Content: systemPrompt}}, contextMsgs...)
+	fitter := newContextFitter(cfg, aiProvider, 0)
+
+	// compact replaces all but the latest exchanges with a stored summary
+	compact := func(auto bool) {
+		stored, err := sessStore.GetMessages(sess.ID)
+		if err != nil {
+			ui.PrintError(err.Error())
+			return
+		}
+		summary, body, rows := sessionContext(stored, cfg.Chat.OutputMaxLines)
+		var n int
+		contextMsgs, n, err = fitter.compact(contextMsgs, summary, body, rows, func(summary string, summaryOf int) error {
+			_, err := sessStore.AddSummary(sess.ID, summary, summaryOf)
+			return err
+		})
+		reportCompaction(n, err, auto)
+	}
 
 	for {
 		// Show current directory in prompt
@@ -411,6 +437,9 @@ func runChat(sessName, continueID string) error {
 		case input == "/clear":
 			fmt.Print("\033[2J\033[H")
 			continue
+		case input == "/compact":
+			compact(false)
+			continue
 		case input == "/pick":
 			// Switch to another session
 			sessions, _ := sessStore.ListSessions(100, 0)
@@ -479,14 +508,19 @@ func runChat(sessName, continueID string) error {
 			continue
 		}
 
+		if fitter.shouldCompact(contextMsgs) {
+			compact(true)
+		}
+
 		// Add user message to context
 		contextMsgs = append(contextMsgs, ai.Message{Role: "user", Content: input})
 
 		// Generate command with AI (streaming)
+		request := fitter.fit(contextMsgs)
 		fmt.Print("🔮 ")
 		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Model.TimeoutSeconds)*time.Second)
 
-		stream, err := aiProvider.ChatStream(ctx, contextMsgs)
+		stream, err := aiProvider.ChatStream(ctx, request)
 		if err != nil {
 			cancel()
 			ui.PrintError(err.Error())
@@ -524,12 +558,15 @@ func runChat(sessName, continueID string) error {
 		assistantContent := response.String()
 		contextMsgs = append(contextMsgs, ai.Message{Role: "assistant", Content: assistantContent})
 
-		// Calculate token counts
-		userTokens := 0
-		assistantTokens := 0
+		// Calculate token counts from the usage billed for the reply
+		var usage ai.TokenUsage
 		if tokenUsage != nil {
-			assistantTokens = tokenUsage.CompletionTokens
-			userTokens = tokenUsage.PromptTokens / max(1, len(contextMsgs)-1)
+			usage = *tokenUsage
+		}
+		userTokens := promptGrowth(usage, lastUsage)
+		assistantTokens := usage.CompletionTokens
+		if tokenUsage != nil {
+			lastUsage = usage
 		}
 
 		// Try to extract command from response
@@ -537,7 +574,7 @@ func runChat(sessName, continueID string) error {
 		if command == "" {
 			// No command found - just a conversational response
 			sessStore.AddMessage(sess.ID, "user", input, userTokens)
-			sessStore.AddMessage(sess.ID, "assistant", assistantContent, assistantTokens)
+			sessStore.AddReply(sess.ID, assistantContent, usage)
 
 			// Generate title after first exchange
 			if isFirstExchange && cfg.Chat.GenerateTitles && sess.Name == "New Session" {
@@ -549,8 +586,7 @@ func runChat(sessName, continueID string) error {
 		}
 
 		// Analyze command safety
-		analyzer := safety.NewAnalyzer(cfg.Safety.BlockedCommands, cfg.Safety.AllowedPaths)
-		analysis, _ := analyzer.Analyze(command)
+		analysis, _ := analyzeCommand(cfg, command)
 
 		// Display command and risk
 		fmt.Printf("\n%s %s\n", ui.Bold("Command:"), ui.Cyan(command))
@@ -561,53 +597,26 @@ func runChat(sessName, continueID string) error {
 				fmt.Printf("   %s\n", ui.Dim(reason))
 			}
 		}
-
-		// Check if blocked
-		if analysis.RiskLevel == types.RiskCritical {
-			fmt.Println(ui.Error("⛔ Command blocked due to critical risk"))
-			sessStore.AddExecutionMessage(sess.ID, input, command, "", 0, analysis.RiskLevel, 0, false, userTokens+assistantTokens)
-			continue
+		if analysis.FileCount > 0 {
+			fmt.Printf("   %s\n", ui.Dim(fmt.Sprintf("📊 %s", ui.FormatFileScope(analysis))))
 		}
+		ui.PrintTargets(analysis.Targets)
+		ui.PrintGitLoss(analysis.GitLoss)
 
-		// Auto-execute safe commands based on session setting or global config
-		autoExec := (sess.AutoExecute || cfg.Safety.AutoExecuteSafe) && analysis.RiskLevel == types.RiskSafe
-
-		var confirmed bool
-		if autoExec {
-			fmt.Println(ui.Dim("[auto-executing - SAFE]"))
-			confirmed = true
-		} else {
-			// Prompt for confirmation using liner
-			confirmInput, err := line.Prompt("[y] run  [n] cancel  [e] edit > ")
-			if err != nil {
-				fmt.Println(ui.Dim("Canceled"))
-				sessStore.AddExecutionMessage(sess.ID, input, command, "", 0, analysis.RiskLevel, 0, false, userTokens+assistantTokens)
-				continue
-			}
-			confirmInput = strings.TrimSpace(strings.ToLower(confirmInput))
-
-			switch confirmInput {
-			case "y", "yes":
-				confirmed = true
-			case "e", "edit":
-				newCmd, err := line.Prompt("  Enter modified command: ")
-				if err != nil {
-					continue
-				}
-				newCmd = strings.TrimSpace(newCmd)
-				if newCmd != "" {
-					command = newCmd
-					analysis, _ = analyzer.Analyze(command)
-					confirmed = true
-				}
-			default:
-				fmt.Println(ui.Dim("Canceled"))
-				sessStore.AddExecutionMessage(sess.ID, input, command, "", 0, analysis.RiskLevel, 0, false, userTokens+assistantTokens)
-				continue
-			}
+		// Apply the safety policy, confirming when it asks to
+		command, analysis, confirmed := confirmChatCommand(line, cfg, command, analysis, sess.AutoExecute)
+		if !confirmed {
+			sessStore.AddExecutionMessage(sess.ID, input, command, "", 0, analysis.RiskLevel, 0, false, userTokens+assistantTokens, usage)
 		}
 
 		if confirmed {
+			// Snapshot affected files and uncommitted git work so the command can be undone
+			var ask gitSafetyAsker
+			if !sess.AutoExecute {
+				ask = lineGitSafetyAsker(line)
+			}
+			snap := snapshotBeforeExec(command, analysis, ask)
+
 			// Execute command
 			start := time.Now()
 			result, execErr := shell.Execute(command, false)
@@ -650,12 +659,12 @@ func runChat(sessName, continueID string) error {
 			}
 
 			// Save execution to session
-			sessStore.AddExecutionMessage(sess.ID, input, command, output, exitCode, analysis.RiskLevel, duration, true, userTokens+assistantTokens)
+			sessStore.AddExecutionMessage(sess.ID, input, command, output, exitCode, analysis.RiskLevel, duration, true, userTokens+assistantTokens, usage)
 
 			// Add execution result to context for AI to see
 			execContext := fmt.Sprintf("[Command executed: %s]\n[Exit code: %d]\n[Output: %s]",
 				command, exitCode, truncateOutput(output, 20))
-			contextMsgs = append(contextMsgs, ai.Message{Role: "user", Content: execContext})
+			contextMsgs = append(contextMsgs, ai.Message{Role: "user", Content: execContext, Execution: true})
 
 			// Update cwd in session if it might have changed
 			if strings.HasPrefix(command, "cd ") {
@@ -673,10 +682,16 @@ func runChat(sessName, continueID string) error {
 					ExitCode:     exitCode,
 					DurationMs:   duration,
 					WorkingDir:   cwd,
-					Provider:     cfg.Provider.Name,
-					Model:        cfg.Model.Name,
+					Provider:     aiProvider.Name(),
+					Model:        aiProvider.Model(),
+
+					PromptTokens:     usage.PromptTokens,
+					CompletionTokens: usage.CompletionTokens,
+					TotalTokens:      usage.TotalTokens,
+				}
+				if err := historyStore.AddCommand(entry); err == nil {
+					recordBackup(entry.ID, snap)
 				}
-				historyStore.AddCommand(entry)
 			}
 		}
 
@@ -690,6 +705,77 @@ func runChat(sessName, continueID string) error {
 	}
 }
 
+// confirmChatCommand applies the safety policy to a command suggested in a
+// chat session, asking to confirm it when the policy requires. Edited
+// commands are analyzed and decided again. It returns the final command and
+// its analysis, and whether to run it.
+func confirmChatCommand(line *liner.State, cfg *config.Config, command string, analysis *types.CommandAnalysis, auto bool) (string, *types.CommandAnalysis, bool) {
+	for {
+		verdict := decide(cfg, analysis, auto)
+		switch verdict.Decision {
+		case safety.DecisionBlock:
+			fmt.Println(ui.Error("⛔ Command blocked: " + verdict.Reason))
+			return command, analysis, false
+		case safety.DecisionDryRunOnly:
+			fmt.Printf("%s %s\n", ui.Warning("🔍 Dry run only:"), verdict.Reason)
+			executeDryRun(command, analysis)
+			return command, analysis, false
+		case safety.DecisionAllow:
+			fmt.Println(ui.Dim(fmt.Sprintf("[auto-executing - %s]", analysis.RiskLevel)))
+			return command, analysis, true
+		}
+
+		confirmInput, err := line.Prompt("[y] run  [n] cancel  [e] edit > ")
+		if err != nil {
+			fmt.Println(ui.Dim("Canceled"))
+			return command, analysis, false
+		}
+
+		switch strings.TrimSpace(strings.ToLower(confirmInput)) {
+		case "y", "yes":
+			if verdict.Decision == safety.DecisionTypedConfirm && !typedConfirmLine(line, analysis.RiskLevel) {
+				fmt.Println(ui.Dim("Canceled"))
+				return command, analysis, false
+			}
+			return command, analysis, true
+		case "e", "edit":
+			newCmd, err := line.Prompt("  Enter modified command: ")
+			if err != nil {
+				fmt.Println(ui.Dim("Canceled"))
+				return command, analysis, false
+			}
+			if newCmd = strings.TrimSpace(newCmd); newCmd != "" {
+				command = newCmd
+				analysis, _ = analyzeCommand(cfg, command)
+				fmt.Printf("%s %s\n", analysis.RiskLevel.Emoji(), analysis.RiskLevel.String())
+				for _, reason := range analysis.RiskReasons {
+					fmt.Printf("   %s\n", ui.Dim(reason))
+				}
+			}
+		default:
+			fmt.Println(ui.Dim("Canceled"))
+			return command, analysis, false
+		}
+	}
+}
+
+// lineGitSafetyAsker asks on the line editor how to keep uncommitted git work
+func lineGitSafetyAsker(line *liner.State) gitSafetyAsker {
+	return func(loss *types.GitLoss) string {
+		// An interrupted prompt keeps the default safety ref
+		input, _ := line.Prompt("🛟 Keep these changes first? [r] Safety ref  [s] Stash  [n] No (r): ")
+		return gitSafetyChoice(input)
+	}
+}
+
+// typedConfirmLine asks to type the risk level of a command before running
+// it, for commands the safety level does not run on a single keypress
+func typedConfirmLine(line *liner.State, risk types.RiskLevel) bool {
+	level := strings.ToLower(risk.String())
+	typed, err := line.Prompt(fmt.Sprintf("%s type %s to run > ", risk.Emoji(), level))
+	return err == nil && strings.TrimSpace(strings.ToLower(typed)) == level
+}
+
 func buildChatSystemPrompt(sysCtx types.SystemContext) string {
 	return fmt.Sprintf(`You are an expert shell assistant running on %s with %s shell.
 Current directory: %s
@@ -722,24 +808,47 @@ Be concise. Focus on practical, working commands.`,
 }
 
 func buildChatContext(msgs []*types.SessionMessage, maxOutputLines int) []ai.Message {
-	var context []ai.Message
+	summary, context, _ := sessionContext(msgs, maxOutputLines)
+	if summary != "" {
+		context = append([]ai.Message{ai.SummaryMessage(summary)}, context...)
+	}
+	return context
+}
+
+// sessionContext returns the latest summary of a session and the messages
+// it does not replace. rows holds the index in msgs of each message of
+// context.
+func sessionContext(msgs []*types.SessionMessage, maxOutputLines int) (summary string, context []ai.Message, rows []int) {
+	from := 0
 	for _, msg := range msgs {
+		if msg.Role == "summary" {
+			summary, from = msg.Content, msg.SummaryOf
+		}
+	}
+
+	for i, msg := range msgs {
+		if msg.Role == "summary" || i < from {
+			continue
+		}
 		if msg.Role == "execution" {
-			// Format execution as user message showing what happened
+			// Format execution as the request and a user message showing
+			// what happened
+			context = append(context, ai.Message{Role: "user", Content: msg.Content})
+			rows = append(rows, i)
 			if msg.Executed {
 				execMsg := fmt.Sprintf("I ran: %s\nExit code: %d", msg.Command, msg.ExitCode)
 				if msg.Output != "" {
 					execMsg += fmt.Sprintf("\nOutput:\n%s", truncateOutput(msg.Output, maxOutputLines))
 				}
-				context = append(context, ai.Message{Role: "user", Content: execMsg})
-			} else {
-				context = append(context, ai.Message{Role: "user", Content: msg.Content})
+				context = append(context, ai.Message{Role: "user", Content: execMsg, Execution: true})
+				rows = append(rows, i)
 			}
 		} else {
 			context = append(context, ai.Message{Role: msg.Role, Content: msg.Content})
+			rows = append(rows, i)
 		}
 	}
-	return context
+	return summary, context, rows
 }
 
 func extractCommand(response string) string {
@@ -809,6 +918,8 @@ func printSessionHistory(msgs []*types.SessionMessage, limit int) {
 			} else {
 				fmt.Printf("%s %s %s\n", ui.Dim("⏸"), msg.Command, ui.Dim("(canceled)"))
 			}
+		case "summary":
+			fmt.Printf("%s %s\n", ui.Dim("📎 summary>"), ui.Dim(msg.Content))
 		}
 	}
 	fmt.Println()
@@ -844,7 +955,7 @@ Command: %s`, truncate(userMsg, 100), truncate(command, 100))
 		{Role: "user", Content: prompt},
 	}
 
-	response, err := provider.Chat(ctx, messages)
+	response, err := provider.Chat(ai.WithMode(ctx, ai.ModeTitle), messages)
 	if err != nil {
 		return
 	}
@@ -871,6 +982,7 @@ func printChatHelp() {
   /auto off      Disable auto-execute
   /pick          Switch to another session
   /new           Start a new session
+  /compact       Summarize older messages to free up context
   /clear         Clear screen
   /quit, /q      Exit
 
@@ -4,9 +4,11 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 
+	"github.com/sonemaro/sosomi/internal/ai"
 	"github.com/sonemaro/sosomi/internal/config"
 )
 
@@ -25,6 +27,28 @@ func configCmd() *cobra.Command {
 			fmt.Printf("Provider: %s\n", cfg.Provider.Name)
 			fmt.Printf("Model: %s\n", cfg.Model.Name)
 			fmt.Printf("Endpoint: %s\n", config.GetEndpoint())
+			if cfg.Provider.Name == "azure" {
+				deployment, apiVersion := cfg.Provider.Deployment, cfg.Provider.APIVersion
+				if deployment == "" {
+					deployment = cfg.Model.Name
+				}
+				if apiVersion == "" {
+					apiVersion = ai.DefaultAzureAPIVersion
+				}
+				fmt.Printf("Deployment: %s\n", deployment)
+				fmt.Printf("API Version: %s\n", apiVersion)
+			}
+			if len(cfg.Provider.Fallbacks) > 0 {
+				chain := make([]string, len(cfg.Provider.Fallbacks))
+				for i, fallback := range cfg.Provider.Fallbacks {
+					chain[i] = fallback.Name
+					if fallback.Model != "" {
+						chain[i] += ":" + fallback.Model
+					}
+				}
+				fmt.Printf("Fallbacks: %s\n", strings.Join(chain, " → "))
+			}
+			fmt.Printf("Max Retries: %d\n", cfg.Model.MaxRetries)
 			fmt.Printf("Safety Level: %s\n", cfg.Safety.Level)
 			fmt.Printf("Auto Execute Safe: %v\n", cfg.Safety.AutoExecuteSafe)
 			fmt.Printf("History Enabled: %v\n", cfg.History.Enabled)
@@ -0,0 +1,152 @@
+// Context window management for chat sessions
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sonemaro/sosomi/internal/ai"
+	"github.com/sonemaro/sosomi/internal/config"
+	"github.com/sonemaro/sosomi/internal/tokenizer"
+	"github.com/sonemaro/sosomi/internal/types"
+	"github.com/sonemaro/sosomi/internal/ui"
+)
+
+// windowLookupTimeout bounds the request asking the server for the window
+const windowLookupTimeout = 5 * time.Second
+
+// compactKeep is how many of the latest exchanges compaction leaves as they are
+const compactKeep = 2
+
+// contextFitter keeps the messages of a session within the model's context
+// window and tells the user when earlier messages stop being sent
+type contextFitter struct {
+	manager     *ai.ContextManager
+	provider    ai.Provider
+	window      int
+	autoCompact float64       // share of the window above which to compact
+	timeout     time.Duration // for summarizing
+	left        int           // messages left out by the last fit
+}
+
+// newContextFitter sizes the context for the configured model. reserved is
+// the number of tokens taken by something other than messages, such as
+// tool definitions.
+func newContextFitter(cfg *config.Config, provider ai.Provider, reserved int) *contextFitter {
+	if dir, err := os.UserCacheDir(); err == nil {
+		tokenizer.SetCacheDir(filepath.Join(dir, "sosomi", "tokenizer"))
+	}
+	tokenizer.SetDownload(cfg.Model.TokenizerDownload)
+
+	window := tokenizer.ResolveWindow(cfg.Model.Name, cfg.Model.ContextWindows, func() int {
+		ctx, cancel := context.WithTimeout(context.Background(), windowLookupTimeout)
+		defer cancel()
+		return ai.ContextWindowOf(ctx, provider)
+	})
+
+	// Leave room for the reply, and a margin for counts that are estimates
+	reply := ai.ModeOptionsFromConfig(cfg.Model)[ai.ModeChat].MaxTokens
+	limit := window - reply - reserved - window/20
+	if limit < window/4 {
+		limit = window / 4
+	}
+
+	summarizer := provider
+	if cfg.Model.ContextStrategy == "trim" {
+		summarizer = nil
+	}
+	return &contextFitter{
+		manager:     ai.NewContextManager(summarizer, tokenizer.ForModel(cfg.Model.Name), limit),
+		provider:    provider,
+		window:      window,
+		autoCompact: cfg.Model.AutoCompact,
+		timeout:     time.Duration(cfg.Model.TimeoutSeconds) * time.Second,
+	}
+}
+
+// toolsTokens estimates the tokens taken by the definitions of tools
+func toolsTokens(cfg *config.Config, tools []types.MCPTool) int {
+	if len(tools) == 0 {
+		return 0
+	}
+	data, _ := json.Marshal(tools)
+	return tokenizer.ForModel(cfg.Model.Name).Count(string(data))
+}
+
+// fit returns the messages to send for the next request. Summarizing gets
+// its own timeout so that it does not eat into the request's.
+func (f *contextFitter) fit(messages []ai.Message) []ai.Message {
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+
+	fitted, left := f.manager.Fit(ctx, messages)
+	if left > f.left {
+		verb := "left out"
+		if f.manager.Summary() != "" {
+			verb = "summarized"
+		}
+		fmt.Println(ui.Dim(fmt.Sprintf("📎 %d earlier messages %s to fit the context window", left, verb)))
+	}
+	f.left = left
+	return fitted
+}
+
+// shouldCompact reports whether messages take more of the context window
+// than model.auto_compact allows
+func (f *contextFitter) shouldCompact(messages []ai.Message) bool {
+	return f.autoCompact > 0 && float64(f.manager.Count(messages)) > f.autoCompact*float64(f.window)
+}
+
+// compact summarizes the stored messages of body before the latest
+// exchanges, extending the previous summary, and saves the summary with
+// the number of stored messages it replaces; rows maps body to them. It
+// returns messages with the summary in place of the replaced ones, and how
+// many were replaced.
+func (f *contextFitter) compact(messages []ai.Message, previous string, body []ai.Message, rows []int, save func(summary string, summaryOf int) error) ([]ai.Message, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+
+	summary, n, err := ai.Compact(ctx, f.provider, previous, body, compactKeep)
+	if err != nil {
+		return messages, 0, err
+	}
+	if err := save(summary, rows[n]); err != nil {
+		return messages, 0, fmt.Errorf("failed to save summary: %w", err)
+	}
+	f.manager.Reset()
+	f.left = 0
+
+	var compacted []ai.Message
+	for _, msg := range messages {
+		if msg.Role != "system" {
+			break
+		}
+		if !msg.Summary {
+			compacted = append(compacted, msg)
+		}
+	}
+	compacted = append(compacted, ai.SummaryMessage(summary))
+	return append(compacted, body[n:]...), n, nil
+}
+
+// reportCompaction tells the user how compaction went. Automatic
+// compaction stays quiet when there is nothing to compact.
+func reportCompaction(n int, err error, auto bool) {
+	switch {
+	case errors.Is(err, ai.ErrNothingToCompact):
+		if !auto {
+			fmt.Println(ui.Dim("Nothing to compact yet"))
+		}
+	case err != nil:
+		ui.PrintError(err.Error())
+	case auto:
+		fmt.Println(ui.Dim(fmt.Sprintf("📎 Compacted %d earlier messages into a summary", n)))
+	default:
+		fmt.Println(ui.Success("✓"), fmt.Sprintf("Compacted %d messages into a summary, /history still shows them", n))
+	}
+}
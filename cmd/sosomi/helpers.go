@@ -7,20 +7,20 @@ import (
 	"os/exec"
 	"strings"
 	"time"
+
+	"github.com/sonemaro/sosomi/internal/ai"
 )
 
-// formatSize converts bytes to human-readable size string
-func formatSize(bytes int64) string {
-	const unit = 1024
-	if bytes < unit {
-		return fmt.Sprintf("%d B", bytes)
-	}
-	div, exp := int64(unit), 0
-	for n := bytes / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
+// promptGrowth returns the tokens the latest messages added to the prompt:
+// the prompt billed for a request less the prompt and completion billed for
+// the previous one. When there is no previous request, or the context was
+// rebuilt in between, the whole prompt is counted.
+func promptGrowth(usage, previous ai.TokenUsage) int {
+	growth := usage.PromptTokens - previous.PromptTokens - previous.CompletionTokens
+	if previous.PromptTokens == 0 || growth < 0 {
+		return usage.PromptTokens
 	}
-	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+	return growth
 }
 
 // truncate shortens a string to maxLen with ellipsis
@@ -53,6 +53,15 @@ func shortenPath(path string) string {
 	return path
 }
 
+// expandPath replaces a leading ~ with the home directory
+func expandPath(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, _ := os.UserHomeDir()
+		return home + path[1:]
+	}
+	return path
+}
+
 // formatDuration formats a duration to short human-readable string
 func formatDuration(d time.Duration) string {
 	if d < time.Minute {
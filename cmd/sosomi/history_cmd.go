@@ -31,8 +31,9 @@ func historyCmd() *cobra.Command {
 						status = "✗"
 					}
 				}
-				fmt.Printf("%s %s [%s] %s\n  └─ %s\n\n",
+				fmt.Printf("%s %s %s [%s] %s\n  └─ %s\n\n",
 					status,
+					shortID(entry.ID),
 					entry.Timestamp.Format("2006-01-02 15:04:05"),
 					entry.RiskLevel.String(),
 					entry.Prompt,
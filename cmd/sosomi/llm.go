@@ -16,7 +16,6 @@ import (
 	"github.com/sonemaro/sosomi/internal/ai"
 	"github.com/sonemaro/sosomi/internal/config"
 	"github.com/sonemaro/sosomi/internal/conversation"
-	"github.com/sonemaro/sosomi/internal/mcp"
 	"github.com/sonemaro/sosomi/internal/types"
 	"github.com/sonemaro/sosomi/internal/ui"
 )
@@ -25,6 +24,7 @@ import (
 func llmCmd() *cobra.Command {
 	var systemPrompt string
 	var continueConv string
+	var useTools bool
 
 	cmd := &cobra.Command{
 		Use:   "llm [conversation-name]",
@@ -37,6 +37,7 @@ Examples:
   sosomi llm "Python Help"             # Start with name
   sosomi llm -s "You are a poet"       # With system prompt
   sosomi llm -c abc123                 # Continue existing conversation
+  sosomi llm --tools                   # Let the model run tools (each call is confirmed)
   sosomi llm list                      # List conversations
   sosomi llm delete <id>               # Delete conversation`,
 		Args: cobra.MaximumNArgs(1),
@@ -45,12 +46,13 @@ Examples:
 			if len(args) > 0 {
 				convName = args[0]
 			}
-			return runLLM(convName, systemPrompt, continueConv)
+			return runLLM(convName, systemPrompt, continueConv, useTools)
 		},
 	}
 
 	cmd.Flags().StringVarP(&systemPrompt, "system", "s", "", "System prompt for the conversation")
 	cmd.Flags().StringVarP(&continueConv, "continue", "c", "", "Continue an existing conversation (ID or name)")
+	cmd.Flags().BoolVar(&useTools, "tools", false, "Let the model call tools (commands, files, MCP servers) after safety analysis and confirmation")
 
 	// Subcommands
 	cmd.AddCommand(llmListCmd())
@@ -291,10 +293,10 @@ Controls:
 			}
 
 			if isNew {
-				return runLLM("", "", "")
+				return runLLM("", "", "", false)
 			}
 
-			return runLLM("", "", selected.ID)
+			return runLLM("", "", selected.ID, false)
 		},
 	}
 
@@ -303,7 +305,7 @@ Controls:
 	return cmd
 }
 
-func runLLM(convName, systemPrompt, continueID string) error {
+func runLLM(convName, systemPrompt, continueID string, useTools bool) error {
 	cfg := config.Get()
 
 	// Ensure data directory exists
@@ -324,13 +326,18 @@ func runLLM(convName, systemPrompt, continueID string) error {
 		return err
 	}
 
-	// Initialize MCP manager if enabled
-	var mcpManager *mcp.Manager
+	if useTools && !provider.SupportsTools() {
+		return fmt.Errorf("provider %s does not support tool calling", provider.Name())
+	}
+
+	// Start configured MCP servers; the built-in tools need no server
+	mcpManager := newMCPManager(cfg)
+	defer mcpManager.Shutdown()
 	if cfg.MCP.Enabled {
-		mcpManager = mcp.NewManager()
-		defer mcpManager.Shutdown()
+		mcpCtx, mcpCancel := context.WithCancel(context.Background())
+		defer mcpCancel()
+		startMCPServers(mcpCtx, mcpManager, cfg)
 	}
-	_ = mcpManager // Silence unused variable warning for now
 
 	// Load or create conversation
 	var conv *types.Conversation
@@ -351,9 +358,7 @@ func runLLM(convName, systemPrompt, continueID string) error {
 		if err != nil {
 			return err
 		}
-		for _, msg := range storedMsgs {
-			messages = append(messages, ai.Message{Role: msg.Role, Content: msg.Content})
-		}
+		messages = toMessages(storedMsgs, useTools)
 		fmt.Printf("📝 Continuing conversation: %s\n", conv.Name)
 		if conv.SystemPrompt != "" {
 			fmt.Printf("📋 System: %s\n", ui.Dim(truncate(conv.SystemPrompt, 60)))
@@ -379,6 +384,14 @@ func runLLM(convName, systemPrompt, continueID string) error {
 	}
 
 	fmt.Printf("🤖 Model: %s (%s)\n", cfg.Model.Name, cfg.Provider.Name)
+	printMCPStatus(mcpManager)
+	if useTools {
+		check := "every call is checked against the safety policy"
+		if cfg.Safety.RequireConfirmation {
+			check = "every call is analyzed and confirmed"
+		}
+		fmt.Printf("🔧 Tools: %d available, %s\n", len(mcpManager.AvailableTools()), check)
+	}
 	fmt.Println("Type /help for commands, /quit to exit")
 	fmt.Println()
 
@@ -399,6 +412,51 @@ func runLLM(convName, systemPrompt, continueID string) error {
 
 	isFirstExchange := conv.MessageCount <= 1 // Only system prompt or empty
 
+	// Usage billed for the last reply, to count what the next prompt adds
+	var lastUsage ai.TokenUsage
+	for _, msg := range storedMsgs {
+		if msg.Role == "assistant" && msg.PromptTokens > 0 {
+			lastUsage = ai.TokenUsage{PromptTokens: msg.PromptTokens, CompletionTokens: msg.CompletionTokens}
+		}
+	}
+
+	reserved := 0
+	if useTools {
+		reserved = toolsTokens(cfg, mcpManager.AvailableTools())
+	}
+	fitter := newContextFitter(cfg, provider, reserved)
+
+	var agent *toolAgent
+	if useTools {
+		agent = &toolAgent{
+			cfg:      cfg,
+			provider: provider,
+			manager:  mcpManager,
+			store:    store,
+			convID:   conv.ID,
+			line:     line,
+			context:  fitter,
+
+			lastUsage: lastUsage,
+		}
+	}
+
+	// compact replaces all but the latest exchanges with a stored summary
+	compact := func(auto bool) {
+		stored, err := store.GetMessages(conv.ID)
+		if err != nil {
+			ui.PrintError(err.Error())
+			return
+		}
+		_, summary, body, rows := conversationContext(stored, useTools)
+		var n int
+		messages, n, err = fitter.compact(messages, summary, body, rows, func(summary string, summaryOf int) error {
+			_, err := store.AddSummary(conv.ID, summary, summaryOf)
+			return err
+		})
+		reportCompaction(n, err, auto)
+	}
+
 	for {
 		input, err := line.Prompt("you> ")
 		if err != nil {
@@ -438,6 +496,14 @@ func runLLM(convName, systemPrompt, continueID string) error {
 			storedMsgs, _ := store.GetMessages(conv.ID)
 			printConversationHistory(storedMsgs)
 			continue
+		case input == "/tools":
+			fmt.Println()
+			printMCPTools(mcpManager.GetTools())
+			fmt.Println()
+			continue
+		case input == "/compact":
+			compact(false)
+			continue
 		case input == "/system":
 			conv, _ = store.GetConversation(conv.ID)
 			fmt.Printf("\n📋 Current system prompt:\n%s\n\n", ui.Dim(conv.SystemPrompt))
@@ -449,14 +515,14 @@ func runLLM(convName, systemPrompt, continueID string) error {
 			if newPrompt == "clear" {
 				store.UpdateSystemPrompt(conv.ID, "")
 				// Update messages context - remove old system message
-				if len(messages) > 0 && messages[0].Role == "system" {
+				if len(messages) > 0 && messages[0].Role == "system" && !messages[0].Summary {
 					messages = messages[1:]
 				}
 				fmt.Println(ui.Success("✓"), "System prompt cleared")
 			} else if newPrompt != "" {
 				store.UpdateSystemPrompt(conv.ID, newPrompt)
 				// Update messages context
-				if len(messages) > 0 && messages[0].Role == "system" {
+				if len(messages) > 0 && messages[0].Role == "system" && !messages[0].Summary {
 					messages[0].Content = newPrompt
 				} else {
 					messages = append([]ai.Message{{Role: "system", Content: newPrompt}}, messages...)
@@ -469,14 +535,37 @@ func runLLM(convName, systemPrompt, continueID string) error {
 			continue
 		}
 
+		if fitter.shouldCompact(messages) {
+			compact(true)
+		}
+
 		// Add user message
 		messages = append(messages, ai.Message{Role: "user", Content: input})
 
+		if agent != nil {
+			updated, answer, err := agent.run(messages)
+			messages = updated
+			if err != nil {
+				ui.PrintError(err.Error())
+				fmt.Println()
+				continue
+			}
+			fmt.Printf("assistant> %s\n", answer)
+
+			if isFirstExchange && cfg.LLM.GenerateTitles && conv.Name == "New Conversation" {
+				go generateConversationTitle(provider, store, conv.ID, input, answer)
+				isFirstExchange = false
+			}
+			fmt.Println()
+			continue
+		}
+
 		// Stream the response
+		request := fitter.fit(messages)
 		fmt.Print("assistant> ")
 		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Model.TimeoutSeconds)*time.Second)
 
-		stream, err := provider.ChatStream(ctx, messages)
+		stream, err := provider.ChatStream(ctx, request)
 		if err != nil {
 			cancel()
 			ui.PrintError(err.Error())
@@ -515,16 +604,16 @@ func runLLM(convName, systemPrompt, continueID string) error {
 		assistantContent := response.String()
 		messages = append(messages, ai.Message{Role: "assistant", Content: assistantContent})
 
-		// Save messages to store
-		userTokens := 0
-		assistantTokens := 0
+		// Save messages to store with the usage billed for them
+		var usage ai.TokenUsage
+		if tokenUsage != nil {
+			usage = *tokenUsage
+		}
+		store.AddMessage(conv.ID, "user", input, promptGrowth(usage, lastUsage))
+		store.AddReply(conv.ID, assistantContent, nil, usage)
 		if tokenUsage != nil {
-			// Rough split: estimate user tokens as prompt tokens minus previous context
-			assistantTokens = tokenUsage.CompletionTokens
-			userTokens = tokenUsage.PromptTokens / max(1, len(messages)-1)
+			lastUsage = usage
 		}
-		store.AddMessage(conv.ID, "user", input, userTokens)
-		store.AddMessage(conv.ID, "assistant", assistantContent, assistantTokens)
 
 		// Generate title after first exchange if enabled
 		if isFirstExchange && cfg.LLM.GenerateTitles && conv.Name == "New Conversation" {
@@ -550,7 +639,7 @@ Assistant: %s`, truncate(userMsg, 200), truncate(assistantMsg, 200))
 		{Role: "user", Content: prompt},
 	}
 
-	response, err := provider.Chat(ctx, messages)
+	response, err := provider.Chat(ai.WithMode(ctx, ai.ModeTitle), messages)
 	if err != nil {
 		return // Silently fail - title generation is not critical
 	}
@@ -573,10 +662,14 @@ func printLLMHelp() {
   /history       Show conversation history
   /system        View/edit system prompt
   /tokens        Show token usage
+  /tools         List tools from MCP servers
+  /compact       Summarize older messages to free up context
   /clear         Clear screen
   /quit, /q      Exit
 
-Just type your message to chat with the AI.`)
+Just type your message to chat with the AI.
+With --tools the AI can run commands, read and write files and call MCP
+tools; every call is safety-analyzed and needs your confirmation.`)
 }
 
 // printConversationHistory displays the conversation history
@@ -606,6 +699,22 @@ func printConversationHistory(messages []*types.ConversationMessage) {
 		case "assistant":
 			prefix = ui.Magenta("assistant> ")
 			content = msg.Content
+			if len(msg.ToolCalls) > 0 {
+				var names []string
+				for _, call := range msg.ToolCalls {
+					names = append(names, call.Name)
+				}
+				if content != "" {
+					content += "\n"
+				}
+				content += ui.Dim("[calls " + strings.Join(names, ", ") + "]")
+			}
+		case "tool":
+			prefix = ui.Dim("tool[" + msg.ToolName + "]> ")
+			content = msg.Content
+		case "summary":
+			prefix = ui.Dim("📎 summary> ")
+			content = ui.Dim(msg.Content)
 		default:
 			prefix = ui.Dim(msg.Role + "> ")
 			content = msg.Content
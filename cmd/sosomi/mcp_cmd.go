@@ -0,0 +1,500 @@
+// MCP server management commands for sosomi CLI
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sonemaro/sosomi/internal/config"
+	"github.com/sonemaro/sosomi/internal/mcp"
+	"github.com/sonemaro/sosomi/internal/types"
+	"github.com/sonemaro/sosomi/internal/ui"
+)
+
+// newMCPManager creates an MCP manager with the progress display and server
+// logging configured
+func newMCPManager(cfg *config.Config) *mcp.Manager {
+	manager := mcp.NewManager()
+	manager.SetProgressHandler(printMCPProgress)
+	manager.SetLogDir(expandPath(cfg.MCP.LogDir))
+	return manager
+}
+
+// printMCPProgress shows a progress notification from a running server tool
+func printMCPProgress(tool string, p mcp.Progress) {
+	status := fmt.Sprintf("%g", p.Progress)
+	if p.Total > 0 {
+		status = fmt.Sprintf("%g/%g", p.Progress, p.Total)
+	}
+	if p.Message != "" {
+		status += " " + p.Message
+	}
+	fmt.Println(ui.Dim(fmt.Sprintf("   ⏳ %s: %s", tool, status)))
+}
+
+// startMCPServers starts the enabled servers from mcp.servers.
+// Failures are reported as warnings so a broken server never blocks sosomi.
+func startMCPServers(ctx context.Context, manager *mcp.Manager, cfg *config.Config) {
+	for _, server := range cfg.MCP.Servers {
+		if !server.IsEnabled() {
+			continue
+		}
+		if err := manager.Start(ctx, mcpServerConfig(server, cfg.MCP.ToolsDir)); err != nil {
+			ui.PrintWarning(fmt.Sprintf("MCP server %s failed to start: %v", server.Name, err))
+		}
+	}
+}
+
+// printMCPStatus reports the running MCP servers at llm startup
+func printMCPStatus(manager *mcp.Manager) {
+	if servers := manager.RunningServers(); len(servers) > 0 {
+		fmt.Printf("🔌 MCP: %d servers, %d tools (/tools to list)\n", len(servers), len(manager.GetTools()))
+	}
+}
+
+// mcpServerConfig converts a configured server, looking up bare command
+// names in tools_dir before falling back to $PATH
+func mcpServerConfig(server config.MCPServerConfig, toolsDir string) mcp.ServerConfig {
+	command := expandPath(server.Command)
+	if command != "" && toolsDir != "" && !strings.ContainsRune(command, filepath.Separator) {
+		candidate := filepath.Join(expandPath(toolsDir), command)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			command = candidate
+		}
+	}
+
+	return mcp.ServerConfig{
+		Name:      server.Name,
+		Transport: strings.ToLower(server.Transport),
+		Command:   command,
+		Args:      server.Args,
+		Env:       server.Env,
+		Cwd:       expandPath(server.Cwd),
+		URL:       server.URL,
+		Headers:   server.Headers,
+	}
+}
+
+// findMCPServer returns the configured server with the given name
+func findMCPServer(cfg *config.Config, name string) (config.MCPServerConfig, error) {
+	for _, server := range cfg.MCP.Servers {
+		if server.Name == name {
+			return server, nil
+		}
+	}
+	return config.MCPServerConfig{}, fmt.Errorf("MCP server not configured: %s", name)
+}
+
+// startMCPServersFor starts a single server, or all enabled servers when name is empty
+func startMCPServersFor(ctx context.Context, manager *mcp.Manager, cfg *config.Config, name string) error {
+	if name == "" {
+		startMCPServers(ctx, manager, cfg)
+		return nil
+	}
+	server, err := findMCPServer(cfg, name)
+	if err != nil {
+		return err
+	}
+	return manager.Start(ctx, mcpServerConfig(server, cfg.MCP.ToolsDir))
+}
+
+// printMCPTools lists the tools available from MCP servers
+func printMCPTools(tools []types.MCPTool) {
+	if len(tools) == 0 {
+		fmt.Println(ui.Dim("  No MCP tools available."))
+		return
+	}
+	for _, tool := range tools {
+		fmt.Printf("  %s  %s\n", ui.Cyan(tool.Name), ui.Dim(truncate(tool.Description, 70)))
+	}
+}
+
+// mcpCmd returns the mcp subcommand
+func mcpCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mcp",
+		Short: "Manage and debug MCP servers, or serve sosomi over MCP",
+		Long: `Inspect the MCP servers configured in mcp.servers and call their tools
+directly, without going through the model. 'sosomi mcp serve' runs sosomi
+itself as an MCP server.
+
+Examples:
+  sosomi mcp list                                  # Configured servers
+  sosomi mcp tools git                             # Tools of one server
+  sosomi mcp call git.git_status '{"repo_path": "."}'
+  sosomi mcp resources fs                          # Resources of one server
+  sosomi mcp read fs file:///etc/hosts             # Read a resource
+  sosomi mcp prompts                               # Prompts of all servers
+  sosomi mcp prompt git.commit-message style=short # Render a prompt
+  sosomi mcp logs git -n 100                       # Server stderr and restarts
+  sosomi mcp serve                                 # Serve sosomi's tools over stdio`,
+	}
+
+	cmd.AddCommand(mcpListCmd())
+	cmd.AddCommand(mcpToolsCmd())
+	cmd.AddCommand(mcpCallCmd())
+	cmd.AddCommand(mcpResourcesCmd())
+	cmd.AddCommand(mcpReadCmd())
+	cmd.AddCommand(mcpPromptsCmd())
+	cmd.AddCommand(mcpPromptCmd())
+	cmd.AddCommand(mcpLogsCmd())
+	cmd.AddCommand(mcpServeCmd())
+
+	return cmd
+}
+
+func mcpListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List configured MCP servers",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := config.Get()
+
+			if len(cfg.MCP.Servers) == 0 {
+				fmt.Println("No MCP servers configured. Add them under mcp.servers in config.yaml.")
+				return nil
+			}
+
+			fmt.Println("\n🔌 MCP Servers:")
+			fmt.Println(strings.Repeat("─", 70))
+			for _, server := range cfg.MCP.Servers {
+				status := ui.Success("enabled ")
+				if !server.IsEnabled() {
+					status = ui.Dim("disabled")
+				}
+				target := strings.Join(append([]string{server.Command}, server.Args...), " ")
+				if server.URL != "" {
+					transport := server.Transport
+					if transport == "" {
+						transport = mcp.TransportHTTP
+					}
+					target = fmt.Sprintf("%s (%s)", server.URL, transport)
+				}
+				fmt.Printf("  %-16s %s  %s\n", server.Name, status, truncate(target, 45))
+				if server.Cwd != "" {
+					fmt.Printf("  %-16s %s\n", "", ui.Dim("cwd: "+server.Cwd))
+				}
+			}
+			if !cfg.MCP.Enabled {
+				fmt.Println(ui.Dim("\n  MCP is disabled (mcp.enabled: false); servers are not started by llm."))
+			}
+			fmt.Println()
+			return nil
+		},
+	}
+}
+
+func mcpToolsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "tools [server]",
+		Short: "Start MCP servers and list their tools",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := config.Get()
+			var name string
+			if len(args) > 0 {
+				name = args[0]
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			manager := newMCPManager(cfg)
+			defer manager.Shutdown()
+
+			if err := startMCPServersFor(ctx, manager, cfg, name); err != nil {
+				return err
+			}
+
+			fmt.Println("\n🔧 MCP Tools:")
+			fmt.Println(strings.Repeat("─", 70))
+			printMCPTools(manager.GetTools())
+			fmt.Println()
+			return nil
+		},
+	}
+}
+
+func mcpCallCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "call <server.tool> [json-arguments]",
+		Short: "Call an MCP server tool directly (Ctrl+C cancels the call)",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := config.Get()
+
+			serverName, _, ok := strings.Cut(args[0], ".")
+			if !ok {
+				return fmt.Errorf("tool must be named <server>.<tool>, got %s", args[0])
+			}
+
+			arguments := map[string]interface{}{}
+			if len(args) > 1 {
+				if err := json.Unmarshal([]byte(args[1]), &arguments); err != nil {
+					return fmt.Errorf("arguments must be a JSON object: %w", err)
+				}
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			manager := newMCPManager(cfg)
+			defer manager.Shutdown()
+
+			if err := startMCPServersFor(ctx, manager, cfg, serverName); err != nil {
+				return err
+			}
+
+			// Ctrl+C cancels the call on the server instead of killing sosomi
+			callCtx, callCancel := signal.NotifyContext(ctx, os.Interrupt)
+			defer callCancel()
+			callCtx, timeoutCancel := context.WithTimeout(callCtx, time.Duration(cfg.Model.TimeoutSeconds)*time.Second)
+			defer timeoutCancel()
+			result, err := manager.CallTool(callCtx, args[0], arguments)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(result.Content)
+			if result.IsError {
+				return fmt.Errorf("tool %s returned an error", args[0])
+			}
+			return nil
+		},
+	}
+}
+
+func mcpResourcesCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "resources [server]",
+		Short: "Start MCP servers and list their resources",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := config.Get()
+			var name string
+			if len(args) > 0 {
+				name = args[0]
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			manager := newMCPManager(cfg)
+			defer manager.Shutdown()
+
+			if err := startMCPServersFor(ctx, manager, cfg, name); err != nil {
+				return err
+			}
+
+			listCtx, listCancel := context.WithTimeout(ctx, time.Duration(cfg.Model.TimeoutSeconds)*time.Second)
+			defer listCancel()
+			resources, err := manager.ListResources(listCtx, name)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println("\n📚 MCP Resources:")
+			fmt.Println(strings.Repeat("─", 70))
+			if len(resources) == 0 {
+				fmt.Println(ui.Dim("  No MCP resources available."))
+			}
+			for _, resource := range resources {
+				fmt.Printf("  %s  %s  %s\n", ui.Dim(resource.Server), ui.Cyan(resource.URI), ui.Dim(truncate(resource.Name, 40)))
+			}
+			fmt.Println()
+			return nil
+		},
+	}
+}
+
+func mcpReadCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "read <server> <uri>",
+		Short: "Read a resource from an MCP server",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := config.Get()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			manager := newMCPManager(cfg)
+			defer manager.Shutdown()
+
+			if err := startMCPServersFor(ctx, manager, cfg, args[0]); err != nil {
+				return err
+			}
+
+			readCtx, readCancel := context.WithTimeout(ctx, time.Duration(cfg.Model.TimeoutSeconds)*time.Second)
+			defer readCancel()
+			contents, err := manager.ReadResource(readCtx, args[0], args[1])
+			if err != nil {
+				return err
+			}
+
+			for _, content := range contents {
+				if content.Text != "" {
+					fmt.Println(content.Text)
+				} else if content.Blob != "" {
+					fmt.Println(ui.Dim(fmt.Sprintf("[binary %s, %d bytes base64]", content.MimeType, len(content.Blob))))
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func mcpPromptsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "prompts [server]",
+		Short: "Start MCP servers and list their prompts",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := config.Get()
+			var name string
+			if len(args) > 0 {
+				name = args[0]
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			manager := newMCPManager(cfg)
+			defer manager.Shutdown()
+
+			if err := startMCPServersFor(ctx, manager, cfg, name); err != nil {
+				return err
+			}
+
+			listCtx, listCancel := context.WithTimeout(ctx, time.Duration(cfg.Model.TimeoutSeconds)*time.Second)
+			defer listCancel()
+			prompts, err := manager.ListPrompts(listCtx, name)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println("\n💬 MCP Prompts:")
+			fmt.Println(strings.Repeat("─", 70))
+			if len(prompts) == 0 {
+				fmt.Println(ui.Dim("  No MCP prompts available."))
+			}
+			for _, prompt := range prompts {
+				fmt.Printf("  %s  %s\n", ui.Cyan(prompt.Name), ui.Dim(truncate(prompt.Description, 60)))
+				for _, arg := range prompt.Arguments {
+					required := ""
+					if arg.Required {
+						required = " (required)"
+					}
+					fmt.Printf("      %s%s  %s\n", arg.Name, required, ui.Dim(truncate(arg.Description, 50)))
+				}
+			}
+			fmt.Println()
+			return nil
+		},
+	}
+}
+
+func mcpPromptCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "prompt <server.prompt> [name=value...]",
+		Short: "Render a prompt from an MCP server",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := config.Get()
+
+			serverName, _, ok := strings.Cut(args[0], ".")
+			if !ok {
+				return fmt.Errorf("prompt must be named <server>.<prompt>, got %s", args[0])
+			}
+
+			arguments := map[string]string{}
+			for _, arg := range args[1:] {
+				key, value, ok := strings.Cut(arg, "=")
+				if !ok {
+					return fmt.Errorf("prompt arguments must be name=value, got %s", arg)
+				}
+				arguments[key] = value
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			manager := newMCPManager(cfg)
+			defer manager.Shutdown()
+
+			if err := startMCPServersFor(ctx, manager, cfg, serverName); err != nil {
+				return err
+			}
+
+			getCtx, getCancel := context.WithTimeout(ctx, time.Duration(cfg.Model.TimeoutSeconds)*time.Second)
+			defer getCancel()
+			messages, err := manager.GetPrompt(getCtx, args[0], arguments)
+			if err != nil {
+				return err
+			}
+
+			for _, msg := range messages {
+				fmt.Printf("%s> %s\n", msg.Role, msg.Content)
+			}
+			return nil
+		},
+	}
+}
+
+func mcpLogsCmd() *cobra.Command {
+	var lines int
+
+	cmd := &cobra.Command{
+		Use:   "logs <server>",
+		Short: "Show a server's stderr output and restart events",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := config.Get()
+			if _, err := findMCPServer(cfg, args[0]); err != nil {
+				return err
+			}
+
+			manager := newMCPManager(cfg)
+			path := manager.LogPath(args[0])
+			if path == "" {
+				return fmt.Errorf("MCP logging is disabled (mcp.log_dir is empty)")
+			}
+
+			f, err := os.Open(path)
+			if os.IsNotExist(err) {
+				fmt.Printf("No logs yet for %s (%s)\n", args[0], path)
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			var tail []string
+			scanner := bufio.NewScanner(f)
+			scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+			for scanner.Scan() {
+				tail = append(tail, scanner.Text())
+				if lines > 0 && len(tail) > lines {
+					tail = tail[1:]
+				}
+			}
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+
+			fmt.Println(ui.Dim("─── " + path + " ───"))
+			for _, line := range tail {
+				fmt.Println(line)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&lines, "lines", "n", 50, "Number of lines to show (0 for all)")
+
+	return cmd
+}
@@ -0,0 +1,364 @@
+// 'sosomi mcp serve': sosomi as an MCP server for other agents
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sonemaro/sosomi/internal/ai"
+	"github.com/sonemaro/sosomi/internal/config"
+	"github.com/sonemaro/sosomi/internal/mcp"
+	"github.com/sonemaro/sosomi/internal/shell"
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+const (
+	// serveHistoryLimit is the default number of history_search results
+	serveHistoryLimit = 20
+	// serveMaxHistoryLimit caps the history_search limit argument
+	serveMaxHistoryLimit = 100
+	// servePrompt marks history entries recorded for MCP clients
+	servePrompt = "[mcp] execute_command"
+)
+
+// generatedCommand is the generate_command result
+type generatedCommand struct {
+	Command      string                 `json:"command"`
+	Explanation  string                 `json:"explanation,omitempty"`
+	Warnings     []string               `json:"warnings,omitempty"`
+	Alternatives []string               `json:"alternatives,omitempty"`
+	Analysis     *types.CommandAnalysis `json:"analysis,omitempty"`
+	Executable   bool                   `json:"executable"`        // execute_command would run it
+	Refusal      string                 `json:"refusal,omitempty"` // why execute_command would refuse it
+}
+
+// mcpServer holds what the served tools need
+type mcpServer struct {
+	cfg         *config.Config
+	provider    ai.Provider
+	providerErr error
+}
+
+func mcpServeCmd() *cobra.Command {
+	var protocolOut *os.File
+
+	return &cobra.Command{
+		Use:   "serve",
+		Short: "Run sosomi as an MCP server over stdio",
+		Long: `Run sosomi as an MCP server so other agents can use it as their shell.
+
+Tools:
+  generate_command   Turn a natural language request into a command (not executed)
+  analyze_command    Safety analysis of a command
+  execute_command    Run a command if the safety profile allows it unattended
+  history_search     Search the command history
+
+There is no one to confirm commands, so execute_command only runs what
+safety.level allows without confirmation: safe commands for cautious and
+moderate, up to caution for normal, up to dangerous for relaxed, permissive
+and dangerous, and nothing for strict. Critical commands, custom confirm
+rules, commands at or above safety.confirm_threshold or above
+safety.max_affected_files, production targets with
+safety.production_action confirm, and everything with
+safety.dry_run_default are refused. Every execution and refusal is
+recorded in the history, and affected files are snapshotted for 'sosomi undo'.
+Uncommitted git work a command discards is kept under a safety ref unless
+safety.git_safety_net is off.
+
+Example client configuration:
+  {"command": "sosomi", "args": ["mcp", "serve"]}`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// stdout carries the protocol; everything else sosomi prints goes to stderr
+			protocolOut = os.Stdout
+			os.Stdout = os.Stderr
+			return initializeApp()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			server := &mcpServer{cfg: config.Get()}
+			server.provider, server.providerErr = getAIProvider()
+
+			fmt.Fprintf(os.Stderr, "sosomi MCP server ready (safety level: %s)\n", server.cfg.Safety.Level)
+			err := mcp.Serve(ctx, os.Stdin, protocolOut, mcp.ServerInfo{Name: "sosomi", Version: version}, server.tools())
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+			return err
+		},
+	}
+}
+
+// tools returns the tools exposed to MCP clients
+func (s *mcpServer) tools() []mcp.ServedTool {
+	return []mcp.ServedTool{
+		{
+			Tool: types.MCPTool{
+				Name:        "generate_command",
+				Description: "Generate a shell command for a natural language request. The command is analyzed but not executed.",
+				InputSchema: map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"prompt": map[string]interface{}{
+							"type":        "string",
+							"description": "What the command should do",
+						},
+					},
+					"required": []string{"prompt"},
+				},
+			},
+			Handler: s.generateCommand,
+		},
+		{
+			Tool: types.MCPTool{
+				Name:        "analyze_command",
+				Description: "Analyze the safety of a shell command without running it",
+				InputSchema: map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"command": map[string]interface{}{
+							"type":        "string",
+							"description": "The shell command to analyze",
+						},
+						"workdir": map[string]interface{}{
+							"type":        "string",
+							"description": "Working directory the command would run in",
+						},
+					},
+					"required": []string{"command"},
+				},
+			},
+			Handler: s.analyzeCommand,
+		},
+		{
+			Tool: types.MCPTool{
+				Name:        "execute_command",
+				Description: "Execute a shell command if sosomi's safety profile allows it without confirmation",
+				InputSchema: map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"command": map[string]interface{}{
+							"type":        "string",
+							"description": "The shell command to execute",
+						},
+						"workdir": map[string]interface{}{
+							"type":        "string",
+							"description": "Working directory for the command",
+						},
+					},
+					"required": []string{"command"},
+				},
+			},
+			Handler: s.executeCommand,
+		},
+		{
+			Tool: types.MCPTool{
+				Name:        "history_search",
+				Description: "Search previously generated and executed commands",
+				InputSchema: map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"query": map[string]interface{}{
+							"type":        "string",
+							"description": "Text to search for in prompts and commands",
+						},
+						"limit": map[string]interface{}{
+							"type":        "integer",
+							"description": fmt.Sprintf("Maximum number of results (default %d)", serveHistoryLimit),
+						},
+					},
+					"required": []string{"query"},
+				},
+			},
+			Handler: s.historySearch,
+		},
+	}
+}
+
+func (s *mcpServer) generateCommand(ctx context.Context, args map[string]interface{}) (*types.MCPToolResult, error) {
+	prompt, _ := args["prompt"].(string)
+	if strings.TrimSpace(prompt) == "" {
+		return nil, fmt.Errorf("prompt argument required")
+	}
+	if s.providerErr != nil {
+		return nil, s.providerErr
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(s.cfg.Model.TimeoutSeconds)*time.Second)
+	defer cancel()
+	response, err := s.provider.GenerateCommand(ctx, prompt, shell.GetSystemContext())
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate command: %w", err)
+	}
+
+	result := generatedCommand{
+		Command:      response.Command,
+		Explanation:  response.Explanation,
+		Warnings:     response.Warnings,
+		Alternatives: response.Alternatives,
+	}
+	if response.Command != "" {
+		analysis, _ := analyzeCommand(s.cfg, response.Command)
+		// Merge AI risk assessment with pattern analysis
+		if response.RiskLevel > analysis.RiskLevel {
+			analysis.RiskLevel = response.RiskLevel
+		}
+		result.Analysis = analysis
+		result.Refusal = unattendedRefusal(s.cfg, analysis)
+		result.Executable = result.Refusal == ""
+	}
+	return jsonToolResult(result)
+}
+
+func (s *mcpServer) analyzeCommand(ctx context.Context, args map[string]interface{}) (*types.MCPToolResult, error) {
+	command, workdir, err := commandArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	analysis, err := analyzeCommandIn(s.cfg, command, workdir)
+	if err != nil {
+		return nil, fmt.Errorf("could not analyze command: %w", err)
+	}
+	return jsonToolResult(analysis)
+}
+
+// executeCommand runs a command when the safety profile allows it unattended.
+// Executions and refusals are both recorded in the history.
+func (s *mcpServer) executeCommand(ctx context.Context, args map[string]interface{}) (*types.MCPToolResult, error) {
+	command, workdir, err := commandArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	analysis, err := analyzeCommandIn(s.cfg, command, workdir)
+	if err != nil {
+		return nil, fmt.Errorf("could not analyze command: %w", err)
+	}
+
+	if refusal := unattendedRefusal(s.cfg, analysis); refusal != "" {
+		s.record(&types.HistoryEntry{GeneratedCmd: command, RiskLevel: analysis.RiskLevel, WorkingDir: workdir})
+		return &types.MCPToolResult{Content: "Command refused: " + refusal, IsError: true}, nil
+	}
+
+	snap := snapshotBeforeExecIn(command, workdir, analysis, nil)
+
+	start := time.Now()
+	c := exec.CommandContext(ctx, "sh", "-c", command)
+	c.Dir = workdir
+	output, runErr := c.CombinedOutput()
+	duration := time.Since(start).Milliseconds()
+
+	exitCode := 0
+	if runErr != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(runErr, &exitErr) {
+			return nil, fmt.Errorf("execution failed: %w", runErr)
+		}
+		exitCode = exitErr.ExitCode()
+	}
+
+	entry := &types.HistoryEntry{
+		GeneratedCmd: command,
+		RiskLevel:    analysis.RiskLevel,
+		Executed:     true,
+		ExitCode:     exitCode,
+		DurationMs:   duration,
+		WorkingDir:   workdir,
+	}
+	if s.record(entry) {
+		recordBackup(entry.ID, snap)
+	}
+
+	content := string(output)
+	if content == "" {
+		content = "(no output)"
+	}
+	if exitCode != 0 {
+		content += fmt.Sprintf("\n[exit code %d]", exitCode)
+	}
+	return &types.MCPToolResult{Content: content, IsError: exitCode != 0}, nil
+}
+
+func (s *mcpServer) historySearch(ctx context.Context, args map[string]interface{}) (*types.MCPToolResult, error) {
+	if historyStore == nil {
+		return nil, fmt.Errorf("history is disabled")
+	}
+
+	query, _ := args["query"].(string)
+	limit := serveHistoryLimit
+	if n, ok := args["limit"].(float64); ok && n > 0 {
+		limit = min(int(n), serveMaxHistoryLimit)
+	}
+
+	entries, err := historyStore.SearchCommands(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	if entries == nil {
+		entries = []*types.HistoryEntry{}
+	}
+	return jsonToolResult(entries)
+}
+
+// record adds an audit entry to the history, reporting whether it was saved
+func (s *mcpServer) record(entry *types.HistoryEntry) bool {
+	if historyStore == nil {
+		return false
+	}
+	entry.Prompt = servePrompt
+	entry.Provider = "mcp"
+	if err := historyStore.AddCommand(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not record command in history: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// unattendedRefusal explains why a command may not run without confirmation,
+// or returns "" when the safety policy allows it
+func unattendedRefusal(cfg *config.Config, analysis *types.CommandAnalysis) string {
+	verdict := newPolicy(cfg).Decide(analysis, true)
+	if verdict.Runs() {
+		return ""
+	}
+	return verdict.Reason
+}
+
+// commandArgs extracts the command and working directory of a tool call,
+// resolving the working directory to an existing directory
+func commandArgs(args map[string]interface{}) (command, workdir string, err error) {
+	command, _ = args["command"].(string)
+	if strings.TrimSpace(command) == "" {
+		return "", "", fmt.Errorf("command argument required")
+	}
+
+	workdir, _ = args["workdir"].(string)
+	if workdir == "" {
+		workdir, _ = os.Getwd()
+	}
+	workdir = expandPath(workdir)
+	if info, err := os.Stat(workdir); err != nil || !info.IsDir() {
+		return "", "", fmt.Errorf("workdir is not a directory: %s", workdir)
+	}
+	return command, workdir, nil
+}
+
+// jsonToolResult returns v as an indented JSON tool result
+func jsonToolResult(v interface{}) (*types.MCPToolResult, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return &types.MCPToolResult{Content: string(data)}, nil
+}
@@ -123,6 +123,9 @@ func profileCmd() *cobra.Command {
 			fmt.Printf("Provider: %s\n", profile.Provider.Name)
 			fmt.Printf("Model: %s\n", profile.Model.Name)
 			fmt.Printf("Endpoint: %s\n", profile.Provider.Endpoint)
+			if profile.Provider.Deployment != "" {
+				fmt.Printf("Deployment: %s\n", profile.Provider.Deployment)
+			}
 			fmt.Printf("Safety Level: %s\n", profile.Safety.Level)
 			return nil
 		},
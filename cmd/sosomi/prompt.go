@@ -4,8 +4,10 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
 	"time"
 
@@ -17,6 +19,9 @@ import (
 	"github.com/sonemaro/sosomi/internal/ui"
 )
 
+// maxCandidates limits --candidates, as each candidate costs a request
+const maxCandidates = 10
+
 // processPrompt handles a single natural language prompt
 func processPrompt(prompt string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Get().Model.TimeoutSeconds)*time.Second)
@@ -31,19 +36,34 @@ func processPrompt(prompt string) error {
 		return err
 	}
 
-	// Show spinner while generating
-	if !silent {
-		fmt.Print("🔮 Generating command...")
+	if candidates > 1 {
+		return processCandidates(ctx, aiProvider, prompt, sysCtx)
 	}
 
-	// Generate command
-	response, err := aiProvider.GenerateCommand(ctx, prompt, sysCtx)
+	// Generate command, streamed unless disabled
+	var response *types.CommandResponse
+	var printed string
+	if config.Get().Model.StreamOutput {
+		response, printed, err = streamCommand(ctx, aiProvider, prompt, sysCtx)
+	} else {
+		if !silent {
+			fmt.Print("🔮 Generating command...")
+		}
+		response, err = aiProvider.GenerateCommand(ctx, prompt, sysCtx)
+		if err == nil {
+			fmt.Print("\r                        \r") // Clear spinner
+		}
+	}
+	if errors.Is(err, context.Canceled) {
+		fmt.Println()
+		ui.PrintInfo("Generation canceled")
+		return nil
+	}
 	if err != nil {
 		fmt.Println() // Clear spinner line
 		return fmt.Errorf("failed to generate command: %w", err)
 	}
-
-	fmt.Print("\r                        \r") // Clear spinner
+	response.Provider, response.Model = aiProvider.Name(), aiProvider.Model()
 
 	if response.Command == "" {
 		ui.PrintError("Could not generate a command for this request")
@@ -53,15 +73,14 @@ func processPrompt(prompt string) error {
 		return nil
 	}
 
-	// Display command
-	if !silent {
+	// Display command, unless the stream already showed it
+	if !silent && response.Command != printed {
 		ui.PrintCommand(response.Command)
 	}
 
 	// Analyze command safety
 	cfg := config.Get()
-	analyzer := safety.NewAnalyzer(cfg.Safety.BlockedCommands, cfg.Safety.AllowedPaths)
-	analysis, err := analyzer.Analyze(response.Command)
+	analysis, err := analyzeCommand(cfg, response.Command)
 	if err != nil {
 		ui.PrintWarning(fmt.Sprintf("Could not analyze command: %v", err))
 	}
@@ -71,12 +90,159 @@ func processPrompt(prompt string) error {
 		analysis.RiskLevel = response.RiskLevel
 	}
 
+	return reviewCommand(response, analysis, prompt)
+}
+
+// streamCommand generates a command with GenerateCommandStream, showing a
+// spinner until the response is complete and the command as soon as it has
+// been streamed. Ctrl+C cancels the request and returns context.Canceled.
+// printed is the command shown while streaming, if any.
+func streamCommand(ctx context.Context, aiProvider ai.Provider, prompt string, sysCtx types.SystemContext) (response *types.CommandResponse, printed string, err error) {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	spinner := ui.NewSpinner("Generating command...")
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	if !silent {
+		fmt.Print(spinner.Frame())
+	}
+
+	chunks, err := aiProvider.GenerateCommandStream(ctx, prompt, sysCtx)
+	if err != nil {
+		return nil, "", canceledOr(ctx, err)
+	}
+
+	parser := ai.NewCommandStreamParser()
+	var usage ai.TokenUsage
+	for done := false; !done; {
+		select {
+		case <-ticker.C:
+			if !silent {
+				fmt.Print(spinner.Frame())
+			}
+		case chunk, ok := <-chunks:
+			if !ok {
+				done = true
+				break
+			}
+			if chunk.Error != nil {
+				if !silent {
+					fmt.Print(spinner.Clear())
+				}
+				return nil, printed, canceledOr(ctx, chunk.Error)
+			}
+			if parser.Feed(chunk.Content) && !silent {
+				printed, _ = parser.Command()
+				fmt.Print(spinner.Clear())
+				ui.PrintCommand(printed)
+				spinner.SetMessage("Finishing response...")
+			}
+			if chunk.Done && chunk.Usage != nil {
+				usage = *chunk.Usage
+			}
+			done = chunk.Done
+		}
+	}
+	if !silent {
+		fmt.Print(spinner.Clear())
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, printed, canceledOr(ctx, err)
+	}
+
+	response, err = parser.Response()
+	if err != nil {
+		return nil, printed, err
+	}
+	response.Usage = usage
+	return response, printed, nil
+}
+
+// canceledOr returns context.Canceled when ctx was canceled by the user,
+// and err otherwise
+func canceledOr(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return context.Canceled
+	}
+	return err
+}
+
+// processCandidates generates several commands for a prompt, ranks them by
+// risk and lets the user pick one. The lowest-risk valid command is
+// preselected, and the only one considered with --auto or --silent.
+func processCandidates(ctx context.Context, aiProvider ai.Provider, prompt string, sysCtx types.SystemContext) error {
+	if !silent {
+		fmt.Printf("🔮 Generating %d commands...", candidates)
+	}
+
+	responses, err := ai.GenerateCandidates(ctx, aiProvider, prompt, sysCtx, candidates)
+	if err != nil {
+		fmt.Println() // Clear spinner line
+		return fmt.Errorf("failed to generate command: %w", err)
+	}
+
+	fmt.Print("\r                              \r") // Clear spinner
+
+	cfg := config.Get()
+	generated := make([]types.Candidate, 0, len(responses))
+	for _, response := range responses {
+		response.Provider, response.Model = aiProvider.Name(), aiProvider.Model()
+		analysis := &types.CommandAnalysis{Command: response.Command}
+		if response.Command != "" {
+			if analysis, err = analyzeCommand(cfg, response.Command); err != nil {
+				ui.PrintWarning(fmt.Sprintf("Could not analyze command: %v", err))
+			}
+		}
+		if response.RiskLevel > analysis.RiskLevel {
+			analysis.RiskLevel = response.RiskLevel
+		}
+		generated = append(generated, types.Candidate{Response: response, Analysis: analysis})
+	}
+
+	ranked := safety.RankCandidates(generated)
+	selected := safety.PreferredCandidate(ranked)
+
+	if !autoExecute && !silent {
+		selected, err = ui.CandidatePicker(ranked, selected)
+		if err != nil {
+			return err
+		}
+		if selected < 0 {
+			ui.PrintInfo("Command canceled")
+			return nil
+		}
+	} else if selected < 0 {
+		ui.PrintError("None of the generated commands can be run")
+		return nil
+	}
+
+	chosen := ranked[selected]
+	if chosen.Response.Command == "" {
+		ui.PrintError("Could not generate a command for this request")
+		if chosen.Response.Explanation != "" {
+			ui.PrintInfo(chosen.Response.Explanation)
+		}
+		return nil
+	}
+
+	if !silent {
+		ui.PrintCommand(chosen.Response.Command)
+	}
+	return reviewCommand(chosen.Response, chosen.Analysis, prompt)
+}
+
+// reviewCommand shows the analysis of a generated command, then explains,
+// dry-runs, executes or asks to confirm it as requested by the flags
+func reviewCommand(response *types.CommandResponse, analysis *types.CommandAnalysis, prompt string) error {
 	// Display analysis
 	if !silent {
 		if config.Get().UI.ShowExplanations && response.Explanation != "" {
 			ui.PrintExplanation(response.Explanation)
 		}
 		ui.PrintRiskLevel(analysis.RiskLevel, analysis.RiskReasons)
+		ui.PrintTargets(analysis.Targets)
+		ui.PrintGitLoss(analysis.GitLoss)
 	}
 
 	// Handle warnings from AI
@@ -86,9 +252,10 @@ func processPrompt(prompt string) error {
 		}
 	}
 
-	// Check if blocked
-	if analysis.RiskLevel == types.RiskCritical {
-		ui.PrintError("This command is blocked due to critical risk level")
+	// Check what the safety policy allows
+	verdict := decide(config.Get(), analysis, autoExecute)
+	if verdict.Decision == safety.DecisionBlock {
+		ui.PrintError("This command is blocked: " + verdict.Reason)
 		return nil
 	}
 
@@ -101,32 +268,45 @@ func processPrompt(prompt string) error {
 		return executeDryRun(response.Command, analysis)
 	}
 
-	// Auto-execute safe commands if enabled
-	if autoExecute && analysis.RiskLevel == types.RiskSafe {
-		return executeCommand(response.Command, prompt, analysis)
-	}
-
-	// Check for auto-execute safe setting from config
-	if config.Get().Safety.AutoExecuteSafe && analysis.RiskLevel == types.RiskSafe {
-		return executeCommand(response.Command, prompt, analysis)
+	switch verdict.Decision {
+	case safety.DecisionAllow:
+		return executeCommand(response, prompt, analysis)
+	case safety.DecisionDryRunOnly:
+		ui.PrintWarning("Dry run only: " + verdict.Reason)
+		return executeDryRun(response.Command, analysis)
 	}
 
 	// Interactive confirmation
 	return interactiveConfirm(response, analysis, prompt)
 }
 
-// interactiveConfirm prompts the user to confirm, modify, or explain the command
+// interactiveConfirm prompts the user to confirm, modify, or explain the
+// command. The safety policy is applied again to modified commands.
 func interactiveConfirm(response *types.CommandResponse, analysis *types.CommandAnalysis, prompt string) error {
 	reader := bufio.NewReader(os.Stdin)
 
 	for {
+		verdict := decide(config.Get(), analysis, false)
+		switch verdict.Decision {
+		case safety.DecisionBlock:
+			ui.PrintError("This command is blocked: " + verdict.Reason)
+			return nil
+		case safety.DecisionDryRunOnly:
+			ui.PrintWarning("Dry run only: " + verdict.Reason)
+			return executeDryRun(response.Command, analysis)
+		}
+
 		ui.PrintConfirmPrompt()
 		input, _ := reader.ReadString('\n')
 		input = strings.TrimSpace(strings.ToLower(input))
 
 		switch input {
 		case "y", "yes":
-			return executeCommand(response.Command, prompt, analysis)
+			if verdict.Decision == safety.DecisionTypedConfirm && !typedConfirm(reader, analysis.RiskLevel) {
+				ui.PrintInfo("Command canceled")
+				return nil
+			}
+			return executeCommand(response, prompt, analysis)
 		case "n", "no", "":
 			ui.PrintInfo("Command canceled")
 			return nil
@@ -142,11 +322,12 @@ func interactiveConfirm(response *types.CommandResponse, analysis *types.Command
 				response.Command = newCmd
 				// Re-analyze
 				cfg := config.Get()
-				analyzer := safety.NewAnalyzer(cfg.Safety.BlockedCommands, cfg.Safety.AllowedPaths)
-				newAnalysis, _ := analyzer.Analyze(newCmd)
+				newAnalysis, _ := analyzeCommand(cfg, newCmd)
 				*analysis = *newAnalysis
 				ui.PrintCommand(newCmd)
 				ui.PrintRiskLevel(analysis.RiskLevel, analysis.RiskReasons)
+				ui.PrintTargets(analysis.Targets)
+				ui.PrintGitLoss(analysis.GitLoss)
 			}
 		default:
 			fmt.Println("  Invalid option. Please enter y, n, d, e, or m")
@@ -154,9 +335,31 @@ func interactiveConfirm(response *types.CommandResponse, analysis *types.Command
 	}
 }
 
-// executeCommand runs the command and logs to history
-func executeCommand(command, prompt string, analysis *types.CommandAnalysis) error {
-	cfg := config.Get()
+// typedConfirm asks to type the risk level of a command before running it,
+// for commands the safety level does not run on a single keypress
+func typedConfirm(reader *bufio.Reader, risk types.RiskLevel) bool {
+	ui.PrintTypedConfirmPrompt(risk)
+	input, _ := reader.ReadString('\n')
+	return strings.EqualFold(strings.TrimSpace(input), risk.String())
+}
+
+// askGitSafety asks on stdin how to keep uncommitted git work
+func askGitSafety(loss *types.GitLoss) string {
+	ui.PrintGitSafetyPrompt()
+	input, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return gitSafetyChoice(input)
+}
+
+// executeCommand runs the command of the response and logs to history
+func executeCommand(response *types.CommandResponse, prompt string, analysis *types.CommandAnalysis) error {
+	command := response.Command
+
+	// Snapshot affected files and uncommitted git work so the command can be undone
+	var ask gitSafetyAsker
+	if !autoExecute && !silent {
+		ask = askGitSafety
+	}
+	snap := snapshotBeforeExec(command, analysis, ask)
 
 	// Execute command
 	start := time.Now()
@@ -187,10 +390,16 @@ func executeCommand(command, prompt string, analysis *types.CommandAnalysis) err
 			ExitCode:     result.ExitCode,
 			DurationMs:   duration,
 			WorkingDir:   cwd,
-			Provider:     cfg.Provider.Name,
-			Model:        cfg.Model.Name,
+			Provider:     response.Provider,
+			Model:        response.Model,
+
+			PromptTokens:     response.Usage.PromptTokens,
+			CompletionTokens: response.Usage.CompletionTokens,
+			TotalTokens:      response.Usage.TotalTokens,
+		}
+		if err := historyStore.AddCommand(entry); err == nil {
+			recordBackup(entry.ID, snap)
 		}
-		historyStore.AddCommand(entry)
 	}
 
 	// Offer retry option if not in auto mode and not silent
@@ -268,6 +477,7 @@ func retryWithFeedback(originalPrompt, executedCmd string, result *shell.Execute
 		fmt.Println() // Clear spinner
 		return fmt.Errorf("failed to refine command: %w", err)
 	}
+	response.Provider, response.Model = aiProvider.Name(), aiProvider.Model()
 
 	fmt.Print("\r                                        \r") // Clear spinner
 
@@ -291,8 +501,7 @@ func retryWithFeedback(originalPrompt, executedCmd string, result *shell.Execute
 
 	// Analyze the new command
 	cfg := config.Get()
-	analyzer := safety.NewAnalyzer(cfg.Safety.BlockedCommands, cfg.Safety.AllowedPaths)
-	analysis, err := analyzer.Analyze(response.Command)
+	analysis, err := analyzeCommand(cfg, response.Command)
 	if err != nil {
 		ui.PrintWarning(fmt.Sprintf("Could not analyze command: %v", err))
 	}
@@ -303,6 +512,8 @@ func retryWithFeedback(originalPrompt, executedCmd string, result *shell.Execute
 
 	if !silent {
 		ui.PrintRiskLevel(analysis.RiskLevel, analysis.RiskReasons)
+		ui.PrintTargets(analysis.Targets)
+		ui.PrintGitLoss(analysis.GitLoss)
 	}
 
 	// Interactive confirmation for the refined command
@@ -317,9 +528,10 @@ func executeDryRun(command string, analysis *types.CommandAnalysis) error {
 	ui.PrintAnalysis(analysis)
 
 	// Try to show what files would be affected
-	cfg := config.Get()
-	analyzer := safety.NewAnalyzer(cfg.Safety.BlockedCommands, cfg.Safety.AllowedPaths)
-	files, _ := analyzer.GetAffectedFiles(analysis)
+	files := analysis.AffectedFiles
+	if len(files) == 0 {
+		files, _ = newAnalyzer(config.Get()).GetAffectedFiles(analysis)
+	}
 
 	if len(files) > 0 {
 		fmt.Println("\n  📁 Files that would be affected:")
@@ -327,10 +539,61 @@ func executeDryRun(command string, analysis *types.CommandAnalysis) error {
 			if f.IsDir {
 				fmt.Printf("     📂 %s (%d files)\n", f.Path, f.FileCount)
 			} else {
-				fmt.Printf("     📄 %s (%s)\n", f.Path, formatSize(f.Size))
+				fmt.Printf("     📄 %s (%s)\n", f.Path, ui.FormatSize(f.Size))
 			}
 		}
 	}
 
 	return nil
 }
+
+// newAnalyzer creates a safety analyzer from the current configuration
+func newAnalyzer(cfg *config.Config) *safety.Analyzer {
+	analyzer := safety.NewAnalyzer(cfg.Safety.BlockedCommands, cfg.Safety.AllowedPaths)
+	analyzer.SetProtectedPaths(cfg.Safety.ProtectedPaths)
+	analyzer.SetCustomRules(loadCustomRules(cfg))
+	return analyzer
+}
+
+// setEnvironment gives an analyzer the kube context, cloud profiles and
+// other targets of commands run in workdir ("" for the current directory)
+func setEnvironment(analyzer *safety.Analyzer, cfg *config.Config, workdir string) {
+	analyzer.SetEnvironment(shell.GetEnvironment(workdir), cfg.Safety.ProductionPatterns, cfg.Safety.ProductionAction)
+}
+
+// newPolicy creates the execution policy from the current configuration
+func newPolicy(cfg *config.Config) safety.Policy {
+	return safety.Policy{
+		Level:               cfg.Safety.Level,
+		ConfirmThreshold:    cfg.Safety.ConfirmThreshold,
+		RequireConfirmation: cfg.Safety.RequireConfirmation,
+		DryRunDefault:       cfg.Safety.DryRunDefault,
+		MaxAffectedFiles:    cfg.Safety.MaxAffectedFiles,
+	}
+}
+
+// decide applies the execution policy to an analyzed command. auto is set
+// when running commands unprompted was requested; safety.auto_execute_safe
+// requests it for every command.
+func decide(cfg *config.Config, analysis *types.CommandAnalysis, auto bool) safety.Verdict {
+	return newPolicy(cfg).Decide(analysis, auto || cfg.Safety.AutoExecuteSafe)
+}
+
+// analyzeCommand runs the full safety analysis, including the real number of affected files
+func analyzeCommand(cfg *config.Config, command string) (*types.CommandAnalysis, error) {
+	return analyzeCommandIn(cfg, command, "")
+}
+
+// analyzeCommandIn analyzes a command that will run in workdir ("" for the current directory)
+func analyzeCommandIn(cfg *config.Config, command, workdir string) (*types.CommandAnalysis, error) {
+	analyzer := newAnalyzer(cfg)
+	analyzer.SetWorkingDir(workdir)
+	setEnvironment(analyzer, cfg, workdir)
+	analysis, err := analyzer.Analyze(command)
+	if err != nil {
+		return analysis, err
+	}
+	analyzer.CheckAffectedFiles(analysis, cfg.Safety.MaxAffectedFiles)
+	analyzer.CheckGitChanges(analysis)
+	return analysis, nil
+}
@@ -26,6 +26,7 @@ Examples:
   sosomi "list all files larger than 100MB"
   sosomi "show disk usage" --auto
   sosomi "delete all .tmp files" --dry-run
+  sosomi "find large log files" --candidates 3
   sosomi chat`,
 		Args:    cobra.ArbitraryArgs,
 		Version: fmt.Sprintf("%s (commit: %s, built: %s)", version, commit, date),
@@ -44,6 +45,10 @@ Examples:
 	rootCmd.AddCommand(askCmd())
 	rootCmd.AddCommand(configCmd())
 	rootCmd.AddCommand(historyCmd())
+	rootCmd.AddCommand(usageCmd())
+	rootCmd.AddCommand(undoCmd())
+	rootCmd.AddCommand(rulesCmd())
+	rootCmd.AddCommand(mcpCmd())
 	rootCmd.AddCommand(modelsCmd())
 	rootCmd.AddCommand(profileCmd())
 	rootCmd.AddCommand(initCmd())
@@ -58,6 +63,7 @@ func addRootFlags(cmd *cobra.Command) {
 	cmd.Flags().BoolVarP(&explainOnly, "explain", "e", false, "Show explanation only")
 	cmd.Flags().BoolVarP(&silent, "silent", "s", false, "Minimal output")
 	cmd.Flags().StringVarP(&profileName, "profile", "p", "", "Configuration profile to use")
+	cmd.Flags().IntVarP(&candidates, "candidates", "n", 1, "Generate N candidate commands and pick one")
 }
 
 // runMain handles the root command execution (single prompt mode)
@@ -66,6 +72,10 @@ func runMain(cmd *cobra.Command, args []string) error {
 		return cmd.Help()
 	}
 
+	if candidates < 1 || candidates > maxCandidates {
+		return fmt.Errorf("--candidates must be between 1 and %d", maxCandidates)
+	}
+
 	prompt := strings.Join(args, " ")
 	return processPrompt(prompt)
 }
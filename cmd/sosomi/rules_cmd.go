@@ -0,0 +1,164 @@
+// Safety rules command and custom rule loading for sosomi CLI
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sonemaro/sosomi/internal/config"
+	"github.com/sonemaro/sosomi/internal/safety"
+	"github.com/sonemaro/sosomi/internal/ui"
+)
+
+var (
+	customRulesMu   sync.Mutex
+	customRulesPath string
+	customRulesList []safety.CustomRule
+)
+
+// loadCustomRules loads the custom rules file once per path. Invalid rules
+// are skipped with a warning. A file that cannot be read or parsed blocks
+// every command until it is fixed, so that a typo never silently drops the
+// block rules in it.
+func loadCustomRules(cfg *config.Config) []safety.CustomRule {
+	customRulesMu.Lock()
+	defer customRulesMu.Unlock()
+
+	path := cfg.Safety.CustomRulesPath
+	if path == customRulesPath && customRulesList != nil {
+		return customRulesList
+	}
+
+	rules, err := safety.LoadCustomRules(path)
+	switch {
+	case err != nil && rules == nil:
+		ui.PrintWarning(fmt.Sprintf("Custom safety rules in %s cannot be loaded, blocking all commands: %v", path, err))
+		blockAll := safety.CustomRule{
+			Pattern: "^",
+			Action:  safety.ActionBlock,
+			Message: "the custom rules file " + path + " is invalid, fix it to run commands",
+		}
+		blockAll.Compile()
+		rules = []safety.CustomRule{blockAll}
+	case err != nil:
+		ui.PrintWarning(fmt.Sprintf("Skipping invalid custom safety rules in %s: %v", path, err))
+	case rules == nil:
+		rules = []safety.CustomRule{}
+	}
+
+	customRulesPath = path
+	customRulesList = rules
+	return rules
+}
+
+// rulesCmd returns the rules subcommand
+func rulesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rules",
+		Short: "Inspect built-in and custom safety rules",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "test <command>",
+		Short: "Show which safety rules fire for a command",
+		Long: `Analyze a shell command without running it and show which built-in
+patterns, tool analyzers and custom rules (from safety.custom_rules_path)
+match.
+
+Examples:
+  sosomi rules test "rm -rf ./build"
+  sosomi rules test "kubectl delete ns staging"`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			command := strings.Join(args, " ")
+			cfg := config.Get()
+
+			fmt.Printf("\n%s %s\n", ui.Bold("Command:"), ui.Cyan(command))
+			fmt.Printf("%s %s\n", ui.Bold("Rules file:"), cfg.Safety.CustomRulesPath)
+
+			analyzer := newAnalyzer(cfg)
+			setEnvironment(analyzer, cfg, "")
+
+			fmt.Printf("\n%s\n", ui.Bold("Built-in patterns:"))
+			patterns := analyzer.MatchPatterns(command)
+			for _, p := range patterns {
+				fmt.Printf("  %s %s %s\n", p.RiskLevel.Emoji(), p.Description, ui.Dim("["+p.Category+"] "+p.Pattern.String()))
+			}
+			if len(patterns) == 0 {
+				fmt.Println(ui.Dim("  (none)"))
+			}
+
+			fmt.Printf("\n%s\n", ui.Bold("Custom rules:"))
+			matched := analyzer.MatchCustomRules(command)
+			for _, r := range matched {
+				fmt.Printf("  %s %s %s\n", r.RiskLevel.Emoji(), r.Description(), ui.Dim("["+r.Action+"] "+r.Pattern))
+			}
+			if len(matched) == 0 {
+				fmt.Println(ui.Dim("  (none)"))
+			}
+
+			fmt.Printf("\n%s\n", ui.Bold("Tool analyzers:"))
+			findings := analyzer.MatchTools(command)
+			for _, f := range findings {
+				fmt.Printf("  %s %s %s\n", f.Risk.Emoji(), f.Reason, ui.Dim("["+f.Tool+"]"))
+			}
+			if len(findings) == 0 {
+				fmt.Println(ui.Dim("  (none)"))
+			}
+
+			analysis, err := analyzer.Analyze(command)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println()
+			ui.PrintRiskLevel(analysis.RiskLevel, analysis.RiskReasons)
+			ui.PrintTargets(analysis.Targets)
+			if analysis.RequiresTypedConfirm {
+				ui.PrintInfo("A production target requires typing the risk level (safety.production_action)")
+			}
+			if analysis.RequiresConfirmation {
+				ui.PrintInfo("A custom rule requires interactive confirmation (--auto is ignored)")
+			}
+			fmt.Println()
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "tools",
+		Short: "List tool analyzers and check their labeled corpora",
+		Long: `List the analyzers that understand the subcommands and flags of tools
+such as git, kubectl and terraform, and run each one on its labeled
+example commands.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			failed := 0
+			fmt.Println()
+			for _, tool := range safety.Tools() {
+				status := ui.Green("ok")
+				err := safety.CheckCorpus(tool)
+				if err != nil {
+					failed++
+					status = ui.Red("FAIL")
+				}
+				fmt.Printf("  %-24s %3d examples  %s\n", strings.Join(tool.Names, ", "), len(tool.Corpus), status)
+				if err != nil {
+					for _, line := range strings.Split(err.Error(), "\n") {
+						fmt.Printf("    %s\n", ui.Dim(line))
+					}
+				}
+			}
+			fmt.Println()
+			if failed > 0 {
+				return fmt.Errorf("%d tool analyzer(s) disagree with their corpus", failed)
+			}
+			return nil
+		},
+	})
+
+	return cmd
+}
@@ -0,0 +1,316 @@
+// Undo command and pre-execution snapshots for sosomi CLI
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sonemaro/sosomi/internal/backup"
+	"github.com/sonemaro/sosomi/internal/config"
+	"github.com/sonemaro/sosomi/internal/types"
+	"github.com/sonemaro/sosomi/internal/ui"
+)
+
+// undoCmd returns the undo subcommand
+func undoCmd() *cobra.Command {
+	var listOnly bool
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "undo [history-id]",
+		Short: "Restore files from the snapshot taken before a command ran",
+		Long: `Restore files that were snapshotted before a destructive command ran.
+Files the command created at paths it named, such as the destination of
+mv a b, are removed; directories only when empty. Files it created inside
+an existing directory, such as cp x dir/, are left in place.
+
+Uncommitted git work that a command discarded (git reset --hard, git
+checkout ., git clean, git stash drop, rm inside a repository) is kept
+under a safety ref in refs/sosomi/ and restored into the working tree too.
+
+Without an ID, the most recent backup that has not been restored is used.
+History IDs are shown by 'sosomi history' and may be abbreviated.
+
+Examples:
+  sosomi undo                  # Undo the most recent snapshotted command
+  sosomi undo 3f2a9c1b         # Undo a specific command
+  sosomi undo --list           # List available backups`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if historyStore == nil {
+				return fmt.Errorf("history is not enabled")
+			}
+
+			if listOnly {
+				return listBackups()
+			}
+
+			var b *types.Backup
+			var err error
+			if len(args) > 0 {
+				b, err = historyStore.GetBackupByCommand(args[0])
+			} else {
+				b, err = historyStore.GetLatestBackup()
+			}
+			if err != nil {
+				return err
+			}
+
+			return runUndo(b, yes)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&listOnly, "list", "l", false, "List available backups")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Restore without asking for confirmation")
+
+	return cmd
+}
+
+// listBackups prints recent backups
+func listBackups() error {
+	backups, err := historyStore.ListBackups(20)
+	if err != nil {
+		return err
+	}
+
+	if len(backups) == 0 {
+		fmt.Println("No backups yet.")
+		return nil
+	}
+
+	fmt.Println("\n💾 Backups:")
+	fmt.Println(ui.Dim("──────────────────────────────────────────────────────────────────"))
+	for _, b := range backups {
+		status := ui.Success("available")
+		if b.RestoredAt != nil {
+			status = ui.Dim("restored " + b.RestoredAt.Format("2006-01-02 15:04"))
+		}
+		contents := fmt.Sprintf("%d files, %s", len(b.Files), ui.FormatSize(b.TotalSize))
+		if b.Git != nil {
+			contents += ", git " + gitSafetyKind(b.Git)
+		}
+		fmt.Printf("  %s  %s  %s  %s\n     └─ %s\n",
+			ui.Cyan(shortID(b.CommandID)),
+			b.CreatedAt.Format("2006-01-02 15:04:05"),
+			contents,
+			status,
+			truncate(b.Command, 60),
+		)
+	}
+	fmt.Println()
+	return nil
+}
+
+// runUndo restores a backup after confirmation
+func runUndo(b *types.Backup, yes bool) error {
+	cfg := config.Get()
+	store, err := backup.NewStore(cfg.History.BackupDir)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n↩️  %s %s\n", ui.Bold("Undo:"), ui.Cyan(b.Command))
+	fmt.Printf("   Snapshot taken %s in %s\n", b.CreatedAt.Format("2006-01-02 15:04:05"), b.WorkingDir)
+	var created []string
+	for _, f := range b.Files {
+		if f.Created {
+			created = append(created, f.Path)
+		}
+	}
+	if entries := len(b.Files) - len(created); entries > 0 {
+		fmt.Printf("   %d entries, %s\n", entries, ui.FormatSize(b.TotalSize))
+	}
+	for _, path := range created {
+		if _, err := os.Lstat(path); err == nil {
+			fmt.Printf("   Removes %s, created by the command\n", path)
+		}
+	}
+	if b.Git != nil {
+		fmt.Printf("   Uncommitted git work in %s (%s %s)\n", b.Git.Repo, gitSafetyKind(b.Git), b.Git.Ref)
+	}
+	if b.RestoredAt != nil {
+		ui.PrintWarning("This backup was already restored on " + b.RestoredAt.Format("2006-01-02 15:04:05"))
+	}
+
+	if !yes {
+		ui.PrintSimpleConfirm("Overwrite current files with the snapshot?")
+		reader := bufio.NewReader(os.Stdin)
+		input, _ := reader.ReadString('\n')
+		input = strings.TrimSpace(strings.ToLower(input))
+		if input != "y" && input != "yes" {
+			ui.PrintInfo("Undo canceled")
+			return nil
+		}
+	}
+
+	restored, restoreErr := store.Restore(b)
+	if b.Git != nil {
+		gitRestored, err := backup.RestoreGit(b.Git)
+		restored = append(restored, gitRestored...)
+		if err != nil {
+			restoreErr = errors.Join(restoreErr, fmt.Errorf("%s: %w", b.Git.Ref, err))
+		}
+	}
+	if len(restored) > 0 {
+		if err := historyStore.MarkBackupRestored(b.ID); err != nil {
+			ui.PrintWarning(fmt.Sprintf("Could not record restore: %v", err))
+		}
+		ui.PrintSuccess(fmt.Sprintf("Restored %d files", len(restored)))
+	}
+	if restoreErr != nil {
+		return fmt.Errorf("some files could not be restored:\n%w", restoreErr)
+	}
+	if len(restored) == 0 {
+		ui.PrintInfo("Nothing to restore")
+	}
+	return nil
+}
+
+// gitSafetyAsker asks how to keep the uncommitted git work a command would
+// discard. It returns backup.GitModeRef, backup.GitModeStash or "" to
+// keep nothing.
+type gitSafetyAsker func(loss *types.GitLoss) string
+
+// snapshotBeforeExec snapshots the files a command will touch and keeps the
+// uncommitted git work it discards. ask is nil when no one can be asked.
+// Returns nil when no snapshot is needed or possible; failures are reported as warnings.
+func snapshotBeforeExec(command string, analysis *types.CommandAnalysis, ask gitSafetyAsker) *types.Backup {
+	return snapshotBeforeExecIn(command, "", analysis, ask)
+}
+
+// snapshotBeforeExecIn snapshots the files a command running in workdir will touch
+// ("" for the current directory)
+func snapshotBeforeExecIn(command, workdir string, analysis *types.CommandAnalysis, ask gitSafetyAsker) *types.Backup {
+	cwd := workdir
+	if cwd == "" {
+		cwd, _ = os.Getwd()
+	}
+
+	// Keep git work first: stashing it changes the files to snapshot
+	gitRef := protectGitWork(command, analysis, ask)
+	snap := snapshotFiles(command, cwd, analysis)
+	if gitRef != nil {
+		if snap == nil {
+			snap = &types.Backup{Command: command, WorkingDir: cwd}
+		}
+		snap.Git = gitRef
+	}
+	return snap
+}
+
+// protectGitWork keeps the uncommitted git work a command discards under a
+// safety ref, as safety.git_safety_net asks. Without anyone to ask, and for
+// dropped stashes, a safety ref is created since it leaves the working tree alone.
+func protectGitWork(command string, analysis *types.CommandAnalysis, ask gitSafetyAsker) *types.GitSafetyRef {
+	if analysis == nil || analysis.GitLoss == nil || len(analysis.GitLoss.Changes) == 0 {
+		return nil
+	}
+	loss := analysis.GitLoss
+
+	mode := strings.ToLower(config.Get().Safety.GitSafetyNet)
+	if mode == "off" {
+		return nil
+	}
+	if mode == "" || mode == "ask" {
+		mode = backup.GitModeRef
+		if loss.Stash == "" && ask != nil {
+			if mode = ask(loss); mode == "" {
+				return nil
+			}
+		}
+	}
+
+	gitRef, err := backup.ProtectGit(loss, mode, command)
+	if err != nil {
+		ui.PrintWarning(fmt.Sprintf("Could not keep uncommitted changes: %v", err))
+		return nil
+	}
+	if !silent {
+		restore := "'sosomi undo' to restore"
+		if historyStore == nil {
+			restore = "history is disabled, restore it with git"
+		}
+		fmt.Println(ui.Dim(fmt.Sprintf("🛟 Uncommitted changes kept in %s - %s", gitRef.Ref, restore)))
+	}
+	return gitRef
+}
+
+// gitSafetyChoice maps an answer to the git safety prompt to a mode,
+// defaulting to a safety ref
+func gitSafetyChoice(input string) string {
+	switch strings.ToLower(strings.TrimSpace(input)) {
+	case "s", "stash":
+		return backup.GitModeStash
+	case "n", "no":
+		return ""
+	default:
+		return backup.GitModeRef
+	}
+}
+
+// gitSafetyKind describes a safety ref as a stash or a snapshot
+func gitSafetyKind(gitRef *types.GitSafetyRef) string {
+	if gitRef.Stash {
+		return "stash"
+	}
+	return "snapshot"
+}
+
+// snapshotFiles copies the files a command running in cwd will touch into
+// the backup store
+func snapshotFiles(command, cwd string, analysis *types.CommandAnalysis) *types.Backup {
+	cfg := config.Get()
+	if historyStore == nil || !cfg.History.BackupEnabled || !backup.ShouldSnapshot(analysis) {
+		return nil
+	}
+
+	store, err := backup.NewStore(cfg.History.BackupDir)
+	if err != nil {
+		ui.PrintWarning(fmt.Sprintf("Backup unavailable: %v", err))
+		return nil
+	}
+
+	maxBytes := int64(cfg.History.BackupMaxMB) * 1024 * 1024
+	snap, err := store.Snapshot(command, cwd, backup.SnapshotPaths(analysis), maxBytes)
+	if err != nil {
+		if errors.Is(err, backup.ErrTooLarge) {
+			ui.PrintWarning("Skipping backup: affected files exceed history.backup_max_mb")
+		} else {
+			ui.PrintWarning(fmt.Sprintf("Backup failed: %v", err))
+		}
+		return nil
+	}
+	if len(snap.Files) == 0 {
+		return nil
+	}
+
+	if !silent {
+		fmt.Println(ui.Dim(fmt.Sprintf("💾 Snapshot saved (%d files, %s) - 'sosomi undo' to restore",
+			len(snap.Files), ui.FormatSize(snap.TotalSize))))
+	}
+	return snap
+}
+
+// recordBackup links a snapshot to its history entry
+func recordBackup(commandID string, snap *types.Backup) {
+	if snap == nil || historyStore == nil {
+		return
+	}
+	snap.CommandID = commandID
+	if err := historyStore.AddBackup(snap); err != nil {
+		ui.PrintWarning(fmt.Sprintf("Could not record backup: %v", err))
+	}
+}
+
+// shortID returns the first 8 characters of an ID
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
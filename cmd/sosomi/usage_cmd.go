@@ -0,0 +1,236 @@
+// Usage command and budget enforcement for sosomi CLI
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sonemaro/sosomi/internal/ai"
+	"github.com/sonemaro/sosomi/internal/config"
+	"github.com/sonemaro/sosomi/internal/ui"
+	"github.com/sonemaro/sosomi/internal/usage"
+)
+
+// usageMeter records requests in the usage ledger and enforces the budget
+type usageMeter struct {
+	ledger  *usage.Ledger
+	pricing *usage.Pricing
+	budget  usage.Budget
+	profile string
+
+	mu       sync.Mutex
+	warned   bool
+	unpriced map[string]bool // models warned about having no price
+}
+
+func newUsageMeter(cfg *config.Config, ledger *usage.Ledger) *usageMeter {
+	return &usageMeter{
+		ledger:  ledger,
+		pricing: newPricing(cfg),
+		budget:  newBudget(cfg),
+		profile: config.GetActiveProfile(),
+	}
+}
+
+func newPricing(cfg *config.Config) *usage.Pricing {
+	overrides := make(map[string]usage.Price, len(cfg.Usage.Pricing))
+	for model, price := range cfg.Usage.Pricing {
+		overrides[model] = usage.Price{Input: price.Input, Output: price.Output}
+	}
+	return usage.NewPricing(overrides)
+}
+
+func newBudget(cfg *config.Config) usage.Budget {
+	b := cfg.Usage.Budget
+	return usage.Budget{
+		DailySoft:   b.DailySoft,
+		DailyHard:   b.DailyHard,
+		MonthlySoft: b.MonthlySoft,
+		MonthlyHard: b.MonthlyHard,
+	}
+}
+
+// Allow refuses requests once a hard budget is used up and warns once per
+// run when a soft budget is. Warnings go to stderr so that they never mix
+// with command output or an MCP stdio stream.
+func (m *usageMeter) Allow(mode ai.Mode) error {
+	if !m.budget.Enabled() {
+		return nil
+	}
+	spent, err := usage.CurrentSpending(m.ledger, time.Now())
+	if err != nil {
+		// Accounting problems should not keep the user from working
+		return nil
+	}
+	warning, err := m.budget.Check(spent)
+	if err != nil {
+		return fmt.Errorf("%w (see 'sosomi usage', or raise usage.budget in the config)", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if warning != "" && !m.warned {
+		m.warned = true
+		fmt.Fprintf(os.Stderr, "%s %s\n", ui.Warning("⚠ Budget:"), warning)
+	}
+	return nil
+}
+
+// Limited reports whether a hard budget is set
+func (m *usageMeter) Limited() bool {
+	return m.budget.DailyHard > 0 || m.budget.MonthlyHard > 0
+}
+
+// Record adds a request to the ledger, warning once per run about each
+// model without a price since its cost is recorded as zero
+func (m *usageMeter) Record(provider, model string, mode ai.Mode, u ai.TokenUsage) {
+	price, known := m.pricing.Lookup(provider, model)
+	if !known {
+		m.warnUnpriced(provider, model)
+	}
+
+	err := m.ledger.Add(usage.Entry{
+		Provider:         provider,
+		Model:            model,
+		Profile:          m.profile,
+		Mode:             string(mode),
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		Cost:             price.Cost(u.PromptTokens, u.CompletionTokens),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not record usage: %v\n", err)
+	}
+}
+
+func (m *usageMeter) warnUnpriced(provider, model string) {
+	key := provider + "/" + model
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.unpriced[key] {
+		return
+	}
+	if m.unpriced == nil {
+		m.unpriced = make(map[string]bool)
+	}
+	m.unpriced[key] = true
+	fmt.Fprintf(os.Stderr, "%s no price known for %s, its cost is recorded as $0 (add it to usage.pricing)\n",
+		ui.Warning("⚠ Usage:"), key)
+}
+
+// usageCmd returns the usage subcommand
+func usageCmd() *cobra.Command {
+	var by string
+	var days int
+
+	cmd := &cobra.Command{
+		Use:   "usage",
+		Short: "Show token usage, cost and budgets",
+		Long: `Show the tokens used and what they cost, broken down by day, model,
+profile or mode (command, chat, title).
+
+Costs come from built-in list prices, which usage.pricing in the config
+overrides. Local providers are free.
+
+Examples:
+  sosomi usage
+  sosomi usage --by model --days 7
+  sosomi usage --by profile`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if usageLedger == nil {
+				return fmt.Errorf("usage ledger is not available")
+			}
+			if days < 1 {
+				return fmt.Errorf("--days must be at least 1")
+			}
+
+			since := time.Now().AddDate(0, 0, -(days - 1))
+			rows, err := usageLedger.Report(since, by)
+			if err != nil {
+				return err
+			}
+
+			printUsageReport(rows, by, days)
+			return printBudgetStatus(config.Get())
+		},
+	}
+
+	cmd.Flags().StringVar(&by, "by", "day", "Group by "+strings.Join(usage.Groupings, ", "))
+	cmd.Flags().IntVar(&days, "days", 30, "Number of days to report, including today")
+
+	return cmd
+}
+
+// printUsageReport prints a usage table with totals
+func printUsageReport(rows []usage.Row, by string, days int) {
+	fmt.Printf("%s (last %d days, by %s)\n\n", ui.Bold("Usage"), days, by)
+	if len(rows) == 0 {
+		fmt.Println(ui.Dim("  No usage recorded"))
+		fmt.Println()
+		return
+	}
+
+	fmt.Printf("  %-32s %8s %12s %12s %10s\n", strings.ToUpper(by), "REQUESTS", "PROMPT", "COMPLETION", "COST")
+	var total usage.Row
+	for _, row := range rows {
+		fmt.Printf("  %-32s %8d %12d %12d %10s\n",
+			truncate(row.Key, 32), row.Requests, row.PromptTokens, row.CompletionTokens, formatCost(row.Cost))
+		total.Requests += row.Requests
+		total.PromptTokens += row.PromptTokens
+		total.CompletionTokens += row.CompletionTokens
+		total.Cost += row.Cost
+	}
+	fmt.Printf("  %-32s %8d %12d %12d %10s\n\n",
+		"Total", total.Requests, total.PromptTokens, total.CompletionTokens, formatCost(total.Cost))
+}
+
+// printBudgetStatus prints spending against the configured budgets
+func printBudgetStatus(cfg *config.Config) error {
+	budget := newBudget(cfg)
+	if !budget.Enabled() {
+		fmt.Println(ui.Dim("No budget set (usage.budget in the config)"))
+		return nil
+	}
+
+	spent, err := usage.CurrentSpending(usageLedger, time.Now())
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(ui.Bold("Budget"))
+	fmt.Printf("  Today:      %s%s\n", formatCost(spent.Today), formatLimits(budget.DailySoft, budget.DailyHard))
+	fmt.Printf("  This month: %s%s\n", formatCost(spent.ThisMonth), formatLimits(budget.MonthlySoft, budget.MonthlyHard))
+
+	if warning, err := budget.Check(spent); err != nil {
+		fmt.Println(ui.Error("  ⛔ " + err.Error()))
+	} else if warning != "" {
+		fmt.Println(ui.Warning("  ⚠ " + warning))
+	}
+	return nil
+}
+
+func formatLimits(soft, hard float64) string {
+	var limits []string
+	if soft > 0 {
+		limits = append(limits, "soft "+formatCost(soft))
+	}
+	if hard > 0 {
+		limits = append(limits, "hard "+formatCost(hard))
+	}
+	if len(limits) == 0 {
+		return ""
+	}
+	return " of " + strings.Join(limits, ", ")
+}
+
+func formatCost(cost float64) string {
+	if cost > 0 && cost < 0.01 {
+		return fmt.Sprintf("$%.4f", cost)
+	}
+	return fmt.Sprintf("$%.2f", cost)
+}
@@ -0,0 +1,568 @@
+// Package ai provides Anthropic Messages API provider implementation
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// anthropicVersion is the Messages API version sent with every request
+const anthropicVersion = "2023-06-01"
+
+// AnthropicProvider implements the Provider interface for the Anthropic Messages API
+type AnthropicProvider struct {
+	endpoint string
+	apiKey   string
+	model    string
+	client   *http.Client
+	options  ModeOptions
+}
+
+// AnthropicRequest represents a Messages API request
+type AnthropicRequest struct {
+	Model         string             `json:"model"`
+	System        string             `json:"system,omitempty"`
+	Messages      []AnthropicMessage `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          float64            `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+	Tools         []AnthropicTool    `json:"tools,omitempty"`
+}
+
+// AnthropicMessage represents a message in Anthropic format. System prompts
+// are not messages; they go in AnthropicRequest.System.
+type AnthropicMessage struct {
+	Role    string                  `json:"role"`
+	Content []AnthropicContentBlock `json:"content"`
+}
+
+// AnthropicContentBlock is a text, tool_use or tool_result content block
+type AnthropicContentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+	IsError   bool   `json:"is_error,omitempty"`
+}
+
+// AnthropicTool represents a tool definition
+type AnthropicTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+// AnthropicUsage reports token usage
+type AnthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+func (u AnthropicUsage) tokenUsage() TokenUsage {
+	return TokenUsage{
+		PromptTokens:     u.InputTokens,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      u.InputTokens + u.OutputTokens,
+	}
+}
+
+// AnthropicResponse represents a Messages API response
+type AnthropicResponse struct {
+	ID         string                  `json:"id"`
+	Model      string                  `json:"model"`
+	Content    []AnthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      AnthropicUsage          `json:"usage"`
+}
+
+// AnthropicStreamEvent is a server-sent event of a streamed response
+type AnthropicStreamEvent struct {
+	Type    string             `json:"type"`
+	Message *AnthropicResponse `json:"message,omitempty"` // message_start
+	Delta   *struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta,omitempty"` // content_block_delta
+	Usage *AnthropicUsage `json:"usage,omitempty"` // message_delta
+	Error *AnthropicError `json:"error,omitempty"` // error
+}
+
+// AnthropicError is the error object returned by the API
+type AnthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// AnthropicModelsResponse represents a page of the models list
+type AnthropicModelsResponse struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+	HasMore bool   `json:"has_more"`
+	LastID  string `json:"last_id"`
+}
+
+// NewAnthropicProvider creates a new Anthropic provider
+func NewAnthropicProvider(apiKey, endpoint, model string) (*AnthropicProvider, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("Anthropic API key is required")
+	}
+
+	// The default config carries the OpenAI endpoint, which is left behind
+	// when only provider.name is switched
+	if endpoint == "" || endpoint == "https://api.openai.com/v1" {
+		endpoint = "https://api.anthropic.com"
+	}
+	// Accept the endpoint with or without the /v1 suffix
+	endpoint = strings.TrimSuffix(strings.TrimSuffix(endpoint, "/"), "/v1")
+
+	if model == "" {
+		model = "claude-sonnet-4-5"
+	}
+
+	return &AnthropicProvider{
+		endpoint: endpoint,
+		apiKey:   apiKey,
+		model:    model,
+		client:   newHTTPClient(),
+		options:  DefaultModeOptions(),
+	}, nil
+}
+
+func (p *AnthropicProvider) Name() string {
+	return "anthropic"
+}
+
+func (p *AnthropicProvider) Model() string {
+	return p.model
+}
+
+func (p *AnthropicProvider) SetOptions(options ModeOptions) {
+	p.options = options
+}
+
+func (p *AnthropicProvider) GenerateCommand(ctx context.Context, prompt string, sysCtx types.SystemContext) (*types.CommandResponse, error) {
+	resp, err := p.messages(ctx, anthropicRequest(AnthropicRequest{
+		Model:    p.model,
+		System:   SystemPrompt + "\n\n" + BuildSystemContext(sysCtx),
+		Messages: []AnthropicMessage{anthropicText("user", prompt)},
+	}, p.options.forRequest(ctx, ModeCommand)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate command: %w", err)
+	}
+
+	response, err := parseCommandResponse(anthropicResponseText(resp.Content))
+	if err != nil {
+		return nil, err
+	}
+	response.Usage = resp.Usage.tokenUsage()
+	return response, nil
+}
+
+func (p *AnthropicProvider) RefineCommand(ctx context.Context, req RefineRequest, sysCtx types.SystemContext) (*types.CommandResponse, error) {
+	// Build the user message with all context
+	var userMessage strings.Builder
+	userMessage.WriteString("ORIGINAL REQUEST: " + req.OriginalPrompt + "\n\n")
+	userMessage.WriteString("GENERATED COMMAND: " + req.GeneratedCmd + "\n\n")
+
+	if req.WasExecuted {
+		userMessage.WriteString("COMMAND WAS EXECUTED\n")
+		userMessage.WriteString(fmt.Sprintf("EXIT CODE: %d\n", req.ExitCode))
+		if req.CommandOutput != "" {
+			// Truncate output if too long
+			output := req.CommandOutput
+			if len(output) > 1000 {
+				output = output[:1000] + "\n... (output truncated)"
+			}
+			userMessage.WriteString("OUTPUT:\n" + output + "\n\n")
+		}
+		if req.CommandError != "" {
+			userMessage.WriteString("ERROR OUTPUT:\n" + req.CommandError + "\n\n")
+		}
+	} else {
+		userMessage.WriteString("COMMAND WAS NOT EXECUTED\n\n")
+	}
+
+	userMessage.WriteString("USER FEEDBACK: " + req.Feedback)
+
+	resp, err := p.messages(ctx, anthropicRequest(AnthropicRequest{
+		Model:    p.model,
+		System:   RefinePrompt + "\n\n" + BuildSystemContext(sysCtx),
+		Messages: []AnthropicMessage{anthropicText("user", userMessage.String())},
+	}, p.options.forRequest(ctx, ModeCommand)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to refine command: %w", err)
+	}
+
+	response, err := parseCommandResponse(anthropicResponseText(resp.Content))
+	if err != nil {
+		return nil, err
+	}
+	response.Usage = resp.Usage.tokenUsage()
+	return response, nil
+}
+
+func (p *AnthropicProvider) GenerateCommandStream(ctx context.Context, prompt string, sysCtx types.SystemContext) (<-chan StreamChunk, error) {
+	return p.stream(ctx, anthropicRequest(AnthropicRequest{
+		Model:    p.model,
+		System:   SystemPrompt + "\n\n" + BuildSystemContext(sysCtx),
+		Messages: []AnthropicMessage{anthropicText("user", prompt)},
+		Stream:   true,
+	}, p.options.forRequest(ctx, ModeCommand)))
+}
+
+func (p *AnthropicProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+	resp, err := p.ChatWithUsage(ctx, messages)
+	if err != nil {
+		return "", err
+	}
+	return resp.Content, nil
+}
+
+// ChatWithUsage sends a chat message and returns the response with token usage
+func (p *AnthropicProvider) ChatWithUsage(ctx context.Context, messages []Message) (*ChatResponse, error) {
+	return p.chat(ctx, messages, nil)
+}
+
+// chat sends a non-streaming Messages request, optionally with tools
+func (p *AnthropicProvider) chat(ctx context.Context, messages []Message, tools []types.MCPTool) (*ChatResponse, error) {
+	names := newToolNames(tools)
+	system, anthropicMessages := toAnthropicMessages(messages, names)
+
+	resp, err := p.messages(ctx, anthropicRequest(AnthropicRequest{
+		Model:    p.model,
+		System:   system,
+		Messages: anthropicMessages,
+		Tools:    toAnthropicTools(tools, names),
+	}, p.options.forRequest(ctx, ModeChat)))
+	if err != nil {
+		return nil, fmt.Errorf("chat failed: %w", err)
+	}
+
+	return &ChatResponse{
+		Content:   anthropicResponseText(resp.Content),
+		ToolCalls: fromAnthropicToolUses(resp.Content, names),
+		Usage: TokenUsage{
+			PromptTokens:     resp.Usage.InputTokens,
+			CompletionTokens: resp.Usage.OutputTokens,
+			TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
+		},
+	}, nil
+}
+
+func (p *AnthropicProvider) ChatStream(ctx context.Context, messages []Message) (<-chan StreamChunk, error) {
+	system, anthropicMessages := toAnthropicMessages(messages, newToolNames(nil))
+
+	return p.stream(ctx, anthropicRequest(AnthropicRequest{
+		Model:    p.model,
+		System:   system,
+		Messages: anthropicMessages,
+		Stream:   true,
+	}, p.options.forRequest(ctx, ModeChat)))
+}
+
+func (p *AnthropicProvider) ListModels(ctx context.Context) ([]string, error) {
+	var models []string
+	afterID := ""
+	for {
+		query := url.Values{"limit": {"100"}}
+		if afterID != "" {
+			query.Set("after_id", afterID)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", p.endpoint+"/v1/models?"+query.Encode(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		p.setHeaders(req)
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send request: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			err := anthropicAPIError(resp)
+			resp.Body.Close()
+			return nil, err
+		}
+
+		var page AnthropicModelsResponse
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+
+		for _, model := range page.Data {
+			models = append(models, model.ID)
+		}
+		if !page.HasMore || page.LastID == "" {
+			return models, nil
+		}
+		afterID = page.LastID
+	}
+}
+
+func (p *AnthropicProvider) SupportsTools() bool {
+	return true
+}
+
+func (p *AnthropicProvider) ChatWithTools(ctx context.Context, messages []Message, tools []types.MCPTool) (*ChatResponse, error) {
+	return p.chat(ctx, messages, tools)
+}
+
+// setHeaders adds authentication and versioning headers to a request
+func (p *AnthropicProvider) setHeaders(req *http.Request) {
+	req.Header.Set("x-api-key", p.apiKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+}
+
+// send POSTs a request to /v1/messages, returning the response on HTTP 200
+func (p *AnthropicProvider) send(ctx context.Context, reqBody AnthropicRequest) (*http.Response, error) {
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.endpoint+"/v1/messages", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	p.setHeaders(req)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, anthropicAPIError(resp)
+	}
+	return resp, nil
+}
+
+// messages sends a non-streaming request and decodes the response
+func (p *AnthropicProvider) messages(ctx context.Context, reqBody AnthropicRequest) (*AnthropicResponse, error) {
+	resp, err := p.send(ctx, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var anthropicResp AnthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&anthropicResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &anthropicResp, nil
+}
+
+// stream sends a streaming request and forwards text deltas as chunks. Input
+// tokens arrive with message_start and output tokens with message_delta; both
+// are reported on the final chunk.
+func (p *AnthropicProvider) stream(ctx context.Context, reqBody AnthropicRequest) (<-chan StreamChunk, error) {
+	resp, err := p.send(ctx, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stream: %w", err)
+	}
+
+	ch := make(chan StreamChunk)
+	go func() {
+		defer close(ch)
+		defer resp.Body.Close()
+
+		var usage TokenUsage
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+		for scanner.Scan() {
+			// Every data payload carries its event type, so event: lines can be skipped
+			data, ok := strings.CutPrefix(scanner.Text(), "data:")
+			if !ok {
+				continue
+			}
+
+			var event AnthropicStreamEvent
+			if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &event); err != nil {
+				ch <- StreamChunk{Error: fmt.Errorf("invalid stream event: %w", err)}
+				return
+			}
+
+			switch event.Type {
+			case "message_start":
+				if event.Message != nil {
+					usage.PromptTokens = event.Message.Usage.InputTokens
+				}
+			case "content_block_delta":
+				if event.Delta != nil && event.Delta.Type == "text_delta" {
+					ch <- StreamChunk{Content: event.Delta.Text}
+				}
+			case "message_delta":
+				if event.Usage != nil {
+					usage.CompletionTokens = event.Usage.OutputTokens
+				}
+			case "message_stop":
+				usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+				ch <- StreamChunk{Done: true, Usage: &usage}
+				return
+			case "error":
+				if event.Error != nil {
+					ch <- StreamChunk{Error: fmt.Errorf("anthropic API error: %s - %s", event.Error.Type, event.Error.Message)}
+				} else {
+					ch <- StreamChunk{Error: fmt.Errorf("anthropic API error")}
+				}
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			ch <- StreamChunk{Error: err}
+			return
+		}
+		ch <- StreamChunk{Error: fmt.Errorf("stream ended before message_stop")}
+	}()
+
+	return ch, nil
+}
+
+// anthropicAPIError builds an error from a non-200 response, preferring the
+// message from the API's error object
+func anthropicAPIError(resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+
+	var errResp struct {
+		Error AnthropicError `json:"error"`
+	}
+	if json.Unmarshal(body, &errResp) == nil && errResp.Error.Message != "" {
+		return fmt.Errorf("anthropic API error: %s - %s", resp.Status, errResp.Error.Message)
+	}
+	return fmt.Errorf("anthropic API error: %s - %s", resp.Status, string(body))
+}
+
+// anthropicText returns a message with a single text block
+func anthropicText(role, text string) AnthropicMessage {
+	return AnthropicMessage{
+		Role:    role,
+		Content: []AnthropicContentBlock{{Type: "text", Text: text}},
+	}
+}
+
+// toAnthropicMessages converts messages to Anthropic format. System messages
+// are joined into the top-level system prompt, tool results become
+// tool_result blocks in a user message, and consecutive messages of the same
+// role are merged since the API expects roles to alternate.
+func toAnthropicMessages(messages []Message, names *toolNames) (string, []AnthropicMessage) {
+	var system []string
+	var result []AnthropicMessage
+
+	for _, msg := range messages {
+		role := msg.Role
+		var blocks []AnthropicContentBlock
+
+		switch msg.Role {
+		case "system":
+			system = append(system, msg.Content)
+			continue
+		case "tool":
+			role = "user"
+			blocks = append(blocks, AnthropicContentBlock{
+				Type:      "tool_result",
+				ToolUseID: msg.ToolCallID,
+				Content:   msg.Content,
+				IsError:   msg.IsError,
+			})
+		default:
+			// The API rejects empty text blocks
+			if msg.Content != "" {
+				blocks = append(blocks, AnthropicContentBlock{Type: "text", Text: msg.Content})
+			}
+			for _, call := range msg.ToolCalls {
+				input := call.argumentsJSON()
+				if !json.Valid([]byte(input)) {
+					input = "{}"
+				}
+				blocks = append(blocks, AnthropicContentBlock{
+					Type:  "tool_use",
+					ID:    call.ID,
+					Name:  names.api(call.Name),
+					Input: json.RawMessage(input),
+				})
+			}
+		}
+
+		if len(blocks) == 0 {
+			continue
+		}
+		if n := len(result); n > 0 && result[n-1].Role == role {
+			result[n-1].Content = append(result[n-1].Content, blocks...)
+			continue
+		}
+		result = append(result, AnthropicMessage{Role: role, Content: blocks})
+	}
+
+	return strings.Join(system, "\n\n"), result
+}
+
+// toAnthropicTools converts MCP tools to Anthropic tool definitions
+func toAnthropicTools(tools []types.MCPTool, names *toolNames) []AnthropicTool {
+	if len(tools) == 0 {
+		return nil
+	}
+	result := make([]AnthropicTool, len(tools))
+	for i, tool := range tools {
+		result[i] = AnthropicTool{
+			Name:        names.api(tool.Name),
+			Description: tool.Description,
+			InputSchema: toolParameters(tool),
+		}
+	}
+	return result
+}
+
+// anthropicResponseText joins the text blocks of a response
+func anthropicResponseText(blocks []AnthropicContentBlock) string {
+	var text strings.Builder
+	for _, block := range blocks {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	return text.String()
+}
+
+// fromAnthropicToolUses converts the tool_use blocks of a response to ToolCalls
+func fromAnthropicToolUses(blocks []AnthropicContentBlock, names *toolNames) []ToolCall {
+	var result []ToolCall
+	for _, block := range blocks {
+		if block.Type != "tool_use" {
+			continue
+		}
+		raw := string(block.Input)
+		result = append(result, ToolCall{
+			ID:           block.ID,
+			Name:         names.original(block.Name),
+			Arguments:    parseToolArguments(raw),
+			RawArguments: raw,
+		})
+	}
+	return result
+}
@@ -0,0 +1,314 @@
+// Package ai Anthropic provider tests
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// newAnthropicTestServer fakes the Messages API, checking the auth headers and
+// passing every decoded request to handle
+func newAnthropicTestServer(t *testing.T, handle func(w http.ResponseWriter, req AnthropicRequest)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "test-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`))
+			return
+		}
+		if r.Header.Get("anthropic-version") != anthropicVersion {
+			t.Errorf("Expected anthropic-version %s, got %q", anthropicVersion, r.Header.Get("anthropic-version"))
+		}
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("Expected /v1/messages, got %s", r.URL.Path)
+		}
+
+		var req AnthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Invalid request: %v", err)
+		}
+		handle(w, req)
+	}))
+}
+
+func writeAnthropicResponse(w http.ResponseWriter, resp AnthropicResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestNewAnthropicProvider(t *testing.T) {
+	provider, err := NewAnthropicProvider("test-key", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	if provider.Name() != "anthropic" {
+		t.Errorf("Expected name 'anthropic', got '%s'", provider.Name())
+	}
+	if provider.endpoint != "https://api.anthropic.com" {
+		t.Errorf("Expected default endpoint, got '%s'", provider.endpoint)
+	}
+	if provider.model != "claude-sonnet-4-5" {
+		t.Errorf("Expected default model, got '%s'", provider.model)
+	}
+	if !provider.SupportsTools() {
+		t.Error("Expected Anthropic provider to support tools")
+	}
+
+	for _, endpoint := range []string{"http://proxy:8080/v1/", "http://proxy:8080/"} {
+		provider, _ := NewAnthropicProvider("test-key", endpoint, "")
+		if provider.endpoint != "http://proxy:8080" {
+			t.Errorf("Expected %s to be normalized, got '%s'", endpoint, provider.endpoint)
+		}
+	}
+
+	// The OpenAI endpoint left over from the default config is ignored
+	provider, _ = NewAnthropicProvider("test-key", "https://api.openai.com/v1", "")
+	if provider.endpoint != "https://api.anthropic.com" {
+		t.Errorf("Expected OpenAI endpoint to be replaced, got '%s'", provider.endpoint)
+	}
+}
+
+func TestAnthropicProvider_GenerateCommand_WithMock(t *testing.T) {
+	server := newAnthropicTestServer(t, func(w http.ResponseWriter, req AnthropicRequest) {
+		if !strings.Contains(req.System, "SYSTEM CONTEXT") {
+			t.Errorf("Expected system prompt at the top level, got %q", req.System)
+		}
+		if len(req.Messages) != 1 || req.Messages[0].Role != "user" {
+			t.Errorf("Expected a single user message, got %+v", req.Messages)
+		}
+		if req.MaxTokens == 0 {
+			t.Error("Expected max_tokens to be set")
+		}
+		writeAnthropicResponse(w, AnthropicResponse{
+			Content: []AnthropicContentBlock{{
+				Type: "text",
+				Text: `{"command": "ls -la", "explanation": "List files", "risk_level": "safe", "confidence": 0.9}`,
+			}},
+			StopReason: "end_turn",
+		})
+	})
+	defer server.Close()
+
+	provider, _ := NewAnthropicProvider("test-key", server.URL, "claude-test")
+	resp, err := provider.GenerateCommand(context.Background(), "list files", types.SystemContext{OS: "linux"})
+	if err != nil {
+		t.Fatalf("GenerateCommand failed: %v", err)
+	}
+	if resp.Command != "ls -la" || resp.RiskLevel != types.RiskSafe {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+}
+
+func TestAnthropicProvider_APIError(t *testing.T) {
+	server := newAnthropicTestServer(t, func(w http.ResponseWriter, req AnthropicRequest) {})
+	defer server.Close()
+
+	provider, _ := NewAnthropicProvider("wrong-key", server.URL, "")
+	_, err := provider.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}})
+	if err == nil || !strings.Contains(err.Error(), "invalid x-api-key") {
+		t.Errorf("Expected API error message, got %v", err)
+	}
+}
+
+func TestAnthropicProvider_ChatStream(t *testing.T) {
+	server := newAnthropicTestServer(t, func(w http.ResponseWriter, req AnthropicRequest) {
+		if !req.Stream {
+			t.Error("Expected stream to be requested")
+		}
+		if req.System != "Be brief" {
+			t.Errorf("Expected system message moved to the top level, got %q", req.System)
+		}
+		if len(req.Messages) != 1 {
+			t.Errorf("Expected system message removed from messages, got %+v", req.Messages)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			`{"type":"message_start","message":{"id":"msg_1","content":[],"usage":{"input_tokens":12,"output_tokens":1}}}`,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			`{"type":"ping"}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" world"}}`,
+			`{"type":"content_block_stop","index":0}`,
+			`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":5}}`,
+			`{"type":"message_stop"}`,
+		}
+		for _, event := range events {
+			var typed struct{ Type string }
+			json.Unmarshal([]byte(event), &typed)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typed.Type, event)
+		}
+	})
+	defer server.Close()
+
+	provider, _ := NewAnthropicProvider("test-key", server.URL, "")
+	ch, err := provider.ChatStream(context.Background(), []Message{
+		{Role: "system", Content: "Be brief"},
+		{Role: "user", Content: "Say hello"},
+	})
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+
+	var content string
+	var usage *TokenUsage
+	for chunk := range ch {
+		if chunk.Error != nil {
+			t.Fatalf("Stream error: %v", chunk.Error)
+		}
+		content += chunk.Content
+		if chunk.Done {
+			usage = chunk.Usage
+		}
+	}
+
+	if content != "Hello world" {
+		t.Errorf("Expected streamed text, got %q", content)
+	}
+	if usage == nil || usage.PromptTokens != 12 || usage.CompletionTokens != 5 || usage.TotalTokens != 17 {
+		t.Errorf("Expected usage on the final chunk, got %+v", usage)
+	}
+}
+
+func TestAnthropicProvider_StreamError(t *testing.T) {
+	server := newAnthropicTestServer(t, func(w http.ResponseWriter, req AnthropicRequest) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: error\ndata: %s\n\n", `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)
+	})
+	defer server.Close()
+
+	provider, _ := NewAnthropicProvider("test-key", server.URL, "")
+	ch, err := provider.GenerateCommandStream(context.Background(), "list files", types.SystemContext{})
+	if err != nil {
+		t.Fatalf("GenerateCommandStream failed: %v", err)
+	}
+
+	var streamErr error
+	for chunk := range ch {
+		if chunk.Error != nil {
+			streamErr = chunk.Error
+		}
+	}
+	if streamErr == nil || !strings.Contains(streamErr.Error(), "Overloaded") {
+		t.Errorf("Expected overloaded error, got %v", streamErr)
+	}
+}
+
+func TestAnthropicProvider_ChatWithTools(t *testing.T) {
+	tools := []types.MCPTool{{
+		Name:        "git.status",
+		Description: "Show git status",
+		InputSchema: map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"path": map[string]interface{}{"type": "string"}},
+		},
+	}}
+
+	var received AnthropicRequest
+	server := newAnthropicTestServer(t, func(w http.ResponseWriter, req AnthropicRequest) {
+		received = req
+		writeAnthropicResponse(w, AnthropicResponse{
+			Content: []AnthropicContentBlock{
+				{Type: "text", Text: "Checking."},
+				{Type: "tool_use", ID: "toolu_2", Name: "git__status", Input: json.RawMessage(`{"path":"src"}`)},
+			},
+			StopReason: "tool_use",
+			Usage:      AnthropicUsage{InputTokens: 30, OutputTokens: 8},
+		})
+	})
+	defer server.Close()
+
+	provider, _ := NewAnthropicProvider("test-key", server.URL, "")
+	resp, err := provider.ChatWithTools(context.Background(), []Message{
+		{Role: "system", Content: "You are helpful"},
+		{Role: "user", Content: "What changed?"},
+		{Role: "assistant", ToolCalls: []ToolCall{
+			{ID: "toolu_1", Name: "git.status", Arguments: map[string]interface{}{"path": "."}},
+			{ID: "toolu_3", Name: "git.status", RawArguments: "not json"},
+		}},
+		{Role: "tool", ToolCallID: "toolu_1", ToolName: "git.status", Content: "clean"},
+		{Role: "tool", ToolCallID: "toolu_3", ToolName: "git.status", Content: "bad arguments", IsError: true},
+		{Role: "user", Content: "And in src?"},
+	}, tools)
+	if err != nil {
+		t.Fatalf("ChatWithTools failed: %v", err)
+	}
+
+	// Request: tools renamed, tool calls as tool_use, results merged into one user turn
+	if len(received.Tools) != 1 || received.Tools[0].Name != "git__status" || received.Tools[0].InputSchema["type"] != "object" {
+		t.Errorf("Unexpected tools: %+v", received.Tools)
+	}
+	if len(received.Messages) != 3 {
+		t.Fatalf("Expected user/assistant/user turns, got %+v", received.Messages)
+	}
+	assistant := received.Messages[1]
+	if assistant.Role != "assistant" || len(assistant.Content) != 2 {
+		t.Fatalf("Expected assistant turn with two tool_use blocks, got %+v", assistant)
+	}
+	if block := assistant.Content[0]; block.Type != "tool_use" || block.Name != "git__status" || string(block.Input) != `{"path":"."}` {
+		t.Errorf("Unexpected tool_use block: %+v", block)
+	}
+	if string(assistant.Content[1].Input) != "{}" {
+		t.Errorf("Expected invalid arguments replaced by {}, got %s", assistant.Content[1].Input)
+	}
+	results := received.Messages[2]
+	if results.Role != "user" || len(results.Content) != 3 {
+		t.Fatalf("Expected tool results and the next question in one user turn, got %+v", results)
+	}
+	if block := results.Content[0]; block.Type != "tool_result" || block.ToolUseID != "toolu_1" || block.Content != "clean" || block.IsError {
+		t.Errorf("Unexpected tool_result block: %+v", block)
+	}
+	if block := results.Content[1]; block.ToolUseID != "toolu_3" || !block.IsError {
+		t.Errorf("Expected the failed call's tool_result to set is_error, got %+v", block)
+	}
+	if block := results.Content[2]; block.Type != "text" || block.Text != "And in src?" {
+		t.Errorf("Unexpected text block: %+v", block)
+	}
+
+	// Response: tool_use mapped back to the MCP tool name
+	if resp.Content != "Checking." {
+		t.Errorf("Expected text content, got %q", resp.Content)
+	}
+	if len(resp.ToolCalls) != 1 {
+		t.Fatalf("Expected one tool call, got %+v", resp.ToolCalls)
+	}
+	call := resp.ToolCalls[0]
+	if call.ID != "toolu_2" || call.Name != "git.status" || call.Arguments["path"] != "src" {
+		t.Errorf("Unexpected tool call: %+v", call)
+	}
+	if resp.Usage.TotalTokens != 38 {
+		t.Errorf("Expected usage total 38, got %d", resp.Usage.TotalTokens)
+	}
+}
+
+func TestAnthropicProvider_ListModels_WithMock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" || r.Header.Get("x-api-key") != "test-key" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("after_id") == "" {
+			w.Write([]byte(`{"data":[{"id":"claude-sonnet-4-5"},{"id":"claude-opus-4-1"}],"has_more":true,"last_id":"claude-opus-4-1"}`))
+			return
+		}
+		w.Write([]byte(`{"data":[{"id":"claude-haiku-4-5"}],"has_more":false,"last_id":"claude-haiku-4-5"}`))
+	}))
+	defer server.Close()
+
+	provider, _ := NewAnthropicProvider("test-key", server.URL, "")
+	models, err := provider.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels failed: %v", err)
+	}
+	want := []string{"claude-sonnet-4-5", "claude-opus-4-1", "claude-haiku-4-5"}
+	if strings.Join(models, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected %v across pages, got %v", want, models)
+	}
+}
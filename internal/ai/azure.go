@@ -0,0 +1,155 @@
+// Package ai provides Azure OpenAI provider implementation
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// DefaultAzureAPIVersion is the api-version used when none is configured
+const DefaultAzureAPIVersion = "2024-10-21"
+
+// azureDeploymentsAPIVersion is the last api-version serving the data plane
+// deployments list, which newer versions moved to the management API
+const azureDeploymentsAPIVersion = "2022-12-01"
+
+// Azure authentication types
+const (
+	AzureAuthAPIKey = "api_key" // api-key header
+	AzureAuthEntra  = "entra"   // Microsoft Entra ID bearer token
+)
+
+// AzureConfig holds the settings for an Azure OpenAI resource
+type AzureConfig struct {
+	Endpoint   string // Resource endpoint, e.g. https://myres.openai.azure.com
+	Deployment string // Deployment that requests are routed to
+	Model      string // Model the deployment serves, reported for usage and pricing; defaults to Deployment
+	APIVersion string // api-version query parameter
+	APIKey     string // API key, or an Entra access token when AuthType is entra
+	AuthType   string // api_key (default) or entra
+
+	// TokenSource fetches new Entra tokens when APIKey and the tokens
+	// after it expire. Without one the token is used until it is rejected.
+	TokenSource TokenSource
+}
+
+// AzureOpenAIProvider implements the Provider interface for Azure OpenAI.
+// Requests go through go-openai's Azure client, so everything but the
+// provider name and model listing is shared with OpenAIProvider.
+type AzureOpenAIProvider struct {
+	*OpenAIProvider
+	cfg    AzureConfig
+	client *http.Client
+}
+
+// azureDeploymentsResponse represents the response from listing deployments
+type azureDeploymentsResponse struct {
+	Data []struct {
+		ID    string `json:"id"`
+		Model string `json:"model"`
+	} `json:"data"`
+}
+
+// NewAzureOpenAIProvider creates a new Azure OpenAI provider
+func NewAzureOpenAIProvider(cfg AzureConfig) (*AzureOpenAIProvider, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("Azure OpenAI resource endpoint is required")
+	}
+	if cfg.Deployment == "" {
+		return nil, fmt.Errorf("Azure OpenAI deployment name is required")
+	}
+	if cfg.Model == "" {
+		cfg.Model = cfg.Deployment
+	}
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("Azure OpenAI API key or Entra token is required")
+	}
+	if cfg.APIVersion == "" {
+		cfg.APIVersion = DefaultAzureAPIVersion
+	}
+	if cfg.AuthType == "" {
+		cfg.AuthType = AzureAuthAPIKey
+	}
+
+	// go-openai appends /openai itself
+	cfg.Endpoint = strings.TrimSuffix(strings.TrimSuffix(cfg.Endpoint, "/"), "/openai")
+
+	client := newHTTPClient()
+	clientCfg := openai.DefaultAzureConfig(cfg.APIKey, cfg.Endpoint)
+	clientCfg.HTTPClient = client
+	clientCfg.APIVersion = cfg.APIVersion
+	switch cfg.AuthType {
+	case AzureAuthAPIKey:
+	case AzureAuthEntra:
+		// Tokens expire, so each request gets the current one
+		clientCfg.APIType = openai.APITypeAzureAD
+		source := cfg.TokenSource
+		if source == nil {
+			token := cfg.APIKey
+			source = func() (string, error) { return token, nil }
+		}
+		client.Transport = entraTransport{base: client.Transport, token: newEntraToken(source, cfg.APIKey)}
+	default:
+		return nil, fmt.Errorf("unknown Azure auth type: %s", cfg.AuthType)
+	}
+	// Every request goes to the configured deployment, whatever model it names
+	deployment := cfg.Deployment
+	clientCfg.AzureModelMapperFunc = func(string) string {
+		return deployment
+	}
+
+	return &AzureOpenAIProvider{
+		OpenAIProvider: &OpenAIProvider{
+			client:  openai.NewClientWithConfig(clientCfg),
+			model:   cfg.Model,
+			options: DefaultModeOptions(),
+		},
+		cfg:    cfg,
+		client: client,
+	}, nil
+}
+
+func (p *AzureOpenAIProvider) Name() string {
+	return "azure"
+}
+
+// ListModels returns the deployments of the resource
+func (p *AzureOpenAIProvider) ListModels(ctx context.Context) ([]string, error) {
+	url := fmt.Sprintf("%s/openai/deployments?api-version=%s", p.cfg.Endpoint, azureDeploymentsAPIVersion)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if p.cfg.AuthType != AzureAuthEntra {
+		// Entra tokens are added by the client's transport
+		req.Header.Set(openai.AzureAPIKeyHeader, p.cfg.APIKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("azure API error: %s - %s", resp.Status, string(body))
+	}
+
+	var deployments azureDeploymentsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&deployments); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	models := make([]string, len(deployments.Data))
+	for i, d := range deployments.Data {
+		models[i] = d.ID
+	}
+	return models, nil
+}
@@ -0,0 +1,298 @@
+// Package ai Azure OpenAI provider tests
+package ai
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sonemaro/sosomi/internal/config"
+)
+
+// newAzureTestServer fakes an Azure OpenAI resource with a single deployment.
+// checkAuth validates the authentication headers of every request.
+func newAzureTestServer(t *testing.T, checkAuth func(r *http.Request) bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"code":"401","message":"Access denied due to invalid subscription key"}}`))
+			return
+		}
+
+		switch r.URL.Path {
+		case "/openai/deployments":
+			if r.URL.Query().Get("api-version") != azureDeploymentsAPIVersion {
+				t.Errorf("Unexpected deployments api-version %q", r.URL.Query().Get("api-version"))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"data":[{"id":"prod-gpt4o","model":"gpt-4o"},{"id":"cheap","model":"gpt-4o-mini"}],"object":"list"}`))
+
+		case "/openai/deployments/prod-gpt4o/chat/completions":
+			if r.URL.Query().Get("api-version") != "2024-06-01" {
+				t.Errorf("Expected configured api-version, got %q", r.URL.Query().Get("api-version"))
+			}
+			var req map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&req)
+
+			if req["stream"] == true {
+				w.Header().Set("Content-Type", "text/event-stream")
+				fmt.Fprintf(w, "data: %s\n\n", `{"choices":[{"index":0,"delta":{"content":"Hi"}}]}`)
+				fmt.Fprintf(w, "data: %s\n\n", `{"choices":[{"index":0,"delta":{"content":" there"}}]}`)
+				fmt.Fprintf(w, "data: %s\n\n", `{"choices":[],"usage":{"prompt_tokens":9,"completion_tokens":2,"total_tokens":11}}`)
+				fmt.Fprintf(w, "data: [DONE]\n\n")
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"Hello from Azure"},"finish_reason":"stop"}],"usage":{"prompt_tokens":7,"completion_tokens":3,"total_tokens":10}}`))
+
+		default:
+			t.Errorf("Unexpected path %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func apiKeyAuth(r *http.Request) bool {
+	return r.Header.Get("api-key") == "azure-key" && r.Header.Get("Authorization") == ""
+}
+
+func TestNewAzureOpenAIProvider_Validation(t *testing.T) {
+	if _, err := NewAzureOpenAIProvider(AzureConfig{APIKey: "k", Deployment: "d"}); err == nil {
+		t.Error("Expected error without endpoint")
+	}
+	if _, err := NewAzureOpenAIProvider(AzureConfig{APIKey: "k", Endpoint: "https://res.openai.azure.com"}); err == nil {
+		t.Error("Expected error without deployment")
+	}
+	if _, err := NewAzureOpenAIProvider(AzureConfig{APIKey: "k", Endpoint: "https://res.openai.azure.com", Deployment: "d", AuthType: "magic"}); err == nil {
+		t.Error("Expected error for unknown auth type")
+	}
+
+	provider, err := NewAzureOpenAIProvider(AzureConfig{APIKey: "k", Endpoint: "https://res.openai.azure.com/openai/", Deployment: "d"})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	if provider.Name() != "azure" {
+		t.Errorf("Expected name 'azure', got '%s'", provider.Name())
+	}
+	if provider.cfg.Endpoint != "https://res.openai.azure.com" || provider.cfg.APIVersion != DefaultAzureAPIVersion {
+		t.Errorf("Expected normalized endpoint and default api-version, got %+v", provider.cfg)
+	}
+	if !provider.SupportsTools() {
+		t.Error("Expected Azure provider to support tools")
+	}
+}
+
+func TestAzureOpenAIProvider_Chat_WithMock(t *testing.T) {
+	server := newAzureTestServer(t, apiKeyAuth)
+	defer server.Close()
+
+	provider, err := NewAzureOpenAIProvider(AzureConfig{
+		Endpoint:   server.URL,
+		Deployment: "prod-gpt4o",
+		APIVersion: "2024-06-01",
+		APIKey:     "azure-key",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+
+	resp, err := provider.ChatWithUsage(context.Background(), []Message{{Role: "user", Content: "Hello"}})
+	if err != nil {
+		t.Fatalf("ChatWithUsage failed: %v", err)
+	}
+	if resp.Content != "Hello from Azure" || resp.Usage.TotalTokens != 10 {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+}
+
+func TestAzureOpenAIProvider_ChatStream_Usage(t *testing.T) {
+	server := newAzureTestServer(t, apiKeyAuth)
+	defer server.Close()
+
+	provider, _ := NewAzureOpenAIProvider(AzureConfig{
+		Endpoint:   server.URL,
+		Deployment: "prod-gpt4o",
+		APIVersion: "2024-06-01",
+		APIKey:     "azure-key",
+	})
+
+	ch, err := provider.ChatStream(context.Background(), []Message{{Role: "user", Content: "Hello"}})
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+
+	var content string
+	var usage *TokenUsage
+	for chunk := range ch {
+		if chunk.Error != nil {
+			t.Fatalf("Stream error: %v", chunk.Error)
+		}
+		content += chunk.Content
+		if chunk.Done {
+			usage = chunk.Usage
+		}
+	}
+	if content != "Hi there" {
+		t.Errorf("Expected streamed content, got %q", content)
+	}
+	if usage == nil || usage.TotalTokens != 11 {
+		t.Errorf("Expected usage on the final chunk, got %+v", usage)
+	}
+}
+
+func TestAzureOpenAIProvider_EntraToken(t *testing.T) {
+	server := newAzureTestServer(t, func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer entra-token" && r.Header.Get("api-key") == ""
+	})
+	defer server.Close()
+
+	provider, _ := NewAzureOpenAIProvider(AzureConfig{
+		Endpoint:   server.URL,
+		Deployment: "prod-gpt4o",
+		APIVersion: "2024-06-01",
+		APIKey:     "entra-token",
+		AuthType:   AzureAuthEntra,
+	})
+
+	if _, err := provider.Chat(context.Background(), []Message{{Role: "user", Content: "Hello"}}); err != nil {
+		t.Errorf("Chat with Entra token failed: %v", err)
+	}
+	models, err := provider.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels with Entra token failed: %v", err)
+	}
+	if strings.Join(models, ",") != "prod-gpt4o,cheap" {
+		t.Errorf("Expected deployments, got %v", models)
+	}
+}
+
+// fakeJWT builds an unsigned token expiring at exp
+func fakeJWT(name string, exp time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":%q,"exp":%d}`, name, exp.Unix())))
+	return "eyJhbGciOiJub25lIn0." + payload + ".sig"
+}
+
+func TestAzureOpenAIProvider_EntraTokenRefresh(t *testing.T) {
+	expired := fakeJWT("old", time.Now().Add(-time.Minute))
+	fresh := fakeJWT("new", time.Now().Add(time.Hour))
+	server := newAzureTestServer(t, func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer "+fresh
+	})
+	defer server.Close()
+
+	fetches := 0
+	provider, _ := NewAzureOpenAIProvider(AzureConfig{
+		Endpoint:   server.URL,
+		Deployment: "prod-gpt4o",
+		APIVersion: "2024-06-01",
+		APIKey:     expired,
+		AuthType:   AzureAuthEntra,
+		TokenSource: func() (string, error) {
+			fetches++
+			return fresh, nil
+		},
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, err := provider.Chat(context.Background(), []Message{{Role: "user", Content: "Hello"}}); err != nil {
+			t.Fatalf("Chat after the token expired failed: %v", err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("Expected the expired token to be replaced once, fetched %d times", fetches)
+	}
+}
+
+func TestEntraToken(t *testing.T) {
+	next := fakeJWT("next", time.Now().Add(time.Hour))
+	fetches := 0
+	source := func() (string, error) {
+		fetches++
+		return next, nil
+	}
+
+	// A token close to its expiry is replaced
+	token := newEntraToken(source, fakeJWT("soon", time.Now().Add(time.Minute)))
+	if got, _ := token.get(); got != next || fetches != 1 {
+		t.Errorf("Expected a token expiring soon to be refreshed, got %q after %d fetches", got, fetches)
+	}
+	if got, _ := token.get(); got != next || fetches != 1 {
+		t.Errorf("Expected the refreshed token to be reused, got %q after %d fetches", got, fetches)
+	}
+
+	// A rejected token is replaced even before it expires
+	token.invalidate(next)
+	if token.get(); fetches != 2 {
+		t.Errorf("Expected a rejected token to be refreshed, fetched %d times", fetches)
+	}
+
+	// Tokens that are not JWTs are kept for the default lifetime
+	opaque := newEntraToken(source, "opaque")
+	if got, _ := opaque.get(); got != "opaque" {
+		t.Errorf("Expected an opaque token to be used, got %q", got)
+	}
+
+	// The current token is kept while it is valid if no new one can be fetched
+	valid := fakeJWT("valid", time.Now().Add(time.Minute))
+	failing := newEntraToken(func() (string, error) { return "", fmt.Errorf("az failed") }, valid)
+	if got, err := failing.get(); err != nil || got != valid {
+		t.Errorf("Expected the valid token to be kept, got %q, %v", got, err)
+	}
+	failing.invalidate(valid)
+	if _, err := failing.get(); err == nil || !strings.Contains(err.Error(), "az failed") {
+		t.Errorf("Expected the source error without a token, got %v", err)
+	}
+}
+
+func TestAzureOpenAIProvider_AuthError(t *testing.T) {
+	server := newAzureTestServer(t, apiKeyAuth)
+	defer server.Close()
+
+	provider, _ := NewAzureOpenAIProvider(AzureConfig{Endpoint: server.URL, Deployment: "prod-gpt4o", APIKey: "wrong"})
+	if _, err := provider.ListModels(context.Background()); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected 401 listing deployments, got %v", err)
+	}
+}
+
+func TestNewProviderFromConfig_Azure(t *testing.T) {
+	config.Init("")
+
+	cfg := config.Get()
+	original := *cfg
+	defer func() { *cfg = original }()
+	cfg.Provider.Name = "azure"
+	cfg.Provider.APIKey = "azure-key"
+	cfg.Provider.Endpoint = "https://res.openai.azure.com"
+	cfg.Provider.Deployment = ""
+	cfg.Provider.AuthType = "Entra"
+	cfg.Model.Name = "my-deployment"
+
+	provider, err := NewProviderFromConfig()
+	if err != nil {
+		t.Fatalf("NewProviderFromConfig failed: %v", err)
+	}
+	azure, ok := provider.(*RetryProvider).Provider.(*AzureOpenAIProvider)
+	if !ok {
+		t.Fatalf("Expected a retrying *AzureOpenAIProvider, got %T", provider)
+	}
+	if azure.cfg.Deployment != "my-deployment" || azure.cfg.AuthType != AzureAuthEntra {
+		t.Errorf("Expected deployment from model name and entra auth, got %+v", azure.cfg)
+	}
+
+	// Usage is priced by the model behind the deployment
+	cfg.Provider.Deployment = "prod-gpt4o"
+	cfg.Model.Name = "gpt-4o"
+	provider, err = NewProviderFromConfig()
+	if err != nil {
+		t.Fatalf("NewProviderFromConfig failed: %v", err)
+	}
+	if provider.Model() != "gpt-4o" {
+		t.Errorf("Expected the model behind the deployment, got %s", provider.Model())
+	}
+}
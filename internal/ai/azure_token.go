@@ -0,0 +1,117 @@
+// Package ai provides Microsoft Entra ID tokens for the Azure OpenAI provider
+package ai
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// entraRefreshMargin is how long before it expires a token is replaced
+	entraRefreshMargin = 5 * time.Minute
+	// entraDefaultLifetime is how long tokens whose expiry cannot be read
+	// from their claims are used
+	entraDefaultLifetime = 10 * time.Minute
+)
+
+// TokenSource fetches a new Entra ID access token, e.g. by running
+// provider.api_key_cmd again
+type TokenSource func() (string, error)
+
+// entraToken caches an access token, fetching a new one from its source
+// shortly before it expires or after it was rejected
+type entraToken struct {
+	source TokenSource
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func newEntraToken(source TokenSource, initial string) *entraToken {
+	t := &entraToken{source: source}
+	if initial != "" {
+		t.token, t.expires = initial, tokenExpiry(initial, time.Now())
+	}
+	return t
+}
+
+// get returns a token that is valid for at least entraRefreshMargin, or
+// the current one while it has not expired if no new one can be fetched
+func (t *entraToken) get() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if t.token != "" && t.expires.Sub(now) > entraRefreshMargin {
+		return t.token, nil
+	}
+
+	token, err := t.source()
+	if err == nil && token == "" {
+		err = fmt.Errorf("token source returned no token")
+	}
+	if err != nil {
+		if t.token != "" && now.Before(t.expires) {
+			return t.token, nil
+		}
+		return "", fmt.Errorf("failed to get Entra token: %w", err)
+	}
+	t.token, t.expires = token, tokenExpiry(token, now)
+	return t.token, nil
+}
+
+// invalidate drops a token the service rejected
+func (t *entraToken) invalidate(token string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token == token {
+		t.token = ""
+	}
+}
+
+// tokenExpiry reads when a token expires from the exp claim of the JWT,
+// defaulting to entraDefaultLifetime from now
+func tokenExpiry(token string, now time.Time) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) == 3 {
+		payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+		var claims struct {
+			Exp int64 `json:"exp"`
+		}
+		if err == nil && json.Unmarshal(payload, &claims) == nil && claims.Exp > 0 {
+			return time.Unix(claims.Exp, 0)
+		}
+	}
+	return now.Add(entraDefaultLifetime)
+}
+
+// entraTransport authenticates every request with the current token
+type entraTransport struct {
+	base  http.RoundTripper
+	token *entraToken
+}
+
+func (t entraTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.token.get()
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Del(openai.AzureAPIKeyHeader)
+
+	resp, err := t.base.RoundTrip(req)
+	if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+		t.token.invalidate(token)
+	}
+	return resp, err
+}
@@ -0,0 +1,130 @@
+// Package ai provides generation of several candidate commands for a prompt
+package ai
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// CandidateGenerator is implemented by providers whose API can return
+// several completions for one request
+type CandidateGenerator interface {
+	// GenerateCandidates generates up to n commands for a prompt
+	GenerateCandidates(ctx context.Context, prompt string, sysCtx types.SystemContext, n int) ([]*types.CommandResponse, error)
+}
+
+// GenerateCandidates generates n commands for a prompt. Providers that can
+// return several completions are asked once; otherwise n requests are sent
+// in parallel. Failed requests are dropped as long as one succeeds.
+func GenerateCandidates(ctx context.Context, provider Provider, prompt string, sysCtx types.SystemContext, n int) ([]*types.CommandResponse, error) {
+	if n < 1 {
+		n = 1
+	}
+	if generator, ok := provider.(CandidateGenerator); ok {
+		return generator.GenerateCandidates(ctx, prompt, sysCtx, n)
+	}
+	return generateInParallel(ctx, provider, prompt, sysCtx, n)
+}
+
+// requestGate is consulted before each of the separate requests made for
+// candidates, and told the usage of each response
+type requestGate struct {
+	allow  func(first bool) error
+	record func(usage TokenUsage)
+	used   bool
+}
+
+type requestGateKey struct{}
+
+func withRequestGate(ctx context.Context, gate *requestGate) context.Context {
+	return context.WithValue(ctx, requestGateKey{}, gate)
+}
+
+// generateInParallel sends n GenerateCommand requests at once, or one after
+// another when the context has a request gate, so that each is checked with
+// the usage of those before it recorded
+func generateInParallel(ctx context.Context, provider Provider, prompt string, sysCtx types.SystemContext, n int) ([]*types.CommandResponse, error) {
+	if gate, ok := ctx.Value(requestGateKey{}).(*requestGate); ok {
+		return generateInSequence(ctx, gate, provider, prompt, sysCtx, n)
+	}
+
+	responses := make([]*types.CommandResponse, n)
+	errs := make([]error, n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i], errs[i] = provider.GenerateCommand(ctx, prompt, sysCtx)
+		}(i)
+	}
+	wg.Wait()
+
+	var generated []*types.CommandResponse
+	for i, response := range responses {
+		if errs[i] == nil && response != nil {
+			generated = append(generated, response)
+		}
+	}
+	if len(generated) == 0 {
+		for _, err := range errs {
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nil, fmt.Errorf("no candidates generated")
+	}
+	return generated, nil
+}
+
+// generateInSequence sends n GenerateCommand requests one at a time through
+// gate, stopping once it refuses one
+func generateInSequence(ctx context.Context, gate *requestGate, provider Provider, prompt string, sysCtx types.SystemContext, n int) ([]*types.CommandResponse, error) {
+	var generated []*types.CommandResponse
+	var lastErr error
+	for i := 0; i < n; i++ {
+		if err := gate.allow(!gate.used); err != nil {
+			lastErr = err
+			break
+		}
+		gate.used = true
+		response, err := provider.GenerateCommand(ctx, prompt, sysCtx)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		gate.record(response.Usage)
+		generated = append(generated, response)
+	}
+
+	if len(generated) == 0 {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no candidates generated")
+		}
+		return nil, lastErr
+	}
+	return generated, nil
+}
+
+// GenerateCandidates retries a provider's multi-completion request as a
+// whole; parallel requests are each retried on their own
+func (p *RetryProvider) GenerateCandidates(ctx context.Context, prompt string, sysCtx types.SystemContext, n int) ([]*types.CommandResponse, error) {
+	if generator, ok := p.Provider.(CandidateGenerator); ok {
+		return withRetry(ctx, p.policy, func(ctx context.Context) ([]*types.CommandResponse, error) {
+			return generator.GenerateCandidates(ctx, prompt, sysCtx, n)
+		})
+	}
+	return generateInParallel(ctx, p, prompt, sysCtx, n)
+}
+
+// GenerateCandidates takes every candidate from the first provider that
+// answers, so that they are all reported with the same provider and model
+func (p *FallbackProvider) GenerateCandidates(ctx context.Context, prompt string, sysCtx types.SystemContext, n int) ([]*types.CommandResponse, error) {
+	return withFallback(ctx, p, p.providers, func(provider Provider) ([]*types.CommandResponse, error) {
+		return GenerateCandidates(ctx, provider, prompt, sysCtx, n)
+	})
+}
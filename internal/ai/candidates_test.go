@@ -0,0 +1,91 @@
+// Package ai candidate generation tests
+package ai
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+func TestGenerateCandidates_Parallel(t *testing.T) {
+	server, requests := newFlakyServer(0, 0, nil, ollamaCommandResponse)
+	defer server.Close()
+
+	ollama, _ := NewOllamaProvider(server.URL, "llama3.2")
+	responses, err := GenerateCandidates(context.Background(), ollama, "list files", types.SystemContext{}, 4)
+	if err != nil {
+		t.Fatalf("GenerateCandidates failed: %v", err)
+	}
+	if len(responses) != 4 || requests.Load() != 4 {
+		t.Errorf("Expected 4 candidates from 4 requests, got %d from %d", len(responses), requests.Load())
+	}
+}
+
+func TestGenerateCandidates_DropsFailures(t *testing.T) {
+	server, _ := newFlakyServer(2, http.StatusBadRequest, nil, ollamaCommandResponse)
+	defer server.Close()
+
+	ollama, _ := NewOllamaProvider(server.URL, "llama3.2")
+	responses, err := GenerateCandidates(context.Background(), ollama, "list files", types.SystemContext{}, 3)
+	if err != nil {
+		t.Fatalf("Expected the successful candidate, got %v", err)
+	}
+	if len(responses) != 1 {
+		t.Errorf("Expected 1 candidate, got %d", len(responses))
+	}
+
+	down, _ := newFlakyServer(100, http.StatusBadRequest, nil, "")
+	defer down.Close()
+	ollama, _ = NewOllamaProvider(down.URL, "llama3.2")
+	if _, err := GenerateCandidates(context.Background(), ollama, "list files", types.SystemContext{}, 3); err == nil {
+		t.Error("Expected an error when every request fails")
+	}
+}
+
+func TestGenerateCandidates_OpenAIUsesN(t *testing.T) {
+	var body map[string]interface{}
+	server := captureRequest(t, `{"choices":[
+		{"index":0,"message":{"role":"assistant","content":"{\"command\":\"ls -la\",\"explanation\":\"list\",\"risk_level\":\"safe\"}"}},
+		{"index":1,"message":{"role":"assistant","content":"{\"command\":\"ls\",\"explanation\":\"list\",\"risk_level\":\"safe\"}"}},
+		{"index":2,"message":{"role":"assistant","content":"{\"command\":\"find .\",\"explanation\":\"list\",\"risk_level\":\"safe\"}"}}
+	]}`, &body)
+	defer server.Close()
+
+	openaiProvider, _ := NewOpenAIProvider("sk-test", server.URL, "gpt-4o-mini")
+	provider := NewRetryProvider(openaiProvider, fastRetries(1))
+
+	responses, err := GenerateCandidates(context.Background(), provider, "list files", types.SystemContext{}, 3)
+	if err != nil {
+		t.Fatalf("GenerateCandidates failed: %v", err)
+	}
+	if body["n"] != 3.0 {
+		t.Errorf("Expected n=3 in the request, got %v", body["n"])
+	}
+	if len(responses) != 3 || responses[2].Command != "find ." {
+		t.Errorf("Expected a candidate per choice, got %+v", responses)
+	}
+}
+
+func TestGenerateCandidates_Fallback(t *testing.T) {
+	down, _ := newFlakyServer(100, http.StatusServiceUnavailable, nil, "")
+	defer down.Close()
+	up, requests := newFlakyServer(0, 0, nil, ollamaCommandResponse)
+	defer up.Close()
+
+	first, _ := NewOllamaProvider(down.URL, "llama3.2")
+	second, _ := NewOllamaProvider(up.URL, "qwen2.5")
+	provider := NewFallbackProvider(NewRetryProvider(first, fastRetries(0)), NewRetryProvider(second, fastRetries(0)))
+
+	responses, err := GenerateCandidates(context.Background(), provider, "list files", types.SystemContext{}, 2)
+	if err != nil {
+		t.Fatalf("GenerateCandidates failed: %v", err)
+	}
+	if len(responses) != 2 || requests.Load() != 2 {
+		t.Errorf("Expected 2 candidates from the fallback, got %d from %d requests", len(responses), requests.Load())
+	}
+	if provider.Model() != "qwen2.5" {
+		t.Errorf("Expected the fallback to be reported, got %s", provider.Model())
+	}
+}
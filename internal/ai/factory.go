@@ -3,6 +3,7 @@ package ai
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/sonemaro/sosomi/internal/config"
 )
@@ -12,6 +13,10 @@ func NewProvider(providerType, apiKey, endpoint, model string) (Provider, error)
 	switch providerType {
 	case "openai":
 		return NewOpenAIProvider(apiKey, endpoint, model)
+	case "anthropic":
+		return NewAnthropicProvider(apiKey, endpoint, model)
+	case "azure":
+		return NewAzureOpenAIProvider(AzureConfig{APIKey: apiKey, Endpoint: endpoint, Deployment: model})
 	case "ollama":
 		return NewOllamaProvider(endpoint, model)
 	case "lmstudio":
@@ -25,19 +30,81 @@ func NewProvider(providerType, apiKey, endpoint, model string) (Provider, error)
 	}
 }
 
-// NewProviderFromConfig creates a provider using the current configuration
+// NewProviderFromConfig creates a provider using the current configuration.
+// Requests are retried up to model.max_retries times, then passed along
+// provider.fallbacks in order.
 func NewProviderFromConfig() (Provider, error) {
 	cfg := config.Get()
-	endpoint := config.GetEndpoint()
-	apiKey := config.GetAPIKey()
+	policy := DefaultRetryPolicy(cfg.Model.MaxRetries)
 
-	return NewProvider(cfg.Provider.Name, apiKey, endpoint, cfg.Model.Name)
+	primary, err := newConfiguredProvider(cfg.Provider, cfg.Model.Name)
+	if err != nil {
+		return nil, err
+	}
+	var provider Provider = NewRetryProvider(primary, policy)
+
+	if len(cfg.Provider.Fallbacks) > 0 {
+		var fallbacks []Provider
+		for _, fc := range cfg.Provider.Fallbacks {
+			fallback, err := newConfiguredProvider(fc.ProviderConfig(), fc.Model)
+			if err != nil {
+				return nil, fmt.Errorf("fallback provider %s: %w", fc.Name, err)
+			}
+			fallbacks = append(fallbacks, NewRetryProvider(fallback, policy))
+		}
+		provider = NewFallbackProvider(provider, fallbacks...)
+	}
+
+	provider.SetOptions(ModeOptionsFromConfig(cfg.Model))
+	return provider, nil
+}
+
+// keyedProviders are the providers that cannot be used without an API key
+var keyedProviders = map[string]bool{
+	"openai":    true,
+	"anthropic": true,
+	"azure":     true,
+}
+
+// newConfiguredProvider creates the provider described by pc, with the key
+// resolved for pc alone: a provider without a key of its own never gets
+// the key of another one
+func newConfiguredProvider(pc config.ProviderConfig, model string) (Provider, error) {
+	endpoint := pc.ResolveEndpoint()
+	apiKey := pc.ResolveAPIKey()
+	if apiKey == "" && keyedProviders[pc.Name] {
+		return nil, fmt.Errorf("no API key for %s: set api_key_env, api_key_cmd or api_key", pc.Name)
+	}
+
+	if pc.Name == "azure" {
+		// Requests are routed by deployment, which defaults to the model name
+		deployment := pc.Deployment
+		if deployment == "" {
+			deployment = model
+		}
+		return NewAzureOpenAIProvider(AzureConfig{
+			Endpoint:   endpoint,
+			Deployment: deployment,
+			Model:      model,
+			APIVersion: pc.APIVersion,
+			APIKey:     apiKey,
+			AuthType:   strings.ToLower(pc.AuthType),
+			// Entra tokens are fetched again, e.g. by api_key_cmd, when they expire
+			TokenSource: func() (string, error) {
+				return pc.ResolveAPIKey(), nil
+			},
+		})
+	}
+
+	return NewProvider(pc.Name, apiKey, endpoint, model)
 }
 
 // AvailableProviders returns a list of available provider types
 func AvailableProviders() []string {
 	return []string{
 		"openai",
+		"anthropic",
+		"azure",
 		"ollama",
 		"lmstudio",
 		"llamacpp",
@@ -55,6 +122,15 @@ func RecommendedModels() map[string][]string {
 			"gpt-4",
 			"gpt-3.5-turbo",
 		},
+		"anthropic": {
+			"claude-sonnet-4-5",
+			"claude-opus-4-1",
+			"claude-haiku-4-5",
+		},
+		"azure": {
+			"gpt-4o", // Deployment names are chosen per resource
+			"gpt-4o-mini",
+		},
 		"ollama": {
 			"llama3.2",
 			"llama3.1",
@@ -15,7 +15,7 @@ func TestAvailableProviders(t *testing.T) {
 		t.Error("AvailableProviders should return at least one provider")
 	}
 
-	expectedProviders := []string{"openai", "ollama", "lmstudio", "llamacpp", "generic"}
+	expectedProviders := []string{"openai", "anthropic", "ollama", "lmstudio", "llamacpp", "generic"}
 	for _, expected := range expectedProviders {
 		found := false
 		for _, p := range providers {
@@ -164,6 +164,17 @@ func TestNewProvider_Generic(t *testing.T) {
 	}
 }
 
+func TestNewProvider_Anthropic(t *testing.T) {
+	provider, err := NewProvider("anthropic", "test-key", "", "claude-sonnet-4-5")
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+
+	if provider.Name() != "anthropic" {
+		t.Errorf("Expected name 'anthropic', got '%s'", provider.Name())
+	}
+}
+
 func TestNewProvider_Unknown(t *testing.T) {
 	_, err := NewProvider("unknown_provider", "", "", "")
 	if err == nil {
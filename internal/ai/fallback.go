@@ -0,0 +1,150 @@
+// Package ai provides a provider that falls back along an ordered chain
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// FallbackProvider sends each request to its providers in order until one
+// answers. Name and Model report the provider that answered last, so the
+// caller can record which backend produced a response.
+type FallbackProvider struct {
+	providers []Provider
+
+	mu       sync.Mutex
+	answered Provider
+}
+
+// NewFallbackProvider creates a provider trying primary first, then each
+// fallback in order
+func NewFallbackProvider(primary Provider, fallbacks ...Provider) *FallbackProvider {
+	return &FallbackProvider{
+		providers: append([]Provider{primary}, fallbacks...),
+		answered:  primary,
+	}
+}
+
+// Providers returns the chain in the order it is tried
+func (p *FallbackProvider) Providers() []Provider {
+	return p.providers
+}
+
+func (p *FallbackProvider) current() Provider {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.answered
+}
+
+func (p *FallbackProvider) Name() string {
+	return p.current().Name()
+}
+
+func (p *FallbackProvider) Model() string {
+	return p.current().Model()
+}
+
+func (p *FallbackProvider) SetOptions(options ModeOptions) {
+	for _, provider := range p.providers {
+		provider.SetOptions(options)
+	}
+}
+
+// SupportsTools reports whether any provider in the chain supports tools;
+// ChatWithTools only falls back to those that do
+func (p *FallbackProvider) SupportsTools() bool {
+	for _, provider := range p.providers {
+		if provider.SupportsTools() {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *FallbackProvider) GenerateCommand(ctx context.Context, prompt string, sysCtx types.SystemContext) (*types.CommandResponse, error) {
+	return withFallback(ctx, p, p.providers, func(provider Provider) (*types.CommandResponse, error) {
+		return provider.GenerateCommand(ctx, prompt, sysCtx)
+	})
+}
+
+func (p *FallbackProvider) RefineCommand(ctx context.Context, req RefineRequest, sysCtx types.SystemContext) (*types.CommandResponse, error) {
+	return withFallback(ctx, p, p.providers, func(provider Provider) (*types.CommandResponse, error) {
+		return provider.RefineCommand(ctx, req, sysCtx)
+	})
+}
+
+func (p *FallbackProvider) GenerateCommandStream(ctx context.Context, prompt string, sysCtx types.SystemContext) (<-chan StreamChunk, error) {
+	return withFallback(ctx, p, p.providers, func(provider Provider) (<-chan StreamChunk, error) {
+		return provider.GenerateCommandStream(ctx, prompt, sysCtx)
+	})
+}
+
+func (p *FallbackProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+	return withFallback(ctx, p, p.providers, func(provider Provider) (string, error) {
+		return provider.Chat(ctx, messages)
+	})
+}
+
+func (p *FallbackProvider) ChatWithUsage(ctx context.Context, messages []Message) (*ChatResponse, error) {
+	return withFallback(ctx, p, p.providers, func(provider Provider) (*ChatResponse, error) {
+		return provider.ChatWithUsage(ctx, messages)
+	})
+}
+
+func (p *FallbackProvider) ChatStream(ctx context.Context, messages []Message) (<-chan StreamChunk, error) {
+	return withFallback(ctx, p, p.providers, func(provider Provider) (<-chan StreamChunk, error) {
+		return provider.ChatStream(ctx, messages)
+	})
+}
+
+// ListModels lists the models of the first provider that responds
+func (p *FallbackProvider) ListModels(ctx context.Context) ([]string, error) {
+	return withFallback(ctx, p, p.providers, func(provider Provider) ([]string, error) {
+		return provider.ListModels(ctx)
+	})
+}
+
+func (p *FallbackProvider) ChatWithTools(ctx context.Context, messages []Message, tools []types.MCPTool) (*ChatResponse, error) {
+	var capable []Provider
+	for _, provider := range p.providers {
+		if provider.SupportsTools() {
+			capable = append(capable, provider)
+		}
+	}
+	if len(capable) == 0 {
+		return nil, fmt.Errorf("no provider in the fallback chain supports tools")
+	}
+	return withFallback(ctx, p, capable, func(provider Provider) (*ChatResponse, error) {
+		return provider.ChatWithTools(ctx, messages, tools)
+	})
+}
+
+// withFallback calls each provider in turn and records the first one that
+// succeeds. It stops early when ctx is done, as later providers would fail
+// the same way.
+func withFallback[T any](ctx context.Context, p *FallbackProvider, providers []Provider, call func(Provider) (T, error)) (T, error) {
+	var result T
+	var errs []error
+	for _, provider := range providers {
+		var err error
+		result, err = call(provider)
+		if err == nil {
+			p.mu.Lock()
+			p.answered = provider
+			p.mu.Unlock()
+			return result, nil
+		}
+		if len(providers) == 1 {
+			return result, err
+		}
+		errs = append(errs, fmt.Errorf("%s (%s): %w", provider.Name(), provider.Model(), err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return result, fmt.Errorf("all providers failed: %w", errors.Join(errs...))
+}
@@ -0,0 +1,151 @@
+// Package ai fallback chain tests
+package ai
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sonemaro/sosomi/internal/config"
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+func TestFallbackProvider_UsesNextProvider(t *testing.T) {
+	down, downRequests := newFlakyServer(100, http.StatusServiceUnavailable, nil, "")
+	defer down.Close()
+	up, _ := newFlakyServer(0, 0, nil, `{"choices":[{"message":{"role":"assistant","content":"ls"}}]}`)
+	defer up.Close()
+
+	ollama, _ := NewOllamaProvider(down.URL, "llama3.2")
+	local, _ := NewLMStudioProvider(up.URL+"/v1", "qwen2.5-coder")
+	provider := NewFallbackProvider(NewRetryProvider(ollama, fastRetries(1)), NewRetryProvider(local, fastRetries(1)))
+
+	if provider.Name() != "ollama" {
+		t.Errorf("Expected the primary to be reported before any request, got %s", provider.Name())
+	}
+
+	resp, err := provider.GenerateCommand(context.Background(), "list files", types.SystemContext{})
+	if err != nil {
+		t.Fatalf("Expected the fallback to answer, got %v", err)
+	}
+	if resp.Command != "ls" {
+		t.Errorf("Expected command from the fallback, got %+v", resp)
+	}
+	if downRequests.Load() != 2 {
+		t.Errorf("Expected the primary to be retried once before falling back, got %d requests", downRequests.Load())
+	}
+	if provider.Name() != "lmstudio" || provider.Model() != "qwen2.5-coder" {
+		t.Errorf("Expected the fallback to be reported, got %s/%s", provider.Name(), provider.Model())
+	}
+}
+
+func TestFallbackProvider_AllFail(t *testing.T) {
+	first, _ := newFlakyServer(100, http.StatusInternalServerError, nil, "")
+	defer first.Close()
+	second, _ := newFlakyServer(100, http.StatusUnauthorized, nil, "")
+	defer second.Close()
+
+	ollama, _ := NewOllamaProvider(first.URL, "llama3.2")
+	local, _ := NewLMStudioProvider(second.URL+"/v1", "qwen2.5-coder")
+	provider := NewFallbackProvider(ollama, local)
+
+	_, err := provider.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}})
+	if err == nil {
+		t.Fatal("Expected an error when every provider fails")
+	}
+	for _, want := range []string{"all providers failed", "ollama (llama3.2)", "lmstudio (qwen2.5-coder)"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in %v", want, err)
+		}
+	}
+	if provider.Name() != "ollama" {
+		t.Errorf("Expected the reported provider to be unchanged, got %s", provider.Name())
+	}
+}
+
+func TestFallbackProvider_StopsWhenContextDone(t *testing.T) {
+	up, requests := newFlakyServer(0, 0, nil, ollamaCommandResponse)
+	defer up.Close()
+
+	first, _ := NewOllamaProvider(up.URL, "llama3.2")
+	second, _ := NewOllamaProvider(up.URL, "qwen2.5")
+	provider := NewFallbackProvider(first, second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := provider.Chat(ctx, []Message{{Role: "user", Content: "hi"}}); err == nil {
+		t.Error("Expected an error for a canceled context")
+	}
+	if requests.Load() != 0 {
+		t.Errorf("Expected no requests, got %d", requests.Load())
+	}
+}
+
+func TestNewProviderFromConfig_Fallbacks(t *testing.T) {
+	config.Init("")
+
+	cfg := config.Get()
+	original := *cfg
+	defer func() { *cfg = original }()
+	cfg.Provider.Name = "ollama"
+	cfg.Model.Name = "llama3.2"
+	cfg.Provider.Fallbacks = []config.FallbackConfig{
+		{Name: "lmstudio", Model: "qwen2.5-coder"},
+		{Name: "openai", Model: "gpt-4o-mini", APIKey: "sk-test"},
+	}
+
+	provider, err := NewProviderFromConfig()
+	if err != nil {
+		t.Fatalf("NewProviderFromConfig failed: %v", err)
+	}
+	chain, ok := provider.(*FallbackProvider)
+	if !ok {
+		t.Fatalf("Expected *FallbackProvider, got %T", provider)
+	}
+
+	var names []string
+	for _, p := range chain.Providers() {
+		names = append(names, p.Name()+"/"+p.Model())
+	}
+	if got := strings.Join(names, ","); got != "ollama/llama3.2,lmstudio/qwen2.5-coder,openai/gpt-4o-mini" {
+		t.Errorf("Unexpected chain %s", got)
+	}
+
+	cfg.Provider.Fallbacks = []config.FallbackConfig{{Name: "nope"}}
+	if _, err := NewProviderFromConfig(); err == nil || !strings.Contains(err.Error(), "fallback provider nope") {
+		t.Errorf("Expected an error naming the fallback, got %v", err)
+	}
+}
+
+func TestNewProviderFromConfig_FallbackWithoutKey(t *testing.T) {
+	config.Init("")
+
+	cfg := config.Get()
+	original := *cfg
+	defer func() { *cfg = original }()
+	t.Setenv("OPENAI_API_KEY", "sk-primary")
+	t.Setenv("SOSOMI_API_KEY", "")
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	t.Setenv("AZURE_OPENAI_API_KEY", "")
+	cfg.Provider.Name = "openai"
+	cfg.Provider.APIKeyEnv = "OPENAI_API_KEY"
+	cfg.Provider.APIKey = ""
+	cfg.Provider.APIKeyCmd = ""
+	cfg.Model.Name = "gpt-4o"
+
+	// The primary key is never sent to a fallback without a key of its own
+	for _, name := range []string{"anthropic", "azure"} {
+		cfg.Provider.Fallbacks = []config.FallbackConfig{{Name: name, Model: "m", Endpoint: "https://res.openai.azure.com"}}
+		_, err := NewProviderFromConfig()
+		if err == nil || !strings.Contains(err.Error(), "fallback provider "+name) || !strings.Contains(err.Error(), "no API key") {
+			t.Errorf("%s: expected a missing key error, got %v", name, err)
+		}
+	}
+
+	// Keyless local providers are still fine as fallbacks
+	cfg.Provider.Fallbacks = []config.FallbackConfig{{Name: "ollama", Model: "llama3.2"}}
+	if _, err := NewProviderFromConfig(); err != nil {
+		t.Errorf("Expected a keyless ollama fallback, got %v", err)
+	}
+}
@@ -4,6 +4,7 @@ package ai
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -15,10 +16,12 @@ import (
 // LocalOpenAIProvider implements the Provider interface for OpenAI-compatible local servers
 // This works with LM Studio, llama.cpp, text-generation-webui, etc.
 type LocalOpenAIProvider struct {
-	client   *openai.Client
-	model    string
-	name     string
-	endpoint string
+	client     *openai.Client
+	model      string
+	name       string
+	endpoint   string
+	options    ModeOptions
+	structured bool // Constrain command responses to CommandResponseSchema
 }
 
 // NewLMStudioProvider creates a new LM Studio provider
@@ -31,13 +34,16 @@ func NewLMStudioProvider(endpoint, model string) (*LocalOpenAIProvider, error) {
 	}
 
 	cfg := openai.DefaultConfig("lm-studio") // LM Studio doesn't require an API key
+	cfg.HTTPClient = newHTTPClient()
 	cfg.BaseURL = endpoint
 
 	return &LocalOpenAIProvider{
-		client:   openai.NewClientWithConfig(cfg),
-		model:    model,
-		name:     "lmstudio",
-		endpoint: endpoint,
+		client:     openai.NewClientWithConfig(cfg),
+		model:      model,
+		name:       "lmstudio",
+		endpoint:   endpoint,
+		options:    DefaultModeOptions(),
+		structured: true,
 	}, nil
 }
 
@@ -51,13 +57,16 @@ func NewLlamaCppProvider(endpoint, model string) (*LocalOpenAIProvider, error) {
 	}
 
 	cfg := openai.DefaultConfig("llamacpp")
+	cfg.HTTPClient = newHTTPClient()
 	cfg.BaseURL = endpoint
 
 	return &LocalOpenAIProvider{
-		client:   openai.NewClientWithConfig(cfg),
-		model:    model,
-		name:     "llamacpp",
-		endpoint: endpoint,
+		client:     openai.NewClientWithConfig(cfg),
+		model:      model,
+		name:       "llamacpp",
+		endpoint:   endpoint,
+		options:    DefaultModeOptions(),
+		structured: true,
 	}, nil
 }
 
@@ -74,6 +83,7 @@ func NewGenericOpenAIProvider(apiKey, endpoint, model string) (*LocalOpenAIProvi
 	}
 
 	cfg := openai.DefaultConfig(apiKey)
+	cfg.HTTPClient = newHTTPClient()
 	cfg.BaseURL = endpoint
 
 	return &LocalOpenAIProvider{
@@ -81,6 +91,7 @@ func NewGenericOpenAIProvider(apiKey, endpoint, model string) (*LocalOpenAIProvi
 		model:    model,
 		name:     "generic",
 		endpoint: endpoint,
+		options:  DefaultModeOptions(),
 	}, nil
 }
 
@@ -88,19 +99,26 @@ func (p *LocalOpenAIProvider) Name() string {
 	return p.name
 }
 
+func (p *LocalOpenAIProvider) Model() string {
+	return p.model
+}
+
+func (p *LocalOpenAIProvider) SetOptions(options ModeOptions) {
+	p.options = options
+}
+
 func (p *LocalOpenAIProvider) GenerateCommand(ctx context.Context, prompt string, sysCtx types.SystemContext) (*types.CommandResponse, error) {
 	// For local models, use a simpler prompt format that works better
 	systemMessage := buildLocalModelSystemPrompt(sysCtx)
 
-	resp, err := p.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+	resp, err := p.client.CreateChatCompletion(ctx, openAIRequest(openai.ChatCompletionRequest{
 		Model: p.model,
 		Messages: []openai.ChatCompletionMessage{
 			{Role: openai.ChatMessageRoleSystem, Content: systemMessage},
 			{Role: openai.ChatMessageRoleUser, Content: prompt},
 		},
-		Temperature: 0.1,
-		MaxTokens:   1024,
-	})
+		ResponseFormat: p.commandResponseFormat(),
+	}, p.options.forRequest(ctx, ModeCommand)))
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate command: %w", err)
 	}
@@ -109,7 +127,12 @@ func (p *LocalOpenAIProvider) GenerateCommand(ctx context.Context, prompt string
 		return nil, fmt.Errorf("no response from model")
 	}
 
-	return parseLocalModelResponse(resp.Choices[0].Message.Content)
+	response, err := parseLocalModelResponse(resp.Choices[0].Message.Content)
+	if err != nil {
+		return nil, err
+	}
+	response.Usage = openAIUsage(resp.Usage)
+	return response, nil
 }
 
 func (p *LocalOpenAIProvider) RefineCommand(ctx context.Context, req RefineRequest, sysCtx types.SystemContext) (*types.CommandResponse, error) {
@@ -138,15 +161,14 @@ func (p *LocalOpenAIProvider) RefineCommand(ctx context.Context, req RefineReque
 	userMessage.WriteString("PROBLEM: " + req.Feedback + "\n\n")
 	userMessage.WriteString("Please provide a corrected command.")
 
-	resp, err := p.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+	resp, err := p.client.CreateChatCompletion(ctx, openAIRequest(openai.ChatCompletionRequest{
 		Model: p.model,
 		Messages: []openai.ChatCompletionMessage{
 			{Role: openai.ChatMessageRoleSystem, Content: systemMessage},
 			{Role: openai.ChatMessageRoleUser, Content: userMessage.String()},
 		},
-		Temperature: 0.1,
-		MaxTokens:   1024,
-	})
+		ResponseFormat: p.commandResponseFormat(),
+	}, p.options.forRequest(ctx, ModeCommand)))
 	if err != nil {
 		return nil, fmt.Errorf("failed to refine command: %w", err)
 	}
@@ -155,25 +177,29 @@ func (p *LocalOpenAIProvider) RefineCommand(ctx context.Context, req RefineReque
 		return nil, fmt.Errorf("no response from model")
 	}
 
-	return parseLocalModelResponse(resp.Choices[0].Message.Content)
+	response, err := parseLocalModelResponse(resp.Choices[0].Message.Content)
+	if err != nil {
+		return nil, err
+	}
+	response.Usage = openAIUsage(resp.Usage)
+	return response, nil
 }
 
 func (p *LocalOpenAIProvider) GenerateCommandStream(ctx context.Context, prompt string, sysCtx types.SystemContext) (<-chan StreamChunk, error) {
 	systemMessage := buildLocalModelSystemPrompt(sysCtx)
 
-	stream, err := p.client.CreateChatCompletionStream(ctx, openai.ChatCompletionRequest{
+	stream, err := p.client.CreateChatCompletionStream(ctx, openAIRequest(openai.ChatCompletionRequest{
 		Model: p.model,
 		Messages: []openai.ChatCompletionMessage{
 			{Role: openai.ChatMessageRoleSystem, Content: systemMessage},
 			{Role: openai.ChatMessageRoleUser, Content: prompt},
 		},
-		Temperature: 0.1,
-		MaxTokens:   1024,
-		Stream:      true,
+		ResponseFormat: p.commandResponseFormat(),
+		Stream:         true,
 		StreamOptions: &openai.StreamOptions{
 			IncludeUsage: true,
 		},
-	})
+	}, p.options.forRequest(ctx, ModeCommand)))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create stream: %w", err)
 	}
@@ -221,20 +247,12 @@ func (p *LocalOpenAIProvider) Chat(ctx context.Context, messages []Message) (str
 
 // ChatWithUsage sends a chat message and returns the response with token usage
 func (p *LocalOpenAIProvider) ChatWithUsage(ctx context.Context, messages []Message) (*ChatResponse, error) {
-	openaiMessages := make([]openai.ChatCompletionMessage, len(messages))
-	for i, msg := range messages {
-		openaiMessages[i] = openai.ChatCompletionMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
-		}
-	}
+	openaiMessages := toOpenAIMessages(messages)
 
-	resp, err := p.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model:       p.model,
-		Messages:    openaiMessages,
-		Temperature: 0.7,
-		MaxTokens:   2048,
-	})
+	resp, err := p.client.CreateChatCompletion(ctx, openAIRequest(openai.ChatCompletionRequest{
+		Model:    p.model,
+		Messages: openaiMessages,
+	}, p.options.forRequest(ctx, ModeChat)))
 	if err != nil {
 		return nil, fmt.Errorf("chat failed: %w", err)
 	}
@@ -254,24 +272,16 @@ func (p *LocalOpenAIProvider) ChatWithUsage(ctx context.Context, messages []Mess
 }
 
 func (p *LocalOpenAIProvider) ChatStream(ctx context.Context, messages []Message) (<-chan StreamChunk, error) {
-	openaiMessages := make([]openai.ChatCompletionMessage, len(messages))
-	for i, msg := range messages {
-		openaiMessages[i] = openai.ChatCompletionMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
-		}
-	}
+	openaiMessages := toOpenAIMessages(messages)
 
-	stream, err := p.client.CreateChatCompletionStream(ctx, openai.ChatCompletionRequest{
-		Model:       p.model,
-		Messages:    openaiMessages,
-		Temperature: 0.7,
-		MaxTokens:   2048,
-		Stream:      true,
+	stream, err := p.client.CreateChatCompletionStream(ctx, openAIRequest(openai.ChatCompletionRequest{
+		Model:    p.model,
+		Messages: openaiMessages,
+		Stream:   true,
 		StreamOptions: &openai.StreamOptions{
 			IncludeUsage: true,
 		},
-	})
+	}, p.options.forRequest(ctx, ModeChat)))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create stream: %w", err)
 	}
@@ -323,14 +333,38 @@ func (p *LocalOpenAIProvider) ListModels(ctx context.Context) ([]string, error)
 	return models, nil
 }
 
+// commandResponseFormat returns the response format of command requests:
+// CommandResponseSchema for LM Studio and llama.cpp, whose server turns the
+// schema into a grammar, and nil for other servers, which may not support it
+func (p *LocalOpenAIProvider) commandResponseFormat() *openai.ChatCompletionResponseFormat {
+	if !p.structured {
+		return nil
+	}
+	return &openai.ChatCompletionResponseFormat{
+		Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+		JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+			Name:   "command_response",
+			Schema: json.RawMessage(CommandResponseSchema),
+			Strict: true,
+		},
+	}
+}
+
 func (p *LocalOpenAIProvider) SupportsTools() bool {
-	return false // Local models generally don't support function calling
+	// LM Studio and llama.cpp accept OpenAI-style tools; whether the model
+	// actually uses them depends on the loaded model and its chat template
+	return true
 }
 
-func (p *LocalOpenAIProvider) CallTool(ctx context.Context, tool types.MCPToolCall) (*types.MCPToolResult, error) {
-	return nil, fmt.Errorf("tool calling not supported for local models")
+func (p *LocalOpenAIProvider) ChatWithTools(ctx context.Context, messages []Message, tools []types.MCPTool) (*ChatResponse, error) {
+	return chatCompletionWithTools(ctx, p.client, p.model, p.options.forRequest(ctx, ModeChat), messages, tools)
 }
 
+// localResponseFormat describes the JSON fields for local models, which do
+// better with a short prompt than with SystemPrompt
+const localResponseFormat = `Respond with ONLY a JSON object:
+{"command": "the shell command (may span several lines)", "explanation": "what it does", "risk_level": "safe|caution|dangerous|critical", "confidence": 0.0-1.0, "warnings": [], "alternatives": []}`
+
 // buildLocalModelSystemPrompt creates a simpler prompt for local models
 func buildLocalModelSystemPrompt(sysCtx types.SystemContext) string {
 	return fmt.Sprintf(`You are a shell command assistant. Convert natural language to shell commands.
@@ -342,20 +376,19 @@ SYSTEM INFO:
 - User: %s
 
 RULES:
-1. Output ONLY the shell command, nothing else
-2. If the command is dangerous, prefix with "WARNING:" on a separate line
+1. Put the complete shell command in "command"
+2. Set risk_level to dangerous or critical for commands that delete, overwrite or need sudo, and explain why in "warnings"
 3. Use the appropriate commands for the user's OS and shell
-4. If you cannot generate a safe command, say "ERROR:" followed by the reason
+4. If you cannot generate a safe command, leave "command" empty, set risk_level to critical and give the reason in "explanation"
+
+%s
 
 Examples:
 User: list files
-Output: ls -la
+{"command": "ls -la", "explanation": "List all files with details", "risk_level": "safe", "confidence": 0.95, "warnings": [], "alternatives": []}
 
 User: delete everything
-Output: ERROR: Cannot generate destructive commands without specific targets
-
-User: disk usage
-Output: df -h`, sysCtx.OS, sysCtx.Shell, sysCtx.CurrentDir, sysCtx.Username)
+{"command": "", "explanation": "Cannot generate destructive commands without specific targets", "risk_level": "critical", "confidence": 0.0, "warnings": [], "alternatives": []}`, sysCtx.OS, sysCtx.Shell, sysCtx.CurrentDir, sysCtx.Username, localResponseFormat)
 }
 
 // buildLocalModelRefinePrompt creates a prompt for refining commands
@@ -376,18 +409,39 @@ IMPORTANT macOS NOTES:
 
 RULES:
 1. Read the error or feedback carefully
-2. Output ONLY the corrected shell command
+2. Put the corrected shell command in "command" and what was wrong in "explanation"
 3. Make sure the command works on the user's specific OS
-4. If the original approach won't work, suggest a different approach`, sysCtx.OS, sysCtx.Shell, sysCtx.CurrentDir, sysCtx.Username)
+4. If the original approach won't work, suggest a different approach
+
+%s`, sysCtx.OS, sysCtx.Shell, sysCtx.CurrentDir, sysCtx.Username, localResponseFormat)
 }
 
-// parseLocalModelResponse parses the simpler response format from local models
+// unstructuredConfidence is the confidence of a response that is not in the
+// JSON format, whose risk level is a guess
+const unstructuredConfidence = 0.3
+
+// parseLocalModelResponse parses a response from a local model. The JSON
+// format is expected; a model that cannot comply gets its text parsed with
+// heuristics, and the result is marked low-confidence and at least caution so
+// that it is never run without confirmation.
 func parseLocalModelResponse(content string) (*types.CommandResponse, error) {
 	content = strings.TrimSpace(content)
 
+	if resp, err := decodeCommandResponse(stripCodeFence(content)); err == nil && (resp.Command != "" || resp.Explanation != "") {
+		return resp, nil
+	}
+
 	resp := &types.CommandResponse{
-		Confidence: 0.8,
-		RiskLevel:  types.RiskSafe,
+		Confidence: unstructuredConfidence,
+		RiskLevel:  types.RiskCaution,
+		Warnings:   []string{"The model did not return a structured response; review the command before running it"},
+	}
+
+	// A fenced block holds the whole script, however many lines it has
+	if block, explanation, ok := extractCodeBlock(content); ok {
+		resp.Command = block
+		resp.Explanation = explanation
+		return resp, nil
 	}
 
 	lines := strings.Split(content, "\n")
@@ -395,10 +449,9 @@ func parseLocalModelResponse(content string) (*types.CommandResponse, error) {
 		line = strings.TrimSpace(line)
 
 		if strings.HasPrefix(line, "WARNING:") {
-			resp.Warnings = append(resp.Warnings, strings.TrimPrefix(line, "WARNING:"))
-			resp.RiskLevel = types.RiskCaution
+			resp.Warnings = append(resp.Warnings, strings.TrimSpace(strings.TrimPrefix(line, "WARNING:")))
 		} else if strings.HasPrefix(line, "ERROR:") {
-			resp.Explanation = strings.TrimPrefix(line, "ERROR:")
+			resp.Explanation = strings.TrimSpace(strings.TrimPrefix(line, "ERROR:"))
 			resp.RiskLevel = types.RiskCritical
 			resp.Command = ""
 			return resp, nil
@@ -406,7 +459,7 @@ func parseLocalModelResponse(content string) (*types.CommandResponse, error) {
 			// First non-warning/error line is the command
 			resp.Command = line
 			if i+1 < len(lines) {
-				resp.Explanation = strings.Join(lines[i+1:], " ")
+				resp.Explanation = strings.TrimSpace(strings.Join(lines[i+1:], " "))
 			}
 		}
 	}
@@ -417,3 +470,39 @@ func parseLocalModelResponse(content string) (*types.CommandResponse, error) {
 
 	return resp, nil
 }
+
+// stripCodeFence removes a markdown code fence around the whole content
+func stripCodeFence(content string) string {
+	if !strings.HasPrefix(content, "```") || !strings.HasSuffix(content, "```") {
+		return content
+	}
+	content = strings.TrimSuffix(content, "```")
+	if i := strings.Index(content, "\n"); i >= 0 {
+		return strings.TrimSpace(content[i+1:])
+	}
+	return ""
+}
+
+// extractCodeBlock returns the first fenced code block in content and the
+// text around it
+func extractCodeBlock(content string) (block, rest string, ok bool) {
+	start := strings.Index(content, "```")
+	if start < 0 {
+		return "", "", false
+	}
+	body := content[start+3:]
+	newline := strings.Index(body, "\n")
+	if newline < 0 {
+		return "", "", false
+	}
+	end := strings.Index(body[newline+1:], "```")
+	if end < 0 {
+		return "", "", false
+	}
+	block = strings.TrimSpace(body[newline+1 : newline+1+end])
+	if block == "" {
+		return "", "", false
+	}
+	rest = strings.TrimSpace(content[:start] + " " + body[newline+1+end+3:])
+	return block, strings.Join(strings.Fields(rest), " "), true
+}
@@ -18,6 +18,7 @@ type OllamaProvider struct {
 	endpoint string
 	model    string
 	client   *http.Client
+	options  ModeOptions
 }
 
 // OllamaChatRequest represents an Ollama chat API request
@@ -27,20 +28,51 @@ type OllamaChatRequest struct {
 	Stream   bool            `json:"stream"`
 	Format   string          `json:"format,omitempty"`
 	Options  *OllamaOptions  `json:"options,omitempty"`
+	Tools    []OllamaTool    `json:"tools,omitempty"`
 }
 
 // OllamaMessage represents a message in Ollama format
 type OllamaMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []OllamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+// OllamaTool represents a tool definition sent to /api/chat
+type OllamaTool struct {
+	Type     string             `json:"type"`
+	Function OllamaToolFunction `json:"function"`
+}
+
+// OllamaToolFunction describes a callable function
+type OllamaToolFunction struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+// OllamaToolCall represents a tool call requested by the model
+type OllamaToolCall struct {
+	Function OllamaToolCallFunction `json:"function"`
+}
+
+// OllamaToolCallFunction holds the function name and its arguments
+type OllamaToolCallFunction struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
 }
 
 // OllamaOptions represents model options
 type OllamaOptions struct {
-	Temperature float64 `json:"temperature,omitempty"`
-	NumPredict  int     `json:"num_predict,omitempty"`
-	TopP        float64 `json:"top_p,omitempty"`
-	TopK        int     `json:"top_k,omitempty"`
+	Temperature      *float64 `json:"temperature,omitempty"`
+	NumPredict       int      `json:"num_predict,omitempty"`
+	TopP             float64  `json:"top_p,omitempty"`
+	TopK             int      `json:"top_k,omitempty"`
+	FrequencyPenalty float64  `json:"frequency_penalty,omitempty"`
+	PresencePenalty  float64  `json:"presence_penalty,omitempty"`
+	RepeatPenalty    float64  `json:"repeat_penalty,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
 }
 
 // OllamaChatResponse represents an Ollama chat API response
@@ -53,6 +85,15 @@ type OllamaChatResponse struct {
 	EvalCount       int           `json:"eval_count,omitempty"`
 }
 
+// tokenUsage returns the token counts of a final response
+func (r OllamaChatResponse) tokenUsage() TokenUsage {
+	return TokenUsage{
+		PromptTokens:     r.PromptEvalCount,
+		CompletionTokens: r.EvalCount,
+		TotalTokens:      r.PromptEvalCount + r.EvalCount,
+	}
+}
+
 // OllamaModelsResponse represents the response from listing models
 type OllamaModelsResponse struct {
 	Models []OllamaModel `json:"models"`
@@ -77,7 +118,8 @@ func NewOllamaProvider(endpoint, model string) (*OllamaProvider, error) {
 	return &OllamaProvider{
 		endpoint: strings.TrimSuffix(endpoint, "/"),
 		model:    model,
-		client:   &http.Client{},
+		client:   newHTTPClient(),
+		options:  DefaultModeOptions(),
 	}, nil
 }
 
@@ -85,6 +127,14 @@ func (p *OllamaProvider) Name() string {
 	return "ollama"
 }
 
+func (p *OllamaProvider) Model() string {
+	return p.model
+}
+
+func (p *OllamaProvider) SetOptions(options ModeOptions) {
+	p.options = options
+}
+
 func (p *OllamaProvider) GenerateCommand(ctx context.Context, prompt string, sysCtx types.SystemContext) (*types.CommandResponse, error) {
 	systemMessage := SystemPrompt + "\n\n" + BuildSystemContext(sysCtx)
 
@@ -94,12 +144,9 @@ func (p *OllamaProvider) GenerateCommand(ctx context.Context, prompt string, sys
 			{Role: "system", Content: systemMessage},
 			{Role: "user", Content: prompt},
 		},
-		Stream: false,
-		Format: "json",
-		Options: &OllamaOptions{
-			Temperature: 0.1,
-			NumPredict:  1024,
-		},
+		Stream:  false,
+		Format:  "json",
+		Options: ollamaOptions(p.options.forRequest(ctx, ModeCommand)),
 	}
 
 	jsonData, err := json.Marshal(reqBody)
@@ -129,7 +176,12 @@ func (p *OllamaProvider) GenerateCommand(ctx context.Context, prompt string, sys
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return parseCommandResponse(ollamaResp.Message.Content)
+	response, err := parseCommandResponse(ollamaResp.Message.Content)
+	if err != nil {
+		return nil, err
+	}
+	response.Usage = ollamaResp.tokenUsage()
+	return response, nil
 }
 
 func (p *OllamaProvider) RefineCommand(ctx context.Context, req RefineRequest, sysCtx types.SystemContext) (*types.CommandResponse, error) {
@@ -163,12 +215,9 @@ func (p *OllamaProvider) RefineCommand(ctx context.Context, req RefineRequest, s
 			{Role: "system", Content: systemMessage},
 			{Role: "user", Content: userMessage.String()},
 		},
-		Stream: false,
-		Format: "json",
-		Options: &OllamaOptions{
-			Temperature: 0.1,
-			NumPredict:  1024,
-		},
+		Stream:  false,
+		Format:  "json",
+		Options: ollamaOptions(p.options.forRequest(ctx, ModeCommand)),
 	}
 
 	jsonData, err := json.Marshal(reqBody)
@@ -198,7 +247,12 @@ func (p *OllamaProvider) RefineCommand(ctx context.Context, req RefineRequest, s
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return parseCommandResponse(ollamaResp.Message.Content)
+	response, err := parseCommandResponse(ollamaResp.Message.Content)
+	if err != nil {
+		return nil, err
+	}
+	response.Usage = ollamaResp.tokenUsage()
+	return response, nil
 }
 
 func (p *OllamaProvider) GenerateCommandStream(ctx context.Context, prompt string, sysCtx types.SystemContext) (<-chan StreamChunk, error) {
@@ -210,11 +264,9 @@ func (p *OllamaProvider) GenerateCommandStream(ctx context.Context, prompt strin
 			{Role: "system", Content: systemMessage},
 			{Role: "user", Content: prompt},
 		},
-		Stream: true,
-		Options: &OllamaOptions{
-			Temperature: 0.1,
-			NumPredict:  1024,
-		},
+		Stream:  true,
+		Format:  "json",
+		Options: ollamaOptions(p.options.forRequest(ctx, ModeCommand)),
 	}
 
 	jsonData, err := json.Marshal(reqBody)
@@ -289,19 +341,17 @@ func (p *OllamaProvider) Chat(ctx context.Context, messages []Message) (string,
 
 // ChatWithUsage sends a chat message and returns the response with token usage
 func (p *OllamaProvider) ChatWithUsage(ctx context.Context, messages []Message) (*ChatResponse, error) {
-	ollamaMessages := make([]OllamaMessage, len(messages))
-	for i, msg := range messages {
-		ollamaMessages[i] = OllamaMessage(msg)
-	}
+	return p.chat(ctx, messages, nil)
+}
 
+// chat sends a non-streaming /api/chat request, optionally with tools
+func (p *OllamaProvider) chat(ctx context.Context, messages []Message, tools []types.MCPTool) (*ChatResponse, error) {
 	reqBody := OllamaChatRequest{
 		Model:    p.model,
-		Messages: ollamaMessages,
+		Messages: toOllamaMessages(messages),
 		Stream:   false,
-		Options: &OllamaOptions{
-			Temperature: 0.7,
-			NumPredict:  2048,
-		},
+		Options:  ollamaOptions(p.options.forRequest(ctx, ModeChat)),
+		Tools:    toOllamaTools(tools),
 	}
 
 	jsonData, err := json.Marshal(reqBody)
@@ -332,7 +382,8 @@ func (p *OllamaProvider) ChatWithUsage(ctx context.Context, messages []Message)
 	}
 
 	return &ChatResponse{
-		Content: ollamaResp.Message.Content,
+		Content:   ollamaResp.Message.Content,
+		ToolCalls: fromOllamaToolCalls(ollamaResp.Message.ToolCalls),
 		Usage: TokenUsage{
 			PromptTokens:     ollamaResp.PromptEvalCount,
 			CompletionTokens: ollamaResp.EvalCount,
@@ -342,19 +393,13 @@ func (p *OllamaProvider) ChatWithUsage(ctx context.Context, messages []Message)
 }
 
 func (p *OllamaProvider) ChatStream(ctx context.Context, messages []Message) (<-chan StreamChunk, error) {
-	ollamaMessages := make([]OllamaMessage, len(messages))
-	for i, msg := range messages {
-		ollamaMessages[i] = OllamaMessage(msg)
-	}
+	ollamaMessages := toOllamaMessages(messages)
 
 	reqBody := OllamaChatRequest{
 		Model:    p.model,
 		Messages: ollamaMessages,
 		Stream:   true,
-		Options: &OllamaOptions{
-			Temperature: 0.7,
-			NumPredict:  2048,
-		},
+		Options:  ollamaOptions(p.options.forRequest(ctx, ModeChat)),
 	}
 
 	jsonData, err := json.Marshal(reqBody)
@@ -448,10 +493,72 @@ func (p *OllamaProvider) ListModels(ctx context.Context) ([]string, error) {
 }
 
 func (p *OllamaProvider) SupportsTools() bool {
-	// Some Ollama models support tools, but not all
-	return false
+	// /api/chat accepts tools; models without tool support ignore them
+	return true
+}
+
+func (p *OllamaProvider) ChatWithTools(ctx context.Context, messages []Message, tools []types.MCPTool) (*ChatResponse, error) {
+	return p.chat(ctx, messages, tools)
 }
 
-func (p *OllamaProvider) CallTool(ctx context.Context, tool types.MCPToolCall) (*types.MCPToolResult, error) {
-	return nil, fmt.Errorf("tool calling not supported for Ollama")
+// toOllamaMessages converts messages, including tool calls and tool results, to Ollama format
+func toOllamaMessages(messages []Message) []OllamaMessage {
+	result := make([]OllamaMessage, len(messages))
+	for i, msg := range messages {
+		result[i] = OllamaMessage{
+			Role:     msg.Role,
+			Content:  msg.Content,
+			ToolName: msg.ToolName,
+		}
+		for _, call := range msg.ToolCalls {
+			args := call.Arguments
+			if args == nil {
+				args = map[string]interface{}{}
+			}
+			result[i].ToolCalls = append(result[i].ToolCalls, OllamaToolCall{
+				Function: OllamaToolCallFunction{Name: call.Name, Arguments: args},
+			})
+		}
+	}
+	return result
+}
+
+// toOllamaTools converts MCP tools to Ollama tool definitions
+func toOllamaTools(tools []types.MCPTool) []OllamaTool {
+	if len(tools) == 0 {
+		return nil
+	}
+	result := make([]OllamaTool, len(tools))
+	for i, tool := range tools {
+		result[i] = OllamaTool{
+			Type: "function",
+			Function: OllamaToolFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  toolParameters(tool),
+			},
+		}
+	}
+	return result
+}
+
+// fromOllamaToolCalls converts Ollama tool calls to ToolCalls.
+// Ollama doesn't assign call IDs, so positional IDs are generated.
+func fromOllamaToolCalls(calls []OllamaToolCall) []ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+	result := make([]ToolCall, len(calls))
+	for i, call := range calls {
+		args := call.Function.Arguments
+		if args == nil {
+			args = map[string]interface{}{}
+		}
+		result[i] = ToolCall{
+			ID:        fmt.Sprintf("call_%d", i),
+			Name:      call.Function.Name,
+			Arguments: args,
+		}
+	}
+	return result
 }
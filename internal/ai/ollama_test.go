@@ -236,7 +236,7 @@ func TestOllamaChatRequest_Serialization(t *testing.T) {
 		Stream: false,
 		Format: "json",
 		Options: &OllamaOptions{
-			Temperature: 0.1,
+			Temperature: float64Ptr(0.1),
 			NumPredict:  1024,
 		},
 	}
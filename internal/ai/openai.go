@@ -10,26 +10,24 @@ import (
 
 	"github.com/sashabaranov/go-openai"
 
-	"github.com/sonemaro/sosomi/internal/config"
 	"github.com/sonemaro/sosomi/internal/types"
 )
 
 // OpenAIProvider implements the Provider interface for OpenAI
 type OpenAIProvider struct {
-	client *openai.Client
-	model  string
+	client  *openai.Client
+	model   string
+	options ModeOptions
 }
 
 // NewOpenAIProvider creates a new OpenAI provider
 func NewOpenAIProvider(apiKey, endpoint, model string) (*OpenAIProvider, error) {
-	if apiKey == "" {
-		apiKey = config.GetAPIKey()
-	}
 	if apiKey == "" {
 		return nil, fmt.Errorf("OpenAI API key is required")
 	}
 
 	cfg := openai.DefaultConfig(apiKey)
+	cfg.HTTPClient = newHTTPClient()
 	if endpoint != "" && endpoint != "https://api.openai.com/v1" {
 		cfg.BaseURL = endpoint
 	}
@@ -39,8 +37,9 @@ func NewOpenAIProvider(apiKey, endpoint, model string) (*OpenAIProvider, error)
 	}
 
 	return &OpenAIProvider{
-		client: openai.NewClientWithConfig(cfg),
-		model:  model,
+		client:  openai.NewClientWithConfig(cfg),
+		model:   model,
+		options: DefaultModeOptions(),
 	}, nil
 }
 
@@ -48,30 +47,73 @@ func (p *OpenAIProvider) Name() string {
 	return "openai"
 }
 
+func (p *OpenAIProvider) Model() string {
+	return p.model
+}
+
+func (p *OpenAIProvider) SetOptions(options ModeOptions) {
+	p.options = options
+}
+
 func (p *OpenAIProvider) GenerateCommand(ctx context.Context, prompt string, sysCtx types.SystemContext) (*types.CommandResponse, error) {
+	resp, err := p.client.CreateChatCompletion(ctx, p.commandRequest(ctx, prompt, sysCtx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate command: %w", err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no response from OpenAI")
+	}
+
+	response, err := parseCommandResponse(resp.Choices[0].Message.Content)
+	if err != nil {
+		return nil, err
+	}
+	response.Usage = openAIUsage(resp.Usage)
+	return response, nil
+}
+
+// GenerateCandidates asks for n completions in a single request
+func (p *OpenAIProvider) GenerateCandidates(ctx context.Context, prompt string, sysCtx types.SystemContext, n int) ([]*types.CommandResponse, error) {
+	req := p.commandRequest(ctx, prompt, sysCtx)
+	req.N = n
+
+	resp, err := p.client.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate commands: %w", err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no response from OpenAI")
+	}
+
+	responses := make([]*types.CommandResponse, 0, len(resp.Choices))
+	for _, choice := range resp.Choices {
+		response, err := parseCommandResponse(choice.Message.Content)
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, response)
+	}
+	// The request is billed once, so its usage goes with the first candidate
+	responses[0].Usage = openAIUsage(resp.Usage)
+	return responses, nil
+}
+
+// commandRequest builds the request generating a command for prompt
+func (p *OpenAIProvider) commandRequest(ctx context.Context, prompt string, sysCtx types.SystemContext) openai.ChatCompletionRequest {
 	systemMessage := SystemPrompt + "\n\n" + BuildSystemContext(sysCtx)
 
-	resp, err := p.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+	return openAIRequest(openai.ChatCompletionRequest{
 		Model: p.model,
 		Messages: []openai.ChatCompletionMessage{
 			{Role: openai.ChatMessageRoleSystem, Content: systemMessage},
 			{Role: openai.ChatMessageRoleUser, Content: prompt},
 		},
-		Temperature: 0.1,
-		MaxTokens:   1024,
 		ResponseFormat: &openai.ChatCompletionResponseFormat{
 			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
 		},
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate command: %w", err)
-	}
-
-	if len(resp.Choices) == 0 {
-		return nil, fmt.Errorf("no response from OpenAI")
-	}
-
-	return parseCommandResponse(resp.Choices[0].Message.Content)
+	}, p.options.forRequest(ctx, ModeCommand))
 }
 
 func (p *OpenAIProvider) RefineCommand(ctx context.Context, req RefineRequest, sysCtx types.SystemContext) (*types.CommandResponse, error) {
@@ -102,18 +144,16 @@ func (p *OpenAIProvider) RefineCommand(ctx context.Context, req RefineRequest, s
 
 	userMessage.WriteString("USER FEEDBACK: " + req.Feedback)
 
-	resp, err := p.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+	resp, err := p.client.CreateChatCompletion(ctx, openAIRequest(openai.ChatCompletionRequest{
 		Model: p.model,
 		Messages: []openai.ChatCompletionMessage{
 			{Role: openai.ChatMessageRoleSystem, Content: systemMessage},
 			{Role: openai.ChatMessageRoleUser, Content: userMessage.String()},
 		},
-		Temperature: 0.1,
-		MaxTokens:   1024,
 		ResponseFormat: &openai.ChatCompletionResponseFormat{
 			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
 		},
-	})
+	}, p.options.forRequest(ctx, ModeCommand)))
 	if err != nil {
 		return nil, fmt.Errorf("failed to refine command: %w", err)
 	}
@@ -122,25 +162,31 @@ func (p *OpenAIProvider) RefineCommand(ctx context.Context, req RefineRequest, s
 		return nil, fmt.Errorf("no response from AI")
 	}
 
-	return parseCommandResponse(resp.Choices[0].Message.Content)
+	response, err := parseCommandResponse(resp.Choices[0].Message.Content)
+	if err != nil {
+		return nil, err
+	}
+	response.Usage = openAIUsage(resp.Usage)
+	return response, nil
 }
 
 func (p *OpenAIProvider) GenerateCommandStream(ctx context.Context, prompt string, sysCtx types.SystemContext) (<-chan StreamChunk, error) {
 	systemMessage := SystemPrompt + "\n\n" + BuildSystemContext(sysCtx)
 
-	stream, err := p.client.CreateChatCompletionStream(ctx, openai.ChatCompletionRequest{
+	stream, err := p.client.CreateChatCompletionStream(ctx, openAIRequest(openai.ChatCompletionRequest{
 		Model: p.model,
 		Messages: []openai.ChatCompletionMessage{
 			{Role: openai.ChatMessageRoleSystem, Content: systemMessage},
 			{Role: openai.ChatMessageRoleUser, Content: prompt},
 		},
-		Temperature: 0.1,
-		MaxTokens:   1024,
-		Stream:      true,
+		ResponseFormat: &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+		},
+		Stream: true,
 		StreamOptions: &openai.StreamOptions{
 			IncludeUsage: true,
 		},
-	})
+	}, p.options.forRequest(ctx, ModeCommand)))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create stream: %w", err)
 	}
@@ -188,20 +234,12 @@ func (p *OpenAIProvider) Chat(ctx context.Context, messages []Message) (string,
 
 // ChatWithUsage sends a chat message and returns the response with token usage
 func (p *OpenAIProvider) ChatWithUsage(ctx context.Context, messages []Message) (*ChatResponse, error) {
-	openaiMessages := make([]openai.ChatCompletionMessage, len(messages))
-	for i, msg := range messages {
-		openaiMessages[i] = openai.ChatCompletionMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
-		}
-	}
+	openaiMessages := toOpenAIMessages(messages)
 
-	resp, err := p.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model:       p.model,
-		Messages:    openaiMessages,
-		Temperature: 0.7,
-		MaxTokens:   2048,
-	})
+	resp, err := p.client.CreateChatCompletion(ctx, openAIRequest(openai.ChatCompletionRequest{
+		Model:    p.model,
+		Messages: openaiMessages,
+	}, p.options.forRequest(ctx, ModeChat)))
 	if err != nil {
 		return nil, fmt.Errorf("chat failed: %w", err)
 	}
@@ -221,24 +259,16 @@ func (p *OpenAIProvider) ChatWithUsage(ctx context.Context, messages []Message)
 }
 
 func (p *OpenAIProvider) ChatStream(ctx context.Context, messages []Message) (<-chan StreamChunk, error) {
-	openaiMessages := make([]openai.ChatCompletionMessage, len(messages))
-	for i, msg := range messages {
-		openaiMessages[i] = openai.ChatCompletionMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
-		}
-	}
+	openaiMessages := toOpenAIMessages(messages)
 
-	stream, err := p.client.CreateChatCompletionStream(ctx, openai.ChatCompletionRequest{
-		Model:       p.model,
-		Messages:    openaiMessages,
-		Temperature: 0.7,
-		MaxTokens:   2048,
-		Stream:      true,
+	stream, err := p.client.CreateChatCompletionStream(ctx, openAIRequest(openai.ChatCompletionRequest{
+		Model:    p.model,
+		Messages: openaiMessages,
+		Stream:   true,
 		StreamOptions: &openai.StreamOptions{
 			IncludeUsage: true,
 		},
-	})
+	}, p.options.forRequest(ctx, ModeChat)))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create stream: %w", err)
 	}
@@ -296,10 +326,17 @@ func (p *OpenAIProvider) SupportsTools() bool {
 	return true
 }
 
-func (p *OpenAIProvider) CallTool(ctx context.Context, tool types.MCPToolCall) (*types.MCPToolResult, error) {
-	// Tool calling implementation for OpenAI
-	// This would use function calling API
-	return nil, fmt.Errorf("tool calling not yet implemented for OpenAI")
+func (p *OpenAIProvider) ChatWithTools(ctx context.Context, messages []Message, tools []types.MCPTool) (*ChatResponse, error) {
+	return chatCompletionWithTools(ctx, p.client, p.model, p.options.forRequest(ctx, ModeChat), messages, tools)
+}
+
+// openAIUsage converts the token usage reported by OpenAI-compatible APIs
+func openAIUsage(usage openai.Usage) TokenUsage {
+	return TokenUsage{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+	}
 }
 
 // parseCommandResponse parses the JSON response from the AI
@@ -318,6 +355,21 @@ func parseCommandResponse(content string) (*types.CommandResponse, error) {
 		content = strings.TrimSpace(content)
 	}
 
+	resp, err := decodeCommandResponse(content)
+	if err != nil {
+		// If JSON parsing fails, treat the entire response as a command
+		return &types.CommandResponse{
+			Command:     content,
+			Explanation: "Generated command",
+			RiskLevel:   types.RiskCaution, // Default to caution when we can't parse
+			Confidence:  0.5,
+		}, nil
+	}
+	return resp, nil
+}
+
+// decodeCommandResponse decodes a response in the JSON format of SystemPrompt
+func decodeCommandResponse(content string) (*types.CommandResponse, error) {
 	var rawResp struct {
 		Command      string   `json:"command"`
 		Explanation  string   `json:"explanation"`
@@ -328,13 +380,7 @@ func parseCommandResponse(content string) (*types.CommandResponse, error) {
 	}
 
 	if err := json.Unmarshal([]byte(content), &rawResp); err != nil {
-		// If JSON parsing fails, treat the entire response as a command
-		return &types.CommandResponse{
-			Command:     content,
-			Explanation: "Generated command",
-			RiskLevel:   types.RiskCaution, // Default to caution when we can't parse
-			Confidence:  0.5,
-		}, nil
+		return nil, err
 	}
 
 	// Convert risk level string to RiskLevel
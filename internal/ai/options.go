@@ -0,0 +1,184 @@
+// Package ai provides the request options shared by the providers
+package ai
+
+import (
+	"context"
+	"math"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/sonemaro/sosomi/internal/config"
+)
+
+// Mode identifies the kind of request, each with its own sampling options
+type Mode string
+
+const (
+	ModeCommand Mode = "command" // GenerateCommand, RefineCommand and GenerateCommandStream
+	ModeChat    Mode = "chat"    // Chat, ChatStream and ChatWithTools
+	ModeTitle   Mode = "title"   // Session and conversation titles
+	ModeSummary Mode = "summary" // Summaries of messages trimmed from the context
+)
+
+// RequestOptions holds the sampling parameters sent with a request. Zero
+// values are left out so the backend default applies.
+type RequestOptions struct {
+	MaxTokens        int
+	Temperature      *float64 // nil leaves the backend default; 0 is greedy decoding
+	TopP             float64
+	FrequencyPenalty float64
+	PresencePenalty  float64
+	RepeatPenalty    float64 // Ollama only
+	Stop             []string
+}
+
+// ModeOptions holds the request options for each mode
+type ModeOptions map[Mode]RequestOptions
+
+// DefaultModeOptions returns the options used when a provider is created
+// without configuration
+func DefaultModeOptions() ModeOptions {
+	return ModeOptions{
+		ModeCommand: {MaxTokens: 1024, Temperature: float64Ptr(0.1)},
+		ModeChat:    {MaxTokens: 2048, Temperature: float64Ptr(0.7)},
+		ModeTitle:   {MaxTokens: 64, Temperature: float64Ptr(0.3)},
+		ModeSummary: {MaxTokens: 512, Temperature: float64Ptr(0.2)},
+	}
+}
+
+// ModeOptionsFromConfig builds the options for every mode: the defaults,
+// overridden by the parameters set in model, overridden in turn by the
+// per-mode settings in model.modes
+func ModeOptionsFromConfig(model config.ModelConfig) ModeOptions {
+	options := DefaultModeOptions()
+	for mode, opts := range options {
+		if model.MaxTokens > 0 {
+			opts.MaxTokens = model.MaxTokens
+		}
+		if model.Temperature != nil {
+			opts.Temperature = float64Ptr(*model.Temperature)
+		}
+		if model.TopP > 0 && model.TopP < 1 { // 1 is the no-op default
+			opts.TopP = model.TopP
+		}
+		if model.FrequencyPenalty != 0 {
+			opts.FrequencyPenalty = model.FrequencyPenalty
+		}
+		if model.PresencePenalty != 0 {
+			opts.PresencePenalty = model.PresencePenalty
+		}
+		if model.RepeatPenalty > 0 {
+			opts.RepeatPenalty = model.RepeatPenalty
+		}
+		if len(model.StopSequences) > 0 {
+			opts.Stop = model.StopSequences
+		}
+
+		if override, ok := model.Modes[string(mode)]; ok {
+			if override.MaxTokens != nil {
+				opts.MaxTokens = *override.MaxTokens
+			}
+			if override.Temperature != nil {
+				opts.Temperature = float64Ptr(*override.Temperature)
+			}
+			if override.TopP != nil {
+				opts.TopP = *override.TopP
+			}
+			if override.FrequencyPenalty != nil {
+				opts.FrequencyPenalty = *override.FrequencyPenalty
+			}
+			if override.PresencePenalty != nil {
+				opts.PresencePenalty = *override.PresencePenalty
+			}
+			if override.RepeatPenalty != nil {
+				opts.RepeatPenalty = *override.RepeatPenalty
+			}
+			if override.StopSequences != nil {
+				opts.Stop = override.StopSequences
+			}
+		}
+		options[mode] = opts
+	}
+	return options
+}
+
+// get returns the options for a mode, falling back to the defaults
+func (m ModeOptions) get(mode Mode) RequestOptions {
+	if opts, ok := m[mode]; ok {
+		return opts
+	}
+	return DefaultModeOptions()[mode]
+}
+
+// forRequest returns the options for the mode selected with WithMode, or for
+// fallback when the context selects none
+func (m ModeOptions) forRequest(ctx context.Context, fallback Mode) RequestOptions {
+	return m.get(modeOf(ctx, fallback))
+}
+
+// modeOf returns the mode selected with WithMode, or fallback
+func modeOf(ctx context.Context, fallback Mode) Mode {
+	if mode, ok := ctx.Value(modeKey{}).(Mode); ok {
+		return mode
+	}
+	return fallback
+}
+
+type modeKey struct{}
+
+// WithMode returns a context that makes providers use the options of mode,
+// e.g. ModeTitle for a Chat call generating a title
+func WithMode(ctx context.Context, mode Mode) context.Context {
+	return context.WithValue(ctx, modeKey{}, mode)
+}
+
+// openAIRequest returns req with the sampling parameters of opts
+func openAIRequest(req openai.ChatCompletionRequest, opts RequestOptions) openai.ChatCompletionRequest {
+	req.MaxTokens = opts.MaxTokens
+	if opts.Temperature != nil {
+		req.Temperature = float32(*opts.Temperature)
+		if req.Temperature == 0 {
+			// go-openai omits a zero temperature, which the API reads as 1
+			req.Temperature = math.SmallestNonzeroFloat32
+		}
+	}
+	req.TopP = float32(opts.TopP)
+	req.FrequencyPenalty = float32(opts.FrequencyPenalty)
+	req.PresencePenalty = float32(opts.PresencePenalty)
+	req.Stop = opts.Stop
+	return req
+}
+
+// ollamaOptions converts request options to Ollama's option names
+func ollamaOptions(opts RequestOptions) *OllamaOptions {
+	return &OllamaOptions{
+		Temperature:      opts.Temperature,
+		NumPredict:       opts.MaxTokens,
+		TopP:             opts.TopP,
+		FrequencyPenalty: opts.FrequencyPenalty,
+		PresencePenalty:  opts.PresencePenalty,
+		RepeatPenalty:    opts.RepeatPenalty,
+		Stop:             opts.Stop,
+	}
+}
+
+// anthropicRequest returns req with the sampling parameters of opts.
+// max_tokens is required by the API; the penalties are not supported, and
+// recent models reject temperature and top_p together, so top_p wins.
+func anthropicRequest(req AnthropicRequest, opts RequestOptions) AnthropicRequest {
+	req.MaxTokens = opts.MaxTokens
+	if req.MaxTokens <= 0 {
+		req.MaxTokens = DefaultModeOptions()[ModeChat].MaxTokens
+	}
+	req.Temperature = opts.Temperature
+	if opts.TopP > 0 {
+		req.Temperature = nil
+		req.TopP = opts.TopP
+	}
+	req.StopSequences = opts.Stop
+	return req
+}
+
+func float64Ptr(v float64) *float64 {
+	return &v
+}
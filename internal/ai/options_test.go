@@ -0,0 +1,233 @@
+// Package ai request options tests
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/sonemaro/sosomi/internal/config"
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+func TestModeOptionsFromConfig_Defaults(t *testing.T) {
+	options := ModeOptionsFromConfig(config.DefaultConfig().Model)
+
+	expected := map[Mode]RequestOptions{
+		ModeCommand: {MaxTokens: 2048, Temperature: float64Ptr(0.1)},
+		ModeChat:    {MaxTokens: 2048, Temperature: float64Ptr(0.7)},
+		ModeTitle:   {MaxTokens: 64, Temperature: float64Ptr(0.3)},
+		ModeSummary: {MaxTokens: 512, Temperature: float64Ptr(0.2)},
+	}
+	for mode, want := range expected {
+		got := options[mode]
+		if got.MaxTokens != want.MaxTokens || *got.Temperature != *want.Temperature {
+			t.Errorf("%s: expected %d/%.1f, got %d/%.1f", mode, want.MaxTokens, *want.Temperature, got.MaxTokens, *got.Temperature)
+		}
+		if got.TopP != 0 {
+			t.Errorf("%s: expected top_p 1.0 to be left out, got %.2f", mode, got.TopP)
+		}
+	}
+}
+
+func TestModeOptionsFromConfig_Layering(t *testing.T) {
+	zero := 0.0
+	maxTokens := 256
+	model := config.ModelConfig{
+		MaxTokens:     512,
+		Temperature:   float64Ptr(0.2),
+		TopP:          0.9,
+		RepeatPenalty: 1.1,
+		StopSequences: []string{"\n\n"},
+		Modes: map[string]config.ModelOverrides{
+			"command": {Temperature: &zero},
+			"title":   {MaxTokens: &maxTokens, StopSequences: []string{}},
+		},
+	}
+
+	options := ModeOptionsFromConfig(model)
+
+	command := options[ModeCommand]
+	if command.MaxTokens != 512 || command.Temperature == nil || *command.Temperature != 0 {
+		t.Errorf("Expected base max_tokens and explicit zero temperature, got %+v", command)
+	}
+	chat := options[ModeChat]
+	if chat.MaxTokens != 512 || *chat.Temperature != 0.2 || chat.TopP != 0.9 || chat.RepeatPenalty != 1.1 {
+		t.Errorf("Expected base parameters for chat, got %+v", chat)
+	}
+	if len(chat.Stop) != 1 {
+		t.Errorf("Expected base stop sequences for chat, got %v", chat.Stop)
+	}
+	title := options[ModeTitle]
+	if title.MaxTokens != 256 || len(title.Stop) != 0 {
+		t.Errorf("Expected title overrides, got %+v", title)
+	}
+
+	// A zero base temperature is sent to every mode without an override
+	options = ModeOptionsFromConfig(config.ModelConfig{Temperature: &zero})
+	for mode, opts := range options {
+		if opts.Temperature == nil || *opts.Temperature != 0 {
+			t.Errorf("%s: expected zero temperature, got %v", mode, opts.Temperature)
+		}
+	}
+}
+
+func TestModeOptions_ForRequest(t *testing.T) {
+	options := DefaultModeOptions()
+
+	if got := options.forRequest(context.Background(), ModeCommand); got.MaxTokens != 1024 {
+		t.Errorf("Expected command options without a mode, got %+v", got)
+	}
+	if got := options.forRequest(WithMode(context.Background(), ModeTitle), ModeChat); got.MaxTokens != 64 {
+		t.Errorf("Expected title options from the context, got %+v", got)
+	}
+	if got := (ModeOptions{}).get(ModeChat); got.MaxTokens != 2048 {
+		t.Errorf("Expected defaults for a missing mode, got %+v", got)
+	}
+}
+
+func TestOpenAIRequest_ZeroTemperature(t *testing.T) {
+	req := openAIRequest(openai.ChatCompletionRequest{}, RequestOptions{Temperature: float64Ptr(0)})
+
+	data, _ := json.Marshal(req)
+	var body map[string]interface{}
+	json.Unmarshal(data, &body)
+	if _, ok := body["temperature"]; !ok {
+		t.Errorf("Expected an explicit zero temperature to be sent, got %s", data)
+	}
+}
+
+func TestAnthropicRequest_TopPReplacesTemperature(t *testing.T) {
+	req := anthropicRequest(AnthropicRequest{}, RequestOptions{Temperature: float64Ptr(0.5), TopP: 0.8})
+	if req.Temperature != nil || req.TopP != 0.8 {
+		t.Errorf("Expected top_p only, got temperature %v top_p %.2f", req.Temperature, req.TopP)
+	}
+	if req.MaxTokens != 2048 {
+		t.Errorf("Expected the default max_tokens, got %d", req.MaxTokens)
+	}
+}
+
+// captureRequest starts a server that records the JSON body of the last
+// request and answers with the given response
+func captureRequest(t *testing.T, response string, body *map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, response)
+	}))
+}
+
+func testOptions() ModeOptions {
+	options := DefaultModeOptions()
+	options[ModeCommand] = RequestOptions{
+		MaxTokens:        300,
+		Temperature:      float64Ptr(0.05),
+		TopP:             0.5,
+		FrequencyPenalty: 0.3,
+		PresencePenalty:  0.4,
+		RepeatPenalty:    1.15,
+		Stop:             []string{"END"},
+	}
+	return options
+}
+
+func TestOpenAIProvider_SendsOptions(t *testing.T) {
+	var body map[string]interface{}
+	server := captureRequest(t, `{"choices":[{"message":{"role":"assistant","content":"{\"command\":\"ls\",\"explanation\":\"list\",\"risk_level\":\"safe\"}"}}]}`, &body)
+	defer server.Close()
+
+	provider, _ := NewLMStudioProvider(server.URL+"/v1", "qwen2.5-coder")
+	provider.SetOptions(testOptions())
+	if _, err := provider.GenerateCommand(context.Background(), "list files", types.SystemContext{}); err != nil {
+		t.Fatalf("GenerateCommand failed: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"max_tokens": 300.0, "temperature": 0.05, "top_p": 0.5,
+		"frequency_penalty": 0.3, "presence_penalty": 0.4,
+	}
+	for key, value := range want {
+		if got, ok := body[key].(float64); !ok || fmt.Sprintf("%.2f", got) != fmt.Sprintf("%.2f", value) {
+			t.Errorf("Expected %s=%v, got %v", key, value, body[key])
+		}
+	}
+	if stop, _ := body["stop"].([]interface{}); len(stop) != 1 || stop[0] != "END" {
+		t.Errorf("Expected stop sequences, got %v", body["stop"])
+	}
+}
+
+func TestOllamaProvider_SendsOptions(t *testing.T) {
+	var body map[string]interface{}
+	server := captureRequest(t, `{"message":{"role":"assistant","content":"{\"command\":\"ls\",\"explanation\":\"list\",\"risk_level\":\"safe\"}"},"done":true}`, &body)
+	defer server.Close()
+
+	provider, _ := NewOllamaProvider(server.URL, "llama3.2")
+	provider.SetOptions(testOptions())
+	if _, err := provider.GenerateCommand(context.Background(), "list files", types.SystemContext{}); err != nil {
+		t.Fatalf("GenerateCommand failed: %v", err)
+	}
+
+	options, _ := body["options"].(map[string]interface{})
+	want := map[string]interface{}{
+		"num_predict": 300.0, "temperature": 0.05, "top_p": 0.5, "repeat_penalty": 1.15,
+		"frequency_penalty": 0.3, "presence_penalty": 0.4,
+	}
+	for key, value := range want {
+		if options[key] != value {
+			t.Errorf("Expected options.%s=%v, got %v", key, value, options[key])
+		}
+	}
+	if stop, _ := options["stop"].([]interface{}); len(stop) != 1 || stop[0] != "END" {
+		t.Errorf("Expected options.stop, got %v", options["stop"])
+	}
+}
+
+func TestAnthropicProvider_SendsOptions(t *testing.T) {
+	var body map[string]interface{}
+	server := captureRequest(t, `{"content":[{"type":"text","text":"Paris"}],"usage":{"input_tokens":5,"output_tokens":1}}`, &body)
+	defer server.Close()
+
+	provider, _ := NewAnthropicProvider("key", server.URL, "claude-haiku-4-5")
+	options := DefaultModeOptions()
+	options[ModeChat] = RequestOptions{MaxTokens: 100, Temperature: float64Ptr(0), Stop: []string{"Human:"}}
+	provider.SetOptions(options)
+	if _, err := provider.Chat(context.Background(), []Message{{Role: "user", Content: "Capital of France?"}}); err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+
+	if body["max_tokens"] != 100.0 || body["temperature"] != 0.0 {
+		t.Errorf("Expected max_tokens 100 and temperature 0, got %v and %v", body["max_tokens"], body["temperature"])
+	}
+	if stop, _ := body["stop_sequences"].([]interface{}); len(stop) != 1 {
+		t.Errorf("Expected stop_sequences, got %v", body["stop_sequences"])
+	}
+	if _, ok := body["frequency_penalty"]; ok {
+		t.Error("Expected no penalties in an Anthropic request")
+	}
+}
+
+func TestNewProviderFromConfig_AppliesOptions(t *testing.T) {
+	config.Init("")
+
+	cfg := config.Get()
+	original := *cfg
+	defer func() { *cfg = original }()
+	cfg.Provider.Name = "ollama"
+	cfg.Model.MaxTokens = 4096
+
+	provider, err := NewProviderFromConfig()
+	if err != nil {
+		t.Fatalf("NewProviderFromConfig failed: %v", err)
+	}
+	ollama := provider.(*RetryProvider).Provider.(*OllamaProvider)
+	if ollama.options[ModeCommand].MaxTokens != 4096 || ollama.options[ModeTitle].MaxTokens != 64 {
+		t.Errorf("Expected configured max_tokens with the title override kept, got %+v", ollama.options)
+	}
+}
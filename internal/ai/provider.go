@@ -12,6 +12,9 @@ type Provider interface {
 	// Name returns the provider name
 	Name() string
 
+	// Model returns the model that requests are sent to
+	Model() string
+
 	// GenerateCommand generates a shell command from a natural language prompt
 	GenerateCommand(ctx context.Context, prompt string, sysCtx types.SystemContext) (*types.CommandResponse, error)
 
@@ -24,6 +27,9 @@ type Provider interface {
 	// Chat sends a chat message and returns the response
 	Chat(ctx context.Context, messages []Message) (string, error)
 
+	// ChatWithUsage sends a chat message and returns the response with its token usage
+	ChatWithUsage(ctx context.Context, messages []Message) (*ChatResponse, error)
+
 	// ChatStream sends a chat message with streaming response
 	ChatStream(ctx context.Context, messages []Message) (<-chan StreamChunk, error)
 
@@ -33,8 +39,12 @@ type Provider interface {
 	// SupportsTools returns whether the provider supports function/tool calling
 	SupportsTools() bool
 
-	// CallTool executes a tool call
-	CallTool(ctx context.Context, tool types.MCPToolCall) (*types.MCPToolResult, error)
+	// ChatWithTools sends a chat with the given tools available. Tool invocations
+	// requested by the model are returned in ChatResponse.ToolCalls for the caller to run.
+	ChatWithTools(ctx context.Context, messages []Message, tools []types.MCPTool) (*ChatResponse, error)
+
+	// SetOptions sets the sampling parameters used for each request mode
+	SetOptions(options ModeOptions)
 }
 
 // RefineRequest contains the context for refining a command
@@ -50,21 +60,29 @@ type RefineRequest struct {
 
 // Message represents a chat message
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`   // Tools requested by an assistant message
+	ToolCallID string     `json:"tool_call_id,omitempty"` // Call answered by a "tool" message
+	ToolName   string     `json:"tool_name,omitempty"`    // Tool that produced a "tool" message
+	IsError    bool       `json:"is_error,omitempty"`     // The "tool" message reports a failed call
+
+	// Execution marks the output of a command the user ran, which is kept
+	// when old messages are trimmed to fit the context window
+	Execution bool `json:"-"`
+	// Summary marks the system message standing in for the summarized
+	// part of the conversation
+	Summary bool `json:"-"`
 }
 
 // TokenUsage represents token usage statistics from an API call
-type TokenUsage struct {
-	PromptTokens     int `json:"prompt_tokens"`
-	CompletionTokens int `json:"completion_tokens"`
-	TotalTokens      int `json:"total_tokens"`
-}
+type TokenUsage = types.TokenUsage
 
 // ChatResponse represents a chat response with token usage
 type ChatResponse struct {
-	Content string     `json:"content"`
-	Usage   TokenUsage `json:"usage"`
+	Content   string     `json:"content"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	Usage     TokenUsage `json:"usage"`
 }
 
 // StreamChunk represents a chunk of streamed response
@@ -126,6 +144,22 @@ If you cannot or should not generate a command, respond with:
   "warnings": ["explanation of the issue"]
 }`
 
+// CommandResponseSchema is the JSON schema of the response format defined in
+// SystemPrompt, used to constrain the output of servers that support it
+const CommandResponseSchema = `{
+  "type": "object",
+  "properties": {
+    "command": {"type": "string"},
+    "explanation": {"type": "string"},
+    "risk_level": {"type": "string", "enum": ["safe", "caution", "dangerous", "critical"]},
+    "confidence": {"type": "number", "minimum": 0, "maximum": 1},
+    "warnings": {"type": "array", "items": {"type": "string"}},
+    "alternatives": {"type": "array", "items": {"type": "string"}}
+  },
+  "required": ["command", "explanation", "risk_level", "confidence", "warnings", "alternatives"],
+  "additionalProperties": false
+}`
+
 // RefinePrompt is the system prompt for refining commands based on feedback
 const RefinePrompt = `You are Sosomi, an expert shell command assistant. The user tried a command but it didn't work as expected. Your job is to fix or improve the command based on their feedback.
 
@@ -164,6 +198,23 @@ func BuildSystemContext(ctx types.SystemContext) string {
 		result += "- Git Status: " + ctx.GitStatus + "\n"
 	}
 
+	env := ctx.Environment
+	if env.KubeContext != "" {
+		result += "- Kube Context: " + env.KubeContext + " (namespace " + env.KubeNamespace + ")\n"
+	}
+	if env.AWSProfile != "" {
+		result += "- AWS Profile: " + env.AWSProfile + "\n"
+	}
+	if env.GCloudProject != "" {
+		result += "- GCloud Project: " + env.GCloudProject + "\n"
+	}
+	if env.TerraformWorkspace != "" {
+		result += "- Terraform Workspace: " + env.TerraformWorkspace + "\n"
+	}
+	if env.DBHost != "" {
+		result += "- Database Host: " + env.DBHost + "\n"
+	}
+
 	if len(ctx.InstalledPkgMgrs) > 0 {
 		result += "- Package Managers: "
 		for i, pm := range ctx.InstalledPkgMgrs {
@@ -0,0 +1,210 @@
+// Package ai provides retries with backoff for transient provider failures
+package ai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// RetryPolicy controls how failed requests are retried
+type RetryPolicy struct {
+	MaxRetries int           // Retries after the first attempt; 0 disables retrying
+	BaseDelay  time.Duration // Delay before the first retry, doubled for each further one
+	MaxDelay   time.Duration // Upper bound of the backoff delay
+}
+
+// DefaultRetryPolicy returns the policy used for maxRetries retries
+func DefaultRetryPolicy(maxRetries int) RetryPolicy {
+	return RetryPolicy{
+		MaxRetries: maxRetries,
+		BaseDelay:  500 * time.Millisecond,
+		MaxDelay:   30 * time.Second,
+	}
+}
+
+// backoff returns the jittered delay before retry number n (0-based)
+func (r RetryPolicy) backoff(n int) time.Duration {
+	delay := r.BaseDelay << n
+	if delay <= 0 || delay > r.MaxDelay {
+		delay = r.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	// Full delay at most, half of it at least
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// RetryProvider wraps a provider and retries requests that failed with a
+// rate limit (429), a server error (5xx) or a connection error
+type RetryProvider struct {
+	Provider
+	policy RetryPolicy
+}
+
+// NewRetryProvider wraps provider with the given retry policy
+func NewRetryProvider(provider Provider, policy RetryPolicy) *RetryProvider {
+	return &RetryProvider{Provider: provider, policy: policy}
+}
+
+func (p *RetryProvider) GenerateCommand(ctx context.Context, prompt string, sysCtx types.SystemContext) (*types.CommandResponse, error) {
+	return withRetry(ctx, p.policy, func(ctx context.Context) (*types.CommandResponse, error) {
+		return p.Provider.GenerateCommand(ctx, prompt, sysCtx)
+	})
+}
+
+func (p *RetryProvider) RefineCommand(ctx context.Context, req RefineRequest, sysCtx types.SystemContext) (*types.CommandResponse, error) {
+	return withRetry(ctx, p.policy, func(ctx context.Context) (*types.CommandResponse, error) {
+		return p.Provider.RefineCommand(ctx, req, sysCtx)
+	})
+}
+
+// GenerateCommandStream retries opening the stream; errors once chunks
+// have been delivered are passed on as they are
+func (p *RetryProvider) GenerateCommandStream(ctx context.Context, prompt string, sysCtx types.SystemContext) (<-chan StreamChunk, error) {
+	return withRetry(ctx, p.policy, func(ctx context.Context) (<-chan StreamChunk, error) {
+		return p.Provider.GenerateCommandStream(ctx, prompt, sysCtx)
+	})
+}
+
+func (p *RetryProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+	return withRetry(ctx, p.policy, func(ctx context.Context) (string, error) {
+		return p.Provider.Chat(ctx, messages)
+	})
+}
+
+func (p *RetryProvider) ChatWithUsage(ctx context.Context, messages []Message) (*ChatResponse, error) {
+	return withRetry(ctx, p.policy, func(ctx context.Context) (*ChatResponse, error) {
+		return p.Provider.ChatWithUsage(ctx, messages)
+	})
+}
+
+// ChatStream retries opening the stream, like GenerateCommandStream
+func (p *RetryProvider) ChatStream(ctx context.Context, messages []Message) (<-chan StreamChunk, error) {
+	return withRetry(ctx, p.policy, func(ctx context.Context) (<-chan StreamChunk, error) {
+		return p.Provider.ChatStream(ctx, messages)
+	})
+}
+
+func (p *RetryProvider) ListModels(ctx context.Context) ([]string, error) {
+	return withRetry(ctx, p.policy, func(ctx context.Context) ([]string, error) {
+		return p.Provider.ListModels(ctx)
+	})
+}
+
+func (p *RetryProvider) ChatWithTools(ctx context.Context, messages []Message, tools []types.MCPTool) (*ChatResponse, error) {
+	return withRetry(ctx, p.policy, func(ctx context.Context) (*ChatResponse, error) {
+		return p.Provider.ChatWithTools(ctx, messages, tools)
+	})
+}
+
+// withRetry runs call until it succeeds, fails with an error that is not
+// transient, or the retries are used up. The wait before a retry is the
+// server's Retry-After when given, the jittered backoff otherwise.
+func withRetry[T any](ctx context.Context, policy RetryPolicy, call func(ctx context.Context) (T, error)) (T, error) {
+	for n := 0; ; n++ {
+		a := &attempt{}
+		result, err := call(context.WithValue(ctx, attemptKey{}, a))
+		if err == nil || n >= policy.MaxRetries || ctx.Err() != nil || !a.retryable(err) {
+			return result, err
+		}
+
+		delay := a.retryAfter()
+		if delay <= 0 {
+			delay = policy.backoff(n)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, err
+		case <-timer.C:
+		}
+	}
+}
+
+type attemptKey struct{}
+
+// attempt records the last HTTP response of a request attempt. Providers
+// report errors in their own formats, so the status and Retry-After header
+// are captured by the transport instead of being parsed from the errors.
+type attempt struct {
+	mu     sync.Mutex
+	status int
+	header http.Header
+}
+
+func (a *attempt) record(resp *http.Response) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.status = resp.StatusCode
+	a.header = resp.Header
+}
+
+// retryable reports whether err is a rate limit, a server error or a
+// connection failure
+func (a *attempt) retryable(err error) bool {
+	a.mu.Lock()
+	status := a.status
+	a.mu.Unlock()
+
+	if status == http.StatusTooManyRequests || status >= 500 {
+		return true
+	}
+	if status != 0 {
+		return false
+	}
+	var netErr *net.OpError
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// retryAfter returns the delay requested by the Retry-After header, if any
+func (a *attempt) retryAfter() time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.header == nil {
+		return 0
+	}
+	return parseRetryAfter(a.header.Get("Retry-After"))
+}
+
+// parseRetryAfter parses a Retry-After value in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// attemptTransport records responses on the attempt in the request context
+type attemptTransport struct {
+	base http.RoundTripper
+}
+
+func (t attemptTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if a, ok := req.Context().Value(attemptKey{}).(*attempt); ok && resp != nil {
+		a.record(resp)
+	}
+	return resp, err
+}
+
+// newHTTPClient returns the HTTP client used by every provider
+func newHTTPClient() *http.Client {
+	return &http.Client{Transport: attemptTransport{base: http.DefaultTransport}}
+}
@@ -0,0 +1,168 @@
+// Package ai retry tests
+package ai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+const ollamaCommandResponse = `{"message":{"role":"assistant","content":"{\"command\":\"ls\",\"explanation\":\"list\",\"risk_level\":\"safe\"}"},"done":true}`
+
+// newFlakyServer fails the first failures requests with status and the
+// given headers, then answers with response
+func newFlakyServer(failures int32, status int, headers map[string]string, response string) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures {
+			for k, v := range headers {
+				w.Header().Set(k, v)
+			}
+			w.WriteHeader(status)
+			fmt.Fprintf(w, `{"error":"failure %d"}`, requests.Load())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, response)
+	}))
+	return server, &requests
+}
+
+func fastRetries(n int) RetryPolicy {
+	return RetryPolicy{MaxRetries: n, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if got := parseRetryAfter("3"); got != 3*time.Second {
+		t.Errorf("Expected 3s, got %v", got)
+	}
+	date := time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(date); got < 8*time.Second || got > 10*time.Second {
+		t.Errorf("Expected about 10s from an HTTP date, got %v", got)
+	}
+	if got := parseRetryAfter("soon"); got != 0 {
+		t.Errorf("Expected 0 for an invalid value, got %v", got)
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for n, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		max *= time.Millisecond
+		for i := 0; i < 20; i++ {
+			if got := policy.backoff(n); got < max/2 || got > max {
+				t.Fatalf("Retry %d: expected a delay in [%v, %v], got %v", n, max/2, max, got)
+			}
+		}
+	}
+}
+
+func TestRetryProvider_RetriesServerErrors(t *testing.T) {
+	server, requests := newFlakyServer(2, http.StatusServiceUnavailable, nil, ollamaCommandResponse)
+	defer server.Close()
+
+	ollama, _ := NewOllamaProvider(server.URL, "llama3.2")
+	provider := NewRetryProvider(ollama, fastRetries(3))
+
+	resp, err := provider.GenerateCommand(context.Background(), "list files", types.SystemContext{})
+	if err != nil {
+		t.Fatalf("Expected success after retries, got %v", err)
+	}
+	if resp.Command != "ls" || requests.Load() != 3 {
+		t.Errorf("Expected 3 requests and a command, got %d and %+v", requests.Load(), resp)
+	}
+}
+
+func TestRetryProvider_GivesUp(t *testing.T) {
+	server, requests := newFlakyServer(10, http.StatusTooManyRequests, nil, ollamaCommandResponse)
+	defer server.Close()
+
+	ollama, _ := NewOllamaProvider(server.URL, "llama3.2")
+	provider := NewRetryProvider(ollama, fastRetries(2))
+
+	if _, err := provider.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}); err == nil {
+		t.Error("Expected an error once the retries are used up")
+	}
+	if requests.Load() != 3 {
+		t.Errorf("Expected 3 requests, got %d", requests.Load())
+	}
+}
+
+func TestRetryProvider_NoRetryOnClientError(t *testing.T) {
+	server, requests := newFlakyServer(1, http.StatusBadRequest, nil, ollamaCommandResponse)
+	defer server.Close()
+
+	ollama, _ := NewOllamaProvider(server.URL, "llama3.2")
+	provider := NewRetryProvider(ollama, fastRetries(3))
+
+	if _, err := provider.GenerateCommand(context.Background(), "list files", types.SystemContext{}); err == nil {
+		t.Error("Expected the 400 to be returned")
+	}
+	if requests.Load() != 1 {
+		t.Errorf("Expected no retry for a client error, got %d requests", requests.Load())
+	}
+}
+
+func TestRetryProvider_RespectsRetryAfter(t *testing.T) {
+	server, requests := newFlakyServer(1, http.StatusTooManyRequests, map[string]string{"Retry-After": "1"},
+		`{"choices":[{"message":{"role":"assistant","content":"pong"}}]}`)
+	defer server.Close()
+
+	local, _ := NewLMStudioProvider(server.URL+"/v1", "qwen2.5-coder")
+	// The backoff alone would wait far longer than Retry-After
+	provider := NewRetryProvider(local, RetryPolicy{MaxRetries: 1, BaseDelay: time.Hour, MaxDelay: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	content, err := provider.Chat(ctx, []Message{{Role: "user", Content: "ping"}})
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second || elapsed > 5*time.Second {
+		t.Errorf("Expected to wait the Retry-After second, waited %v", elapsed)
+	}
+	if content != "pong" || requests.Load() != 2 {
+		t.Errorf("Expected 2 requests and a reply, got %d and %q", requests.Load(), content)
+	}
+}
+
+func TestRetryProvider_ConnectionRefused(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	ollama, _ := NewOllamaProvider(url, "llama3.2")
+	var attempts int
+	_, err := withRetry(context.Background(), fastRetries(2), func(ctx context.Context) ([]string, error) {
+		attempts++
+		return ollama.ListModels(ctx)
+	})
+	if err == nil || attempts != 3 {
+		t.Errorf("Expected 3 attempts against a closed port, got %d (err %v)", attempts, err)
+	}
+}
+
+func TestRetryProvider_StopsWhenContextDone(t *testing.T) {
+	server, requests := newFlakyServer(10, http.StatusBadGateway, nil, ollamaCommandResponse)
+	defer server.Close()
+
+	ollama, _ := NewOllamaProvider(server.URL, "llama3.2")
+	provider := NewRetryProvider(ollama, RetryPolicy{MaxRetries: 5, BaseDelay: time.Hour, MaxDelay: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := provider.Chat(ctx, []Message{{Role: "user", Content: "hi"}}); err == nil {
+		t.Error("Expected an error")
+	}
+	if requests.Load() != 1 {
+		t.Errorf("Expected the wait to end with the context, got %d requests", requests.Load())
+	}
+}
@@ -0,0 +1,132 @@
+// Package ai provides incremental parsing of streamed command responses
+package ai
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// CommandStreamParser collects the chunks of a GenerateCommandStream
+// response. The command is available as soon as its JSON field is
+// complete, before the explanation and the rest of the response arrive.
+type CommandStreamParser struct {
+	content  strings.Builder
+	command  string
+	complete bool
+}
+
+// NewCommandStreamParser creates an empty parser
+func NewCommandStreamParser() *CommandStreamParser {
+	return &CommandStreamParser{}
+}
+
+// Feed adds a chunk of streamed content. It returns true for the chunk
+// that completes the command field, and false before and after it.
+func (p *CommandStreamParser) Feed(delta string) bool {
+	p.content.WriteString(delta)
+	if p.complete {
+		return false
+	}
+	p.command, p.complete = jsonStringField(p.content.String(), "command")
+	return p.complete
+}
+
+// Command returns the command once its field is complete
+func (p *CommandStreamParser) Command() (string, bool) {
+	return p.command, p.complete
+}
+
+// Content returns everything streamed so far
+func (p *CommandStreamParser) Content() string {
+	return p.content.String()
+}
+
+// Response parses the complete stream. Streams are parsed as leniently as
+// local model responses, since not every provider can enforce JSON while
+// streaming.
+func (p *CommandStreamParser) Response() (*types.CommandResponse, error) {
+	return parseLocalModelResponse(p.content.String())
+}
+
+// jsonStringField returns the string value of key in the top-level object
+// of a possibly incomplete JSON document, and whether the value is complete
+func jsonStringField(s, key string) (string, bool) {
+	target := `"` + key + `"`
+	depth := 0
+	expectKey := false
+
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '"':
+			end, ok := scanJSONString(s, i)
+			if !ok {
+				return "", false
+			}
+			if depth != 1 || !expectKey {
+				i = end
+				continue
+			}
+			j := skipJSONSpace(s, end)
+			if j >= len(s) {
+				return "", false
+			}
+			if s[j] != ':' {
+				i = end
+				continue
+			}
+			expectKey = false
+			j = skipJSONSpace(s, j+1)
+			if s[i:end] != target {
+				i = j
+				continue
+			}
+			if j >= len(s) || s[j] != '"' {
+				// Missing so far, or not a string
+				return "", false
+			}
+			valueEnd, ok := scanJSONString(s, j)
+			if !ok {
+				return "", false
+			}
+			var value string
+			if err := json.Unmarshal([]byte(s[j:valueEnd]), &value); err != nil {
+				return "", false
+			}
+			return value, true
+		case '{':
+			depth++
+			expectKey = depth == 1
+		case '[':
+			depth++
+		case '}', ']':
+			depth--
+		case ',':
+			expectKey = depth == 1
+		}
+		i++
+	}
+	return "", false
+}
+
+// scanJSONString returns the index after the string literal starting at
+// s[start], and false if it is not terminated yet
+func scanJSONString(s string, start int) (int, bool) {
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1, true
+		}
+	}
+	return len(s), false
+}
+
+func skipJSONSpace(s string, i int) int {
+	for i < len(s) && strings.ContainsRune(" \t\r\n", rune(s[i])) {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,151 @@
+// Package ai streamed command parsing tests
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+func TestJSONStringField(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		complete bool
+	}{
+		{`{"command": "ls -la", "explanation": "list"}`, "ls -la", true},
+		{`{"command": "ls -la`, "", false},
+		{`{"command": `, "", false},
+		{`{"explanation": "no \"command\": \"here\"", "command": "pwd"}`, "pwd", true},
+		{`{"alternatives": ["x", {"command": "nested"}], "command": "echo \"hi\"\n"}`, "echo \"hi\"\n", true},
+		{"```json\n{\"command\":\"du -sh *\"", "du -sh *", true},
+		{`{"command": null}`, "", false},
+		{`{"risk_level": "safe"}`, "", false},
+	}
+
+	for _, tt := range tests {
+		got, complete := jsonStringField(tt.input, "command")
+		if got != tt.expected || complete != tt.complete {
+			t.Errorf("%q: expected %q/%v, got %q/%v", tt.input, tt.expected, tt.complete, got, complete)
+		}
+	}
+}
+
+func TestCommandStreamParser(t *testing.T) {
+	parser := NewCommandStreamParser()
+	chunks := []string{`{"comm`, `and": "find . -name`, ` '*.log'", "expla`, `nation": "Find logs", "risk_level": "safe"}`}
+
+	completedAt := -1
+	for i, chunk := range chunks {
+		if parser.Feed(chunk) {
+			if completedAt >= 0 {
+				t.Errorf("Expected the command to complete once, again at chunk %d", i)
+			}
+			completedAt = i
+		}
+	}
+	if completedAt != 2 {
+		t.Errorf("Expected the command to complete with chunk 2, got %d", completedAt)
+	}
+	if command, ok := parser.Command(); !ok || command != "find . -name '*.log'" {
+		t.Errorf("Unexpected command %q", command)
+	}
+
+	resp, err := parser.Response()
+	if err != nil {
+		t.Fatalf("Response failed: %v", err)
+	}
+	if resp.Explanation != "Find logs" || resp.RiskLevel != types.RiskSafe {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+}
+
+func TestCommandStreamParser_Unstructured(t *testing.T) {
+	parser := NewCommandStreamParser()
+	parser.Feed("ls -la\nLists all files")
+
+	if _, ok := parser.Command(); ok {
+		t.Error("Expected no command field in plain text")
+	}
+	resp, _ := parser.Response()
+	if resp.Command != "ls -la" || resp.RiskLevel < types.RiskCaution {
+		t.Errorf("Expected a cautious fallback parse, got %+v", resp)
+	}
+}
+
+func TestOllamaProvider_GenerateCommandStream_Parsed(t *testing.T) {
+	var format string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OllamaChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		format = req.Format
+		for _, piece := range []string{`{"command":`, `"uptime"`, `,"explanation":"Show uptime"}`} {
+			fmt.Fprintf(w, "{\"message\":{\"role\":\"assistant\",\"content\":%q},\"done\":false}\n", piece)
+		}
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":10,"eval_count":5}`+"\n")
+	}))
+	defer server.Close()
+
+	provider, _ := NewOllamaProvider(server.URL, "llama3.2")
+	ch, err := provider.GenerateCommandStream(context.Background(), "uptime", types.SystemContext{})
+	if err != nil {
+		t.Fatalf("GenerateCommandStream failed: %v", err)
+	}
+
+	parser := NewCommandStreamParser()
+	for chunk := range ch {
+		if chunk.Error != nil {
+			t.Fatalf("Stream error: %v", chunk.Error)
+		}
+		parser.Feed(chunk.Content)
+	}
+	if format != "json" {
+		t.Errorf("Expected JSON format to be requested, got %q", format)
+	}
+	resp, _ := parser.Response()
+	if resp.Command != "uptime" || resp.Explanation != "Show uptime" {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+}
+
+func TestOllamaProvider_GenerateCommandStream_Canceled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":"{\"command\":"},"done":false}`+"\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	provider, _ := NewOllamaProvider(server.URL, "llama3.2")
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := provider.GenerateCommandStream(ctx, "uptime", types.SystemContext{})
+	if err != nil {
+		t.Fatalf("GenerateCommandStream failed: %v", err)
+	}
+
+	<-ch
+	cancel()
+
+	select {
+	case chunk := <-ch:
+		if chunk.Error == nil || !strings.Contains(chunk.Error.Error(), "canceled") {
+			t.Errorf("Expected a cancellation error, got %+v", chunk)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the stream to end after cancel")
+	}
+}
@@ -0,0 +1,238 @@
+// Package ai provides native tool calling support shared by the providers
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// ToolCall is a tool invocation requested by the model
+type ToolCall struct {
+	ID        string                 `json:"id"`
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+	// RawArguments holds the arguments exactly as the model sent them.
+	// Arguments is nil when they could not be parsed as a JSON object.
+	RawArguments string `json:"raw_arguments,omitempty"`
+}
+
+// argumentsJSON returns the call arguments as a JSON string
+func (c ToolCall) argumentsJSON() string {
+	if c.RawArguments != "" {
+		return c.RawArguments
+	}
+	if c.Arguments == nil {
+		return "{}"
+	}
+	data, err := json.Marshal(c.Arguments)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+// parseToolArguments decodes a JSON arguments string
+func parseToolArguments(raw string) map[string]interface{} {
+	if raw == "" {
+		return map[string]interface{}{}
+	}
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &args); err != nil {
+		return nil
+	}
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	return args
+}
+
+// toolParameters returns a tool's input schema, defaulting to an empty object schema
+func toolParameters(tool types.MCPTool) map[string]interface{} {
+	if tool.InputSchema != nil {
+		return tool.InputSchema
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{},
+	}
+}
+
+// toOpenAIMessages converts messages, including tool calls and tool results, to OpenAI format
+func toOpenAIMessages(messages []Message) []openai.ChatCompletionMessage {
+	result := make([]openai.ChatCompletionMessage, len(messages))
+	for i, msg := range messages {
+		result[i] = openai.ChatCompletionMessage{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			ToolCallID: msg.ToolCallID,
+		}
+		for _, call := range msg.ToolCalls {
+			result[i].ToolCalls = append(result[i].ToolCalls, openai.ToolCall{
+				ID:   call.ID,
+				Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{
+					Name:      call.Name,
+					Arguments: call.argumentsJSON(),
+				},
+			})
+		}
+	}
+	return result
+}
+
+// maxFunctionNameLen is the longest function name OpenAI accepts
+const maxFunctionNameLen = 64
+
+// toolNames maps tool names to OpenAI function names, which may only contain
+// [a-zA-Z0-9_-]. Namespaced MCP tools (server.tool) are sent as server__tool
+// and mapped back when the model calls them.
+type toolNames struct {
+	toAPI   map[string]string
+	fromAPI map[string]string
+}
+
+// newToolNames assigns function names to tools
+func newToolNames(tools []types.MCPTool) *toolNames {
+	n := &toolNames{
+		toAPI:   make(map[string]string),
+		fromAPI: make(map[string]string),
+	}
+	for _, tool := range tools {
+		n.api(tool.Name)
+	}
+	return n
+}
+
+// api returns the function name sent for a tool, assigning a unique one on first use
+func (n *toolNames) api(name string) string {
+	if apiName, ok := n.toAPI[name]; ok {
+		return apiName
+	}
+
+	base := sanitizeFunctionName(name)
+	apiName := base
+	for i := 2; ; i++ {
+		if _, taken := n.fromAPI[apiName]; !taken {
+			break
+		}
+		suffix := fmt.Sprintf("_%d", i)
+		apiName = base[:min(len(base), maxFunctionNameLen-len(suffix))] + suffix
+	}
+
+	n.toAPI[name] = apiName
+	n.fromAPI[apiName] = name
+	return apiName
+}
+
+// original returns the tool name for a function name used by the model
+func (n *toolNames) original(apiName string) string {
+	if name, ok := n.fromAPI[apiName]; ok {
+		return name
+	}
+	return apiName
+}
+
+// sanitizeFunctionName converts a tool name to a valid OpenAI function name
+func sanitizeFunctionName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			b.WriteRune(r)
+		case r == '.':
+			b.WriteString("__")
+		default:
+			b.WriteByte('_')
+		}
+	}
+
+	result := b.String()
+	if len(result) > maxFunctionNameLen {
+		result = result[:maxFunctionNameLen]
+	}
+	if result == "" {
+		result = "tool"
+	}
+	return result
+}
+
+// toOpenAITools converts MCP tools to OpenAI function definitions
+func toOpenAITools(tools []types.MCPTool, names *toolNames) []openai.Tool {
+	if len(tools) == 0 {
+		return nil
+	}
+	result := make([]openai.Tool, len(tools))
+	for i, tool := range tools {
+		result[i] = openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        names.api(tool.Name),
+				Description: tool.Description,
+				Parameters:  toolParameters(tool),
+			},
+		}
+	}
+	return result
+}
+
+// fromOpenAIToolCalls converts OpenAI tool calls to ToolCalls
+func fromOpenAIToolCalls(calls []openai.ToolCall, names *toolNames) []ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+	result := make([]ToolCall, len(calls))
+	for i, call := range calls {
+		id := call.ID
+		if id == "" {
+			id = fmt.Sprintf("call_%d", i)
+		}
+		result[i] = ToolCall{
+			ID:           id,
+			Name:         names.original(call.Function.Name),
+			Arguments:    parseToolArguments(call.Function.Arguments),
+			RawArguments: call.Function.Arguments,
+		}
+	}
+	return result
+}
+
+// chatCompletionWithTools sends a chat completion request with tools through an OpenAI-compatible client
+func chatCompletionWithTools(ctx context.Context, client *openai.Client, model string, opts RequestOptions, messages []Message, tools []types.MCPTool) (*ChatResponse, error) {
+	names := newToolNames(tools)
+	openaiMessages := toOpenAIMessages(messages)
+	for i := range openaiMessages {
+		for j := range openaiMessages[i].ToolCalls {
+			call := &openaiMessages[i].ToolCalls[j].Function
+			call.Name = names.api(call.Name)
+		}
+	}
+
+	resp, err := client.CreateChatCompletion(ctx, openAIRequest(openai.ChatCompletionRequest{
+		Model:    model,
+		Messages: openaiMessages,
+		Tools:    toOpenAITools(tools, names),
+	}, opts))
+	if err != nil {
+		return nil, fmt.Errorf("chat failed: %w", err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no response")
+	}
+
+	return &ChatResponse{
+		Content:   resp.Choices[0].Message.Content,
+		ToolCalls: fromOpenAIToolCalls(resp.Choices[0].Message.ToolCalls, names),
+		Usage: TokenUsage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		},
+	}, nil
+}
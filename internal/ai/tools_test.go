@@ -0,0 +1,285 @@
+// Package ai tests for tool calling
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+var testTools = []types.MCPTool{
+	{
+		Name:        "read_file",
+		Description: "Read the contents of a file",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{"type": "string"},
+			},
+			"required": []string{"path"},
+		},
+	},
+	{Name: "no_schema", Description: "Tool without a schema"},
+}
+
+func TestParseToolArguments(t *testing.T) {
+	args := parseToolArguments(`{"path": "/tmp/a", "lines": 3}`)
+	if args["path"] != "/tmp/a" || args["lines"] != float64(3) {
+		t.Errorf("Unexpected arguments: %v", args)
+	}
+
+	if args := parseToolArguments(""); args == nil || len(args) != 0 {
+		t.Errorf("Expected empty map for empty arguments, got %v", args)
+	}
+
+	if args := parseToolArguments(`{"path": `); args != nil {
+		t.Errorf("Expected nil for invalid JSON, got %v", args)
+	}
+}
+
+func TestToOpenAIMessages_ToolRoundTrip(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "show /tmp/a"},
+		{Role: "assistant", ToolCalls: []ToolCall{
+			{ID: "call_1", Name: "read_file", Arguments: map[string]interface{}{"path": "/tmp/a"}},
+		}},
+		{Role: "tool", Content: "hello", ToolCallID: "call_1", ToolName: "read_file"},
+	}
+
+	result := toOpenAIMessages(messages)
+	if len(result) != 3 {
+		t.Fatalf("Expected 3 messages, got %d", len(result))
+	}
+
+	calls := result[1].ToolCalls
+	if len(calls) != 1 || calls[0].ID != "call_1" || calls[0].Type != openai.ToolTypeFunction {
+		t.Fatalf("Unexpected tool calls: %+v", calls)
+	}
+	if calls[0].Function.Arguments != `{"path":"/tmp/a"}` {
+		t.Errorf("Unexpected arguments: %s", calls[0].Function.Arguments)
+	}
+	if result[2].ToolCallID != "call_1" {
+		t.Errorf("Expected tool_call_id call_1, got %q", result[2].ToolCallID)
+	}
+}
+
+func TestToOpenAITools(t *testing.T) {
+	if toOpenAITools(nil, newToolNames(nil)) != nil {
+		t.Error("Expected nil tools for empty list")
+	}
+
+	tools := toOpenAITools(testTools, newToolNames(testTools))
+	if len(tools) != 2 {
+		t.Fatalf("Expected 2 tools, got %d", len(tools))
+	}
+	if tools[0].Function.Name != "read_file" || tools[0].Type != openai.ToolTypeFunction {
+		t.Errorf("Unexpected tool: %+v", tools[0])
+	}
+	params, ok := tools[1].Function.Parameters.(map[string]interface{})
+	if !ok || params["type"] != "object" {
+		t.Errorf("Expected default object schema, got %v", tools[1].Function.Parameters)
+	}
+}
+
+func TestToolNames(t *testing.T) {
+	tools := []types.MCPTool{
+		{Name: "read_file"},
+		{Name: "github.search_issues"},
+		{Name: "github__search_issues"},
+		{Name: "weird tool/name"},
+	}
+	names := newToolNames(tools)
+
+	want := map[string]string{
+		"read_file":             "read_file",
+		"github.search_issues":  "github__search_issues",
+		"github__search_issues": "github__search_issues_2",
+		"weird tool/name":       "weird_tool_name",
+	}
+	for name, apiName := range want {
+		if got := names.api(name); got != apiName {
+			t.Errorf("api(%q) = %q, want %q", name, got, apiName)
+		}
+		if got := names.original(apiName); got != name {
+			t.Errorf("original(%q) = %q, want %q", apiName, got, name)
+		}
+	}
+
+	long := strings.Repeat("a", 80) + ".tool"
+	if got := names.api(long); len(got) != maxFunctionNameLen {
+		t.Errorf("Expected long name truncated to %d characters, got %d", maxFunctionNameLen, len(got))
+	}
+}
+
+func TestOpenAIProvider_ChatWithTools(t *testing.T) {
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &received)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":     "test-id",
+			"object": "chat.completion",
+			"choices": []map[string]interface{}{
+				{
+					"index": 0,
+					"message": map[string]interface{}{
+						"role":    "assistant",
+						"content": "",
+						"tool_calls": []map[string]interface{}{
+							{
+								"id":   "call_abc",
+								"type": "function",
+								"function": map[string]interface{}{
+									"name":      "read_file",
+									"arguments": `{"path":"/etc/hostname"}`,
+								},
+							},
+						},
+					},
+					"finish_reason": "tool_calls",
+				},
+			},
+			"usage": map[string]interface{}{"prompt_tokens": 50, "completion_tokens": 10, "total_tokens": 60},
+		})
+	}))
+	defer server.Close()
+
+	provider, err := NewOpenAIProvider("test-key", server.URL, "gpt-4o")
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+
+	resp, err := provider.ChatWithTools(context.Background(), []Message{{Role: "user", Content: "hostname?"}}, testTools)
+	if err != nil {
+		t.Fatalf("ChatWithTools failed: %v", err)
+	}
+
+	tools, ok := received["tools"].([]interface{})
+	if !ok || len(tools) != 2 {
+		t.Fatalf("Expected 2 tools in request, got %v", received["tools"])
+	}
+
+	if len(resp.ToolCalls) != 1 {
+		t.Fatalf("Expected 1 tool call, got %d", len(resp.ToolCalls))
+	}
+	call := resp.ToolCalls[0]
+	if call.ID != "call_abc" || call.Name != "read_file" || call.Arguments["path"] != "/etc/hostname" {
+		t.Errorf("Unexpected tool call: %+v", call)
+	}
+	if resp.Usage.TotalTokens != 60 {
+		t.Errorf("Expected 60 total tokens, got %d", resp.Usage.TotalTokens)
+	}
+}
+
+func TestLocalOpenAIProvider_ChatWithTools(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{
+					"message": map[string]interface{}{
+						"role":    "assistant",
+						"content": "The file says hello.",
+					},
+				},
+			},
+		})
+	}))
+	defer server.Close()
+
+	provider, _ := NewLlamaCppProvider(server.URL, "local-model")
+
+	resp, err := provider.ChatWithTools(context.Background(), []Message{{Role: "user", Content: "hi"}}, testTools)
+	if err != nil {
+		t.Fatalf("ChatWithTools failed: %v", err)
+	}
+	if resp.Content != "The file says hello." || len(resp.ToolCalls) != 0 {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+}
+
+func TestOllamaProvider_ChatWithTools(t *testing.T) {
+	var received OllamaChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OllamaChatResponse{
+			Model: "llama3.2",
+			Message: OllamaMessage{
+				Role: "assistant",
+				ToolCalls: []OllamaToolCall{
+					{Function: OllamaToolCallFunction{Name: "read_file", Arguments: map[string]interface{}{"path": "/tmp/x"}}},
+					{Function: OllamaToolCallFunction{Name: "no_schema"}},
+				},
+			},
+			Done:            true,
+			PromptEvalCount: 20,
+			EvalCount:       5,
+		})
+	}))
+	defer server.Close()
+
+	provider, _ := NewOllamaProvider(server.URL, "llama3.2")
+
+	messages := []Message{
+		{Role: "user", Content: "read it"},
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_0", Name: "read_file", Arguments: map[string]interface{}{"path": "/tmp/y"}}}},
+		{Role: "tool", Content: "contents", ToolCallID: "call_0", ToolName: "read_file"},
+	}
+
+	resp, err := provider.ChatWithTools(context.Background(), messages, testTools)
+	if err != nil {
+		t.Fatalf("ChatWithTools failed: %v", err)
+	}
+
+	if len(received.Tools) != 2 || received.Tools[0].Type != "function" || received.Tools[0].Function.Name != "read_file" {
+		t.Errorf("Unexpected tools in request: %+v", received.Tools)
+	}
+	if len(received.Messages[1].ToolCalls) != 1 || received.Messages[1].ToolCalls[0].Function.Arguments["path"] != "/tmp/y" {
+		t.Errorf("Expected assistant tool call to be sent back, got %+v", received.Messages[1])
+	}
+	if received.Messages[2].ToolName != "read_file" {
+		t.Errorf("Expected tool_name on tool message, got %+v", received.Messages[2])
+	}
+
+	if len(resp.ToolCalls) != 2 {
+		t.Fatalf("Expected 2 tool calls, got %d", len(resp.ToolCalls))
+	}
+	if resp.ToolCalls[0].ID != "call_0" || resp.ToolCalls[1].ID != "call_1" {
+		t.Errorf("Expected positional IDs, got %q and %q", resp.ToolCalls[0].ID, resp.ToolCalls[1].ID)
+	}
+	if resp.ToolCalls[1].Arguments == nil {
+		t.Error("Expected empty arguments map, got nil")
+	}
+	if resp.Usage.TotalTokens != 25 {
+		t.Errorf("Expected 25 total tokens, got %d", resp.Usage.TotalTokens)
+	}
+}
+
+func TestOllamaProvider_Chat_OmitsTools(t *testing.T) {
+	var raw map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&raw)
+		json.NewEncoder(w).Encode(OllamaChatResponse{Message: OllamaMessage{Role: "assistant", Content: "hi"}, Done: true})
+	}))
+	defer server.Close()
+
+	provider, _ := NewOllamaProvider(server.URL, "llama3.2")
+	if _, err := provider.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}); err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	if _, ok := raw["tools"]; ok {
+		t.Error("Expected no tools field in plain chat requests")
+	}
+}
@@ -0,0 +1,181 @@
+// Package ai provides a provider that accounts for the tokens it uses
+package ai
+
+import (
+	"context"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// UsageMeter accounts for the tokens used by requests
+type UsageMeter interface {
+	// Allow is called before each request and refuses it with an error,
+	// e.g. when a budget is used up
+	Allow(mode Mode) error
+
+	// Limited reports whether Allow may refuse requests
+	Limited() bool
+
+	// Record is called with the tokens billed for each response
+	Record(provider, model string, mode Mode, usage TokenUsage)
+}
+
+// MeteredProvider wraps a provider, asking its meter before each request
+// and reporting the usage of each response to it. Usage is recorded under
+// the provider and model that answered, which for a fallback chain is not
+// necessarily the first one.
+type MeteredProvider struct {
+	Provider
+	meter UsageMeter
+}
+
+// NewMeteredProvider wraps provider with meter
+func NewMeteredProvider(provider Provider, meter UsageMeter) *MeteredProvider {
+	return &MeteredProvider{Provider: provider, meter: meter}
+}
+
+func (p *MeteredProvider) record(mode Mode, usage TokenUsage) {
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	if usage.TotalTokens > 0 {
+		p.meter.Record(p.Provider.Name(), p.Provider.Model(), mode, usage)
+	}
+}
+
+func (p *MeteredProvider) GenerateCommand(ctx context.Context, prompt string, sysCtx types.SystemContext) (*types.CommandResponse, error) {
+	mode := modeOf(ctx, ModeCommand)
+	if err := p.meter.Allow(mode); err != nil {
+		return nil, err
+	}
+	resp, err := p.Provider.GenerateCommand(ctx, prompt, sysCtx)
+	if err == nil {
+		p.record(mode, resp.Usage)
+	}
+	return resp, err
+}
+
+func (p *MeteredProvider) RefineCommand(ctx context.Context, req RefineRequest, sysCtx types.SystemContext) (*types.CommandResponse, error) {
+	mode := modeOf(ctx, ModeCommand)
+	if err := p.meter.Allow(mode); err != nil {
+		return nil, err
+	}
+	resp, err := p.Provider.RefineCommand(ctx, req, sysCtx)
+	if err == nil {
+		p.record(mode, resp.Usage)
+	}
+	return resp, err
+}
+
+// GenerateCandidates checks a limited meter once for a provider that returns
+// all candidates from one request, and before each request otherwise, so
+// that n requests cannot overrun a budget close to its limit n-fold. The
+// separate requests are then sent one after another rather than in parallel.
+func (p *MeteredProvider) GenerateCandidates(ctx context.Context, prompt string, sysCtx types.SystemContext, n int) ([]*types.CommandResponse, error) {
+	mode := modeOf(ctx, ModeCommand)
+	if err := p.meter.Allow(mode); err != nil {
+		return nil, err
+	}
+	if !p.meter.Limited() {
+		responses, err := GenerateCandidates(ctx, p.Provider, prompt, sysCtx, n)
+		for _, resp := range responses {
+			p.record(mode, resp.Usage)
+		}
+		return responses, err
+	}
+
+	gate := &requestGate{
+		allow: func(first bool) error {
+			if first {
+				// Already checked above
+				return nil
+			}
+			return p.meter.Allow(mode)
+		},
+		record: func(usage TokenUsage) { p.record(mode, usage) },
+	}
+	responses, err := GenerateCandidates(withRequestGate(ctx, gate), p.Provider, prompt, sysCtx, n)
+	if !gate.used {
+		// One request returned every candidate
+		for _, resp := range responses {
+			p.record(mode, resp.Usage)
+		}
+	}
+	return responses, err
+}
+
+func (p *MeteredProvider) GenerateCommandStream(ctx context.Context, prompt string, sysCtx types.SystemContext) (<-chan StreamChunk, error) {
+	mode := modeOf(ctx, ModeCommand)
+	if err := p.meter.Allow(mode); err != nil {
+		return nil, err
+	}
+	stream, err := p.Provider.GenerateCommandStream(ctx, prompt, sysCtx)
+	if err != nil {
+		return nil, err
+	}
+	return p.meterStream(ctx, mode, stream), nil
+}
+
+func (p *MeteredProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+	resp, err := p.ChatWithUsage(ctx, messages)
+	if err != nil {
+		return "", err
+	}
+	return resp.Content, nil
+}
+
+func (p *MeteredProvider) ChatWithUsage(ctx context.Context, messages []Message) (*ChatResponse, error) {
+	mode := modeOf(ctx, ModeChat)
+	if err := p.meter.Allow(mode); err != nil {
+		return nil, err
+	}
+	resp, err := p.Provider.ChatWithUsage(ctx, messages)
+	if err == nil {
+		p.record(mode, resp.Usage)
+	}
+	return resp, err
+}
+
+func (p *MeteredProvider) ChatStream(ctx context.Context, messages []Message) (<-chan StreamChunk, error) {
+	mode := modeOf(ctx, ModeChat)
+	if err := p.meter.Allow(mode); err != nil {
+		return nil, err
+	}
+	stream, err := p.Provider.ChatStream(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+	return p.meterStream(ctx, mode, stream), nil
+}
+
+func (p *MeteredProvider) ChatWithTools(ctx context.Context, messages []Message, tools []types.MCPTool) (*ChatResponse, error) {
+	mode := modeOf(ctx, ModeChat)
+	if err := p.meter.Allow(mode); err != nil {
+		return nil, err
+	}
+	resp, err := p.Provider.ChatWithTools(ctx, messages, tools)
+	if err == nil {
+		p.record(mode, resp.Usage)
+	}
+	return resp, err
+}
+
+// meterStream passes the chunks of stream on, recording the usage that
+// comes with the final one. Once ctx is done the rest of the stream is
+// drained rather than passed on, since nobody may be reading anymore.
+func (p *MeteredProvider) meterStream(ctx context.Context, mode Mode, stream <-chan StreamChunk) <-chan StreamChunk {
+	ch := make(chan StreamChunk)
+	go func() {
+		defer close(ch)
+		for chunk := range stream {
+			if chunk.Done && chunk.Usage != nil {
+				p.record(mode, *chunk.Usage)
+			}
+			select {
+			case ch <- chunk:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,155 @@
+// Package ai metered provider tests
+package ai
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+type recordedUsage struct {
+	provider, model string
+	mode            Mode
+	usage           TokenUsage
+}
+
+type testMeter struct {
+	refuse   error
+	limit    int // refuse once this many responses are recorded
+	allowed  []Mode
+	recorded []recordedUsage
+}
+
+func (m *testMeter) Allow(mode Mode) error {
+	m.allowed = append(m.allowed, mode)
+	if m.limit > 0 && len(m.recorded) >= m.limit {
+		return errors.New("budget exceeded")
+	}
+	return m.refuse
+}
+
+func (m *testMeter) Limited() bool {
+	return true
+}
+
+func (m *testMeter) Record(provider, model string, mode Mode, usage TokenUsage) {
+	m.recorded = append(m.recorded, recordedUsage{provider, model, mode, usage})
+}
+
+const ollamaCountedResponse = `{"message":{"role":"assistant","content":"{\"command\":\"ls\",\"explanation\":\"list\",\"risk_level\":\"safe\"}"},"done":true,"prompt_eval_count":120,"eval_count":30}`
+
+func TestMeteredProvider_RecordsUsage(t *testing.T) {
+	server, _ := newFlakyServer(0, 0, nil, ollamaCountedResponse)
+	defer server.Close()
+
+	ollama, _ := NewOllamaProvider(server.URL, "llama3.2")
+	meter := &testMeter{}
+	provider := NewMeteredProvider(ollama, meter)
+
+	if _, err := provider.GenerateCommand(context.Background(), "list files", types.SystemContext{}); err != nil {
+		t.Fatalf("GenerateCommand failed: %v", err)
+	}
+	if _, err := provider.Chat(WithMode(context.Background(), ModeTitle), []Message{{Role: "user", Content: "hi"}}); err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+
+	if len(meter.recorded) != 2 {
+		t.Fatalf("Expected 2 recorded responses, got %+v", meter.recorded)
+	}
+	first := meter.recorded[0]
+	if first.provider != "ollama" || first.model != "llama3.2" || first.mode != ModeCommand {
+		t.Errorf("Unexpected first record %+v", first)
+	}
+	if first.usage != (TokenUsage{PromptTokens: 120, CompletionTokens: 30, TotalTokens: 150}) {
+		t.Errorf("Unexpected usage %+v", first.usage)
+	}
+	if meter.recorded[1].mode != ModeTitle {
+		t.Errorf("Expected the mode from the context, got %s", meter.recorded[1].mode)
+	}
+}
+
+func TestMeteredProvider_Refuses(t *testing.T) {
+	server, requests := newFlakyServer(0, 0, nil, ollamaCountedResponse)
+	defer server.Close()
+
+	ollama, _ := NewOllamaProvider(server.URL, "llama3.2")
+	refusal := errors.New("budget exceeded")
+	provider := NewMeteredProvider(ollama, &testMeter{refuse: refusal})
+
+	if _, err := provider.GenerateCommand(context.Background(), "list files", types.SystemContext{}); !errors.Is(err, refusal) {
+		t.Errorf("Expected the meter's refusal, got %v", err)
+	}
+	if _, err := provider.ChatStream(context.Background(), []Message{{Role: "user", Content: "hi"}}); !errors.Is(err, refusal) {
+		t.Errorf("Expected the meter's refusal for streams, got %v", err)
+	}
+	if requests.Load() != 0 {
+		t.Errorf("Expected no requests once refused, got %d", requests.Load())
+	}
+}
+
+func TestMeteredProvider_Stream(t *testing.T) {
+	server, _ := newFlakyServer(0, 0, nil, `{"message":{"role":"assistant","content":"hi"},"done":true,"prompt_eval_count":10,"eval_count":2}`+"\n")
+	defer server.Close()
+
+	ollama, _ := NewOllamaProvider(server.URL, "llama3.2")
+	meter := &testMeter{}
+	stream, err := NewMeteredProvider(ollama, meter).ChatStream(context.Background(), []Message{{Role: "user", Content: "hi"}})
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+	for range stream {
+	}
+	if len(meter.recorded) != 1 || meter.recorded[0].usage.TotalTokens != 12 || meter.recorded[0].mode != ModeChat {
+		t.Errorf("Expected the final chunk's usage to be recorded, got %+v", meter.recorded)
+	}
+}
+
+func TestMeteredProvider_CandidatesCheckEachRequest(t *testing.T) {
+	server, requests := newFlakyServer(0, 0, nil, ollamaCountedResponse)
+	defer server.Close()
+
+	ollama, _ := NewOllamaProvider(server.URL, "llama3.2")
+	meter := &testMeter{limit: 2}
+	provider := NewMeteredProvider(NewRetryProvider(ollama, fastRetries(1)), meter)
+
+	responses, err := provider.GenerateCandidates(context.Background(), "list files", types.SystemContext{}, 4)
+	if err != nil {
+		t.Fatalf("GenerateCandidates failed: %v", err)
+	}
+	if len(responses) != 2 || requests.Load() != 2 {
+		t.Errorf("Expected 2 candidates from 2 requests within the budget, got %d from %d", len(responses), requests.Load())
+	}
+	if len(meter.recorded) != 2 {
+		t.Errorf("Expected each response recorded once, got %+v", meter.recorded)
+	}
+
+	if _, err := provider.GenerateCandidates(context.Background(), "list files", types.SystemContext{}, 4); err == nil {
+		t.Error("Expected the meter's refusal once the budget is used up")
+	}
+	if requests.Load() != 2 {
+		t.Errorf("Expected no requests once refused, got %d", requests.Load())
+	}
+}
+
+func TestMeteredProvider_CandidatesFromOneRequest(t *testing.T) {
+	var body map[string]interface{}
+	server := captureRequest(t, `{"choices":[
+		{"index":0,"message":{"role":"assistant","content":"{\"command\":\"ls -la\",\"explanation\":\"list\",\"risk_level\":\"safe\"}"}},
+		{"index":1,"message":{"role":"assistant","content":"{\"command\":\"ls\",\"explanation\":\"list\",\"risk_level\":\"safe\"}"}}
+	],"usage":{"prompt_tokens":100,"completion_tokens":20,"total_tokens":120}}`, &body)
+	defer server.Close()
+
+	openaiProvider, _ := NewOpenAIProvider("sk-test", server.URL, "gpt-4o-mini")
+	meter := &testMeter{}
+	provider := NewMeteredProvider(NewRetryProvider(openaiProvider, fastRetries(1)), meter)
+
+	responses, err := provider.GenerateCandidates(context.Background(), "list files", types.SystemContext{}, 2)
+	if err != nil {
+		t.Fatalf("GenerateCandidates failed: %v", err)
+	}
+	if len(responses) != 2 || len(meter.allowed) != 1 {
+		t.Errorf("Expected 2 candidates checked against the budget once, got %d checked %d times", len(responses), len(meter.allowed))
+	}
+}
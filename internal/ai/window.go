@@ -0,0 +1,405 @@
+// Package ai provides context window management for long conversations
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sonemaro/sosomi/internal/tokenizer"
+)
+
+// ContextWindower is implemented by providers whose server reports the
+// context window of the model in its metadata
+type ContextWindower interface {
+	// ContextWindow returns the model's context window in tokens, or 0
+	// when it is unknown
+	ContextWindow(ctx context.Context) int
+}
+
+// ContextWindowOf returns the context window reported by provider, or 0
+func ContextWindowOf(ctx context.Context, provider Provider) int {
+	if windower, ok := provider.(ContextWindower); ok {
+		return windower.ContextWindow(ctx)
+	}
+	return 0
+}
+
+// ContextWindow returns the window set by num_ctx in the model's Modelfile,
+// which is what the server actually uses, or else the model's own
+// context_length
+func (p *OllamaProvider) ContextWindow(ctx context.Context) int {
+	var show struct {
+		Parameters string                 `json:"parameters"`
+		ModelInfo  map[string]interface{} `json:"model_info"`
+	}
+	body := strings.NewReader(fmt.Sprintf(`{"model":%q}`, p.model))
+	if err := getJSON(ctx, p.client, "POST", p.endpoint+"/api/show", body, &show); err != nil {
+		return 0
+	}
+
+	for _, line := range strings.Split(show.Parameters, "\n") {
+		var n int
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "num_ctx" {
+			if _, err := fmt.Sscanf(fields[1], "%d", &n); err == nil && n > 0 {
+				return n
+			}
+		}
+	}
+	for key, value := range show.ModelInfo {
+		if n, ok := value.(float64); ok && strings.HasSuffix(key, ".context_length") {
+			return int(n)
+		}
+	}
+	return 0
+}
+
+// ContextWindow asks LM Studio for the context the model is loaded with,
+// and llama.cpp for the context of its slots. Other servers report none.
+func (p *LocalOpenAIProvider) ContextWindow(ctx context.Context) int {
+	base := strings.TrimSuffix(strings.TrimSuffix(p.endpoint, "/"), "/v1")
+
+	switch p.name {
+	case "lmstudio":
+		var model struct {
+			LoadedContextLength int `json:"loaded_context_length"`
+			MaxContextLength    int `json:"max_context_length"`
+		}
+		if err := getJSON(ctx, newHTTPClient(), "GET", base+"/api/v0/models/"+p.model, nil, &model); err != nil {
+			return 0
+		}
+		if model.LoadedContextLength > 0 {
+			return model.LoadedContextLength
+		}
+		return model.MaxContextLength
+	case "llamacpp":
+		var props struct {
+			DefaultGenerationSettings struct {
+				NCtx int `json:"n_ctx"`
+			} `json:"default_generation_settings"`
+		}
+		if err := getJSON(ctx, newHTTPClient(), "GET", base+"/props", nil, &props); err != nil {
+			return 0
+		}
+		return props.DefaultGenerationSettings.NCtx
+	}
+	return 0
+}
+
+func (p *RetryProvider) ContextWindow(ctx context.Context) int {
+	return ContextWindowOf(ctx, p.Provider)
+}
+
+// ContextWindow returns the smallest window reported in the chain, since
+// the conversation has to fit whichever provider ends up answering
+func (p *FallbackProvider) ContextWindow(ctx context.Context) int {
+	smallest := 0
+	for _, provider := range p.providers {
+		if window := ContextWindowOf(ctx, provider); window > 0 && (smallest == 0 || window < smallest) {
+			smallest = window
+		}
+	}
+	return smallest
+}
+
+func (p *MeteredProvider) ContextWindow(ctx context.Context) int {
+	return ContextWindowOf(ctx, p.Provider)
+}
+
+// getJSON sends a request and decodes a successful JSON response into v
+func getJSON(ctx context.Context, client *http.Client, method, url string, body *strings.Reader, v interface{}) error {
+	var req *http.Request
+	var err error
+	if body != nil {
+		req, err = http.NewRequestWithContext(ctx, method, url, body)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, method, url, nil)
+	}
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %s", method, url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Token overheads of the chat format, as documented for OpenAI models
+const (
+	messageOverhead = 4 // role and separators of every message
+	replyOverhead   = 3 // priming of the assistant's reply
+)
+
+// keptExecutions is how many of the latest command outputs are always kept
+const keptExecutions = 2
+
+// summaryPrompt asks for a summary of trimmed messages
+const summaryPrompt = `You condense the earlier part of a conversation so that it can continue without it.
+Write a short summary keeping facts, decisions, names, paths, commands and their results that later messages may rely on.
+Extend the previous summary, if there is one, rather than repeating it. Reply with the summary only.`
+
+// ContextManager fits conversations into the model's context window. When
+// a conversation outgrows the window, the oldest messages are summarized,
+// or dropped if no summary can be made. The system prompt, the latest
+// command outputs and the current exchange are always kept.
+type ContextManager struct {
+	provider Provider // makes summaries; nil drops messages instead
+	counter  tokenizer.Counter
+	limit    int // tokens available to the prompt
+
+	summary    string
+	summarized map[int]bool // indexes of summarized messages after the system prompt
+}
+
+// NewContextManager creates a manager keeping prompts within limit tokens
+func NewContextManager(provider Provider, counter tokenizer.Counter, limit int) *ContextManager {
+	return &ContextManager{
+		provider:   provider,
+		counter:    counter,
+		limit:      limit,
+		summarized: make(map[int]bool),
+	}
+}
+
+// Limit returns the number of tokens available to prompts
+func (m *ContextManager) Limit() int {
+	return m.limit
+}
+
+// Summary returns the summary of the messages left out so far, if any
+func (m *ContextManager) Summary() string {
+	return m.summary
+}
+
+// Reset forgets the summary, for conversations whose messages were replaced
+func (m *ContextManager) Reset() {
+	m.summary, m.summarized = "", make(map[int]bool)
+}
+
+// Count returns the number of prompt tokens of messages
+func (m *ContextManager) Count(messages []Message) int {
+	total := replyOverhead
+	for _, msg := range messages {
+		total += messageOverhead + m.counter.Count(msg.Content)
+		for _, call := range msg.ToolCalls {
+			total += m.counter.Count(call.Name) + m.counter.Count(call.RawArguments)
+			if call.RawArguments == "" && call.Arguments != nil {
+				args, _ := json.Marshal(call.Arguments)
+				total += m.counter.Count(string(args))
+			}
+		}
+	}
+	return total
+}
+
+// contextUnit is a message, or an assistant message together with the
+// results of the tools it called, which must be kept or left out together
+type contextUnit struct {
+	start, end int // messages[start:end]
+	pinned     bool
+}
+
+// Fit returns the messages to send: messages itself when they fit, and
+// otherwise the system prompt, a summary of the oldest messages and the
+// rest. It also returns how many messages were left out.
+func (m *ContextManager) Fit(ctx context.Context, messages []Message) ([]Message, int) {
+	if m.Count(messages) <= m.limit {
+		return messages, 0
+	}
+
+	head := 0
+	for head < len(messages) && messages[head].Role == "system" {
+		head++
+	}
+	body := messages[head:]
+	for i := range m.summarized {
+		if i >= len(body) {
+			// The conversation was replaced, start over
+			m.Reset()
+			break
+		}
+	}
+
+	units := splitUnits(body)
+	kept := make([]bool, len(units))
+	for i, u := range units {
+		kept[i] = u.pinned || !m.summarized[u.start]
+	}
+
+	// Leave room for the next few exchanges so that the summary does not
+	// have to be redone on every message
+	target := m.limit * 3 / 4
+	var dropped []int
+	for i, u := range units {
+		if m.Count(m.assemble(messages[:head], body, units, kept, m.summary)) <= target &&
+			(len(dropped) == 0 || body[u.start].Role == "user") {
+			break
+		}
+		if !kept[i] || u.pinned {
+			continue
+		}
+		kept[i] = false
+		dropped = append(dropped, i)
+	}
+
+	if len(dropped) > 0 && m.provider != nil {
+		var old []Message
+		for _, i := range dropped {
+			old = append(old, body[units[i].start:units[i].end]...)
+		}
+		if summary, err := summarize(ctx, m.provider, m.summary, old); err == nil {
+			m.summary = summary
+			for _, i := range dropped {
+				for j := units[i].start; j < units[i].end; j++ {
+					m.summarized[j] = true
+				}
+			}
+		}
+	}
+
+	fitted := m.assemble(messages[:head], body, units, kept, m.summary)
+	return fitted, len(messages) - len(fitted)
+}
+
+// splitUnits groups body into units and pins the current exchange, from
+// the last user message on, and the latest command outputs
+func splitUnits(body []Message) []contextUnit {
+	var units []contextUnit
+	for i := 0; i < len(body); {
+		end := i + 1
+		if len(body[i].ToolCalls) > 0 {
+			for end < len(body) && body[end].Role == "tool" {
+				end++
+			}
+		}
+		units = append(units, contextUnit{start: i, end: end})
+		i = end
+	}
+
+	current := len(units)
+	for i := len(units) - 1; i >= 0; i-- {
+		if msg := body[units[i].start]; msg.Role == "user" && !msg.Execution {
+			current = i
+			break
+		}
+	}
+	executions := 0
+	for i := len(units) - 1; i >= 0; i-- {
+		if i >= current {
+			units[i].pinned = true
+			continue
+		}
+		for _, msg := range body[units[i].start:units[i].end] {
+			if msg.Execution || msg.Role == "tool" {
+				if executions < keptExecutions {
+					units[i].pinned = true
+				}
+				executions++
+				break
+			}
+		}
+	}
+	return units
+}
+
+// assemble builds a request from the system prompt, the summary and the
+// kept units
+func (m *ContextManager) assemble(head, body []Message, units []contextUnit, kept []bool, summary string) []Message {
+	result := append([]Message(nil), head...)
+	if summary != "" {
+		result = append(result, SummaryMessage(summary))
+	}
+	for i, u := range units {
+		if kept[i] {
+			result = append(result, body[u.start:u.end]...)
+		}
+	}
+	return result
+}
+
+// maxSummarizedChars limits how much of each message is summarized
+const maxSummarizedChars = 2000
+
+// summarize asks provider to extend the previous summary with messages
+func summarize(ctx context.Context, provider Provider, previous string, messages []Message) (string, error) {
+	var transcript strings.Builder
+	if previous != "" {
+		transcript.WriteString("Previous summary:\n" + previous + "\n\nMessages:\n")
+	}
+	for _, msg := range messages {
+		content := msg.Content
+		if len(content) > maxSummarizedChars {
+			content = content[:maxSummarizedChars] + "..."
+		}
+		role := msg.Role
+		if msg.ToolName != "" {
+			role += " (" + msg.ToolName + ")"
+		}
+		for _, call := range msg.ToolCalls {
+			content += fmt.Sprintf("\n[called %s]", call.Name)
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n", role, content)
+	}
+
+	summary, err := provider.Chat(WithMode(ctx, ModeSummary), []Message{
+		{Role: "system", Content: summaryPrompt},
+		{Role: "user", Content: transcript.String()},
+	})
+	if err != nil {
+		return "", err
+	}
+	summary = strings.TrimSpace(summary)
+	if summary == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	return summary, nil
+}
+
+// SummaryMessage returns the message standing in for the summarized part
+// of a conversation, sent after the system prompt
+func SummaryMessage(summary string) Message {
+	return Message{Role: "system", Content: "Summary of the earlier conversation:\n" + summary, Summary: true}
+}
+
+// ErrNothingToCompact is returned by Compact when no messages are older
+// than the exchanges to keep
+var ErrNothingToCompact = errors.New("nothing to compact")
+
+// Compact summarizes the messages of a conversation, without its system
+// prompt, that come before the last keep exchanges, extending the previous
+// summary. It returns the summary and how many messages it replaces.
+func Compact(ctx context.Context, provider Provider, previous string, messages []Message, keep int) (string, int, error) {
+	if keep < 1 {
+		keep = 1
+	}
+	cut := 0
+	for i := len(messages) - 1; i > 0; i-- {
+		if messages[i].Role == "user" && !messages[i].Execution {
+			if keep--; keep == 0 {
+				cut = i
+				break
+			}
+		}
+	}
+	if cut == 0 {
+		return "", 0, ErrNothingToCompact
+	}
+
+	summary, err := summarize(ctx, provider, previous, messages[:cut])
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to summarize: %w", err)
+	}
+	return summary, cut, nil
+}
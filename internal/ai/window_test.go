@@ -0,0 +1,238 @@
+// Package ai context window tests
+package ai
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sonemaro/sosomi/internal/tokenizer"
+)
+
+func TestContextWindow_Ollama(t *testing.T) {
+	parameters := "num_ctx 16384"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/show" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"parameters":"stop \"<|eot_id|>\"\n` + parameters + `","model_info":{"general.architecture":"llama","llama.context_length":131072}}`))
+	}))
+	defer server.Close()
+
+	ollama, _ := NewOllamaProvider(server.URL, "llama3.2")
+	provider := NewMeteredProvider(NewRetryProvider(ollama, fastRetries(1)), &testMeter{})
+	if got := ContextWindowOf(context.Background(), provider); got != 16384 {
+		t.Errorf("Expected num_ctx to win, got %d", got)
+	}
+
+	parameters = "temperature 0.7"
+	if got := ContextWindowOf(context.Background(), provider); got != 131072 {
+		t.Errorf("Expected the model's context length, got %d", got)
+	}
+}
+
+func TestContextWindow_LocalServers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/props":
+			w.Write([]byte(`{"default_generation_settings":{"n_ctx":4096}}`))
+		case "/api/v0/models/qwen2.5-coder":
+			w.Write([]byte(`{"id":"qwen2.5-coder","max_context_length":32768,"loaded_context_length":8192}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	llamacpp, _ := NewLlamaCppProvider(server.URL+"/v1", "qwen2.5-coder")
+	lmstudio, _ := NewLMStudioProvider(server.URL+"/v1", "qwen2.5-coder")
+	ctx := context.Background()
+
+	if got := ContextWindowOf(ctx, llamacpp); got != 4096 {
+		t.Errorf("Expected llama.cpp n_ctx, got %d", got)
+	}
+	if got := ContextWindowOf(ctx, lmstudio); got != 8192 {
+		t.Errorf("Expected LM Studio's loaded context, got %d", got)
+	}
+	if got := ContextWindowOf(ctx, NewFallbackProvider(lmstudio, llamacpp)); got != 4096 {
+		t.Errorf("Expected the smallest window of the chain, got %d", got)
+	}
+
+	missing, _ := NewLMStudioProvider(server.URL+"/v1", "unknown")
+	if got := ContextWindowOf(ctx, missing); got != 0 {
+		t.Errorf("Expected 0 for an unknown model, got %d", got)
+	}
+}
+
+// longConversation returns a system prompt followed by turns of questions,
+// answers and command outputs, and a final question
+func longConversation(turns int) []Message {
+	messages := []Message{{Role: "system", Content: "You are a shell assistant."}}
+	filler := strings.Repeat("word ", 50)
+	for i := 0; i < turns; i++ {
+		messages = append(messages,
+			Message{Role: "user", Content: "question " + filler},
+			Message{Role: "assistant", Content: "answer " + filler},
+			Message{Role: "user", Content: "output " + filler, Execution: true},
+		)
+	}
+	return append(messages, Message{Role: "user", Content: "latest question"})
+}
+
+func TestContextManager_FitsUnchanged(t *testing.T) {
+	messages := longConversation(2)
+	mgr := NewContextManager(nil, tokenizer.Heuristic{}, 100000)
+
+	fitted, left := mgr.Fit(context.Background(), messages)
+	if left != 0 || len(fitted) != len(messages) {
+		t.Errorf("Expected messages to be unchanged, got %d left out", left)
+	}
+}
+
+func TestContextManager_Trims(t *testing.T) {
+	messages := longConversation(20)
+	mgr := NewContextManager(nil, tokenizer.Heuristic{}, 1000)
+
+	fitted, left := mgr.Fit(context.Background(), messages)
+	if left == 0 {
+		t.Fatal("Expected messages to be left out")
+	}
+	if got := mgr.Count(fitted); got > mgr.Limit() {
+		t.Errorf("Expected at most %d tokens, got %d", mgr.Limit(), got)
+	}
+	if fitted[0].Content != messages[0].Content {
+		t.Errorf("Expected the system prompt first, got %+v", fitted[0])
+	}
+	if last := fitted[len(fitted)-1]; last.Content != "latest question" {
+		t.Errorf("Expected the latest question last, got %+v", last)
+	}
+	if second := fitted[1]; second.Role != "user" {
+		t.Errorf("Expected the kept messages to start with a user message, got %s", second.Role)
+	}
+
+	executions := 0
+	for _, msg := range fitted {
+		if msg.Execution {
+			executions++
+		}
+	}
+	if executions < keptExecutions {
+		t.Errorf("Expected the latest %d outputs to be kept, got %d", keptExecutions, executions)
+	}
+}
+
+func TestContextManager_KeepsToolResultsWithCalls(t *testing.T) {
+	filler := strings.Repeat("word ", 100)
+	messages := []Message{{Role: "system", Content: "system"}}
+	for i := 0; i < 10; i++ {
+		messages = append(messages,
+			Message{Role: "user", Content: filler},
+			Message{Role: "assistant", ToolCalls: []ToolCall{{ID: "1", Name: "read_file"}}},
+			Message{Role: "tool", ToolCallID: "1", ToolName: "read_file", Content: filler},
+			Message{Role: "assistant", Content: "done"},
+		)
+	}
+	mgr := NewContextManager(nil, tokenizer.Heuristic{}, 600)
+
+	fitted, _ := mgr.Fit(context.Background(), messages)
+	for i, msg := range fitted {
+		if msg.Role == "tool" && (i == 0 || len(fitted[i-1].ToolCalls) == 0) {
+			t.Fatalf("Tool result at %d kept without its call", i)
+		}
+		if len(msg.ToolCalls) > 0 && (i+1 == len(fitted) || fitted[i+1].Role != "tool") {
+			t.Fatalf("Tool call at %d kept without its result", i)
+		}
+	}
+}
+
+func TestContextManager_Summarizes(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, string(body))
+		w.Write([]byte(`{"message":{"role":"assistant","content":"They asked questions."},"done":true}`))
+	}))
+	defer server.Close()
+
+	ollama, _ := NewOllamaProvider(server.URL, "llama3.2")
+	mgr := NewContextManager(ollama, tokenizer.Heuristic{}, 1000)
+	messages := longConversation(20)
+
+	fitted, left := mgr.Fit(context.Background(), messages)
+	if left == 0 || len(requests) != 1 {
+		t.Fatalf("Expected one summary of the left out messages, got %d requests and %d left out", len(requests), left)
+	}
+	if fitted[1].Role != "system" || !strings.Contains(fitted[1].Content, "They asked questions.") {
+		t.Errorf("Expected the summary after the system prompt, got %+v", fitted[1])
+	}
+	if got := mgr.Count(fitted); got > mgr.Limit() {
+		t.Errorf("Expected at most %d tokens, got %d", mgr.Limit(), got)
+	}
+
+	// One more exchange still fits next to the summary
+	messages = append(messages, Message{Role: "assistant", Content: "ok"}, Message{Role: "user", Content: "next"})
+	if _, _ = mgr.Fit(context.Background(), messages); len(requests) != 1 {
+		t.Errorf("Expected the summary to be reused, got %d requests", len(requests))
+	}
+
+	// Many more are summarized on top of the previous summary
+	messages = append(messages, longConversation(10)[1:]...)
+	mgr.Fit(context.Background(), messages)
+	if len(requests) != 2 || !strings.Contains(requests[1], "They asked questions.") {
+		t.Errorf("Expected the summary to be extended, got %d requests", len(requests))
+	}
+}
+
+func TestContextManager_TrimsWhenSummaryFails(t *testing.T) {
+	server, _ := newFlakyServer(100, http.StatusInternalServerError, nil, "")
+	defer server.Close()
+
+	ollama, _ := NewOllamaProvider(server.URL, "llama3.2")
+	mgr := NewContextManager(ollama, tokenizer.Heuristic{}, 1000)
+
+	fitted, left := mgr.Fit(context.Background(), longConversation(20))
+	if left == 0 {
+		t.Fatal("Expected messages to be left out")
+	}
+	for _, msg := range fitted[1:] {
+		if msg.Role == "system" {
+			t.Errorf("Expected no summary, got %+v", msg)
+		}
+	}
+}
+
+func TestCompact(t *testing.T) {
+	var request string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		request = string(body)
+		w.Write([]byte(`{"message":{"role":"assistant","content":"They listed files."},"done":true}`))
+	}))
+	defer server.Close()
+	ollama, _ := NewOllamaProvider(server.URL, "llama3.2")
+
+	messages := longConversation(3)[1:]
+	summary, n, err := Compact(context.Background(), ollama, "They said hello.", messages, 2)
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if summary != "They listed files." {
+		t.Errorf("Unexpected summary %q", summary)
+	}
+	// Turns are a question, an answer and an output; the last turn and the
+	// latest question are kept
+	if n != 6 {
+		t.Errorf("Expected the first two turns to be replaced, got %d messages", n)
+	}
+	if !strings.Contains(request, "They said hello.") {
+		t.Error("Expected the previous summary to be extended")
+	}
+
+	if _, _, err := Compact(context.Background(), ollama, "", messages[len(messages)-1:], 2); err != ErrNothingToCompact {
+		t.Errorf("Expected ErrNothingToCompact, got %v", err)
+	}
+}
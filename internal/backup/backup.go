@@ -0,0 +1,348 @@
+// Package backup provides pre-execution file snapshots backed by a content-addressed store
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// ErrTooLarge is returned when a snapshot would exceed the configured size limit
+var ErrTooLarge = errors.New("snapshot exceeds backup size limit")
+
+// Store keeps file contents under <dir>/objects, addressed by their SHA-256 hash
+type Store struct {
+	dir string
+}
+
+// NewStore creates a backup store rooted at dir
+func NewStore(dir string) (*Store, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("backup directory is required")
+	}
+	if strings.HasPrefix(dir, "~") {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, dir[1:])
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "objects"), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// ShouldSnapshot reports whether a command warrants a snapshot before it runs
+func ShouldSnapshot(analysis *types.CommandAnalysis) bool {
+	return len(SnapshotPaths(analysis)) > 0
+}
+
+// SnapshotPaths returns the paths to snapshot before a command runs: those
+// it writes, moves or deletes. Files it only reads, such as cp sources and
+// input redirects, are left out. Irreversible commands whose writes are not
+// known fall back to every path they name.
+func SnapshotPaths(analysis *types.CommandAnalysis) []string {
+	if analysis == nil {
+		return nil
+	}
+	if len(analysis.WritePaths) > 0 || analysis.Reversible {
+		return analysis.WritePaths
+	}
+	return analysis.AffectedPaths
+}
+
+// ExpandPaths resolves analyzer paths to absolute paths that currently exist.
+// Handles ~, paths relative to cwd, and glob patterns.
+func ExpandPaths(paths []string, cwd string) []string {
+	seen := make(map[string]bool)
+	var result []string
+
+	for _, path := range paths {
+		if path == "" || strings.HasPrefix(path, "-") {
+			continue
+		}
+		path = absPath(path, cwd)
+
+		matches := []string{path}
+		if strings.ContainsAny(path, "*?[") {
+			matches, _ = filepath.Glob(path)
+		}
+
+		for _, m := range matches {
+			m = filepath.Clean(m)
+			if seen[m] {
+				continue
+			}
+			if _, err := os.Lstat(m); err != nil {
+				continue
+			}
+			seen[m] = true
+			result = append(result, m)
+		}
+	}
+
+	return result
+}
+
+// absPath resolves ~ and paths relative to cwd
+func absPath(path, cwd string) string {
+	if strings.HasPrefix(path, "~") {
+		home, _ := os.UserHomeDir()
+		path = filepath.Join(home, path[1:])
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cwd, path)
+	}
+	return path
+}
+
+// createdPaths returns the paths that do not exist yet, which the command
+// will create. Globs only match existing files and are left out.
+func createdPaths(paths []string, cwd string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, path := range paths {
+		if path == "" || strings.HasPrefix(path, "-") || strings.ContainsAny(path, "*?[") {
+			continue
+		}
+		path = filepath.Clean(absPath(path, cwd))
+		if seen[path] {
+			continue
+		}
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			seen[path] = true
+			result = append(result, path)
+		}
+	}
+	return result
+}
+
+// Snapshot copies every file under the given paths into the store, and
+// records the paths that do not exist yet so that undo removes what the
+// command creates. maxBytes <= 0 disables the size limit.
+func (s *Store) Snapshot(command, cwd string, paths []string, maxBytes int64) (*types.Backup, error) {
+	backup := &types.Backup{
+		Command:    command,
+		WorkingDir: cwd,
+	}
+
+	// Collect entries first so we can enforce the size limit before copying.
+	// The walk stops as soon as the limit is exceeded, so that huge trees
+	// such as / are not walked to the end.
+	var entries []types.BackupFile
+	for _, root := range ExpandPaths(paths, cwd) {
+		err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil // Skip unreadable entries
+			}
+			entry := types.BackupFile{
+				Path:    p,
+				Mode:    uint32(info.Mode()),
+				Size:    info.Size(),
+				ModTime: info.ModTime(),
+				IsDir:   info.IsDir(),
+			}
+			if info.Mode()&os.ModeSymlink != 0 {
+				entry.Link, _ = os.Readlink(p)
+				entry.Size = 0
+			} else if info.Mode().IsRegular() {
+				backup.TotalSize += info.Size()
+				if maxBytes > 0 && backup.TotalSize > maxBytes {
+					return ErrTooLarge
+				}
+			} else if !info.IsDir() {
+				return nil // Skip devices, sockets and pipes
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+		if errors.Is(err, ErrTooLarge) {
+			return nil, fmt.Errorf("%w (more than %d bytes)", ErrTooLarge, maxBytes)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range entries {
+		if entries[i].IsDir || entries[i].Link != "" {
+			continue
+		}
+		hash, err := s.storeObject(entries[i].Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to back up %s: %w", entries[i].Path, err)
+		}
+		entries[i].Hash = hash
+	}
+	for _, path := range createdPaths(paths, cwd) {
+		entries = append(entries, types.BackupFile{Path: path, Created: true})
+	}
+
+	backup.Files = entries
+	return backup, nil
+}
+
+// Restore writes every file in the backup back to its original location
+// and removes the files the command created. A created directory is only
+// removed when it is empty. Returns the restored and removed paths; errors
+// for individual files are joined.
+func (s *Store) Restore(backup *types.Backup) ([]string, error) {
+	var restored []string
+	var errs []error
+
+	// Remove created paths first, deepest first, as a file may have been
+	// moved to one of them
+	var created []string
+	for _, f := range backup.Files {
+		if f.Created {
+			created = append(created, f.Path)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(created)))
+	for _, path := range created {
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			errs = append(errs, fmt.Errorf("%s: created by the command, not removed: %w", path, err))
+			continue
+		}
+		restored = append(restored, path)
+	}
+
+	// Directories first so files have somewhere to go
+	for _, f := range backup.Files {
+		if !f.IsDir || f.Created {
+			continue
+		}
+		if err := os.MkdirAll(f.Path, os.FileMode(f.Mode).Perm()); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.Path, err))
+			continue
+		}
+		os.Chmod(f.Path, os.FileMode(f.Mode).Perm())
+	}
+
+	for _, f := range backup.Files {
+		if f.IsDir || f.Created {
+			continue
+		}
+		if err := s.restoreFile(f); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.Path, err))
+			continue
+		}
+		restored = append(restored, f.Path)
+	}
+
+	// Restore directory timestamps last since writing files updates them
+	for _, f := range backup.Files {
+		if f.IsDir {
+			os.Chtimes(f.Path, f.ModTime, f.ModTime)
+		}
+	}
+
+	return restored, errors.Join(errs...)
+}
+
+// restoreFile restores a single regular file or symlink
+func (s *Store) restoreFile(f types.BackupFile) error {
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+		return err
+	}
+
+	if f.Link != "" {
+		if info, err := os.Lstat(f.Path); err == nil {
+			if info.IsDir() {
+				return fmt.Errorf("a directory now exists at this path")
+			}
+			if err := os.Remove(f.Path); err != nil {
+				return err
+			}
+		}
+		return os.Symlink(f.Link, f.Path)
+	}
+
+	if f.Hash == "" {
+		return fmt.Errorf("no content recorded for file")
+	}
+	src, err := os.Open(s.objectPath(f.Hash))
+	if err != nil {
+		return fmt.Errorf("backup object missing: %w", err)
+	}
+	defer src.Close()
+
+	// Write to a temp file in the same directory and rename over the target
+	tmp, err := os.CreateTemp(filepath.Dir(f.Path), ".sosomi-restore-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), os.FileMode(f.Mode).Perm()); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), f.Path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Chtimes(f.Path, f.ModTime, f.ModTime)
+}
+
+// storeObject copies a file into the object store and returns its hash
+func (s *Store) storeObject(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(filepath.Join(s.dir, "objects"), ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hasher), src); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	dst := s.objectPath(hash)
+
+	// Identical content is already stored
+	if _, err := os.Stat(dst); err == nil {
+		return hash, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return "", err
+	}
+
+	return hash, nil
+}
+
+// objectPath returns the location of an object in the store
+func (s *Store) objectPath(hash string) string {
+	return filepath.Join(s.dir, "objects", hash[:2], hash)
+}
@@ -0,0 +1,236 @@
+// Package backup tests
+package backup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+func TestNewStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backups")
+
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	if store == nil {
+		t.Fatal("NewStore returned nil")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "objects")); err != nil {
+		t.Errorf("Expected objects directory to be created: %v", err)
+	}
+}
+
+func TestNewStore_EmptyDir(t *testing.T) {
+	if _, err := NewStore(""); err == nil {
+		t.Error("Expected error for empty backup directory")
+	}
+}
+
+func TestShouldSnapshot(t *testing.T) {
+	tests := []struct {
+		name     string
+		analysis *types.CommandAnalysis
+		want     bool
+	}{
+		{"nil", nil, false},
+		{"read only", &types.CommandAnalysis{Reversible: true}, false},
+		{"irreversible without paths", &types.CommandAnalysis{Reversible: false}, false},
+		{"irreversible", &types.CommandAnalysis{Reversible: false, AffectedPaths: []string{"file.txt"}}, true},
+		{"reads only", &types.CommandAnalysis{Reversible: true, AffectedPaths: []string{"src.txt"}}, false},
+		{"writes", &types.CommandAnalysis{Reversible: true, AffectedPaths: []string{"src.txt", "dst.txt"}, WritePaths: []string{"dst.txt"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ShouldSnapshot(tt.analysis); got != tt.want {
+				t.Errorf("ShouldSnapshot() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandPaths(t *testing.T) {
+	cwd := t.TempDir()
+	os.WriteFile(filepath.Join(cwd, "a.log"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(cwd, "b.log"), []byte("b"), 0644)
+	os.WriteFile(filepath.Join(cwd, "c.txt"), []byte("c"), 0644)
+
+	paths := ExpandPaths([]string{"*.log", "c.txt", "missing.txt", "-rf", "a.log"}, cwd)
+
+	if len(paths) != 3 {
+		t.Fatalf("Expected 3 paths, got %d: %v", len(paths), paths)
+	}
+	for _, p := range paths {
+		if !filepath.IsAbs(p) {
+			t.Errorf("Expected absolute path, got %s", p)
+		}
+	}
+}
+
+func TestSnapshotAndRestore(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "backups"))
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+
+	cwd := t.TempDir()
+	buildDir := filepath.Join(cwd, "build")
+	os.MkdirAll(filepath.Join(buildDir, "sub"), 0755)
+	os.WriteFile(filepath.Join(buildDir, "out.bin"), []byte("binary"), 0755)
+	os.WriteFile(filepath.Join(buildDir, "sub", "notes.txt"), []byte("notes"), 0600)
+	os.Symlink("out.bin", filepath.Join(buildDir, "latest"))
+
+	snap, err := store.Snapshot("rm -rf build", cwd, []string{"build"}, 0)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+
+	if snap.TotalSize != int64(len("binary")+len("notes")) {
+		t.Errorf("Unexpected total size: %d", snap.TotalSize)
+	}
+	if len(snap.Files) != 5 {
+		t.Errorf("Expected 5 entries (2 dirs, 2 files, 1 link), got %d", len(snap.Files))
+	}
+
+	// Simulate the destructive command
+	if err := os.RemoveAll(buildDir); err != nil {
+		t.Fatalf("RemoveAll failed: %v", err)
+	}
+
+	restored, err := store.Restore(snap)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if len(restored) != 3 {
+		t.Errorf("Expected 3 restored files, got %d", len(restored))
+	}
+
+	data, err := os.ReadFile(filepath.Join(buildDir, "sub", "notes.txt"))
+	if err != nil || string(data) != "notes" {
+		t.Errorf("Expected notes.txt to be restored, got %q (%v)", data, err)
+	}
+
+	info, err := os.Stat(filepath.Join(buildDir, "out.bin"))
+	if err != nil {
+		t.Fatalf("out.bin not restored: %v", err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("Expected mode 0755, got %v", info.Mode().Perm())
+	}
+
+	link, err := os.Readlink(filepath.Join(buildDir, "latest"))
+	if err != nil || link != "out.bin" {
+		t.Errorf("Expected symlink to out.bin, got %q (%v)", link, err)
+	}
+}
+
+func TestSnapshot_Deduplicates(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backups")
+	store, _ := NewStore(dir)
+
+	cwd := t.TempDir()
+	os.WriteFile(filepath.Join(cwd, "one.txt"), []byte("same"), 0644)
+	os.WriteFile(filepath.Join(cwd, "two.txt"), []byte("same"), 0644)
+
+	snap, err := store.Snapshot("rm *.txt", cwd, []string{"*.txt"}, 0)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+
+	if snap.Files[0].Hash != snap.Files[1].Hash {
+		t.Error("Expected identical content to share a hash")
+	}
+
+	objects, _ := os.ReadDir(filepath.Join(dir, "objects", snap.Files[0].Hash[:2]))
+	if len(objects) != 1 {
+		t.Errorf("Expected 1 stored object, got %d", len(objects))
+	}
+}
+
+func TestSnapshot_TooLarge(t *testing.T) {
+	store, _ := NewStore(filepath.Join(t.TempDir(), "backups"))
+
+	cwd := t.TempDir()
+	os.WriteFile(filepath.Join(cwd, "big.bin"), make([]byte, 2048), 0644)
+
+	_, err := store.Snapshot("rm big.bin", cwd, []string{"big.bin"}, 1024)
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected ErrTooLarge, got %v", err)
+	}
+}
+
+func TestRestore_RemovesCreated(t *testing.T) {
+	store, _ := NewStore(filepath.Join(t.TempDir(), "backups"))
+
+	cwd := t.TempDir()
+	os.WriteFile(filepath.Join(cwd, "a.txt"), []byte("a"), 0644)
+	os.MkdirAll(filepath.Join(cwd, "kept"), 0755)
+
+	snap, err := store.Snapshot("mv a.txt b.txt && mkdir out kept/new", cwd, []string{"a.txt", "b.txt", "out", "kept/new", "*.log"}, 0)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	var created []string
+	for _, f := range snap.Files {
+		if f.Created {
+			created = append(created, filepath.Base(f.Path))
+		}
+	}
+	if strings.Join(created, ",") != "b.txt,out,new" {
+		t.Errorf("Expected b.txt, out and new to be recorded as created, got %v", created)
+	}
+
+	// Simulate the command, and a file put into one of the new directories
+	os.Rename(filepath.Join(cwd, "a.txt"), filepath.Join(cwd, "b.txt"))
+	os.MkdirAll(filepath.Join(cwd, "out"), 0755)
+	os.WriteFile(filepath.Join(cwd, "out", "later.txt"), []byte("later"), 0644)
+	os.MkdirAll(filepath.Join(cwd, "kept", "new"), 0755)
+
+	_, err = store.Restore(snap)
+	if err == nil || !strings.Contains(err.Error(), "out") {
+		t.Errorf("Expected the non-empty created directory to be reported, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cwd, "b.txt")); !os.IsNotExist(err) {
+		t.Error("Expected the moved-to file to be removed")
+	}
+	if data, _ := os.ReadFile(filepath.Join(cwd, "a.txt")); string(data) != "a" {
+		t.Errorf("Expected a.txt to be restored, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(cwd, "kept", "new")); !os.IsNotExist(err) {
+		t.Error("Expected the empty created directory to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(cwd, "out", "later.txt")); err != nil {
+		t.Error("Expected files in a non-empty created directory to be kept")
+	}
+}
+
+func TestRestore_Overwrite(t *testing.T) {
+	store, _ := NewStore(filepath.Join(t.TempDir(), "backups"))
+
+	cwd := t.TempDir()
+	target := filepath.Join(cwd, "config.txt")
+	os.WriteFile(target, []byte("original"), 0644)
+
+	snap, err := store.Snapshot("echo x > config.txt", cwd, []string{"config.txt"}, 0)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+
+	os.WriteFile(target, []byte("clobbered"), 0644)
+
+	if _, err := store.Restore(snap); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(target)
+	if string(data) != "original" {
+		t.Errorf("Expected original content, got %q", data)
+	}
+}
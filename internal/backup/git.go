@@ -0,0 +1,206 @@
+// Package backup provides safety refs for uncommitted git work
+package backup
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// Ways to keep uncommitted git work before a command discards it
+const (
+	GitModeRef   = "ref"   // snapshot the work in a commit under refs/sosomi/, leaving the working tree alone
+	GitModeStash = "stash" // stash the work, also kept under refs/sosomi/
+)
+
+// GitRefPrefix is the namespace of safety refs
+const GitRefPrefix = "refs/sosomi/"
+
+// ProtectGit keeps the uncommitted work a command would discard under a
+// new ref in its repository. A dropped stash is kept as is; otherwise
+// mode selects between a snapshot commit and git stash.
+func ProtectGit(loss *types.GitLoss, mode, command string) (*types.GitSafetyRef, error) {
+	if loss == nil || len(loss.Changes) == 0 {
+		return nil, fmt.Errorf("no uncommitted work to keep")
+	}
+
+	safety := &types.GitSafetyRef{
+		Repo: loss.Repo,
+		Ref:  GitRefPrefix + time.Now().Format("20060102-150405") + "-" + uuid.New().String()[:8],
+	}
+	for _, change := range loss.Changes {
+		if change.Status == "stash" && loss.Stash == "" {
+			return nil, fmt.Errorf("git stash clear drops every stash; only a single dropped stash can be kept")
+		}
+		safety.Paths = append(safety.Paths, change.Path)
+	}
+
+	var commit string
+	var err error
+	switch {
+	case loss.Stash != "":
+		commit, safety.Stash = loss.Stash, true
+	case mode == GitModeStash:
+		commit, err = stashChanges(loss, safety.Paths, command)
+		safety.Stash = true
+	case mode == GitModeRef:
+		commit, err = snapshotChanges(loss, safety.Paths, command)
+	default:
+		return nil, fmt.Errorf("unknown git safety mode: %s", mode)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := runGit(loss.Repo, nil, nil, "update-ref", "-m", "sosomi: "+command, safety.Ref, commit); err != nil {
+		return nil, err
+	}
+	return safety, nil
+}
+
+// stashChanges stashes the paths and returns the stash commit
+func stashChanges(loss *types.GitLoss, paths []string, command string) (string, error) {
+	before, _ := runGit(loss.Repo, nil, nil, "rev-parse", "--verify", "--quiet", "refs/stash")
+
+	untracked := "--include-untracked"
+	if loss.Ignored {
+		untracked = "--all"
+	}
+	if _, err := runGit(loss.Repo, nil, pathspecs(paths), "stash", "push", "--quiet", untracked,
+		"-m", "sosomi: "+command, "--pathspec-from-file=-", "--pathspec-file-nul"); err != nil {
+		return "", err
+	}
+
+	after, err := runGit(loss.Repo, nil, nil, "rev-parse", "--verify", "--quiet", "refs/stash")
+	if err != nil || after == before {
+		return "", fmt.Errorf("git stash did not record any changes")
+	}
+	return after, nil
+}
+
+// snapshotChanges commits the paths on top of HEAD through a temporary
+// index, so the working tree, index and branch are left alone
+func snapshotChanges(loss *types.GitLoss, paths []string, command string) (string, error) {
+	indexPath, err := runGit(loss.Repo, nil, nil, "rev-parse", "--path-format=absolute", "--git-path", "index")
+	if err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp("", "sosomi-index-*")
+	if err != nil {
+		return "", err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	// Start from the current index; a new repository has none yet
+	if index, err := os.ReadFile(indexPath); err == nil {
+		if err := os.WriteFile(tmp.Name(), index, 0600); err != nil {
+			return "", err
+		}
+	} else {
+		os.Remove(tmp.Name())
+	}
+
+	env := []string{
+		"GIT_INDEX_FILE=" + tmp.Name(),
+		"GIT_AUTHOR_NAME=sosomi", "GIT_AUTHOR_EMAIL=sosomi@localhost",
+		"GIT_COMMITTER_NAME=sosomi", "GIT_COMMITTER_EMAIL=sosomi@localhost",
+	}
+	add := []string{"add", "--all", "--pathspec-from-file=-", "--pathspec-file-nul"}
+	if loss.Ignored {
+		add = append(add, "--force")
+	}
+	if _, err := runGit(loss.Repo, env, pathspecs(paths), add...); err != nil {
+		return "", err
+	}
+	tree, err := runGit(loss.Repo, env, nil, "write-tree")
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"commit-tree", tree, "-m", "sosomi: uncommitted work before " + command}
+	if head, err := runGit(loss.Repo, nil, nil, "rev-parse", "--verify", "--quiet", "HEAD"); err == nil {
+		args = append(args, "-p", head)
+	}
+	return runGit(loss.Repo, env, nil, args...)
+}
+
+// RestoreGit brings back the work kept under a safety ref and returns the
+// restored paths. Stashes are applied; snapshots are checked out into the
+// working tree without touching the index.
+func RestoreGit(safety *types.GitSafetyRef) ([]string, error) {
+	if _, err := runGit(safety.Repo, nil, nil, "rev-parse", "--verify", "--quiet", safety.Ref); err != nil {
+		return nil, fmt.Errorf("safety ref %s not found in %s", safety.Ref, safety.Repo)
+	}
+
+	if safety.Stash {
+		if _, err := runGit(safety.Repo, nil, nil, "stash", "apply", "--quiet", safety.Ref); err != nil {
+			return nil, err
+		}
+		return absolutePaths(safety.Repo, safety.Paths), nil
+	}
+
+	// Deleted files are not in the snapshot and stay deleted
+	out, err := runGit(safety.Repo, nil, nil, append([]string{"ls-tree", "-r", "-z", "--name-only", safety.Ref, "--"}, safety.Paths...)...)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, path := range strings.Split(out, "\x00") {
+		if path != "" {
+			files = append(files, path)
+		}
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+	if _, err := runGit(safety.Repo, nil, pathspecs(files), "restore", "--source="+safety.Ref, "--worktree",
+		"--pathspec-from-file=-", "--pathspec-file-nul"); err != nil {
+		return nil, err
+	}
+	return absolutePaths(safety.Repo, files), nil
+}
+
+// pathspecs joins paths for --pathspec-from-file with --pathspec-file-nul
+func pathspecs(paths []string) []byte {
+	return []byte(strings.Join(paths, "\x00"))
+}
+
+// absolutePaths resolves repository paths against its top-level directory
+func absolutePaths(repo string, paths []string) []string {
+	result := make([]string, 0, len(paths))
+	for _, path := range paths {
+		result = append(result, filepath.Join(repo, path))
+	}
+	return result
+}
+
+// runGit runs git in the repository with literal pathspecs and returns its
+// trimmed output. stdin feeds --pathspec-from-file=- when set.
+func runGit(repo string, env []string, stdin []byte, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_LITERAL_PATHSPECS=1", "LC_ALL=C")
+	cmd.Env = append(cmd.Env, env...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,152 @@
+// Package backup git safety ref tests
+package backup
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// gitRepo creates a repository with tracked.txt committed, then modifies
+// tracked.txt and adds untracked notes.txt
+func gitRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "tracked.txt"), []byte("v1\n"), 0644)
+	git(t, dir, "init", "-q")
+	git(t, dir, "add", "-A")
+	git(t, dir, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "init")
+
+	os.WriteFile(filepath.Join(dir, "tracked.txt"), []byte("v2\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("draft\n"), 0644)
+	return dir
+}
+
+// git runs a git command in dir and returns its trimmed output
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// gitLoss is the loss of git reset --hard && git clean -f in a gitRepo
+func gitLoss(dir string) *types.GitLoss {
+	return &types.GitLoss{Repo: dir, Changes: []types.GitChange{
+		{Status: " M", Path: "tracked.txt"},
+		{Status: "??", Path: "notes.txt"},
+	}}
+}
+
+// assertContent fails unless the file in dir has the given content
+func assertContent(t *testing.T, dir, name, want string) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatalf("Expected %s to exist: %v", name, err)
+	}
+	if string(data) != want {
+		t.Errorf("Expected %s to contain %q, got %q", name, want, data)
+	}
+}
+
+func TestProtectGit_Ref(t *testing.T) {
+	dir := gitRepo(t)
+	status := git(t, dir, "status", "--porcelain")
+
+	safety, err := ProtectGit(gitLoss(dir), GitModeRef, "git reset --hard")
+	if err != nil {
+		t.Fatalf("ProtectGit failed: %v", err)
+	}
+	if !strings.HasPrefix(safety.Ref, GitRefPrefix) || safety.Stash {
+		t.Errorf("Expected a snapshot ref under %s, got %+v", GitRefPrefix, safety)
+	}
+	if got := git(t, dir, "status", "--porcelain"); got != status {
+		t.Errorf("Expected the working tree and index to be left alone, got %q", got)
+	}
+	if got := git(t, dir, "show", safety.Ref+":notes.txt"); got != "draft" {
+		t.Errorf("Expected the untracked file in the snapshot, got %q", got)
+	}
+
+	git(t, dir, "reset", "-q", "--hard")
+	git(t, dir, "clean", "-qf")
+
+	restored, err := RestoreGit(safety)
+	if err != nil {
+		t.Fatalf("RestoreGit failed: %v", err)
+	}
+	if len(restored) != 2 {
+		t.Errorf("Expected 2 restored files, got %v", restored)
+	}
+	assertContent(t, dir, "tracked.txt", "v2\n")
+	assertContent(t, dir, "notes.txt", "draft\n")
+}
+
+func TestProtectGit_Stash(t *testing.T) {
+	dir := gitRepo(t)
+
+	safety, err := ProtectGit(gitLoss(dir), GitModeStash, "git checkout .")
+	if err != nil {
+		t.Fatalf("ProtectGit failed: %v", err)
+	}
+	if !safety.Stash {
+		t.Errorf("Expected a stash ref, got %+v", safety)
+	}
+	if got := git(t, dir, "status", "--porcelain"); got != "" {
+		t.Errorf("Expected the changes to be stashed, got %q", got)
+	}
+
+	// The ref keeps the stash after it is dropped
+	git(t, dir, "stash", "drop", "-q")
+	if _, err := RestoreGit(safety); err != nil {
+		t.Fatalf("RestoreGit failed: %v", err)
+	}
+	assertContent(t, dir, "tracked.txt", "v2\n")
+	assertContent(t, dir, "notes.txt", "draft\n")
+}
+
+func TestProtectGit_DroppedStash(t *testing.T) {
+	dir := gitRepo(t)
+	git(t, dir, "stash", "push", "-q", "--include-untracked")
+	commit := git(t, dir, "rev-parse", "stash@{0}")
+
+	loss := &types.GitLoss{Repo: dir, Stash: commit, Changes: []types.GitChange{
+		{Status: "stash", Path: "tracked.txt"},
+		{Status: "stash", Path: "notes.txt"},
+	}}
+	safety, err := ProtectGit(loss, GitModeRef, "git stash drop")
+	if err != nil {
+		t.Fatalf("ProtectGit failed: %v", err)
+	}
+	if got := git(t, dir, "rev-parse", safety.Ref); got != commit {
+		t.Errorf("Expected the ref to point at the stash %s, got %s", commit, got)
+	}
+}
+
+func TestProtectGit_Errors(t *testing.T) {
+	dir := gitRepo(t)
+
+	if _, err := ProtectGit(&types.GitLoss{Repo: dir}, GitModeRef, "git reset --hard"); err == nil {
+		t.Error("Expected an error without changes")
+	}
+	if _, err := ProtectGit(gitLoss(dir), "copy", "git reset --hard"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+	cleared := &types.GitLoss{Repo: dir, Changes: []types.GitChange{{Status: "stash", Path: "stash@{0}: WIP on master"}}}
+	if _, err := ProtectGit(cleared, GitModeRef, "git stash clear"); err == nil {
+		t.Error("Expected an error for git stash clear")
+	}
+	if _, err := RestoreGit(&types.GitSafetyRef{Repo: dir, Ref: GitRefPrefix + "missing"}); err == nil {
+		t.Error("Expected an error for a missing ref")
+	}
+}
@@ -41,6 +41,9 @@ type Config struct {
 	// MCP settings
 	MCP MCPConfig `yaml:"mcp" mapstructure:"mcp"`
 
+	// Token pricing and spending budgets
+	Usage UsageConfig `yaml:"usage" mapstructure:"usage"`
+
 	// UI settings
 	UI UIConfig `yaml:"ui" mapstructure:"ui"`
 
@@ -53,41 +56,114 @@ type Config struct {
 
 // ProviderConfig holds AI provider settings
 type ProviderConfig struct {
-	Name     string `yaml:"name" mapstructure:"name"`         // openai, ollama, lmstudio, llamacpp, generic
+	Name     string `yaml:"name" mapstructure:"name"`         // openai, anthropic, azure, ollama, lmstudio, llamacpp, generic
 	Endpoint string `yaml:"endpoint" mapstructure:"endpoint"` // API endpoint
 
+	// Azure OpenAI routing
+	Deployment string `yaml:"deployment,omitempty" mapstructure:"deployment"`   // Deployment name (defaults to model.name)
+	APIVersion string `yaml:"api_version,omitempty" mapstructure:"api_version"` // api-version query parameter
+	AuthType   string `yaml:"auth_type,omitempty" mapstructure:"auth_type"`     // api_key (default) or entra
+
 	// Credential references (prefer api_key_env over api_key for security)
 	APIKey    string `yaml:"api_key,omitempty" mapstructure:"api_key"`         // Plain text key (not recommended)
 	APIKeyEnv string `yaml:"api_key_env,omitempty" mapstructure:"api_key_env"` // Environment variable name
 	APIKeyCmd string `yaml:"api_key_cmd,omitempty" mapstructure:"api_key_cmd"` // Command to get key (e.g., "op read 'OpenAI'")
+
+	// Providers tried in order when this one fails after its retries
+	Fallbacks []FallbackConfig `yaml:"fallbacks,omitempty" mapstructure:"fallbacks"`
+}
+
+// FallbackConfig describes a provider in the fallback chain. Unset
+// endpoints and keys resolve the same way as for the main provider.
+type FallbackConfig struct {
+	Name       string `yaml:"name" mapstructure:"name"`
+	Model      string `yaml:"model,omitempty" mapstructure:"model"` // Defaults to the provider's default model
+	Endpoint   string `yaml:"endpoint,omitempty" mapstructure:"endpoint"`
+	Deployment string `yaml:"deployment,omitempty" mapstructure:"deployment"`
+	APIVersion string `yaml:"api_version,omitempty" mapstructure:"api_version"`
+	AuthType   string `yaml:"auth_type,omitempty" mapstructure:"auth_type"`
+	APIKey     string `yaml:"api_key,omitempty" mapstructure:"api_key"`
+	APIKeyEnv  string `yaml:"api_key_env,omitempty" mapstructure:"api_key_env"`
+	APIKeyCmd  string `yaml:"api_key_cmd,omitempty" mapstructure:"api_key_cmd"`
+}
+
+// ProviderConfig returns the provider settings of the fallback
+func (f FallbackConfig) ProviderConfig() ProviderConfig {
+	return ProviderConfig{
+		Name:       f.Name,
+		Endpoint:   f.Endpoint,
+		Deployment: f.Deployment,
+		APIVersion: f.APIVersion,
+		AuthType:   f.AuthType,
+		APIKey:     f.APIKey,
+		APIKeyEnv:  f.APIKeyEnv,
+		APIKeyCmd:  f.APIKeyCmd,
+	}
 }
 
 // ModelConfig holds model-specific parameters
 type ModelConfig struct {
 	Name             string   `yaml:"name" mapstructure:"name"`
 	MaxTokens        int      `yaml:"max_tokens" mapstructure:"max_tokens"`
-	Temperature      float64  `yaml:"temperature" mapstructure:"temperature"`
+	Temperature      *float64 `yaml:"temperature,omitempty" mapstructure:"temperature"` // nil leaves the backend default
 	TopP             float64  `yaml:"top_p" mapstructure:"top_p"`
 	FrequencyPenalty float64  `yaml:"frequency_penalty,omitempty" mapstructure:"frequency_penalty"`
 	PresencePenalty  float64  `yaml:"presence_penalty,omitempty" mapstructure:"presence_penalty"`
+	RepeatPenalty    float64  `yaml:"repeat_penalty,omitempty" mapstructure:"repeat_penalty"` // Ollama only
 	StopSequences    []string `yaml:"stop_sequences,omitempty" mapstructure:"stop_sequences"`
 	TimeoutSeconds   int      `yaml:"timeout_seconds" mapstructure:"timeout_seconds"`
 	MaxRetries       int      `yaml:"max_retries" mapstructure:"max_retries"`
 	StreamOutput     bool     `yaml:"stream_output" mapstructure:"stream_output"`
+
+	// Per-mode overrides of the parameters above: command, chat, title, summary
+	Modes map[string]ModelOverrides `yaml:"modes,omitempty" mapstructure:"modes"`
+
+	// Context windows in tokens keyed by model name or prefix. They take
+	// precedence over what the server reports and the built-in table.
+	ContextWindows map[string]int `yaml:"context_windows,omitempty" mapstructure:"context_windows"`
+	// What to do with old messages that no longer fit: summarize or trim
+	ContextStrategy string `yaml:"context_strategy" mapstructure:"context_strategy"`
+	// Share of the context window above which chat sessions and
+	// conversations are compacted as with /compact; 0 disables it
+	AutoCompact float64 `yaml:"auto_compact,omitempty" mapstructure:"auto_compact"`
+	// Download OpenAI tokenizer vocabularies to count tokens exactly;
+	// without them tokens are estimated and nothing is downloaded
+	TokenizerDownload bool `yaml:"tokenizer_download,omitempty" mapstructure:"tokenizer_download"`
+}
+
+// ContextStrategies lists the valid values of model.context_strategy
+var ContextStrategies = []string{"summarize", "trim"}
+
+// ModelOverrides replaces model parameters for one request mode. Unset
+// fields keep the value from ModelConfig.
+type ModelOverrides struct {
+	MaxTokens        *int     `yaml:"max_tokens,omitempty" mapstructure:"max_tokens"`
+	Temperature      *float64 `yaml:"temperature,omitempty" mapstructure:"temperature"`
+	TopP             *float64 `yaml:"top_p,omitempty" mapstructure:"top_p"`
+	FrequencyPenalty *float64 `yaml:"frequency_penalty,omitempty" mapstructure:"frequency_penalty"`
+	PresencePenalty  *float64 `yaml:"presence_penalty,omitempty" mapstructure:"presence_penalty"`
+	RepeatPenalty    *float64 `yaml:"repeat_penalty,omitempty" mapstructure:"repeat_penalty"`
+	StopSequences    []string `yaml:"stop_sequences,omitempty" mapstructure:"stop_sequences"`
 }
 
+// ModelModes lists the request modes that can be overridden in model.modes
+var ModelModes = []string{"command", "chat", "title", "summary"}
+
 // SafetyConfig holds safety-related settings
 type SafetyConfig struct {
-	Level               string   `yaml:"level" mapstructure:"level"` // strict, moderate, permissive
+	Level               string   `yaml:"level" mapstructure:"level"` // strict, cautious, moderate, normal, relaxed, permissive, dangerous
 	RequireConfirmation bool     `yaml:"require_confirmation" mapstructure:"require_confirmation"`
 	AutoExecuteSafe     bool     `yaml:"auto_execute_safe" mapstructure:"auto_execute_safe"`
-	ConfirmThreshold    string   `yaml:"confirm_threshold,omitempty" mapstructure:"confirm_threshold"` // safe, caution, dangerous
+	ConfirmThreshold    string   `yaml:"confirm_threshold,omitempty" mapstructure:"confirm_threshold"` // safe, caution, dangerous, or none to follow the level
 	DryRunDefault       bool     `yaml:"dry_run_default,omitempty" mapstructure:"dry_run_default"`
 	MaxAffectedFiles    int      `yaml:"max_affected_files,omitempty" mapstructure:"max_affected_files"`
 	BlockedCommands     []string `yaml:"blocked_commands,omitempty" mapstructure:"blocked_commands"`
 	ProtectedPaths      []string `yaml:"protected_paths,omitempty" mapstructure:"protected_paths"`
 	AllowedPaths        []string `yaml:"allowed_paths,omitempty" mapstructure:"allowed_paths"`
 	CustomRulesPath     string   `yaml:"custom_rules_path,omitempty" mapstructure:"custom_rules_path"`
+	ProductionPatterns  []string `yaml:"production_patterns,omitempty" mapstructure:"production_patterns"` // globs like prod* matched against kube contexts, profiles and hosts
+	ProductionAction    string   `yaml:"production_action,omitempty" mapstructure:"production_action"`     // escalate, confirm or warn
+	GitSafetyNet        string   `yaml:"git_safety_net,omitempty" mapstructure:"git_safety_net"`           // ask, ref, stash or off
 }
 
 // HistoryConfig holds history settings
@@ -95,6 +171,11 @@ type HistoryConfig struct {
 	Enabled       bool   `yaml:"enabled" mapstructure:"enabled"`
 	DBPath        string `yaml:"db_path" mapstructure:"db_path"`
 	RetentionDays int    `yaml:"retention_days" mapstructure:"retention_days"`
+
+	// Pre-execution file snapshots used by 'sosomi undo'
+	BackupEnabled bool   `yaml:"backup_enabled" mapstructure:"backup_enabled"`
+	BackupDir     string `yaml:"backup_dir,omitempty" mapstructure:"backup_dir"`
+	BackupMaxMB   int    `yaml:"backup_max_mb,omitempty" mapstructure:"backup_max_mb"` // skip snapshots larger than this
 }
 
 // LLMConfig holds LLM client mode settings
@@ -117,9 +198,78 @@ type ChatConfig struct {
 
 // MCPConfig holds MCP (Model Context Protocol) settings
 type MCPConfig struct {
-	Enabled  bool     `yaml:"enabled" mapstructure:"enabled"`
-	Servers  []string `yaml:"servers,omitempty" mapstructure:"servers"`
-	ToolsDir string   `yaml:"tools_dir,omitempty" mapstructure:"tools_dir"`
+	Enabled  bool              `yaml:"enabled" mapstructure:"enabled"`
+	Servers  []MCPServerConfig `yaml:"servers,omitempty" mapstructure:"servers"`
+	ToolsDir string            `yaml:"tools_dir,omitempty" mapstructure:"tools_dir"` // searched for relative server commands
+	LogDir   string            `yaml:"log_dir,omitempty" mapstructure:"log_dir"`     // server stderr logs
+}
+
+// MCPServerConfig describes an MCP server started or connected to by sosomi.
+// Local servers set Command; remote servers set URL.
+type MCPServerConfig struct {
+	Name      string            `yaml:"name" mapstructure:"name"`
+	Transport string            `yaml:"transport,omitempty" mapstructure:"transport"` // stdio, http or sse
+	Command   string            `yaml:"command,omitempty" mapstructure:"command"`
+	Args      []string          `yaml:"args,omitempty" mapstructure:"args"`
+	Env       map[string]string `yaml:"env,omitempty" mapstructure:"env"`
+	Cwd       string            `yaml:"cwd,omitempty" mapstructure:"cwd"`
+	URL       string            `yaml:"url,omitempty" mapstructure:"url"`
+	Headers   map[string]string `yaml:"headers,omitempty" mapstructure:"headers"` // ${VAR} is read from the environment
+	Enabled   *bool             `yaml:"enabled,omitempty" mapstructure:"enabled"` // defaults to true
+}
+
+// IsEnabled reports whether the server should be started
+func (s MCPServerConfig) IsEnabled() bool {
+	return s.Enabled == nil || *s.Enabled
+}
+
+// UnmarshalYAML accepts either a server mapping or, for older configs,
+// a plain command string such as "npx -y @modelcontextprotocol/server-git"
+func (s *MCPServerConfig) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*s = ParseMCPServerCommand(value.Value)
+		return nil
+	}
+
+	type plain MCPServerConfig
+	return value.Decode((*plain)(s))
+}
+
+// ParseMCPServerCommand converts a command string into a server config,
+// naming the server after the command's base name
+func ParseMCPServerCommand(command string) MCPServerConfig {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return MCPServerConfig{}
+	}
+	name := strings.TrimSuffix(filepath.Base(fields[0]), filepath.Ext(fields[0]))
+	return MCPServerConfig{
+		Name:    name,
+		Command: fields[0],
+		Args:    fields[1:],
+	}
+}
+
+// UsageConfig holds token accounting settings
+type UsageConfig struct {
+	DBPath  string                 `yaml:"db_path" mapstructure:"db_path"`
+	Pricing map[string]PriceConfig `yaml:"pricing,omitempty" mapstructure:"pricing"` // keyed by model or provider/model
+	Budget  BudgetConfig           `yaml:"budget,omitempty" mapstructure:"budget"`
+}
+
+// PriceConfig is the price of a model in USD per million tokens
+type PriceConfig struct {
+	Input  float64 `yaml:"input" mapstructure:"input"`
+	Output float64 `yaml:"output" mapstructure:"output"`
+}
+
+// BudgetConfig limits spending in USD. Soft limits warn, hard limits refuse
+// requests until the day or month is over. Zero disables a limit.
+type BudgetConfig struct {
+	DailySoft   float64 `yaml:"daily_soft,omitempty" mapstructure:"daily_soft"`
+	DailyHard   float64 `yaml:"daily_hard,omitempty" mapstructure:"daily_hard"`
+	MonthlySoft float64 `yaml:"monthly_soft,omitempty" mapstructure:"monthly_soft"`
+	MonthlyHard float64 `yaml:"monthly_hard,omitempty" mapstructure:"monthly_hard"`
 }
 
 // UIConfig holds UI settings
@@ -174,11 +324,17 @@ func DefaultConfig() *Config {
 		Model: ModelConfig{
 			Name:           "gpt-4o",
 			MaxTokens:      2048,
-			Temperature:    0.1,
+			Temperature:    floatPtr(0.1),
 			TopP:           1.0,
 			TimeoutSeconds: 30,
 			MaxRetries:     3,
 			StreamOutput:   true,
+			Modes: map[string]ModelOverrides{
+				"chat":    {Temperature: floatPtr(0.7)},
+				"title":   {MaxTokens: intPtr(64), Temperature: floatPtr(0.3)},
+				"summary": {MaxTokens: intPtr(512), Temperature: floatPtr(0.2)},
+			},
+			ContextStrategy: "summarize",
 		},
 
 		Safety: SafetyConfig{
@@ -191,12 +347,18 @@ func DefaultConfig() *Config {
 			BlockedCommands:     []string{"shutdown", "reboot", "init 0", "init 6", ":(){ :|:& };:"},
 			ProtectedPaths:      []string{"/", "/etc", "/usr", "/bin", "/sbin", "/boot"},
 			CustomRulesPath:     filepath.Join(configDir, "safety_rules.yaml"),
+			ProductionPatterns:  []string{"prod*", "*-prod", "*_prod"},
+			ProductionAction:    "escalate",
+			GitSafetyNet:        "ask",
 		},
 
 		History: HistoryConfig{
 			Enabled:       true,
 			DBPath:        filepath.Join(dataDir, "history.db"),
 			RetentionDays: 30,
+			BackupEnabled: true,
+			BackupDir:     filepath.Join(homeDir, ".sosomi", "backups"),
+			BackupMaxMB:   512,
 		},
 
 		LLM: LLMConfig{
@@ -217,8 +379,13 @@ func DefaultConfig() *Config {
 
 		MCP: MCPConfig{
 			Enabled:  true,
-			Servers:  []string{},
+			Servers:  []MCPServerConfig{},
 			ToolsDir: filepath.Join(configDir, "mcp_tools"),
+			LogDir:   filepath.Join(dataDir, "mcp_logs"),
+		},
+
+		Usage: UsageConfig{
+			DBPath: filepath.Join(dataDir, "usage.db"),
 		},
 
 		UI: UIConfig{
@@ -380,9 +547,60 @@ func copyConfig(src *Config) *Config {
 		dst.Safety.AllowedPaths = make([]string, len(src.Safety.AllowedPaths))
 		copy(dst.Safety.AllowedPaths, src.Safety.AllowedPaths)
 	}
+	if src.Safety.ProductionPatterns != nil {
+		dst.Safety.ProductionPatterns = append([]string(nil), src.Safety.ProductionPatterns...)
+	}
+	if src.Provider.Fallbacks != nil {
+		dst.Provider.Fallbacks = append([]FallbackConfig(nil), src.Provider.Fallbacks...)
+	}
+	if src.Model.StopSequences != nil {
+		dst.Model.StopSequences = append([]string(nil), src.Model.StopSequences...)
+	}
+	if src.Model.Modes != nil {
+		dst.Model.Modes = make(map[string]ModelOverrides, len(src.Model.Modes))
+		for mode, override := range src.Model.Modes {
+			if override.StopSequences != nil {
+				override.StopSequences = append([]string(nil), override.StopSequences...)
+			}
+			dst.Model.Modes[mode] = override
+		}
+	}
+	if src.Model.ContextWindows != nil {
+		dst.Model.ContextWindows = make(map[string]int, len(src.Model.ContextWindows))
+		for k, v := range src.Model.ContextWindows {
+			dst.Model.ContextWindows[k] = v
+		}
+	}
 	if src.MCP.Servers != nil {
-		dst.MCP.Servers = make([]string, len(src.MCP.Servers))
-		copy(dst.MCP.Servers, src.MCP.Servers)
+		dst.MCP.Servers = make([]MCPServerConfig, len(src.MCP.Servers))
+		for i, server := range src.MCP.Servers {
+			dst.MCP.Servers[i] = server
+			if server.Args != nil {
+				dst.MCP.Servers[i].Args = append([]string(nil), server.Args...)
+			}
+			if server.Env != nil {
+				dst.MCP.Servers[i].Env = make(map[string]string)
+				for k, v := range server.Env {
+					dst.MCP.Servers[i].Env[k] = v
+				}
+			}
+			if server.Headers != nil {
+				dst.MCP.Servers[i].Headers = make(map[string]string)
+				for k, v := range server.Headers {
+					dst.MCP.Servers[i].Headers[k] = v
+				}
+			}
+			if server.Enabled != nil {
+				enabled := *server.Enabled
+				dst.MCP.Servers[i].Enabled = &enabled
+			}
+		}
+	}
+	if src.Usage.Pricing != nil {
+		dst.Usage.Pricing = make(map[string]PriceConfig, len(src.Usage.Pricing))
+		for k, v := range src.Usage.Pricing {
+			dst.Usage.Pricing[k] = v
+		}
 	}
 	if src.Aliases != nil {
 		dst.Aliases = make(map[string]string)
@@ -393,6 +611,111 @@ func copyConfig(src *Config) *Config {
 	return &dst
 }
 
+// mergeModelOverrides merges the fields set in src into dst
+func mergeModelOverrides(dst, src ModelOverrides) ModelOverrides {
+	if src.MaxTokens != nil {
+		dst.MaxTokens = src.MaxTokens
+	}
+	if src.Temperature != nil {
+		dst.Temperature = src.Temperature
+	}
+	if src.TopP != nil {
+		dst.TopP = src.TopP
+	}
+	if src.FrequencyPenalty != nil {
+		dst.FrequencyPenalty = src.FrequencyPenalty
+	}
+	if src.PresencePenalty != nil {
+		dst.PresencePenalty = src.PresencePenalty
+	}
+	if src.RepeatPenalty != nil {
+		dst.RepeatPenalty = src.RepeatPenalty
+	}
+	if src.StopSequences != nil {
+		dst.StopSequences = src.StopSequences
+	}
+	return dst
+}
+
+// setModelOverride sets model.modes.<mode>.<field>
+func setModelOverride(c *Config, path []string, value interface{}) error {
+	if len(path) != 4 || !containsString(ModelModes, path[2]) {
+		return fmt.Errorf("unknown key: %s (use model.modes.<%s>.<field>)", strings.Join(path, "."), strings.Join(ModelModes, "|"))
+	}
+
+	override := c.Model.Modes[path[2]]
+	switch path[3] {
+	case "max_tokens":
+		override.MaxTokens = intPtr(toInt(value))
+	case "temperature":
+		override.Temperature = floatPtr(toFloat(value))
+	case "top_p":
+		override.TopP = floatPtr(toFloat(value))
+	case "frequency_penalty":
+		override.FrequencyPenalty = floatPtr(toFloat(value))
+	case "presence_penalty":
+		override.PresencePenalty = floatPtr(toFloat(value))
+	case "repeat_penalty":
+		override.RepeatPenalty = floatPtr(toFloat(value))
+	case "stop_sequences":
+		override.StopSequences = toStringList(value)
+	default:
+		return fmt.Errorf("unknown key: %s", strings.Join(path, "."))
+	}
+
+	if c.Model.Modes == nil {
+		c.Model.Modes = make(map[string]ModelOverrides)
+	}
+	c.Model.Modes[path[2]] = override
+	return nil
+}
+
+// setBudget sets usage.budget.<field>
+func setBudget(c *Config, path []string, value interface{}) error {
+	if len(path) != 3 {
+		return fmt.Errorf("unknown key: %s (use usage.budget.<daily_soft|daily_hard|monthly_soft|monthly_hard>)", strings.Join(path, "."))
+	}
+	switch path[2] {
+	case "daily_soft":
+		c.Usage.Budget.DailySoft = toFloat(value)
+	case "daily_hard":
+		c.Usage.Budget.DailyHard = toFloat(value)
+	case "monthly_soft":
+		c.Usage.Budget.MonthlySoft = toFloat(value)
+	case "monthly_hard":
+		c.Usage.Budget.MonthlyHard = toFloat(value)
+	default:
+		return fmt.Errorf("unknown key: %s", strings.Join(path, "."))
+	}
+	return nil
+}
+
+// setPrice sets usage.pricing.<model> from "input,output". Model names
+// may contain dots, so the rest of the path is the model.
+func setPrice(c *Config, path []string, value interface{}) error {
+	if len(path) < 3 {
+		return fmt.Errorf("unknown key: %s (use usage.pricing.<model>)", strings.Join(path, "."))
+	}
+	model := strings.Join(path[2:], ".")
+
+	parts := toStringList(value)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid price for %s: expected \"input,output\" in USD per million tokens", model)
+	}
+	var prices [2]float64
+	for i, part := range parts {
+		if _, err := fmt.Sscanf(part, "%g", &prices[i]); err != nil {
+			return fmt.Errorf("invalid price for %s: %s", model, part)
+		}
+	}
+
+	if c.Usage.Pricing == nil {
+		c.Usage.Pricing = make(map[string]PriceConfig)
+	}
+	c.Usage.Pricing[model] = PriceConfig{Input: prices[0], Output: prices[1]}
+	return nil
+}
+
 // mergeConfig merges src into dst (non-zero values from src override dst)
 func mergeConfig(dst, src *Config) {
 	if src.Provider.Name != "" {
@@ -410,6 +733,18 @@ func mergeConfig(dst, src *Config) {
 	if src.Provider.APIKeyCmd != "" {
 		dst.Provider.APIKeyCmd = src.Provider.APIKeyCmd
 	}
+	if src.Provider.Deployment != "" {
+		dst.Provider.Deployment = src.Provider.Deployment
+	}
+	if src.Provider.APIVersion != "" {
+		dst.Provider.APIVersion = src.Provider.APIVersion
+	}
+	if src.Provider.AuthType != "" {
+		dst.Provider.AuthType = src.Provider.AuthType
+	}
+	if src.Provider.Fallbacks != nil {
+		dst.Provider.Fallbacks = src.Provider.Fallbacks
+	}
 
 	if src.Model.Name != "" {
 		dst.Model.Name = src.Model.Name
@@ -417,7 +752,7 @@ func mergeConfig(dst, src *Config) {
 	if src.Model.MaxTokens != 0 {
 		dst.Model.MaxTokens = src.Model.MaxTokens
 	}
-	if src.Model.Temperature != 0 {
+	if src.Model.Temperature != nil {
 		dst.Model.Temperature = src.Model.Temperature
 	}
 	if src.Model.TopP != 0 {
@@ -429,6 +764,38 @@ func mergeConfig(dst, src *Config) {
 	if src.Model.MaxRetries != 0 {
 		dst.Model.MaxRetries = src.Model.MaxRetries
 	}
+	if src.Model.FrequencyPenalty != 0 {
+		dst.Model.FrequencyPenalty = src.Model.FrequencyPenalty
+	}
+	if src.Model.PresencePenalty != 0 {
+		dst.Model.PresencePenalty = src.Model.PresencePenalty
+	}
+	if src.Model.RepeatPenalty != 0 {
+		dst.Model.RepeatPenalty = src.Model.RepeatPenalty
+	}
+	if len(src.Model.StopSequences) > 0 {
+		dst.Model.StopSequences = src.Model.StopSequences
+	}
+	for mode, override := range src.Model.Modes {
+		if dst.Model.Modes == nil {
+			dst.Model.Modes = make(map[string]ModelOverrides)
+		}
+		dst.Model.Modes[mode] = mergeModelOverrides(dst.Model.Modes[mode], override)
+	}
+	if src.Model.ContextWindows != nil {
+		if dst.Model.ContextWindows == nil {
+			dst.Model.ContextWindows = make(map[string]int)
+		}
+		for k, v := range src.Model.ContextWindows {
+			dst.Model.ContextWindows[k] = v
+		}
+	}
+	if src.Model.ContextStrategy != "" {
+		dst.Model.ContextStrategy = src.Model.ContextStrategy
+	}
+	if src.Model.AutoCompact != 0 {
+		dst.Model.AutoCompact = src.Model.AutoCompact
+	}
 
 	if src.Safety.Level != "" {
 		dst.Safety.Level = src.Safety.Level
@@ -445,6 +812,15 @@ func mergeConfig(dst, src *Config) {
 	if len(src.Safety.AllowedPaths) > 0 {
 		dst.Safety.AllowedPaths = src.Safety.AllowedPaths
 	}
+	if len(src.Safety.ProductionPatterns) > 0 {
+		dst.Safety.ProductionPatterns = src.Safety.ProductionPatterns
+	}
+	if src.Safety.ProductionAction != "" {
+		dst.Safety.ProductionAction = src.Safety.ProductionAction
+	}
+	if src.Safety.GitSafetyNet != "" {
+		dst.Safety.GitSafetyNet = src.Safety.GitSafetyNet
+	}
 
 	if src.History.DBPath != "" {
 		dst.History.DBPath = src.History.DBPath
@@ -452,6 +828,46 @@ func mergeConfig(dst, src *Config) {
 	if src.History.RetentionDays != 0 {
 		dst.History.RetentionDays = src.History.RetentionDays
 	}
+	if src.History.BackupDir != "" {
+		dst.History.BackupDir = src.History.BackupDir
+	}
+	if src.History.BackupMaxMB != 0 {
+		dst.History.BackupMaxMB = src.History.BackupMaxMB
+	}
+
+	if len(src.MCP.Servers) > 0 {
+		dst.MCP.Servers = src.MCP.Servers
+	}
+	if src.MCP.ToolsDir != "" {
+		dst.MCP.ToolsDir = src.MCP.ToolsDir
+	}
+	if src.MCP.LogDir != "" {
+		dst.MCP.LogDir = src.MCP.LogDir
+	}
+
+	if src.Usage.DBPath != "" {
+		dst.Usage.DBPath = src.Usage.DBPath
+	}
+	if src.Usage.Pricing != nil {
+		if dst.Usage.Pricing == nil {
+			dst.Usage.Pricing = make(map[string]PriceConfig)
+		}
+		for k, v := range src.Usage.Pricing {
+			dst.Usage.Pricing[k] = v
+		}
+	}
+	if src.Usage.Budget.DailySoft != 0 {
+		dst.Usage.Budget.DailySoft = src.Usage.Budget.DailySoft
+	}
+	if src.Usage.Budget.DailyHard != 0 {
+		dst.Usage.Budget.DailyHard = src.Usage.Budget.DailyHard
+	}
+	if src.Usage.Budget.MonthlySoft != 0 {
+		dst.Usage.Budget.MonthlySoft = src.Usage.Budget.MonthlySoft
+	}
+	if src.Usage.Budget.MonthlyHard != 0 {
+		dst.Usage.Budget.MonthlyHard = src.Usage.Budget.MonthlyHard
+	}
 
 	if src.UI.Language != "" {
 		dst.UI.Language = src.UI.Language
@@ -548,6 +964,14 @@ func setNestedValue(c *Config, path []string, value interface{}) error {
 				c.Provider.APIKeyEnv = strVal
 			case "api_key_cmd":
 				c.Provider.APIKeyCmd = strVal
+			case "deployment":
+				c.Provider.Deployment = strVal
+			case "api_version":
+				c.Provider.APIVersion = strVal
+			case "auth_type":
+				c.Provider.AuthType = strVal
+			case "fallbacks":
+				c.Provider.Fallbacks = toFallbacks(value)
 			default:
 				return fmt.Errorf("unknown key: %s", strings.Join(path, "."))
 			}
@@ -561,15 +985,39 @@ func setNestedValue(c *Config, path []string, value interface{}) error {
 			case "max_tokens":
 				c.Model.MaxTokens = toInt(value)
 			case "temperature":
-				c.Model.Temperature = toFloat(value)
+				c.Model.Temperature = floatPtr(toFloat(value))
 			case "top_p":
 				c.Model.TopP = toFloat(value)
+			case "frequency_penalty":
+				c.Model.FrequencyPenalty = toFloat(value)
+			case "presence_penalty":
+				c.Model.PresencePenalty = toFloat(value)
+			case "repeat_penalty":
+				c.Model.RepeatPenalty = toFloat(value)
+			case "stop_sequences":
+				c.Model.StopSequences = toStringList(value)
 			case "timeout_seconds":
 				c.Model.TimeoutSeconds = toInt(value)
 			case "max_retries":
 				c.Model.MaxRetries = toInt(value)
 			case "stream_output":
 				c.Model.StreamOutput = toBool(value)
+			case "modes":
+				return setModelOverride(c, path, value)
+			case "context_windows":
+				if len(path) < 3 {
+					return fmt.Errorf("unknown key: %s (use model.context_windows.<model>)", strings.Join(path, "."))
+				}
+				if c.Model.ContextWindows == nil {
+					c.Model.ContextWindows = make(map[string]int)
+				}
+				c.Model.ContextWindows[strings.Join(path[2:], ".")] = toInt(value)
+			case "context_strategy":
+				c.Model.ContextStrategy = strVal
+			case "auto_compact":
+				c.Model.AutoCompact = toFloat(value)
+			case "tokenizer_download":
+				c.Model.TokenizerDownload = toBool(value)
 			default:
 				return fmt.Errorf("unknown key: %s", strings.Join(path, "."))
 			}
@@ -590,6 +1038,10 @@ func setNestedValue(c *Config, path []string, value interface{}) error {
 				c.Safety.DryRunDefault = toBool(value)
 			case "max_affected_files":
 				c.Safety.MaxAffectedFiles = toInt(value)
+			case "production_action":
+				c.Safety.ProductionAction = strVal
+			case "git_safety_net":
+				c.Safety.GitSafetyNet = strVal
 			default:
 				return fmt.Errorf("unknown key: %s", strings.Join(path, "."))
 			}
@@ -604,6 +1056,12 @@ func setNestedValue(c *Config, path []string, value interface{}) error {
 				c.History.DBPath = strVal
 			case "retention_days":
 				c.History.RetentionDays = toInt(value)
+			case "backup_enabled":
+				c.History.BackupEnabled = toBool(value)
+			case "backup_dir":
+				c.History.BackupDir = strVal
+			case "backup_max_mb":
+				c.History.BackupMaxMB = toInt(value)
 			default:
 				return fmt.Errorf("unknown key: %s", strings.Join(path, "."))
 			}
@@ -648,6 +1106,22 @@ func setNestedValue(c *Config, path []string, value interface{}) error {
 				c.MCP.Enabled = toBool(value)
 			case "tools_dir":
 				c.MCP.ToolsDir = strVal
+			case "log_dir":
+				c.MCP.LogDir = strVal
+			default:
+				return fmt.Errorf("unknown key: %s", strings.Join(path, "."))
+			}
+			return nil
+		}
+	case "usage":
+		if len(path) >= 2 {
+			switch path[1] {
+			case "db_path":
+				c.Usage.DBPath = strVal
+			case "budget":
+				return setBudget(c, path, value)
+			case "pricing":
+				return setPrice(c, path, value)
 			default:
 				return fmt.Errorf("unknown key: %s", strings.Join(path, "."))
 			}
@@ -681,6 +1155,14 @@ func getNestedValue(c *Config, path []string) (interface{}, error) {
 			return c.Provider.APIKeyEnv, nil
 		case "api_key_cmd":
 			return c.Provider.APIKeyCmd, nil
+		case "deployment":
+			return c.Provider.Deployment, nil
+		case "api_version":
+			return c.Provider.APIVersion, nil
+		case "auth_type":
+			return c.Provider.AuthType, nil
+		case "fallbacks":
+			return c.Provider.Fallbacks, nil
 		}
 	case "model":
 		if len(path) == 1 {
@@ -692,9 +1174,40 @@ func getNestedValue(c *Config, path []string) (interface{}, error) {
 		case "max_tokens":
 			return c.Model.MaxTokens, nil
 		case "temperature":
-			return c.Model.Temperature, nil
+			if c.Model.Temperature == nil {
+				return nil, nil
+			}
+			return *c.Model.Temperature, nil
 		case "top_p":
 			return c.Model.TopP, nil
+		case "frequency_penalty":
+			return c.Model.FrequencyPenalty, nil
+		case "presence_penalty":
+			return c.Model.PresencePenalty, nil
+		case "repeat_penalty":
+			return c.Model.RepeatPenalty, nil
+		case "stop_sequences":
+			return c.Model.StopSequences, nil
+		case "modes":
+			if len(path) == 2 {
+				return c.Model.Modes, nil
+			}
+			if override, ok := c.Model.Modes[path[2]]; ok && len(path) == 3 {
+				return override, nil
+			}
+		case "context_windows":
+			if len(path) == 2 {
+				return c.Model.ContextWindows, nil
+			}
+			if window, ok := c.Model.ContextWindows[strings.Join(path[2:], ".")]; ok {
+				return window, nil
+			}
+		case "context_strategy":
+			return c.Model.ContextStrategy, nil
+		case "auto_compact":
+			return c.Model.AutoCompact, nil
+		case "tokenizer_download":
+			return c.Model.TokenizerDownload, nil
 		case "timeout_seconds":
 			return c.Model.TimeoutSeconds, nil
 		case "max_retries":
@@ -713,6 +1226,16 @@ func getNestedValue(c *Config, path []string) (interface{}, error) {
 			return c.Safety.RequireConfirmation, nil
 		case "auto_execute_safe":
 			return c.Safety.AutoExecuteSafe, nil
+		case "confirm_threshold":
+			return c.Safety.ConfirmThreshold, nil
+		case "dry_run_default":
+			return c.Safety.DryRunDefault, nil
+		case "production_patterns":
+			return c.Safety.ProductionPatterns, nil
+		case "production_action":
+			return c.Safety.ProductionAction, nil
+		case "git_safety_net":
+			return c.Safety.GitSafetyNet, nil
 		}
 	case "history":
 		if len(path) == 1 {
@@ -723,6 +1246,12 @@ func getNestedValue(c *Config, path []string) (interface{}, error) {
 			return c.History.Enabled, nil
 		case "db_path":
 			return c.History.DBPath, nil
+		case "backup_enabled":
+			return c.History.BackupEnabled, nil
+		case "backup_dir":
+			return c.History.BackupDir, nil
+		case "backup_max_mb":
+			return c.History.BackupMaxMB, nil
 		}
 	case "ui":
 		if len(path) == 1 {
@@ -734,6 +1263,49 @@ func getNestedValue(c *Config, path []string) (interface{}, error) {
 		case "show_explanations":
 			return c.UI.ShowExplanations, nil
 		}
+	case "mcp":
+		if len(path) == 1 {
+			return c.MCP, nil
+		}
+		switch path[1] {
+		case "enabled":
+			return c.MCP.Enabled, nil
+		case "servers":
+			return c.MCP.Servers, nil
+		case "tools_dir":
+			return c.MCP.ToolsDir, nil
+		case "log_dir":
+			return c.MCP.LogDir, nil
+		}
+	case "usage":
+		if len(path) == 1 {
+			return c.Usage, nil
+		}
+		switch path[1] {
+		case "db_path":
+			return c.Usage.DBPath, nil
+		case "pricing":
+			if len(path) == 2 {
+				return c.Usage.Pricing, nil
+			}
+			if price, ok := c.Usage.Pricing[strings.Join(path[2:], ".")]; ok {
+				return price, nil
+			}
+		case "budget":
+			if len(path) == 2 {
+				return c.Usage.Budget, nil
+			}
+			switch path[2] {
+			case "daily_soft":
+				return c.Usage.Budget.DailySoft, nil
+			case "daily_hard":
+				return c.Usage.Budget.DailyHard, nil
+			case "monthly_soft":
+				return c.Usage.Budget.MonthlySoft, nil
+			case "monthly_hard":
+				return c.Usage.Budget.MonthlyHard, nil
+			}
+		}
 	case "default_profile":
 		return c.DefaultProfile, nil
 	case "active_profile":
@@ -776,6 +1348,42 @@ func toFloat(v interface{}) float64 {
 	return 0
 }
 
+// toStringList converts a list or a comma-separated string to a string slice
+func toStringList(v interface{}) []string {
+	switch val := v.(type) {
+	case []string:
+		return val
+	case string:
+		var list []string
+		for _, item := range strings.Split(val, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// toFallbacks converts a comma-separated list of provider[:model] entries
+// to fallback configs
+func toFallbacks(v interface{}) []FallbackConfig {
+	var fallbacks []FallbackConfig
+	for _, item := range toStringList(v) {
+		name, model, _ := strings.Cut(item, ":")
+		fallbacks = append(fallbacks, FallbackConfig{Name: name, Model: model})
+	}
+	return fallbacks
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
 func toBool(v interface{}) bool {
 	switch val := v.(type) {
 	case bool:
@@ -790,11 +1398,31 @@ func toBool(v interface{}) bool {
 
 // GetAPIKey returns the API key for the current provider
 func GetAPIKey() string {
-	c := Get()
+	return Get().Provider.ResolveAPIKey()
+}
+
+// providerKeyEnvs are the environment variables holding the API keys of
+// providers other than OpenAI
+var providerKeyEnvs = map[string]string{
+	"anthropic": "ANTHROPIC_API_KEY",
+	"azure":     "AZURE_OPENAI_API_KEY",
+}
 
+// KeyEnv returns the environment variable the API key is read from. The
+// default OPENAI_API_KEY stands for the provider's own variable, so that
+// switching providers never sends an OpenAI key to another one.
+func (p ProviderConfig) KeyEnv() string {
+	if own := providerKeyEnvs[p.Name]; own != "" && p.APIKeyEnv == "OPENAI_API_KEY" {
+		return own
+	}
+	return p.APIKeyEnv
+}
+
+// ResolveAPIKey returns the API key for the provider
+func (p ProviderConfig) ResolveAPIKey() string {
 	// 1. Check command (e.g., 1Password CLI)
-	if c.Provider.APIKeyCmd != "" {
-		parts := strings.Fields(c.Provider.APIKeyCmd)
+	if p.APIKeyCmd != "" {
+		parts := strings.Fields(p.APIKeyCmd)
 		if len(parts) > 0 {
 			cmd := exec.Command(parts[0], parts[1:]...)
 			output, err := cmd.Output()
@@ -805,42 +1433,47 @@ func GetAPIKey() string {
 	}
 
 	// 2. Check configured environment variable
-	if c.Provider.APIKeyEnv != "" {
-		if key := os.Getenv(c.Provider.APIKeyEnv); key != "" {
+	if env := p.KeyEnv(); env != "" {
+		if key := os.Getenv(env); key != "" {
 			return key
 		}
 	}
 
 	// 3. Check direct API key in config
-	if c.Provider.APIKey != "" {
-		return c.Provider.APIKey
+	if p.APIKey != "" {
+		return p.APIKey
 	}
 
-	// 4. Check common environment variables
+	// 4. Check SOSOMI_API_KEY, then the provider's own variable. Keys of
+	// other providers are never used.
 	if key := os.Getenv("SOSOMI_API_KEY"); key != "" {
 		return key
 	}
-	if key := os.Getenv("OPENAI_API_KEY"); key != "" {
-		return key
-	}
-	if key := os.Getenv("ANTHROPIC_API_KEY"); key != "" {
-		return key
+	env := "OPENAI_API_KEY"
+	if own := providerKeyEnvs[p.Name]; own != "" {
+		env = own
 	}
-
-	return ""
+	return os.Getenv(env)
 }
 
 // GetEndpoint returns the API endpoint for the current provider
 func GetEndpoint() string {
-	c := Get()
+	return Get().Provider.ResolveEndpoint()
+}
 
+// ResolveEndpoint returns the configured endpoint or the provider's default
+func (p ProviderConfig) ResolveEndpoint() string {
 	// Check if endpoint is explicitly set
-	if c.Provider.Endpoint != "" {
-		return c.Provider.Endpoint
+	if p.Endpoint != "" {
+		return p.Endpoint
 	}
 
 	// Return defaults based on provider
-	switch c.Provider.Name {
+	switch p.Name {
+	case "anthropic":
+		return "https://api.anthropic.com"
+	case "azure":
+		return "" // Resource specific, no default
 	case "ollama":
 		return "http://localhost:11434"
 	case "lmstudio":
@@ -870,7 +1503,10 @@ func EnsureDirs() error {
 
 	dirs := []string{
 		filepath.Dir(c.History.DBPath),
+		filepath.Dir(c.Usage.DBPath),
+		c.History.BackupDir,
 		c.MCP.ToolsDir,
+		c.MCP.LogDir,
 		filepath.Dir(c.Safety.CustomRulesPath),
 		paths.ProfileDir,
 	}
@@ -1022,8 +1658,8 @@ func migrateLegacy(legacy *LegacyConfig, c *Config) {
 
 	// MCP
 	c.MCP.Enabled = legacy.MCPEnabled
-	if len(legacy.MCPServers) > 0 {
-		c.MCP.Servers = legacy.MCPServers
+	for _, server := range legacy.MCPServers {
+		c.MCP.Servers = append(c.MCP.Servers, ParseMCPServerCommand(server))
 	}
 	if legacy.MCPToolsDir != "" {
 		c.MCP.ToolsDir = legacy.MCPToolsDir
@@ -4,7 +4,10 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"gopkg.in/yaml.v3"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -32,8 +35,8 @@ func TestDefaultConfig(t *testing.T) {
 	if cfg.Model.MaxTokens != 2048 {
 		t.Errorf("Expected default Model.MaxTokens to be 2048, got %d", cfg.Model.MaxTokens)
 	}
-	if cfg.Model.Temperature != 0.1 {
-		t.Errorf("Expected default Model.Temperature to be 0.1, got %f", cfg.Model.Temperature)
+	if cfg.Model.Temperature == nil || *cfg.Model.Temperature != 0.1 {
+		t.Errorf("Expected default Model.Temperature to be 0.1, got %v", cfg.Model.Temperature)
 	}
 	if cfg.Model.TimeoutSeconds != 30 {
 		t.Errorf("Expected default Model.TimeoutSeconds to be 30, got %d", cfg.Model.TimeoutSeconds)
@@ -52,6 +55,9 @@ func TestDefaultConfig(t *testing.T) {
 	if !cfg.Safety.RequireConfirmation {
 		t.Error("Expected default Safety.RequireConfirmation to be true")
 	}
+	if cfg.Safety.ConfirmThreshold != "caution" {
+		t.Errorf("Expected default Safety.ConfirmThreshold to be 'caution', got '%s'", cfg.Safety.ConfirmThreshold)
+	}
 	if cfg.Safety.AutoExecuteSafe {
 		t.Error("Expected default Safety.AutoExecuteSafe to be false")
 	}
@@ -173,6 +179,7 @@ func TestGetEndpoint(t *testing.T) {
 		expected string
 	}{
 		{"OpenAI", "openai", "", "https://api.openai.com/v1"},
+		{"Anthropic", "anthropic", "", "https://api.anthropic.com"},
 		{"Ollama", "ollama", "", "http://localhost:11434"},
 		{"LMStudio", "lmstudio", "", "http://localhost:1234/v1"},
 		{"LlamaCpp", "llamacpp", "", "http://localhost:8080/v1"},
@@ -225,6 +232,49 @@ func TestGetAPIKey(t *testing.T) {
 	}
 }
 
+func TestGetAPIKey_PrefersProviderEnv(t *testing.T) {
+	ResetInitialized()
+	t.Setenv("SOSOMI_API_KEY", "")
+	t.Setenv("OPENAI_API_KEY", "openai-key")
+	t.Setenv("ANTHROPIC_API_KEY", "anthropic-key")
+
+	cfg := DefaultConfig()
+	cfg.Provider.APIKeyEnv = ""
+	cfg.Provider.APIKey = ""
+	activeCfg = cfg
+
+	cfg.Provider.Name = "anthropic"
+	if key := GetAPIKey(); key != "anthropic-key" {
+		t.Errorf("Expected ANTHROPIC_API_KEY for anthropic, got '%s'", key)
+	}
+
+	cfg.Provider.Name = "openai"
+	if key := GetAPIKey(); key != "openai-key" {
+		t.Errorf("Expected OPENAI_API_KEY for openai, got '%s'", key)
+	}
+
+	// Keys of other providers are never sent
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	cfg.Provider.Name = "anthropic"
+	if key := GetAPIKey(); key != "" {
+		t.Errorf("Expected no key for anthropic without ANTHROPIC_API_KEY, got '%s'", key)
+	}
+	cfg.Provider.Name = "azure"
+	cfg.Provider.APIKeyEnv = "OPENAI_API_KEY" // the default, left from openai
+	if key := GetAPIKey(); key != "" {
+		t.Errorf("Expected no key for azure without AZURE_OPENAI_API_KEY, got '%s'", key)
+	}
+	t.Setenv("AZURE_OPENAI_API_KEY", "azure-key")
+	if key := GetAPIKey(); key != "azure-key" {
+		t.Errorf("Expected AZURE_OPENAI_API_KEY for azure, got '%s'", key)
+	}
+	cfg.Provider.APIKeyEnv = "MY_AZURE_KEY"
+	t.Setenv("MY_AZURE_KEY", "custom-key")
+	if key := GetAPIKey(); key != "custom-key" {
+		t.Errorf("Expected the configured variable, got '%s'", key)
+	}
+}
+
 func TestSet(t *testing.T) {
 	ResetInitialized()
 	baseCfg := DefaultConfig()
@@ -301,6 +351,7 @@ func TestEnsureDirs(t *testing.T) {
 	baseCfg := DefaultConfig()
 	baseCfg.History.DBPath = filepath.Join(tmpDir, "data", "history.db")
 	baseCfg.MCP.ToolsDir = filepath.Join(tmpDir, "mcp_tools")
+	baseCfg.MCP.LogDir = filepath.Join(tmpDir, "mcp_logs")
 	baseCfg.Safety.CustomRulesPath = filepath.Join(tmpDir, "rules", "safety.yaml")
 	activeCfg = baseCfg
 
@@ -451,6 +502,251 @@ func TestMergeConfig(t *testing.T) {
 	}
 }
 
+func TestModelModes(t *testing.T) {
+	ResetInitialized()
+	baseCfg := DefaultConfig()
+	cfg = baseCfg
+	activeCfg = baseCfg
+
+	if err := Set("model.modes.command.temperature", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := Set("model.stop_sequences", "###, END"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := Set("model.modes.review.temperature", 0.5); err == nil {
+		t.Error("Expected error for unknown mode")
+	}
+
+	command := cfg.Model.Modes["command"]
+	if command.Temperature == nil || *command.Temperature != 0 {
+		t.Errorf("Expected explicit zero temperature for command mode, got %v", command.Temperature)
+	}
+	if len(cfg.Model.StopSequences) != 2 || cfg.Model.StopSequences[1] != "END" {
+		t.Errorf("Expected two stop sequences, got %q", cfg.Model.StopSequences)
+	}
+	if *cfg.Model.Modes["chat"].Temperature != 0.7 {
+		t.Error("Expected the default chat override to be kept")
+	}
+
+	// A zero base temperature is kept, and overrides the one below it
+	if err := Set("model.temperature", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if cfg.Model.Temperature == nil || *cfg.Model.Temperature != 0 {
+		t.Errorf("Expected explicit zero base temperature, got %v", cfg.Model.Temperature)
+	}
+	merged := copyConfig(baseCfg)
+	merged.Model.Temperature = floatPtr(0.5)
+	mergeConfig(merged, &Config{Model: ModelConfig{Temperature: floatPtr(0)}})
+	if *merged.Model.Temperature != 0 {
+		t.Errorf("Expected a zero temperature to override 0.5, got %v", *merged.Model.Temperature)
+	}
+	mergeConfig(merged, &Config{})
+	if *merged.Model.Temperature != 0 {
+		t.Errorf("Expected an unset temperature to keep 0, got %v", *merged.Model.Temperature)
+	}
+
+	// A profile overriding one field of a mode keeps the others
+	dst := copyConfig(baseCfg)
+	mergeConfig(dst, &Config{Model: ModelConfig{Modes: map[string]ModelOverrides{
+		"title": {MaxTokens: intPtr(32)},
+	}}})
+	title := dst.Model.Modes["title"]
+	if *title.MaxTokens != 32 || *title.Temperature != 0.3 {
+		t.Errorf("Expected merged title override, got max_tokens %d temperature %.1f", *title.MaxTokens, *title.Temperature)
+	}
+	if *baseCfg.Model.Modes["title"].MaxTokens != 64 {
+		t.Error("Modes map was not deep copied")
+	}
+
+	dst.Model.Modes["review"] = ModelOverrides{}
+	if result := Validate(dst); result.IsValid() {
+		t.Error("Expected validation error for unknown mode")
+	}
+}
+
+func TestProviderFallbacks(t *testing.T) {
+	ResetInitialized()
+	baseCfg := DefaultConfig()
+	cfg = baseCfg
+	activeCfg = baseCfg
+
+	if err := Set("provider.fallbacks", "ollama:llama3.2, openai"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	fallbacks := cfg.Provider.Fallbacks
+	if len(fallbacks) != 2 || fallbacks[0].Model != "llama3.2" || fallbacks[1].Name != "openai" || fallbacks[1].Model != "" {
+		t.Fatalf("Unexpected fallbacks %+v", fallbacks)
+	}
+
+	// A profile without fallbacks keeps the base chain
+	dst := copyConfig(cfg)
+	mergeConfig(dst, &Config{Provider: ProviderConfig{Name: "lmstudio"}})
+	if len(dst.Provider.Fallbacks) != 2 {
+		t.Errorf("Expected base fallbacks to be kept, got %+v", dst.Provider.Fallbacks)
+	}
+	dst.Provider.Fallbacks[0].Name = "changed"
+	if cfg.Provider.Fallbacks[0].Name != "ollama" {
+		t.Error("Fallbacks slice was not deep copied")
+	}
+
+	cfg.Provider.Fallbacks = []FallbackConfig{{Name: "bogus"}, {Name: "azure"}}
+	result := Validate(cfg)
+	var fields []string
+	for _, e := range result.Errors {
+		fields = append(fields, e.Field)
+	}
+	got := strings.Join(fields, ",")
+	if !strings.Contains(got, "provider.fallbacks[0].name") || !strings.Contains(got, "provider.fallbacks[1].deployment") {
+		t.Errorf("Expected fallback errors, got %s", got)
+	}
+}
+
+func TestUsageConfig(t *testing.T) {
+	ResetInitialized()
+	baseCfg := DefaultConfig()
+	cfg = baseCfg
+	activeCfg = baseCfg
+
+	if !strings.HasSuffix(cfg.Usage.DBPath, "usage.db") {
+		t.Errorf("Unexpected default usage db %s", cfg.Usage.DBPath)
+	}
+
+	if err := Set("usage.pricing.gpt-4.1", "2.5, 9"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := Set("usage.budget.daily_hard", "1.5"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if price := cfg.Usage.Pricing["gpt-4.1"]; price.Input != 2.5 || price.Output != 9 {
+		t.Errorf("Expected the model name to keep its dot, got %+v", cfg.Usage.Pricing)
+	}
+	if got, _ := GetValue("usage.budget.daily_hard"); got != 1.5 {
+		t.Errorf("Expected daily_hard 1.5, got %v", got)
+	}
+	if err := Set("usage.pricing.gpt-4o", "cheap"); err == nil {
+		t.Error("Expected an error for a malformed price")
+	}
+	if err := Set("usage.budget.weekly", 1); err == nil {
+		t.Error("Expected an error for an unknown budget")
+	}
+
+	// A profile adds prices and budgets without dropping the base ones
+	dst := copyConfig(cfg)
+	mergeConfig(dst, &Config{Usage: UsageConfig{
+		Pricing: map[string]PriceConfig{"openrouter/llama-3.3": {Input: 0.1, Output: 0.2}},
+		Budget:  BudgetConfig{MonthlyHard: 20},
+	}})
+	if len(dst.Usage.Pricing) != 2 || dst.Usage.Budget.DailyHard != 1.5 || dst.Usage.Budget.MonthlyHard != 20 {
+		t.Errorf("Unexpected merged usage %+v", dst.Usage)
+	}
+	if len(cfg.Usage.Pricing) != 1 {
+		t.Error("Pricing map was not deep copied")
+	}
+
+	cfg.Usage.Budget = BudgetConfig{DailySoft: 2, DailyHard: 1, MonthlyHard: -1}
+	result := &ValidationResult{}
+	validateUsage(cfg, result)
+	if len(result.Errors) != 1 || result.Errors[0].Field != "usage.budget.monthly_hard" {
+		t.Errorf("Expected a negative budget error, got %v", result.Errors)
+	}
+	if len(result.Warnings) != 1 || result.Warnings[0].Field != "usage.budget.daily_soft" {
+		t.Errorf("Expected a warning for a soft budget above the hard one, got %v", result.Warnings)
+	}
+}
+
+func TestContextConfig(t *testing.T) {
+	ResetInitialized()
+	baseCfg := DefaultConfig()
+	cfg = baseCfg
+	activeCfg = baseCfg
+
+	if cfg.Model.ContextStrategy != "summarize" {
+		t.Errorf("Expected summarize by default, got %s", cfg.Model.ContextStrategy)
+	}
+	if err := Set("model.context_windows.qwen2.5-coder", 32768); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := Set("model.context_strategy", "trim"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got, _ := GetValue("model.context_windows.qwen2.5-coder"); got != 32768 {
+		t.Errorf("Expected the model name to keep its dot, got %v", got)
+	}
+
+	dst := copyConfig(cfg)
+	mergeConfig(dst, &Config{Model: ModelConfig{ContextWindows: map[string]int{"llama3.2": 8192}}})
+	if len(dst.Model.ContextWindows) != 2 || dst.Model.ContextStrategy != "trim" {
+		t.Errorf("Unexpected merged model %+v", dst.Model)
+	}
+	if len(cfg.Model.ContextWindows) != 1 {
+		t.Error("ContextWindows map was not deep copied")
+	}
+
+	if err := Set("model.auto_compact", "0.8"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got, _ := GetValue("model.auto_compact"); got != 0.8 {
+		t.Errorf("Expected auto_compact 0.8, got %v", got)
+	}
+
+	cfg.Model.ContextWindows["tiny"] = 0
+	cfg.Model.ContextStrategy = "forget"
+	cfg.Model.AutoCompact = 1.5
+	result := &ValidationResult{}
+	validateModel(cfg, result)
+	if len(result.Errors) != 3 {
+		t.Errorf("Expected errors for the window, the strategy and auto_compact, got %v", result.Errors)
+	}
+}
+
+func TestProviderConfig_ResolveEndpoint(t *testing.T) {
+	if got := (ProviderConfig{Name: "ollama"}).ResolveEndpoint(); got != "http://localhost:11434" {
+		t.Errorf("Expected the Ollama default, got %s", got)
+	}
+	if got := (ProviderConfig{Name: "ollama", Endpoint: "http://gpu:11434"}).ResolveEndpoint(); got != "http://gpu:11434" {
+		t.Errorf("Expected the configured endpoint, got %s", got)
+	}
+}
+
+func TestMCPServerConfig_Unmarshal(t *testing.T) {
+	data := `
+servers:
+  - name: git
+    command: uvx
+    args: ["mcp-server-git", "--repository", "."]
+    env:
+      GIT_PAGER: cat
+    cwd: /tmp
+    enabled: false
+  - /usr/local/bin/fs-server --root /home
+`
+	var cfg MCPConfig
+	if err := yaml.Unmarshal([]byte(data), &cfg); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if len(cfg.Servers) != 2 {
+		t.Fatalf("Expected 2 servers, got %d", len(cfg.Servers))
+	}
+
+	git := cfg.Servers[0]
+	if git.Name != "git" || git.Command != "uvx" || len(git.Args) != 3 || git.Env["GIT_PAGER"] != "cat" || git.Cwd != "/tmp" {
+		t.Errorf("Unexpected server config: %+v", git)
+	}
+	if git.IsEnabled() {
+		t.Error("Expected git server to be disabled")
+	}
+
+	legacy := cfg.Servers[1]
+	if legacy.Name != "fs-server" || legacy.Command != "/usr/local/bin/fs-server" || len(legacy.Args) != 2 {
+		t.Errorf("Unexpected legacy server config: %+v", legacy)
+	}
+	if !legacy.IsEnabled() {
+		t.Error("Expected servers to be enabled by default")
+	}
+}
+
 func TestInitWithProfile(t *testing.T) {
 	ResetInitialized()
 
@@ -133,6 +133,10 @@ func TestProfile(name string) error {
 	if endpoint == "" {
 		// Use default for provider type
 		switch profile.Provider.Name {
+		case "anthropic":
+			endpoint = "https://api.anthropic.com"
+		case "azure":
+			return fmt.Errorf("profile '%s' has no Azure resource endpoint", name)
 		case "ollama":
 			endpoint = "http://localhost:11434"
 		case "lmstudio":
@@ -220,12 +224,15 @@ func GetProfileInfo(name string) (string, error) {
 	if profile.Provider.Endpoint != "" {
 		sb.WriteString(fmt.Sprintf("Endpoint: %s\n", profile.Provider.Endpoint))
 	}
+	if profile.Provider.Deployment != "" {
+		sb.WriteString(fmt.Sprintf("Deployment: %s\n", profile.Provider.Deployment))
+	}
 	sb.WriteString(fmt.Sprintf("Model: %s\n", profile.Model.Name))
 	if profile.Model.MaxTokens > 0 {
 		sb.WriteString(fmt.Sprintf("Max Tokens: %d\n", profile.Model.MaxTokens))
 	}
-	if profile.Model.Temperature > 0 {
-		sb.WriteString(fmt.Sprintf("Temperature: %.2f\n", profile.Model.Temperature))
+	if profile.Model.Temperature != nil {
+		sb.WriteString(fmt.Sprintf("Temperature: %.2f\n", *profile.Model.Temperature))
 	}
 	if profile.Safety.Level != "" {
 		sb.WriteString(fmt.Sprintf("Safety Level: %s\n", profile.Safety.Level))
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"path"
 	"strings"
 )
 
@@ -70,9 +71,11 @@ func Validate(cfg *Config) *ValidationResult {
 	}
 
 	validateProvider(cfg, result)
+	validateFallbacks(cfg, result)
 	validateModel(cfg, result)
 	validateSafety(cfg, result)
 	validateHistory(cfg, result)
+	validateUsage(cfg, result)
 	validateMCP(cfg, result)
 
 	return result
@@ -85,20 +88,20 @@ func ValidateCurrent() *ValidationResult {
 
 func validateProvider(cfg *Config, result *ValidationResult) {
 	// Validate provider name
-	validProviders := []string{"openai", "ollama", "lmstudio", "llamacpp", "local", "generic"}
+	validProviders := []string{"openai", "anthropic", "azure", "ollama", "lmstudio", "llamacpp", "local", "generic"}
 	providerName := strings.ToLower(cfg.Provider.Name)
 
 	if providerName == "" {
 		result.Errors = append(result.Errors, ValidationError{
 			Field:   "provider.name",
 			Message: "provider name is required",
-			Hint:    "Set provider.name to one of: openai, ollama, lmstudio, llamacpp, local",
+			Hint:    "Set provider.name to one of: openai, anthropic, azure, ollama, lmstudio, llamacpp, local",
 		})
 	} else if !containsString(validProviders, providerName) {
 		result.Warnings = append(result.Warnings, ValidationError{
 			Field:   "provider.name",
 			Message: fmt.Sprintf("unknown provider '%s'", providerName),
-			Hint:    "Known providers: openai, ollama, lmstudio, llamacpp, local",
+			Hint:    "Known providers: openai, anthropic, azure, ollama, lmstudio, llamacpp, local",
 		})
 	}
 
@@ -110,6 +113,8 @@ func validateProvider(cfg *Config, result *ValidationResult) {
 			switch providerName {
 			case "openai":
 				// OpenAI has a default
+			case "anthropic":
+				// Anthropic has a default
 			case "ollama":
 				// Ollama has a default
 			case "lmstudio":
@@ -135,10 +140,14 @@ func validateProvider(cfg *Config, result *ValidationResult) {
 		}
 	}
 
-	// Validate API key for OpenAI
-	if providerName == "openai" {
+	if providerName == "azure" {
+		validateAzure(cfg, result)
+	}
+
+	// Validate API key for hosted providers
+	if providerName == "openai" || providerName == "anthropic" || providerName == "azure" {
 		apiKey := cfg.Provider.APIKey
-		apiKeyEnv := cfg.Provider.APIKeyEnv
+		apiKeyEnv := cfg.Provider.KeyEnv()
 		apiKeyCmd := cfg.Provider.APIKeyCmd
 
 		hasKey := false
@@ -169,12 +178,90 @@ func validateProvider(cfg *Config, result *ValidationResult) {
 		}
 
 		if !hasKey && apiKeyEnv == "" && apiKeyCmd == "" {
+			label, envVar := "OpenAI", "OPENAI_API_KEY"
+			switch providerName {
+			case "anthropic":
+				label, envVar = "Anthropic", "ANTHROPIC_API_KEY"
+			case "azure":
+				label, envVar = "Azure OpenAI", "AZURE_OPENAI_API_KEY"
+			}
 			result.Errors = append(result.Errors, ValidationError{
 				Field:   "provider.api_key",
-				Message: "OpenAI requires an API key",
-				Hint:    "Set api_key_env: OPENAI_API_KEY and export the variable",
+				Message: fmt.Sprintf("%s requires an API key", label),
+				Hint:    fmt.Sprintf("Set api_key_env: %s and export the variable", envVar),
+			})
+		}
+	}
+}
+
+// validateFallbacks checks the providers of the fallback chain
+func validateFallbacks(cfg *Config, result *ValidationResult) {
+	validProviders := []string{"openai", "anthropic", "azure", "ollama", "lmstudio", "llamacpp", "generic"}
+
+	for i, fallback := range cfg.Provider.Fallbacks {
+		field := fmt.Sprintf("provider.fallbacks[%d]", i)
+		name := strings.ToLower(fallback.Name)
+
+		if !containsString(validProviders, name) {
+			result.Errors = append(result.Errors, ValidationError{
+				Field:   field + ".name",
+				Message: fmt.Sprintf("unknown fallback provider '%s'", fallback.Name),
+				Hint:    "Known providers: " + strings.Join(validProviders, ", "),
 			})
+			continue
 		}
+
+		if name == "azure" && fallback.Deployment == "" && fallback.Model == "" {
+			result.Errors = append(result.Errors, ValidationError{
+				Field:   field + ".deployment",
+				Message: "Azure OpenAI requires a deployment name",
+				Hint:    "Set deployment (or model) on the fallback",
+			})
+		}
+		if name == "generic" && fallback.Endpoint == "" {
+			result.Errors = append(result.Errors, ValidationError{
+				Field:   field + ".endpoint",
+				Message: "endpoint URL is required for this provider",
+			})
+		}
+
+		if (name == "openai" || name == "anthropic" || name == "azure") &&
+			fallback.APIKeyCmd == "" && fallback.ProviderConfig().ResolveAPIKey() == "" {
+			result.Warnings = append(result.Warnings, ValidationError{
+				Field:   field + ".api_key_env",
+				Message: fmt.Sprintf("no API key found for fallback provider '%s'", fallback.Name),
+				Hint:    "Set api_key_env on the fallback and export the variable",
+			})
+		}
+	}
+}
+
+// validateAzure checks the Azure OpenAI routing and authentication settings
+func validateAzure(cfg *Config, result *ValidationResult) {
+	if cfg.Provider.Deployment == "" && cfg.Model.Name == "" {
+		result.Errors = append(result.Errors, ValidationError{
+			Field:   "provider.deployment",
+			Message: "Azure OpenAI requires a deployment name",
+			Hint:    "Set provider.deployment (or model.name) to the deployment created in your resource",
+		})
+	}
+
+	switch strings.ToLower(cfg.Provider.AuthType) {
+	case "", "api_key":
+	case "entra":
+		if cfg.Provider.APIKeyCmd == "" {
+			result.Warnings = append(result.Warnings, ValidationError{
+				Field:   "provider.auth_type",
+				Message: "Entra tokens expire, but no api_key_cmd is set to fetch a fresh one",
+				Hint:    "Set api_key_cmd to e.g. az account get-access-token --resource https://cognitiveservices.azure.com --query accessToken -o tsv",
+			})
+		}
+	default:
+		result.Errors = append(result.Errors, ValidationError{
+			Field:   "provider.auth_type",
+			Message: fmt.Sprintf("unknown auth type '%s'", cfg.Provider.AuthType),
+			Hint:    "Use api_key or entra",
+		})
 	}
 }
 
@@ -188,10 +275,10 @@ func validateModel(cfg *Config, result *ValidationResult) {
 	}
 
 	// Validate temperature
-	if cfg.Model.Temperature < 0 || cfg.Model.Temperature > 2 {
+	if t := cfg.Model.Temperature; t != nil && (*t < 0 || *t > 2) {
 		result.Warnings = append(result.Warnings, ValidationError{
 			Field:   "model.temperature",
-			Message: fmt.Sprintf("unusual temperature value: %.2f", cfg.Model.Temperature),
+			Message: fmt.Sprintf("unusual temperature value: %.2f", *t),
 			Hint:    "Temperature typically ranges from 0 (deterministic) to 1 (creative)",
 		})
 	}
@@ -209,10 +296,85 @@ func validateModel(cfg *Config, result *ValidationResult) {
 			Hint:    "Most models have a context limit around 4096-128000 tokens",
 		})
 	}
+
+	if cfg.Model.MaxRetries < 0 {
+		result.Errors = append(result.Errors, ValidationError{
+			Field:   "model.max_retries",
+			Message: "max_retries cannot be negative",
+		})
+	}
+
+	// Validate top_p
+	if cfg.Model.TopP < 0 || cfg.Model.TopP > 1 {
+		result.Errors = append(result.Errors, ValidationError{
+			Field:   "model.top_p",
+			Message: fmt.Sprintf("top_p must be between 0 and 1, got %.2f", cfg.Model.TopP),
+		})
+	}
+
+	// Validate per-mode overrides
+	for mode, override := range cfg.Model.Modes {
+		field := "model.modes." + mode
+		if !containsString(ModelModes, mode) {
+			result.Errors = append(result.Errors, ValidationError{
+				Field:   field,
+				Message: fmt.Sprintf("unknown mode '%s'", mode),
+				Hint:    "Valid modes: " + strings.Join(ModelModes, ", "),
+			})
+			continue
+		}
+		if override.Temperature != nil && (*override.Temperature < 0 || *override.Temperature > 2) {
+			result.Warnings = append(result.Warnings, ValidationError{
+				Field:   field + ".temperature",
+				Message: fmt.Sprintf("unusual temperature value: %.2f", *override.Temperature),
+				Hint:    "Temperature typically ranges from 0 (deterministic) to 1 (creative)",
+			})
+		}
+		if override.MaxTokens != nil && *override.MaxTokens < 0 {
+			result.Errors = append(result.Errors, ValidationError{
+				Field:   field + ".max_tokens",
+				Message: "max_tokens cannot be negative",
+			})
+		}
+		if override.TopP != nil && (*override.TopP < 0 || *override.TopP > 1) {
+			result.Errors = append(result.Errors, ValidationError{
+				Field:   field + ".top_p",
+				Message: fmt.Sprintf("top_p must be between 0 and 1, got %.2f", *override.TopP),
+			})
+		}
+	}
+
+	for model, window := range cfg.Model.ContextWindows {
+		if window <= 0 {
+			result.Errors = append(result.Errors, ValidationError{
+				Field:   "model.context_windows." + model,
+				Message: fmt.Sprintf("context window must be positive, got %d", window),
+			})
+		} else if window <= cfg.Model.MaxTokens {
+			result.Warnings = append(result.Warnings, ValidationError{
+				Field:   "model.context_windows." + model,
+				Message: fmt.Sprintf("context window %d leaves no room next to max_tokens %d", window, cfg.Model.MaxTokens),
+			})
+		}
+	}
+	if cfg.Model.ContextStrategy != "" && !containsString(ContextStrategies, cfg.Model.ContextStrategy) {
+		result.Errors = append(result.Errors, ValidationError{
+			Field:   "model.context_strategy",
+			Message: fmt.Sprintf("invalid context strategy '%s'", cfg.Model.ContextStrategy),
+			Hint:    "Valid strategies: " + strings.Join(ContextStrategies, ", "),
+		})
+	}
+	if cfg.Model.AutoCompact < 0 || cfg.Model.AutoCompact >= 1 {
+		result.Errors = append(result.Errors, ValidationError{
+			Field:   "model.auto_compact",
+			Message: fmt.Sprintf("auto_compact must be between 0 and 1, got %.2f", cfg.Model.AutoCompact),
+			Hint:    "A share of the context window such as 0.8, or 0 to disable",
+		})
+	}
 }
 
 func validateSafety(cfg *Config, result *ValidationResult) {
-	validLevels := []string{"strict", "cautious", "moderate", "normal", "relaxed", "dangerous"}
+	validLevels := []string{"strict", "cautious", "moderate", "normal", "relaxed", "permissive", "dangerous"}
 	level := strings.ToLower(cfg.Safety.Level)
 
 	if level == "" {
@@ -224,7 +386,7 @@ func validateSafety(cfg *Config, result *ValidationResult) {
 		result.Errors = append(result.Errors, ValidationError{
 			Field:   "safety.level",
 			Message: fmt.Sprintf("invalid safety level: %s", level),
-			Hint:    "Valid levels: strict, cautious, normal, relaxed, dangerous",
+			Hint:    "Valid levels: " + strings.Join(validLevels, ", "),
 		})
 	}
 
@@ -235,6 +397,41 @@ func validateSafety(cfg *Config, result *ValidationResult) {
 			Hint:    "Commands will be executed with minimal safety checks!",
 		})
 	}
+
+	validThresholds := []string{"safe", "caution", "dangerous", "none"}
+	if threshold := strings.ToLower(cfg.Safety.ConfirmThreshold); threshold != "" && !containsString(validThresholds, threshold) {
+		result.Errors = append(result.Errors, ValidationError{
+			Field:   "safety.confirm_threshold",
+			Message: fmt.Sprintf("invalid confirm threshold: %s", cfg.Safety.ConfirmThreshold),
+			Hint:    "Valid thresholds: " + strings.Join(validThresholds, ", ") + "; none follows the safety level",
+		})
+	}
+
+	validActions := []string{"escalate", "confirm", "warn"}
+	if action := strings.ToLower(cfg.Safety.ProductionAction); action != "" && !containsString(validActions, action) {
+		result.Errors = append(result.Errors, ValidationError{
+			Field:   "safety.production_action",
+			Message: fmt.Sprintf("invalid production action: %s", cfg.Safety.ProductionAction),
+			Hint:    "Valid actions: " + strings.Join(validActions, ", "),
+		})
+	}
+	validNets := []string{"ask", "ref", "stash", "off"}
+	if net := strings.ToLower(cfg.Safety.GitSafetyNet); net != "" && !containsString(validNets, net) {
+		result.Errors = append(result.Errors, ValidationError{
+			Field:   "safety.git_safety_net",
+			Message: fmt.Sprintf("invalid git safety net: %s", cfg.Safety.GitSafetyNet),
+			Hint:    "Valid values: " + strings.Join(validNets, ", "),
+		})
+	}
+	for _, pattern := range cfg.Safety.ProductionPatterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			result.Errors = append(result.Errors, ValidationError{
+				Field:   "safety.production_patterns",
+				Message: fmt.Sprintf("invalid production pattern %q: %v", pattern, err),
+				Hint:    "Use glob patterns like prod* or *-prod",
+			})
+		}
+	}
 }
 
 func validateHistory(cfg *Config, result *ValidationResult) {
@@ -255,6 +452,50 @@ func validateHistory(cfg *Config, result *ValidationResult) {
 	}
 }
 
+func validateUsage(cfg *Config, result *ValidationResult) {
+	for model, price := range cfg.Usage.Pricing {
+		if price.Input < 0 || price.Output < 0 {
+			result.Errors = append(result.Errors, ValidationError{
+				Field:   "usage.pricing." + model,
+				Message: "prices cannot be negative",
+			})
+		}
+	}
+
+	budget := cfg.Usage.Budget
+	limits := []struct {
+		field string
+		value float64
+	}{
+		{"daily_soft", budget.DailySoft},
+		{"daily_hard", budget.DailyHard},
+		{"monthly_soft", budget.MonthlySoft},
+		{"monthly_hard", budget.MonthlyHard},
+	}
+	for _, limit := range limits {
+		if limit.value < 0 {
+			result.Errors = append(result.Errors, ValidationError{
+				Field:   "usage.budget." + limit.field,
+				Message: "budget cannot be negative",
+				Hint:    "Use 0 to disable a limit",
+			})
+		}
+	}
+
+	if budget.DailyHard > 0 && budget.DailySoft >= budget.DailyHard {
+		result.Warnings = append(result.Warnings, ValidationError{
+			Field:   "usage.budget.daily_soft",
+			Message: "daily soft budget is not below the hard limit, so it never warns",
+		})
+	}
+	if budget.MonthlyHard > 0 && budget.MonthlySoft >= budget.MonthlyHard {
+		result.Warnings = append(result.Warnings, ValidationError{
+			Field:   "usage.budget.monthly_soft",
+			Message: "monthly soft budget is not below the hard limit, so it never warns",
+		})
+	}
+}
+
 func validateMCP(cfg *Config, result *ValidationResult) {
 	if cfg.MCP.Enabled {
 		if len(cfg.MCP.Servers) == 0 {
@@ -265,6 +506,90 @@ func validateMCP(cfg *Config, result *ValidationResult) {
 			})
 		}
 	}
+
+	seen := make(map[string]bool)
+	for i, server := range cfg.MCP.Servers {
+		field := fmt.Sprintf("mcp.servers[%d]", i)
+		if !validMCPServerName(server.Name) {
+			result.Errors = append(result.Errors, ValidationError{
+				Field:   field + ".name",
+				Message: fmt.Sprintf("invalid server name '%s'", server.Name),
+				Hint:    "Use letters, digits, '_' and '-' only; tools are exposed as <name>.<tool>",
+			})
+		} else if seen[server.Name] {
+			result.Errors = append(result.Errors, ValidationError{
+				Field:   field + ".name",
+				Message: fmt.Sprintf("duplicate server name '%s'", server.Name),
+			})
+		}
+		seen[server.Name] = true
+
+		validateMCPTransport(server, field, result)
+	}
+}
+
+// validateMCPTransport checks that a server has what its transport needs:
+// a command for stdio, an http(s) URL for http and sse
+func validateMCPTransport(server MCPServerConfig, field string, result *ValidationResult) {
+	transport := strings.ToLower(server.Transport)
+	if transport == "" {
+		transport = "stdio"
+		if server.URL != "" {
+			transport = "http"
+		}
+	}
+
+	switch transport {
+	case "stdio":
+		if server.Command == "" {
+			result.Errors = append(result.Errors, ValidationError{
+				Field:   field + ".command",
+				Message: "command is required",
+				Hint:    "Set command for a local server, or url for a remote one",
+			})
+		}
+		if server.URL != "" {
+			result.Errors = append(result.Errors, ValidationError{
+				Field:   field + ".url",
+				Message: "url cannot be used with the stdio transport",
+			})
+		}
+	case "http", "sse":
+		if server.Command != "" {
+			result.Errors = append(result.Errors, ValidationError{
+				Field:   field + ".command",
+				Message: fmt.Sprintf("command cannot be used with the %s transport", transport),
+				Hint:    "Set either command (local server) or url (remote server)",
+			})
+		}
+		u, err := url.Parse(server.URL)
+		if server.URL == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			result.Errors = append(result.Errors, ValidationError{
+				Field:   field + ".url",
+				Message: fmt.Sprintf("invalid url '%s'", server.URL),
+				Hint:    "Use an http:// or https:// URL",
+			})
+		}
+	default:
+		result.Errors = append(result.Errors, ValidationError{
+			Field:   field + ".transport",
+			Message: fmt.Sprintf("invalid transport '%s'", server.Transport),
+			Hint:    "Valid transports: stdio, http, sse",
+		})
+	}
+}
+
+// validMCPServerName reports whether name can be used as a tool namespace
+func validMCPServerName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
 }
 
 // ValidateConfigFile validates a configuration file at the given path
@@ -2,7 +2,9 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -87,7 +89,7 @@ func TestValidate_MissingModel(t *testing.T) {
 
 func TestValidate_UnusualTemperature(t *testing.T) {
 	cfg := DefaultConfig()
-	cfg.Model.Temperature = 2.5 // Too high
+	cfg.Model.Temperature = floatPtr(2.5) // Too high
 
 	result := Validate(cfg)
 
@@ -145,6 +147,78 @@ func TestValidate_DangerousSafetyLevel(t *testing.T) {
 	}
 }
 
+func TestValidate_ConfirmThreshold(t *testing.T) {
+	for threshold, valid := range map[string]bool{
+		"":          true,
+		"safe":      true,
+		"Caution":   true,
+		"dangerous": true,
+		"none":      true,
+		"critical":  false,
+		"high":      false,
+	} {
+		cfg := DefaultConfig()
+		cfg.Safety.ConfirmThreshold = threshold
+
+		result := &ValidationResult{}
+		validateSafety(cfg, result)
+
+		if result.IsValid() != valid {
+			t.Errorf("Expected valid=%v for confirm_threshold %q, got errors %v", valid, threshold, result.Errors)
+		}
+	}
+
+	cfg := DefaultConfig()
+	cfg.Safety.Level = "permissive"
+	result := &ValidationResult{}
+	validateSafety(cfg, result)
+	if !result.IsValid() {
+		t.Errorf("Expected permissive to be a valid safety level, got %v", result.Errors)
+	}
+}
+
+func TestValidate_Production(t *testing.T) {
+	tests := []struct {
+		action   string
+		patterns []string
+		valid    bool
+	}{
+		{"escalate", []string{"prod*"}, true},
+		{"Confirm", []string{"*-prod", "live"}, true},
+		{"warn", nil, true},
+		{"", nil, true},
+		{"block", []string{"prod*"}, false},
+		{"escalate", []string{"prod["}, false},
+	}
+
+	for _, tt := range tests {
+		cfg := DefaultConfig()
+		cfg.Safety.ProductionAction = tt.action
+		cfg.Safety.ProductionPatterns = tt.patterns
+
+		result := &ValidationResult{}
+		validateSafety(cfg, result)
+
+		if result.IsValid() != tt.valid {
+			t.Errorf("Expected valid=%v for %q %v, got errors %v", tt.valid, tt.action, tt.patterns, result.Errors)
+		}
+	}
+}
+
+func TestValidate_GitSafetyNet(t *testing.T) {
+	for net, valid := range map[string]bool{"ask": true, "Ref": true, "stash": true, "off": true, "": true, "commit": false} {
+		cfg := DefaultConfig()
+		cfg.Safety.GitSafetyNet = net
+
+		result := &ValidationResult{}
+		validateSafety(cfg, result)
+
+		if result.IsValid() != valid {
+			t.Errorf("Expected valid=%v for %q, got errors %v", valid, net, result.Errors)
+		}
+	}
+}
+
 func TestValidate_DisabledHistory(t *testing.T) {
 	cfg := DefaultConfig()
 	cfg.History.Enabled = false
@@ -167,7 +241,7 @@ func TestValidate_DisabledHistory(t *testing.T) {
 func TestValidate_MCPEnabledNoServers(t *testing.T) {
 	cfg := DefaultConfig()
 	cfg.MCP.Enabled = true
-	cfg.MCP.Servers = []string{}
+	cfg.MCP.Servers = []MCPServerConfig{}
 
 	result := Validate(cfg)
 
@@ -203,6 +277,72 @@ func TestValidate_OpenAI_MissingAPIKey(t *testing.T) {
 	}
 }
 
+func TestValidate_Anthropic_MissingAPIKey(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Provider.Name = "anthropic"
+	cfg.Provider.Endpoint = ""
+	cfg.Provider.APIKey = ""
+	cfg.Provider.APIKeyEnv = ""
+	cfg.Provider.APIKeyCmd = ""
+
+	result := Validate(cfg)
+
+	found := false
+	for _, e := range result.Errors {
+		if e.Field == "provider.api_key" && strings.Contains(e.Hint, "ANTHROPIC_API_KEY") {
+			found = true
+		}
+		if e.Field == "provider.endpoint" {
+			t.Errorf("Expected default endpoint for anthropic, got error: %s", e.Message)
+		}
+	}
+	if !found {
+		t.Errorf("Expected error pointing at ANTHROPIC_API_KEY, got %+v", result.Errors)
+	}
+	for _, w := range result.Warnings {
+		if w.Field == "provider.name" {
+			t.Errorf("Expected anthropic to be a known provider, got warning: %s", w.Message)
+		}
+	}
+}
+
+func TestValidate_Azure(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Provider.Name = "azure"
+	cfg.Provider.Endpoint = ""
+	cfg.Provider.APIKeyEnv = ""
+	cfg.Provider.APIKeyCmd = ""
+	cfg.Provider.AuthType = "password"
+
+	result := Validate(cfg)
+
+	errorFields := map[string]bool{}
+	for _, e := range result.Errors {
+		errorFields[e.Field] = true
+	}
+	for _, field := range []string{"provider.endpoint", "provider.auth_type", "provider.api_key"} {
+		if !errorFields[field] {
+			t.Errorf("Expected error on %s, got %+v", field, result.Errors)
+		}
+	}
+
+	cfg.Provider.Endpoint = "https://res.openai.azure.com"
+	cfg.Provider.AuthType = "entra"
+	cfg.Provider.APIKeyCmd = ""
+	cfg.Provider.APIKey = "static-token"
+	result = Validate(cfg)
+
+	found := false
+	for _, w := range result.Warnings {
+		if w.Field == "provider.auth_type" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected warning for entra auth without api_key_cmd")
+	}
+}
+
 func TestValidate_OpenAI_PlainTextAPIKey(t *testing.T) {
 	cfg := DefaultConfig()
 	cfg.Provider.Name = "openai"
@@ -390,3 +530,40 @@ func containsStr(s, substr string) bool {
 	}
 	return false
 }
+
+func TestValidate_MCPServers(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MCP.Servers = []MCPServerConfig{
+		{Name: "git", Command: "mcp-server-git"},
+		{Name: "git", Command: "other"},
+		{Name: "bad.name", Command: "x"},
+		{Name: "nocmd"},
+		{Name: "remote", URL: "https://tools.example.com/mcp"},
+		{Name: "legacy", Transport: "sse", URL: "http://localhost:8080/sse"},
+		{Name: "both", Command: "x", URL: "https://tools.example.com/mcp"},
+		{Name: "badurl", Transport: "http", URL: "ftp://example.com"},
+		{Name: "badtransport", Transport: "grpc", URL: "https://example.com"},
+	}
+
+	result := Validate(cfg)
+
+	fields := make(map[string]bool)
+	for _, e := range result.Errors {
+		fields[e.Field] = true
+	}
+	for _, want := range []string{
+		"mcp.servers[1].name", "mcp.servers[2].name", "mcp.servers[3].command",
+		"mcp.servers[6].command", "mcp.servers[7].url", "mcp.servers[8].transport",
+	} {
+		if !fields[want] {
+			t.Errorf("Expected error for %s, got %v", want, result.Errors)
+		}
+	}
+	for _, valid := range []int{0, 4, 5} {
+		for _, suffix := range []string{"name", "command", "url", "transport"} {
+			if field := fmt.Sprintf("mcp.servers[%d].%s", valid, suffix); fields[field] {
+				t.Errorf("Expected server %d to be valid, got error for %s", valid, field)
+			}
+		}
+	}
+}
@@ -34,12 +34,14 @@ func RunWizard() (*WizardResult, error) {
 	fmt.Println("Select your AI provider:")
 	fmt.Println()
 	fmt.Println("  1) OpenAI        - GPT-4o, GPT-4, etc. (requires API key)")
-	fmt.Println("  2) Ollama        - Local models, free (llama3, mistral, etc.)")
-	fmt.Println("  3) LM Studio     - Local models with GUI")
-	fmt.Println("  4) llama.cpp     - Local llama.cpp server")
-	fmt.Println("  5) Other         - Any OpenAI-compatible API")
+	fmt.Println("  2) Anthropic     - Claude Sonnet, Opus, Haiku (requires API key)")
+	fmt.Println("  3) Azure OpenAI  - OpenAI models deployed in your Azure resource")
+	fmt.Println("  4) Ollama        - Local models, free (llama3, mistral, etc.)")
+	fmt.Println("  5) LM Studio     - Local models with GUI")
+	fmt.Println("  6) llama.cpp     - Local llama.cpp server")
+	fmt.Println("  7) Other         - Any OpenAI-compatible API")
 	fmt.Println()
-	fmt.Print("Choice [1-5]: ")
+	fmt.Print("Choice [1-7]: ")
 
 	choice, _ := reader.ReadString('\n')
 	choice = strings.TrimSpace(choice)
@@ -52,18 +54,26 @@ func RunWizard() (*WizardResult, error) {
 			return nil, err
 		}
 	case "2":
-		if err := configureOllama(reader, cfg); err != nil {
+		if err := configureAnthropic(reader, cfg); err != nil {
 			return nil, err
 		}
 	case "3":
-		if err := configureLMStudio(reader, cfg); err != nil {
+		if err := configureAzure(reader, cfg); err != nil {
 			return nil, err
 		}
 	case "4":
-		if err := configureLlamaCpp(reader, cfg); err != nil {
+		if err := configureOllama(reader, cfg); err != nil {
 			return nil, err
 		}
 	case "5":
+		if err := configureLMStudio(reader, cfg); err != nil {
+			return nil, err
+		}
+	case "6":
+		if err := configureLlamaCpp(reader, cfg); err != nil {
+			return nil, err
+		}
+	case "7":
 		if err := configureGeneric(reader, cfg); err != nil {
 			return nil, err
 		}
@@ -163,6 +173,89 @@ func configureOpenAI(reader *bufio.Reader, cfg *Config) error {
 	return nil
 }
 
+func configureAnthropic(reader *bufio.Reader, cfg *Config) error {
+	cfg.Provider.Name = "anthropic"
+	cfg.Provider.Endpoint = "https://api.anthropic.com"
+	cfg.Provider.APIKeyEnv = "ANTHROPIC_API_KEY"
+	cfg.Model.Name = "claude-sonnet-4-5"
+
+	fmt.Println()
+	fmt.Println("Anthropic requires an API key from https://console.anthropic.com")
+	fmt.Println()
+
+	// Check if key already exists
+	if key := os.Getenv("ANTHROPIC_API_KEY"); key != "" {
+		fmt.Println("✓ Found ANTHROPIC_API_KEY environment variable")
+	} else {
+		fmt.Println("Set the ANTHROPIC_API_KEY environment variable with your API key.")
+		fmt.Print("Or enter a custom env var name [ANTHROPIC_API_KEY]: ")
+		envVar, _ := reader.ReadString('\n')
+		envVar = strings.TrimSpace(envVar)
+		if envVar != "" {
+			cfg.Provider.APIKeyEnv = envVar
+		}
+	}
+
+	fmt.Println()
+	fmt.Println("Available models: claude-sonnet-4-5, claude-opus-4-1, claude-haiku-4-5")
+	fmt.Print("Model [claude-sonnet-4-5]: ")
+	model, _ := reader.ReadString('\n')
+	model = strings.TrimSpace(model)
+	if model != "" {
+		cfg.Model.Name = model
+	}
+
+	return nil
+}
+
+func configureAzure(reader *bufio.Reader, cfg *Config) error {
+	cfg.Provider.Name = "azure"
+	cfg.Provider.APIKeyEnv = "AZURE_OPENAI_API_KEY"
+
+	fmt.Println()
+	fmt.Print("Resource endpoint (e.g. https://myresource.openai.azure.com): ")
+	endpoint, _ := reader.ReadString('\n')
+	cfg.Provider.Endpoint = strings.TrimSpace(endpoint)
+
+	fmt.Print("Deployment name: ")
+	deployment, _ := reader.ReadString('\n')
+	cfg.Provider.Deployment = strings.TrimSpace(deployment)
+	cfg.Model.Name = cfg.Provider.Deployment
+
+	fmt.Print("API version [2024-10-21]: ")
+	apiVersion, _ := reader.ReadString('\n')
+	cfg.Provider.APIVersion = strings.TrimSpace(apiVersion)
+
+	fmt.Println()
+	fmt.Println("Authentication:")
+	fmt.Println("  1) API key from the resource's Keys and Endpoint page")
+	fmt.Println("  2) Microsoft Entra ID token from the Azure CLI")
+	fmt.Print("Choice [1]: ")
+	auth, _ := reader.ReadString('\n')
+
+	if strings.TrimSpace(auth) == "2" {
+		cfg.Provider.AuthType = "entra"
+		cfg.Provider.APIKeyEnv = ""
+		cfg.Provider.APIKeyCmd = "az account get-access-token --resource https://cognitiveservices.azure.com --query accessToken -o tsv"
+		fmt.Println("✓ Tokens will be fetched with 'az account get-access-token' (run 'az login' first)")
+		return nil
+	}
+
+	if key := os.Getenv("AZURE_OPENAI_API_KEY"); key != "" {
+		fmt.Println("✓ Found AZURE_OPENAI_API_KEY environment variable")
+	} else {
+		fmt.Println("Set the AZURE_OPENAI_API_KEY environment variable with your API key.")
+		fmt.Print("Or enter a custom env var name [AZURE_OPENAI_API_KEY]: ")
+		envVar, _ := reader.ReadString('\n')
+		envVar = strings.TrimSpace(envVar)
+		if envVar != "" {
+			cfg.Provider.APIKeyEnv = envVar
+		}
+	}
+
+	return nil
+}
+
 func configureOllama(reader *bufio.Reader, cfg *Config) error {
 	cfg.Provider.Name = "ollama"
 	cfg.Model.Name = "llama3.2"
@@ -257,6 +350,10 @@ func testConnection(cfg *Config) bool {
 	endpoint := cfg.Provider.Endpoint
 	if endpoint == "" {
 		switch cfg.Provider.Name {
+		case "anthropic":
+			endpoint = "https://api.anthropic.com"
+		case "azure":
+			return false
 		case "ollama":
 			endpoint = "http://localhost:11434"
 		case "lmstudio":
@@ -318,6 +415,24 @@ func QuickSetup(provider, endpoint, model string) error {
 		} else {
 			cfg.Model.Name = "gpt-4o"
 		}
+	case "anthropic":
+		cfg.Provider.Name = "anthropic"
+		cfg.Provider.Endpoint = "https://api.anthropic.com"
+		cfg.Provider.APIKeyEnv = "ANTHROPIC_API_KEY"
+		if model != "" {
+			cfg.Model.Name = model
+		} else {
+			cfg.Model.Name = "claude-sonnet-4-5"
+		}
+	case "azure":
+		if endpoint == "" || model == "" {
+			return fmt.Errorf("azure needs the resource endpoint and the deployment name as model")
+		}
+		cfg.Provider.Name = "azure"
+		cfg.Provider.Endpoint = endpoint
+		cfg.Provider.APIKeyEnv = "AZURE_OPENAI_API_KEY"
+		cfg.Provider.Deployment = model
+		cfg.Model.Name = model
 	case "ollama":
 		cfg.Provider.Name = "ollama"
 		if endpoint != "" {
@@ -55,7 +55,14 @@ func (s *Store) initialize() error {
 		role TEXT NOT NULL,
 		content TEXT NOT NULL,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		tokens INTEGER DEFAULT 0
+		tokens INTEGER DEFAULT 0,
+		tool_calls TEXT,
+		tool_call_id TEXT,
+		tool_name TEXT,
+		tool_error INTEGER DEFAULT 0,
+		prompt_tokens INTEGER DEFAULT 0,
+		completion_tokens INTEGER DEFAULT 0,
+		summary_of INTEGER DEFAULT 0
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_conversations_updated ON conversations(updated_at);
@@ -64,7 +71,87 @@ func (s *Store) initialize() error {
 	`
 
 	_, err := s.db.Exec(schema)
-	return err
+	if err != nil {
+		return err
+	}
+
+	if err := s.migrateToolColumns(); err != nil {
+		return err
+	}
+	if err := s.migrateUsageColumns(); err != nil {
+		return err
+	}
+	if err := s.migrateSummaryColumn(); err != nil {
+		return err
+	}
+	return s.migrateToolErrorColumn()
+}
+
+// migrateToolColumns adds tool call columns to existing databases
+func (s *Store) migrateToolColumns() error {
+	rows, err := s.db.Query("SELECT tool_calls FROM messages LIMIT 1")
+	if err == nil {
+		rows.Close()
+		return nil
+	}
+
+	migrations := []string{
+		"ALTER TABLE messages ADD COLUMN tool_calls TEXT",
+		"ALTER TABLE messages ADD COLUMN tool_call_id TEXT",
+		"ALTER TABLE messages ADD COLUMN tool_name TEXT",
+	}
+	for _, m := range migrations {
+		if _, err := s.db.Exec(m); err != nil {
+			// Ignore errors if column already exists
+			continue
+		}
+	}
+	return nil
+}
+
+// migrateUsageColumns adds the billed token columns to existing databases
+func (s *Store) migrateUsageColumns() error {
+	rows, err := s.db.Query("SELECT prompt_tokens FROM messages LIMIT 1")
+	if err == nil {
+		rows.Close()
+		return nil
+	}
+
+	migrations := []string{
+		"ALTER TABLE messages ADD COLUMN prompt_tokens INTEGER DEFAULT 0",
+		"ALTER TABLE messages ADD COLUMN completion_tokens INTEGER DEFAULT 0",
+	}
+	for _, m := range migrations {
+		if _, err := s.db.Exec(m); err != nil {
+			// Ignore errors if column already exists
+			continue
+		}
+	}
+	return nil
+}
+
+// migrateSummaryColumn adds the summary_of column to existing databases
+func (s *Store) migrateSummaryColumn() error {
+	rows, err := s.db.Query("SELECT summary_of FROM messages LIMIT 1")
+	if err == nil {
+		rows.Close()
+		return nil
+	}
+	// Ignore errors if column already exists
+	s.db.Exec("ALTER TABLE messages ADD COLUMN summary_of INTEGER DEFAULT 0")
+	return nil
+}
+
+// migrateToolErrorColumn adds the failed tool call flag to existing databases
+func (s *Store) migrateToolErrorColumn() error {
+	rows, err := s.db.Query("SELECT tool_error FROM messages LIMIT 1")
+	if err == nil {
+		rows.Close()
+		return nil
+	}
+	// Ignore errors if column already exists
+	s.db.Exec("ALTER TABLE messages ADD COLUMN tool_error INTEGER DEFAULT 0")
+	return nil
 }
 
 // CreateConversation creates a new conversation
@@ -220,23 +307,103 @@ func (s *Store) ListConversations(limit, offset int) ([]*types.Conversation, err
 // AddMessage adds a message to a conversation
 func (s *Store) AddMessage(conversationID, role, content string, tokens int) (*types.ConversationMessage, error) {
 	msg := &types.ConversationMessage{
-		ID:             uuid.New().String(),
 		ConversationID: conversationID,
 		Role:           role,
 		Content:        content,
-		CreatedAt:      time.Now(),
 		Tokens:         tokens,
 	}
+	if err := s.insertMessage(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// AddToolCallMessage adds an assistant message that requests tool calls
+func (s *Store) AddToolCallMessage(conversationID, content string, calls []types.MCPToolCall, tokens int) (*types.ConversationMessage, error) {
+	msg := &types.ConversationMessage{
+		ConversationID: conversationID,
+		Role:           "assistant",
+		Content:        content,
+		Tokens:         tokens,
+		ToolCalls:      calls,
+	}
+	if err := s.insertMessage(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// AddReply adds an assistant message, possibly requesting tool calls,
+// together with the tokens billed for the request that produced it. The
+// message itself counts for its completion tokens.
+func (s *Store) AddReply(conversationID, content string, calls []types.MCPToolCall, usage types.TokenUsage) (*types.ConversationMessage, error) {
+	msg := &types.ConversationMessage{
+		ConversationID:   conversationID,
+		Role:             "assistant",
+		Content:          content,
+		Tokens:           usage.CompletionTokens,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		ToolCalls:        calls,
+	}
+	if err := s.insertMessage(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// AddToolResultMessage adds a "tool" message holding the result of a tool
+// call, which isError marks as failed
+func (s *Store) AddToolResultMessage(conversationID, callID, toolName, content string, isError bool) (*types.ConversationMessage, error) {
+	msg := &types.ConversationMessage{
+		ConversationID: conversationID,
+		Role:           "tool",
+		Content:        content,
+		ToolCallID:     callID,
+		ToolName:       toolName,
+		ToolError:      isError,
+	}
+	if err := s.insertMessage(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// AddSummary adds a "summary" message replacing the first summaryOf
+// messages of the conversation in the context sent to the model. The
+// replaced messages are kept.
+func (s *Store) AddSummary(conversationID, content string, summaryOf int) (*types.ConversationMessage, error) {
+	msg := &types.ConversationMessage{
+		ConversationID: conversationID,
+		Role:           "summary",
+		Content:        content,
+		SummaryOf:      summaryOf,
+	}
+	if err := s.insertMessage(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// insertMessage stores a message and updates the conversation stats
+func (s *Store) insertMessage(msg *types.ConversationMessage) error {
+	msg.ID = uuid.New().String()
+	msg.CreatedAt = time.Now()
+
+	toolCalls, err := encodeToolCalls(msg.ToolCalls)
+	if err != nil {
+		return err
+	}
 
 	tx, err := s.db.Begin()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer tx.Rollback()
 
 	_, err = tx.Exec(`
-		INSERT INTO messages (id, conversation_id, role, content, created_at, tokens)
-		VALUES (?, ?, ?, ?, ?, ?)
+		INSERT INTO messages (id, conversation_id, role, content, created_at, tokens, tool_calls, tool_call_id, tool_name, tool_error, prompt_tokens, completion_tokens, summary_of)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`,
 		msg.ID,
 		msg.ConversationID,
@@ -244,9 +411,16 @@ func (s *Store) AddMessage(conversationID, role, content string, tokens int) (*t
 		msg.Content,
 		msg.CreatedAt,
 		msg.Tokens,
+		toolCalls,
+		msg.ToolCallID,
+		msg.ToolName,
+		msg.ToolError,
+		msg.PromptTokens,
+		msg.CompletionTokens,
+		msg.SummaryOf,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to insert message: %w", err)
+		return fmt.Errorf("failed to insert message: %w", err)
 	}
 
 	// Update conversation stats
@@ -256,22 +430,32 @@ func (s *Store) AddMessage(conversationID, role, content string, tokens int) (*t
 		    total_tokens = total_tokens + ?,
 		    message_count = message_count + 1
 		WHERE id = ?
-	`, time.Now(), tokens, conversationID)
+	`, time.Now(), msg.Tokens, msg.ConversationID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to update conversation: %w", err)
+		return fmt.Errorf("failed to update conversation: %w", err)
 	}
 
-	if err := tx.Commit(); err != nil {
-		return nil, err
-	}
+	return tx.Commit()
+}
 
-	return msg, nil
+// encodeToolCalls serializes tool calls for storage, returning "" when there are none
+func encodeToolCalls(calls []types.MCPToolCall) (string, error) {
+	if len(calls) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(calls)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode tool calls: %w", err)
+	}
+	return string(data), nil
 }
 
 // GetMessages retrieves all messages for a conversation
 func (s *Store) GetMessages(conversationID string) ([]*types.ConversationMessage, error) {
 	rows, err := s.db.Query(`
-		SELECT id, conversation_id, role, content, created_at, tokens
+		SELECT id, conversation_id, role, content, created_at, tokens,
+		       COALESCE(tool_calls, ''), COALESCE(tool_call_id, ''), COALESCE(tool_name, ''), COALESCE(tool_error, 0),
+		       COALESCE(prompt_tokens, 0), COALESCE(completion_tokens, 0), COALESCE(summary_of, 0)
 		FROM messages
 		WHERE conversation_id = ?
 		ORDER BY created_at ASC
@@ -284,6 +468,7 @@ func (s *Store) GetMessages(conversationID string) ([]*types.ConversationMessage
 	var messages []*types.ConversationMessage
 	for rows.Next() {
 		msg := &types.ConversationMessage{}
+		var toolCalls string
 		if err := rows.Scan(
 			&msg.ID,
 			&msg.ConversationID,
@@ -291,9 +476,21 @@ func (s *Store) GetMessages(conversationID string) ([]*types.ConversationMessage
 			&msg.Content,
 			&msg.CreatedAt,
 			&msg.Tokens,
+			&toolCalls,
+			&msg.ToolCallID,
+			&msg.ToolName,
+			&msg.ToolError,
+			&msg.PromptTokens,
+			&msg.CompletionTokens,
+			&msg.SummaryOf,
 		); err != nil {
 			return nil, err
 		}
+		if toolCalls != "" {
+			if err := json.Unmarshal([]byte(toolCalls), &msg.ToolCalls); err != nil {
+				return nil, fmt.Errorf("failed to decode tool calls: %w", err)
+			}
+		}
 		messages = append(messages, msg)
 	}
 
@@ -412,9 +609,13 @@ func (s *Store) ImportConversation(data []byte) (*types.Conversation, error) {
 	// Insert messages
 	for _, msg := range export.Messages {
 		newMsgID := uuid.New().String()
+		toolCalls, err := encodeToolCalls(msg.ToolCalls)
+		if err != nil {
+			return nil, err
+		}
 		_, err = tx.Exec(`
-			INSERT INTO messages (id, conversation_id, role, content, created_at, tokens)
-			VALUES (?, ?, ?, ?, ?, ?)
+			INSERT INTO messages (id, conversation_id, role, content, created_at, tokens, tool_calls, tool_call_id, tool_name, tool_error, prompt_tokens, completion_tokens, summary_of)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		`,
 			newMsgID,
 			newConvID,
@@ -422,6 +623,13 @@ func (s *Store) ImportConversation(data []byte) (*types.Conversation, error) {
 			msg.Content,
 			msg.CreatedAt,
 			msg.Tokens,
+			toolCalls,
+			msg.ToolCallID,
+			msg.ToolName,
+			msg.ToolError,
+			msg.PromptTokens,
+			msg.CompletionTokens,
+			msg.SummaryOf,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to import message: %w", err)
@@ -1,11 +1,14 @@
 package conversation
 
 import (
+	"database/sql"
 	"encoding/json"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/sonemaro/sosomi/internal/types"
 )
 
 func TestNewStore(t *testing.T) {
@@ -414,6 +417,180 @@ func TestExportImportConversation(t *testing.T) {
 	}
 }
 
+func TestToolMessages(t *testing.T) {
+	store := setupTestStore(t)
+	defer store.Close()
+
+	conv, _ := store.CreateConversation("Tools", "", "openai", "gpt-4o")
+	store.AddMessage(conv.ID, "user", "What is in /tmp?", 5)
+
+	calls := []types.MCPToolCall{
+		{ID: "call_1", Name: "list_directory", Arguments: map[string]interface{}{"path": "/tmp"}},
+	}
+	if _, err := store.AddToolCallMessage(conv.ID, "", calls, 12); err != nil {
+		t.Fatalf("failed to add tool call message: %v", err)
+	}
+	if _, err := store.AddToolResultMessage(conv.ID, "call_1", "list_directory", "a.txt\n", false); err != nil {
+		t.Fatalf("failed to add tool result message: %v", err)
+	}
+
+	messages, err := store.GetMessages(conv.ID)
+	if err != nil {
+		t.Fatalf("failed to get messages: %v", err)
+	}
+	if len(messages) != 3 {
+		t.Fatalf("got %d messages, want 3", len(messages))
+	}
+
+	call := messages[1]
+	if call.Role != "assistant" || len(call.ToolCalls) != 1 {
+		t.Fatalf("got role %q with %d tool calls, want assistant with 1", call.Role, len(call.ToolCalls))
+	}
+	if call.ToolCalls[0].ID != "call_1" || call.ToolCalls[0].Name != "list_directory" {
+		t.Errorf("got tool call %+v", call.ToolCalls[0])
+	}
+	if call.ToolCalls[0].Arguments["path"] != "/tmp" {
+		t.Errorf("got arguments %v, want path /tmp", call.ToolCalls[0].Arguments)
+	}
+
+	result := messages[2]
+	if result.Role != "tool" || result.ToolCallID != "call_1" || result.ToolName != "list_directory" {
+		t.Errorf("got tool result %+v", result)
+	}
+
+	// Tool messages survive export and import
+	export, _ := store.ExportConversation(conv.ID)
+	data, _ := json.Marshal(export)
+	imported, err := store.ImportConversation(data)
+	if err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	messages, _ = store.GetMessages(imported.ID)
+	if len(messages) != 3 || len(messages[1].ToolCalls) != 1 || messages[2].ToolCallID != "call_1" {
+		t.Error("tool calls were not preserved by export and import")
+	}
+}
+
+func TestAddReply(t *testing.T) {
+	store := setupTestStore(t)
+	defer store.Close()
+
+	conv, _ := store.CreateConversation("Usage", "", "openai", "gpt-4o")
+	store.AddMessage(conv.ID, "user", "hello", 40)
+	usage := types.TokenUsage{PromptTokens: 52, CompletionTokens: 8, TotalTokens: 60}
+	if _, err := store.AddReply(conv.ID, "hi there", nil, usage); err != nil {
+		t.Fatalf("failed to add reply: %v", err)
+	}
+
+	messages, _ := store.GetMessages(conv.ID)
+	reply := messages[1]
+	if reply.Role != "assistant" || reply.Tokens != 8 || reply.PromptTokens != 52 || reply.CompletionTokens != 8 {
+		t.Errorf("got reply %+v, want the billed usage", reply)
+	}
+	updated, _ := store.GetConversation(conv.ID)
+	if updated.TotalTokens != 48 {
+		t.Errorf("got %d total tokens, want the message shares 40+8", updated.TotalTokens)
+	}
+
+	// Billed usage survives export and import
+	export, _ := store.ExportConversation(conv.ID)
+	data, _ := json.Marshal(export)
+	imported, _ := store.ImportConversation(data)
+	messages, _ = store.GetMessages(imported.ID)
+	if len(messages) != 2 || messages[1].PromptTokens != 52 {
+		t.Error("billed usage was not preserved by export and import")
+	}
+}
+
+func TestAddSummary(t *testing.T) {
+	store := setupTestStore(t)
+	defer store.Close()
+
+	conv, _ := store.CreateConversation("Long", "Be brief", "openai", "gpt-4o")
+	store.AddMessage(conv.ID, "user", "hello", 10)
+	store.AddMessage(conv.ID, "assistant", "hi", 2)
+	store.AddMessage(conv.ID, "user", "list files", 10)
+	if _, err := store.AddSummary(conv.ID, "They greeted each other.", 3); err != nil {
+		t.Fatalf("failed to add summary: %v", err)
+	}
+
+	messages, _ := store.GetMessages(conv.ID)
+	if len(messages) != 5 {
+		t.Fatalf("got %d messages, want the full transcript and the summary", len(messages))
+	}
+	summary := messages[4]
+	if summary.Role != "summary" || summary.SummaryOf != 3 || summary.Content != "They greeted each other." {
+		t.Errorf("got summary %+v", summary)
+	}
+
+	export, _ := store.ExportConversation(conv.ID)
+	data, _ := json.Marshal(export)
+	imported, _ := store.ImportConversation(data)
+	messages, _ = store.GetMessages(imported.ID)
+	if len(messages) != 5 || messages[4].SummaryOf != 3 {
+		t.Error("summary was not preserved by export and import")
+	}
+}
+
+func TestMigrateToolColumns(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "old.db")
+
+	// Create a database with the schema used before tool messages existed
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE conversations (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			system_prompt TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			provider TEXT,
+			model TEXT,
+			total_tokens INTEGER DEFAULT 0,
+			message_count INTEGER DEFAULT 0
+		);
+		CREATE TABLE messages (
+			id TEXT PRIMARY KEY,
+			conversation_id TEXT NOT NULL,
+			role TEXT NOT NULL,
+			content TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			tokens INTEGER DEFAULT 0
+		);
+		INSERT INTO conversations (id, name) VALUES ('old', 'Old');
+		INSERT INTO messages (id, conversation_id, role, content) VALUES ('m1', 'old', 'user', 'hi');
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("failed to create old schema: %v", err)
+	}
+
+	store, err := NewStore(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open old database: %v", err)
+	}
+	defer store.Close()
+
+	messages, err := store.GetMessages("old")
+	if err != nil {
+		t.Fatalf("failed to read old messages: %v", err)
+	}
+	if len(messages) != 1 || messages[0].Content != "hi" {
+		t.Errorf("got %+v, want the existing message", messages)
+	}
+
+	if _, err := store.AddToolResultMessage("old", "call_1", "read_file", "data", true); err != nil {
+		t.Errorf("failed to add tool message after migration: %v", err)
+	}
+	messages, _ = store.GetMessages("old")
+	if len(messages) != 2 || !messages[1].ToolError || messages[0].ToolError {
+		t.Errorf("got %+v, want the failed tool result flagged", messages)
+	}
+}
+
 func TestSearchConversations(t *testing.T) {
 	store := setupTestStore(t)
 	defer store.Close()
@@ -3,6 +3,7 @@ package history
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -61,7 +62,8 @@ func (s *Store) initialize() error {
 		command TEXT,
 		working_dir TEXT,
 		files_json TEXT,
-		total_size INTEGER
+		total_size INTEGER,
+		git_json TEXT
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_commands_timestamp ON commands(timestamp);
@@ -75,7 +77,10 @@ func (s *Store) initialize() error {
 	}
 
 	// Run migration to add token columns if they don't exist
-	return s.migrateTokenColumns()
+	if err := s.migrateTokenColumns(); err != nil {
+		return err
+	}
+	return s.migrateBackupColumns()
 }
 
 // migrateTokenColumns adds token columns to existing databases
@@ -99,6 +104,17 @@ func (s *Store) migrateTokenColumns() error {
 	return nil
 }
 
+// migrateBackupColumns adds the git safety ref column to existing databases
+func (s *Store) migrateBackupColumns() error {
+	rows, err := s.db.Query("SELECT git_json FROM backups LIMIT 1")
+	if err == nil {
+		rows.Close()
+		return nil
+	}
+	_, err = s.db.Exec("ALTER TABLE backups ADD COLUMN git_json TEXT")
+	return err
+}
+
 // AddCommand adds a command to history
 func (s *Store) AddCommand(entry *types.HistoryEntry) error {
 	if entry.ID == "" {
@@ -317,9 +333,111 @@ func (s *Store) GetStats() (map[string]interface{}, error) {
 	return stats, nil
 }
 
+// AddBackup records a pre-execution file snapshot for a command
+func (s *Store) AddBackup(backup *types.Backup) error {
+	if backup.ID == "" {
+		backup.ID = uuid.New().String()
+	}
+	if backup.CreatedAt.IsZero() {
+		backup.CreatedAt = time.Now()
+	}
+
+	filesJSON, err := json.Marshal(backup.Files)
+	if err != nil {
+		return fmt.Errorf("failed to encode backup files: %w", err)
+	}
+	var gitJSON sql.NullString
+	if backup.Git != nil {
+		data, err := json.Marshal(backup.Git)
+		if err != nil {
+			return fmt.Errorf("failed to encode git safety ref: %w", err)
+		}
+		gitJSON = sql.NullString{String: string(data), Valid: true}
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO backups (id, command_id, created_at, command, working_dir, files_json, total_size, git_json)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		backup.ID,
+		backup.CommandID,
+		backup.CreatedAt,
+		backup.Command,
+		backup.WorkingDir,
+		string(filesJSON),
+		backup.TotalSize,
+		gitJSON,
+	)
+	return err
+}
+
+// GetBackupByCommand retrieves the backup for a command (supports partial ID match)
+func (s *Store) GetBackupByCommand(commandID string) (*types.Backup, error) {
+	row := s.db.QueryRow(`
+		SELECT id, command_id, created_at, restored_at, command, working_dir, files_json, total_size, git_json
+		FROM backups WHERE command_id = ? OR command_id LIKE ?
+		ORDER BY created_at DESC LIMIT 1
+	`, commandID, commandID+"%")
+
+	backup, err := scanBackup(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no backup found for command: %s", commandID)
+	}
+	return backup, err
+}
+
+// GetLatestBackup retrieves the most recent backup that has not been restored
+func (s *Store) GetLatestBackup() (*types.Backup, error) {
+	row := s.db.QueryRow(`
+		SELECT id, command_id, created_at, restored_at, command, working_dir, files_json, total_size, git_json
+		FROM backups WHERE restored_at IS NULL
+		ORDER BY created_at DESC LIMIT 1
+	`)
+
+	backup, err := scanBackup(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no backups available to restore")
+	}
+	return backup, err
+}
+
+// ListBackups lists the most recent backups
+func (s *Store) ListBackups(limit int) ([]*types.Backup, error) {
+	rows, err := s.db.Query(`
+		SELECT id, command_id, created_at, restored_at, command, working_dir, files_json, total_size, git_json
+		FROM backups
+		ORDER BY created_at DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var backups []*types.Backup
+	for rows.Next() {
+		backup, err := scanBackup(rows)
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, backup)
+	}
+
+	return backups, nil
+}
+
+// MarkBackupRestored records when a backup was restored
+func (s *Store) MarkBackupRestored(id string) error {
+	_, err := s.db.Exec("UPDATE backups SET restored_at = ? WHERE id = ?", time.Now(), id)
+	return err
+}
+
 // Cleanup removes old entries
 func (s *Store) Cleanup(retentionDays int) error {
 	cutoff := time.Now().AddDate(0, 0, -retentionDays)
+	if _, err := s.db.Exec("DELETE FROM backups WHERE created_at < ?", cutoff); err != nil {
+		return err
+	}
 	_, err := s.db.Exec("DELETE FROM commands WHERE timestamp < ?", cutoff)
 	return err
 }
@@ -329,6 +447,55 @@ func (s *Store) Close() error {
 	return s.db.Close()
 }
 
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanBackup reads a backup row and decodes its file list and git safety ref
+func scanBackup(row rowScanner) (*types.Backup, error) {
+	backup := &types.Backup{}
+	var restoredAt sql.NullTime
+	var command, workingDir, filesJSON, gitJSON sql.NullString
+	var totalSize sql.NullInt64
+
+	if err := row.Scan(
+		&backup.ID,
+		&backup.CommandID,
+		&backup.CreatedAt,
+		&restoredAt,
+		&command,
+		&workingDir,
+		&filesJSON,
+		&totalSize,
+		&gitJSON,
+	); err != nil {
+		return nil, err
+	}
+
+	if restoredAt.Valid {
+		t := restoredAt.Time
+		backup.RestoredAt = &t
+	}
+	backup.Command = command.String
+	backup.WorkingDir = workingDir.String
+	backup.TotalSize = totalSize.Int64
+
+	if filesJSON.Valid && filesJSON.String != "" {
+		if err := json.Unmarshal([]byte(filesJSON.String), &backup.Files); err != nil {
+			return nil, fmt.Errorf("failed to decode backup files: %w", err)
+		}
+	}
+	if gitJSON.Valid && gitJSON.String != "" {
+		backup.Git = &types.GitSafetyRef{}
+		if err := json.Unmarshal([]byte(gitJSON.String), backup.Git); err != nil {
+			return nil, fmt.Errorf("failed to decode git safety ref: %w", err)
+		}
+	}
+
+	return backup, nil
+}
+
 // parseRiskLevel converts a string to RiskLevel
 func parseRiskLevel(s string) types.RiskLevel {
 	switch s {
@@ -2,6 +2,7 @@
 package history
 
 import (
+	"database/sql"
 	"os"
 	"path/filepath"
 	"testing"
@@ -354,6 +355,147 @@ func TestStore_GetStats(t *testing.T) {
 	}
 }
 
+func TestStore_Backups(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := NewStore(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	defer store.Close()
+
+	older := &types.Backup{
+		CommandID:  "aaaa1111-0000-0000-0000-000000000000",
+		CreatedAt:  time.Now().Add(-time.Hour),
+		Command:    "rm old.txt",
+		WorkingDir: "/tmp",
+		Files:      []types.BackupFile{{Path: "/tmp/old.txt", Hash: "abc", Size: 3}},
+		TotalSize:  3,
+	}
+	newer := &types.Backup{
+		CommandID:  "bbbb2222-0000-0000-0000-000000000000",
+		Command:    "rm -rf build",
+		WorkingDir: "/tmp",
+		Files: []types.BackupFile{
+			{Path: "/tmp/build", IsDir: true, Mode: 0755},
+			{Path: "/tmp/build/out", Hash: "def", Size: 10},
+		},
+		TotalSize: 10,
+		Git:       &types.GitSafetyRef{Repo: "/tmp", Ref: "refs/sosomi/20260101-120000-abcd1234", Paths: []string{"build/notes.txt"}},
+	}
+
+	for _, b := range []*types.Backup{older, newer} {
+		if err := store.AddBackup(b); err != nil {
+			t.Fatalf("AddBackup failed: %v", err)
+		}
+		if b.ID == "" {
+			t.Error("Expected ID to be generated")
+		}
+	}
+
+	// Prefix lookup
+	got, err := store.GetBackupByCommand("aaaa1111")
+	if err != nil {
+		t.Fatalf("GetBackupByCommand failed: %v", err)
+	}
+	if got.Command != "rm old.txt" || len(got.Files) != 1 || got.Files[0].Hash != "abc" {
+		t.Errorf("Unexpected backup: %+v", got)
+	}
+	if got.Git != nil {
+		t.Errorf("Expected no git safety ref, got %+v", got.Git)
+	}
+
+	// Latest unrestored backup
+	latest, err := store.GetLatestBackup()
+	if err != nil {
+		t.Fatalf("GetLatestBackup failed: %v", err)
+	}
+	if latest.ID != newer.ID {
+		t.Errorf("Expected latest backup %s, got %s", newer.ID, latest.ID)
+	}
+	if len(latest.Files) != 2 || !latest.Files[0].IsDir {
+		t.Errorf("Expected directory entry to round-trip, got %+v", latest.Files)
+	}
+	if latest.Git == nil || latest.Git.Ref != newer.Git.Ref || len(latest.Git.Paths) != 1 {
+		t.Errorf("Expected git safety ref to round-trip, got %+v", latest.Git)
+	}
+
+	if err := store.MarkBackupRestored(newer.ID); err != nil {
+		t.Fatalf("MarkBackupRestored failed: %v", err)
+	}
+
+	latest, err = store.GetLatestBackup()
+	if err != nil {
+		t.Fatalf("GetLatestBackup failed: %v", err)
+	}
+	if latest.ID != older.ID {
+		t.Errorf("Expected restored backup to be skipped, got %s", latest.ID)
+	}
+
+	backups, err := store.ListBackups(10)
+	if err != nil {
+		t.Fatalf("ListBackups failed: %v", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 backups, got %d", len(backups))
+	}
+	if backups[0].RestoredAt == nil {
+		t.Error("Expected RestoredAt to be set on restored backup")
+	}
+}
+
+func TestStore_MigrateBackupColumns(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+
+	// A backups table from before git safety refs were recorded
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE backups (
+		id TEXT PRIMARY KEY, command_id TEXT, created_at DATETIME, restored_at DATETIME,
+		command TEXT, working_dir TEXT, files_json TEXT, total_size INTEGER
+	)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO backups (id, command_id, created_at, command, files_json) VALUES ('b1', 'c1', ?, 'rm a', '[]')", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	store, err := NewStore(dbPath)
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	defer store.Close()
+
+	backup, err := store.GetBackupByCommand("c1")
+	if err != nil {
+		t.Fatalf("GetBackupByCommand failed: %v", err)
+	}
+	if backup.Git != nil {
+		t.Errorf("Expected no git safety ref on an old backup, got %+v", backup.Git)
+	}
+	if err := store.AddBackup(&types.Backup{CommandID: "c2", Git: &types.GitSafetyRef{Ref: "refs/sosomi/x"}}); err != nil {
+		t.Errorf("AddBackup failed after migration: %v", err)
+	}
+}
+
+func TestStore_GetBackupByCommand_NotFound(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := NewStore(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	defer store.Close()
+
+	if _, err := store.GetBackupByCommand("missing"); err == nil {
+		t.Error("Expected error for missing backup")
+	}
+	if _, err := store.GetLatestBackup(); err == nil {
+		t.Error("Expected error when no backups exist")
+	}
+}
+
 func TestParseRiskLevel(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -2,28 +2,40 @@
 package mcp
 
 import (
-	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"os"
 	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/sonemaro/sosomi/internal/types"
 )
 
 // Server represents an MCP server connection
 type Server struct {
-	name    string
-	cmd     *exec.Cmd
-	stdin   io.WriteCloser
-	stdout  *bufio.Reader
-	stderr  io.ReadCloser
-	tools   []types.MCPTool
-	mu      sync.Mutex
-	running bool
+	name      string
+	cmd       *exec.Cmd // the server process, nil for remote servers
+	transport Transport
+	log       *os.File // receives the server's stderr, nil when not logging
+	tools     []types.MCPTool
+	mu        sync.Mutex
+	running   bool
+
+	capabilities Capabilities                     // advertised by the server during initialize
+	pending      map[string]chan *incomingMessage // in-flight requests by ID
+	progress     map[string]func(Progress)        // progress callbacks by token
+	done         chan struct{}                    // closed when the connection ends
+	closeErr     error                            // why the connection ended
+	logf         func(format string, args ...interface{})
+
+	startedAt time.Time
 }
 
 // Message represents an MCP JSON-RPC message
@@ -42,6 +54,25 @@ type RPCError struct {
 	Message string `json:"message"`
 }
 
+// incomingMessage is a JSON-RPC message read from the other side of a
+// connection. IDs are kept raw since peers may use strings or numbers.
+type incomingMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// outgoingMessage is a JSON-RPC response to an incomingMessage request
+type outgoingMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
 // InitializeParams are sent when initializing an MCP server
 type InitializeParams struct {
 	ProtocolVersion string       `json:"protocolVersion"`
@@ -49,13 +80,28 @@ type InitializeParams struct {
 	ClientInfo      ClientInfo   `json:"clientInfo"`
 }
 
-// Capabilities describes client capabilities
+// Capabilities describes the capabilities of a client or server
 type Capabilities struct {
-	Tools *ToolsCapability `json:"tools,omitempty"`
+	Tools     *ToolsCapability     `json:"tools,omitempty"`
+	Resources *ResourcesCapability `json:"resources,omitempty"`
+	Prompts   *PromptsCapability   `json:"prompts,omitempty"`
 }
 
 // ToolsCapability describes tool-related capabilities
-type ToolsCapability struct{}
+type ToolsCapability struct {
+	ListChanged bool `json:"listChanged,omitempty"`
+}
+
+// ResourcesCapability describes resource-related capabilities
+type ResourcesCapability struct {
+	Subscribe   bool `json:"subscribe,omitempty"`
+	ListChanged bool `json:"listChanged,omitempty"`
+}
+
+// PromptsCapability describes prompt-related capabilities
+type PromptsCapability struct {
+	ListChanged bool `json:"listChanged,omitempty"`
+}
 
 // ClientInfo provides information about the client
 type ClientInfo struct {
@@ -85,8 +131,24 @@ type ToolsListResult struct {
 type ToolCallParams struct {
 	Name      string                 `json:"name"`
 	Arguments map[string]interface{} `json:"arguments"`
+	Meta      *RequestMeta           `json:"_meta,omitempty"`
 }
 
+// RequestMeta carries request metadata such as the progress token
+type RequestMeta struct {
+	ProgressToken int `json:"progressToken,omitempty"`
+}
+
+// Progress is reported by a server while a request is running
+type Progress struct {
+	Progress float64 `json:"progress"`
+	Total    float64 `json:"total,omitempty"` // 0 when unknown
+	Message  string  `json:"message,omitempty"`
+}
+
+// ProgressHandler receives progress notifications for a running tool call
+type ProgressHandler func(tool string, progress Progress)
+
 // ToolCallResult is the result of a tool call
 type ToolCallResult struct {
 	Content []ContentBlock `json:"content"`
@@ -101,70 +163,27 @@ type ContentBlock struct {
 
 // Manager manages multiple MCP servers
 type Manager struct {
-	servers map[string]*Server
-	mu      sync.RWMutex
+	servers  map[string]*Server
+	progress ProgressHandler
+	logDir   string
+	mu       sync.RWMutex
+
+	restartDelay    time.Duration
+	maxRestartDelay time.Duration
 }
 
 // NewManager creates a new MCP manager
 func NewManager() *Manager {
 	return &Manager{
-		servers: make(map[string]*Server),
+		servers:         make(map[string]*Server),
+		restartDelay:    defaultRestartDelay,
+		maxRestartDelay: defaultMaxRestartDelay,
 	}
 }
 
 // StartServer starts an MCP server
 func (m *Manager) StartServer(ctx context.Context, name string, command string, args ...string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	if _, exists := m.servers[name]; exists {
-		return fmt.Errorf("server %s already running", name)
-	}
-
-	cmd := exec.CommandContext(ctx, command, args...)
-
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return fmt.Errorf("failed to create stdin pipe: %w", err)
-	}
-
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return fmt.Errorf("failed to create stdout pipe: %w", err)
-	}
-
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return fmt.Errorf("failed to create stderr pipe: %w", err)
-	}
-
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start server: %w", err)
-	}
-
-	server := &Server{
-		name:    name,
-		cmd:     cmd,
-		stdin:   stdin,
-		stdout:  bufio.NewReader(stdout),
-		stderr:  stderr,
-		running: true,
-	}
-
-	// Initialize the server
-	if err := server.initialize(); err != nil {
-		cmd.Process.Kill()
-		return fmt.Errorf("failed to initialize server: %w", err)
-	}
-
-	// Get available tools
-	if err := server.listTools(); err != nil {
-		cmd.Process.Kill()
-		return fmt.Errorf("failed to list tools: %w", err)
-	}
-
-	m.servers[name] = server
-	return nil
+	return m.Start(ctx, ServerConfig{Name: name, Command: command, Args: args})
 }
 
 // StopServer stops an MCP server
@@ -177,177 +196,386 @@ func (m *Manager) StopServer(name string) error {
 		return fmt.Errorf("server %s not found", name)
 	}
 
-	server.stdin.Close()
-	server.cmd.Process.Kill()
-	server.running = false
 	delete(m.servers, name)
+	server.stop()
 
 	return nil
 }
 
-// GetTools returns all tools from all servers
+// GetTools returns all tools from all servers, named <server>.<tool>
 func (m *Manager) GetTools() []types.MCPTool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	names := make([]string, 0, len(m.servers))
+	for name := range m.servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
 	var tools []types.MCPTool
-	for _, server := range m.servers {
-		tools = append(tools, server.tools...)
+	for _, name := range names {
+		tools = append(tools, m.servers[name].namespacedTools()...)
 	}
 	return tools
 }
 
-// CallTool calls a tool on the appropriate server
+// AvailableTools returns the built-in tools followed by the tools of all running servers
+func (m *Manager) AvailableTools() []types.MCPTool {
+	return append(BuiltinTools(), m.GetTools()...)
+}
+
+// CallTool calls a server tool by its namespaced name (<server>.<tool>).
+// Cancelling ctx cancels the call on the server.
 func (m *Manager) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (*types.MCPToolResult, error) {
+	serverName, toolName, ok := strings.Cut(name, ".")
+	if !ok {
+		return nil, fmt.Errorf("tool %s not found", name)
+	}
+
 	m.mu.RLock()
-	defer m.mu.RUnlock()
+	server, exists := m.servers[serverName]
+	handler := m.progress
+	m.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("tool %s not found: server %s is not running", name, serverName)
+	}
 
-	for _, server := range m.servers {
-		for _, tool := range server.tools {
-			if tool.Name == name {
-				return server.callTool(name, arguments)
-			}
+	if !server.isRunning() {
+		return nil, fmt.Errorf("server %s is not running (restarting)", serverName)
+	}
+
+	var onProgress func(Progress)
+	if handler != nil {
+		onProgress = func(p Progress) { handler(name, p) }
+	}
+
+	for _, tool := range server.toolList() {
+		if tool.Name == toolName {
+			return server.callTool(ctx, toolName, arguments, onProgress)
 		}
 	}
 
 	return nil, fmt.Errorf("tool %s not found", name)
 }
 
+// SetProgressHandler sets the callback receiving progress notifications of server tool calls
+func (m *Manager) SetProgressHandler(handler ProgressHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.progress = handler
+}
+
 // Shutdown stops all servers
 func (m *Manager) Shutdown() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	for name, server := range m.servers {
-		server.stdin.Close()
-		server.cmd.Process.Kill()
 		delete(m.servers, name)
+		server.stop()
 	}
 }
 
-var messageID = 0
+var messageID atomic.Int64
 
 func nextID() int {
-	messageID++
-	return messageID
+	return int(messageID.Add(1))
 }
 
-func (s *Server) send(msg *Message) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// cancelledParams are the params of notifications/cancelled
+type cancelledParams struct {
+	RequestID json.RawMessage `json:"requestId"`
+	Reason    string          `json:"reason,omitempty"`
+}
 
+// progressParams are the params of notifications/progress
+type progressParams struct {
+	ProgressToken json.RawMessage `json:"progressToken"`
+	Progress
+}
+
+// logMessageParams are the params of notifications/message
+type logMessageParams struct {
+	Level  string          `json:"level"`
+	Logger string          `json:"logger,omitempty"`
+	Data   json.RawMessage `json:"data"`
+}
+
+func (s *Server) send(msg interface{}) error {
 	data, err := json.Marshal(msg)
 	if err != nil {
 		return err
 	}
+	return s.transport.Send(data)
+}
 
-	_, err = fmt.Fprintf(s.stdin, "%s\n", data)
-	return err
+// notify sends a notification, which gets no response
+func (s *Server) notify(method string, params interface{}) error {
+	return s.send(&Message{JSONRPC: "2.0", Method: method, Params: params})
 }
 
-func (s *Server) receive() (*Message, error) {
-	line, err := s.stdout.ReadString('\n')
-	if err != nil {
-		return nil, err
+// readLoop reads messages until the connection ends, routing responses to
+// their pending requests and handling notifications and server requests
+func (s *Server) readLoop() {
+	for {
+		line, err := s.transport.Receive()
+		if len(bytes.TrimSpace(line)) > 0 {
+			var msg incomingMessage
+			if jsonErr := json.Unmarshal(line, &msg); jsonErr != nil {
+				s.logEvent("ignoring invalid message: %v", jsonErr)
+			} else {
+				s.dispatch(&msg)
+			}
+		}
+		if err != nil {
+			s.closeConnection(fmt.Errorf("server %s closed the connection: %w", s.name, err))
+			return
+		}
 	}
+}
 
-	var msg Message
-	if err := json.Unmarshal([]byte(line), &msg); err != nil {
-		return nil, err
+// dispatch routes a single message read from the server
+func (s *Server) dispatch(msg *incomingMessage) {
+	switch {
+	case msg.Method == "" && len(msg.ID) > 0:
+		s.mu.Lock()
+		ch, ok := s.pending[string(msg.ID)]
+		delete(s.pending, string(msg.ID))
+		s.mu.Unlock()
+		if ok {
+			ch <- msg
+		}
+	case msg.Method != "" && len(msg.ID) > 0:
+		// Answered in the background so a blocked write never stalls reading
+		go s.answer(msg)
+	default:
+		s.handleNotification(msg)
 	}
+}
 
-	return &msg, nil
+// answer responds to a request sent by the server. Only ping is supported.
+func (s *Server) answer(msg *incomingMessage) {
+	resp := outgoingMessage{JSONRPC: "2.0", ID: msg.ID}
+	if msg.Method == "ping" {
+		resp.Result = struct{}{}
+	} else {
+		resp.Error = &RPCError{Code: codeMethodNotFound, Message: fmt.Sprintf("method not found: %s", msg.Method)}
+	}
+	s.send(resp)
 }
 
-func (s *Server) initialize() error {
-	msg := &Message{
-		JSONRPC: "2.0",
-		ID:      nextID(),
-		Method:  "initialize",
-		Params: InitializeParams{
-			ProtocolVersion: "2024-11-05",
-			Capabilities: Capabilities{
-				Tools: &ToolsCapability{},
-			},
-			ClientInfo: ClientInfo{
-				Name:    "sosomi",
-				Version: "1.0.0",
-			},
-		},
+// handleNotification handles a notification sent by the server
+func (s *Server) handleNotification(msg *incomingMessage) {
+	switch msg.Method {
+	case "notifications/tools/list_changed":
+		go s.refreshTools()
+
+	case "notifications/progress":
+		var params progressParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return
+		}
+		s.mu.Lock()
+		onProgress := s.progress[string(params.ProgressToken)]
+		s.mu.Unlock()
+		if onProgress != nil {
+			onProgress(params.Progress)
+		}
+
+	case "notifications/message":
+		var params logMessageParams
+		if err := json.Unmarshal(msg.Params, &params); err == nil {
+			s.logEvent("%s: %s", params.Level, params.Data)
+		}
 	}
+}
 
-	if err := s.send(msg); err != nil {
-		return err
+// closeConnection fails all pending requests once the connection has ended
+func (s *Server) closeConnection(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closeErr == nil {
+		s.closeErr = err
+		close(s.done)
 	}
+}
 
-	resp, err := s.receive()
+// forget drops a pending request that will no longer be waited for
+func (s *Server) forget(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, key)
+}
+
+// request sends a request and waits for its response. When ctx ends first,
+// the server is told to stop working on it with notifications/cancelled.
+func (s *Server) request(ctx context.Context, method string, params interface{}) (*incomingMessage, error) {
+	id := nextID()
+	key := strconv.Itoa(id)
+	ch := make(chan *incomingMessage, 1)
+
+	s.mu.Lock()
+	if s.closeErr != nil {
+		err := s.closeErr
+		s.mu.Unlock()
+		return nil, err
+	}
+	s.pending[key] = ch
+	s.mu.Unlock()
+
+	if err := s.send(&Message{JSONRPC: "2.0", ID: id, Method: method, Params: params}); err != nil {
+		s.forget(key)
+		return nil, fmt.Errorf("server %s is not accepting requests: %w", s.name, err)
+	}
+
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-s.done:
+		s.forget(key)
+		select {
+		case resp := <-ch:
+			return resp, nil
+		default:
+		}
+		return nil, s.closeErr
+	case <-ctx.Done():
+		s.forget(key)
+		s.notify("notifications/cancelled", cancelledParams{RequestID: json.RawMessage(key), Reason: ctx.Err().Error()})
+		return nil, fmt.Errorf("%s on server %s: %w", method, s.name, ctx.Err())
+	}
+}
+
+// call sends a request and decodes its result into result (which may be nil)
+func (s *Server) call(ctx context.Context, method string, params, result interface{}) error {
+	resp, err := s.request(ctx, method, params)
 	if err != nil {
 		return err
 	}
-
 	if resp.Error != nil {
-		return fmt.Errorf("initialization failed: %s", resp.Error.Message)
+		return fmt.Errorf("%s failed: %s", method, resp.Error.Message)
 	}
+	if result == nil || len(resp.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, result)
+}
 
-	// Send initialized notification
-	notif := &Message{
-		JSONRPC: "2.0",
-		Method:  "notifications/initialized",
+// listAll fetches every page of a paginated list method whose items are in field
+func listAll[T any](ctx context.Context, s *Server, method, field string) ([]T, error) {
+	var items []T
+	var params interface{}
+	for {
+		var page map[string]json.RawMessage
+		if err := s.call(ctx, method, params, &page); err != nil {
+			return nil, err
+		}
+
+		var batch []T
+		if raw, ok := page[field]; ok {
+			if err := json.Unmarshal(raw, &batch); err != nil {
+				return nil, fmt.Errorf("invalid %s result: %w", method, err)
+			}
+		}
+		items = append(items, batch...)
+
+		var cursor string
+		if raw, ok := page["nextCursor"]; ok {
+			json.Unmarshal(raw, &cursor)
+		}
+		if cursor == "" {
+			return items, nil
+		}
+		params = map[string]string{"cursor": cursor}
 	}
-	return s.send(notif)
 }
 
-func (s *Server) listTools() error {
-	msg := &Message{
-		JSONRPC: "2.0",
-		ID:      nextID(),
-		Method:  "tools/list",
+// logEvent records an event in the server's log, if logging is set up
+func (s *Server) logEvent(format string, args ...interface{}) {
+	if s.logf != nil {
+		s.logf(format, args...)
 	}
+}
 
-	if err := s.send(msg); err != nil {
-		return err
+func (s *Server) initialize(ctx context.Context) error {
+	params := InitializeParams{
+		ProtocolVersion: "2024-11-05",
+		Capabilities: Capabilities{
+			Tools: &ToolsCapability{},
+		},
+		ClientInfo: ClientInfo{
+			Name:    "sosomi",
+			Version: "1.0.0",
+		},
 	}
 
-	resp, err := s.receive()
-	if err != nil {
+	var result InitializeResult
+	if err := s.call(ctx, "initialize", params, &result); err != nil {
 		return err
 	}
 
-	if resp.Error != nil {
-		return fmt.Errorf("failed to list tools: %s", resp.Error.Message)
-	}
+	s.mu.Lock()
+	s.capabilities = result.Capabilities
+	s.mu.Unlock()
 
-	// Parse tools from result
-	resultBytes, err := json.Marshal(resp.Result)
+	// Send initialized notification
+	return s.notify("notifications/initialized", nil)
+}
+
+func (s *Server) listTools(ctx context.Context) error {
+	tools, err := listAll[types.MCPTool](ctx, s, "tools/list", "tools")
 	if err != nil {
 		return err
 	}
 
-	var result ToolsListResult
-	if err := json.Unmarshal(resultBytes, &result); err != nil {
-		return err
+	s.mu.Lock()
+	s.tools = tools
+	s.mu.Unlock()
+	return nil
+}
+
+// refreshTools reloads the tool list after the server reports that it changed
+func (s *Server) refreshTools() {
+	ctx, cancel := context.WithTimeout(context.Background(), startTimeout)
+	defer cancel()
+
+	if err := s.listTools(ctx); err != nil {
+		s.logEvent("failed to refresh tools: %v", err)
+		return
 	}
+	s.logEvent("tool list changed, now %d tools", len(s.toolList()))
+}
 
-	s.tools = result.Tools
-	return nil
+// toolList returns the server's tools
+func (s *Server) toolList() []types.MCPTool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tools
 }
 
-func (s *Server) callTool(name string, arguments map[string]interface{}) (*types.MCPToolResult, error) {
-	msg := &Message{
-		JSONRPC: "2.0",
-		ID:      nextID(),
-		Method:  "tools/call",
-		Params: ToolCallParams{
-			Name:      name,
-			Arguments: arguments,
-		},
+// callTool calls a tool, reporting progress notifications to onProgress when set
+func (s *Server) callTool(ctx context.Context, name string, arguments map[string]interface{}, onProgress func(Progress)) (*types.MCPToolResult, error) {
+	params := ToolCallParams{
+		Name:      name,
+		Arguments: arguments,
 	}
+	if onProgress != nil {
+		token := nextID()
+		key := strconv.Itoa(token)
+		params.Meta = &RequestMeta{ProgressToken: token}
 
-	if err := s.send(msg); err != nil {
-		return nil, err
+		s.mu.Lock()
+		s.progress[key] = onProgress
+		s.mu.Unlock()
+		defer func() {
+			s.mu.Lock()
+			delete(s.progress, key)
+			s.mu.Unlock()
+		}()
 	}
 
-	resp, err := s.receive()
+	resp, err := s.request(ctx, "tools/call", params)
 	if err != nil {
 		return nil, err
 	}
@@ -359,14 +587,8 @@ func (s *Server) callTool(name string, arguments map[string]interface{}) (*types
 		}, nil
 	}
 
-	// Parse result
-	resultBytes, err := json.Marshal(resp.Result)
-	if err != nil {
-		return nil, err
-	}
-
 	var result ToolCallResult
-	if err := json.Unmarshal(resultBytes, &result); err != nil {
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
 		return nil, err
 	}
 
@@ -454,7 +676,18 @@ func BuiltinTools() []types.MCPTool {
 	}
 }
 
-// ExecuteBuiltinTool executes a built-in tool
+// IsBuiltinTool reports whether name is one of sosomi's built-in tools
+func IsBuiltinTool(name string) bool {
+	for _, tool := range BuiltinTools() {
+		if tool.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ExecuteBuiltinTool executes a built-in tool without any safety checks;
+// callers analyze and confirm execute_command and write_file calls first
 func ExecuteBuiltinTool(name string, arguments map[string]interface{}) (*types.MCPToolResult, error) {
 	switch name {
 	case "execute_command":
@@ -392,3 +392,18 @@ func TestExecuteBuiltinTool_InvalidParams(t *testing.T) {
 		t.Error("Expected error for missing parameters")
 	}
 }
+
+func TestManager_AvailableTools(t *testing.T) {
+	manager := NewManager()
+
+	tools := manager.AvailableTools()
+	if len(tools) != len(BuiltinTools()) {
+		t.Errorf("Expected %d built-in tools without servers, got %d", len(BuiltinTools()), len(tools))
+	}
+}
+
+func TestIsBuiltinTool(t *testing.T) {
+	if !IsBuiltinTool("read_file") || IsBuiltinTool("github.search") {
+		t.Error("IsBuiltinTool misclassified a tool")
+	}
+}
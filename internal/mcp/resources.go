@@ -0,0 +1,168 @@
+// Package mcp provides Model Context Protocol support
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// ResourceReadParams are the parameters for reading a resource
+type ResourceReadParams struct {
+	URI string `json:"uri"`
+}
+
+// ResourceReadResult is the result of reading a resource
+type ResourceReadResult struct {
+	Contents []types.MCPResourceContent `json:"contents"`
+}
+
+// PromptGetParams are the parameters for getting a prompt
+type PromptGetParams struct {
+	Name      string            `json:"name"`
+	Arguments map[string]string `json:"arguments,omitempty"`
+}
+
+// PromptGetResult is the result of getting a prompt
+type PromptGetResult struct {
+	Description string          `json:"description,omitempty"`
+	Messages    []PromptMessage `json:"messages"`
+}
+
+// PromptMessage is a message in a prompt result
+type PromptMessage struct {
+	Role    string       `json:"role"`
+	Content ContentBlock `json:"content"`
+}
+
+// ListResources returns the resources of a server, or of every running
+// server offering resources when server is ""
+func (m *Manager) ListResources(ctx context.Context, server string) ([]types.MCPResource, error) {
+	servers, err := m.serversOffering(server, "resources")
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []types.MCPResource
+	for _, s := range servers {
+		list, err := listAll[types.MCPResource](ctx, s, "resources/list", "resources")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.name, err)
+		}
+		for i := range list {
+			list[i].Server = s.name
+		}
+		resources = append(resources, list...)
+	}
+	return resources, nil
+}
+
+// ReadResource reads a resource from a server
+func (m *Manager) ReadResource(ctx context.Context, server, uri string) ([]types.MCPResourceContent, error) {
+	servers, err := m.serversOffering(server, "resources")
+	if err != nil {
+		return nil, err
+	}
+
+	var result ResourceReadResult
+	if err := servers[0].call(ctx, "resources/read", ResourceReadParams{URI: uri}, &result); err != nil {
+		return nil, err
+	}
+	return result.Contents, nil
+}
+
+// ListPrompts returns the prompts of a server, or of every running server
+// offering prompts when server is "". Prompts are named <server>.<prompt>.
+func (m *Manager) ListPrompts(ctx context.Context, server string) ([]types.MCPPrompt, error) {
+	servers, err := m.serversOffering(server, "prompts")
+	if err != nil {
+		return nil, err
+	}
+
+	var prompts []types.MCPPrompt
+	for _, s := range servers {
+		list, err := listAll[types.MCPPrompt](ctx, s, "prompts/list", "prompts")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.name, err)
+		}
+		for i := range list {
+			list[i].Name = s.name + "." + list[i].Name
+		}
+		prompts = append(prompts, list...)
+	}
+	return prompts, nil
+}
+
+// GetPrompt renders a prompt by its namespaced name (<server>.<prompt>)
+func (m *Manager) GetPrompt(ctx context.Context, name string, arguments map[string]string) ([]types.MCPPromptMessage, error) {
+	serverName, promptName, ok := strings.Cut(name, ".")
+	if !ok {
+		return nil, fmt.Errorf("prompt must be named <server>.<prompt>, got %s", name)
+	}
+	servers, err := m.serversOffering(serverName, "prompts")
+	if err != nil {
+		return nil, err
+	}
+
+	var result PromptGetResult
+	params := PromptGetParams{Name: promptName, Arguments: arguments}
+	if err := servers[0].call(ctx, "prompts/get", params, &result); err != nil {
+		return nil, err
+	}
+
+	messages := make([]types.MCPPromptMessage, len(result.Messages))
+	for i, msg := range result.Messages {
+		messages[i] = types.MCPPromptMessage{Role: msg.Role, Content: msg.Content.Text}
+	}
+	return messages, nil
+}
+
+// serversOffering returns the named running server, failing when it does not
+// offer feature ("resources" or "prompts"). With an empty name it returns every
+// running server that offers the feature, sorted by name.
+func (m *Manager) serversOffering(name, feature string) ([]*Server, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if name != "" {
+		server, exists := m.servers[name]
+		if !exists || !server.isRunning() {
+			return nil, fmt.Errorf("server %s is not running", name)
+		}
+		if !server.offers(feature) {
+			return nil, fmt.Errorf("server %s does not offer %s", name, feature)
+		}
+		return []*Server{server}, nil
+	}
+
+	names := make([]string, 0, len(m.servers))
+	for name := range m.servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var servers []*Server
+	for _, name := range names {
+		if server := m.servers[name]; server.isRunning() && server.offers(feature) {
+			servers = append(servers, server)
+		}
+	}
+	return servers, nil
+}
+
+// offers reports whether the server advertised feature during initialize
+func (s *Server) offers(feature string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch feature {
+	case "resources":
+		return s.capabilities.Resources != nil
+	case "prompts":
+		return s.capabilities.Prompts != nil
+	}
+	return false
+}
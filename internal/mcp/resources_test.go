@@ -0,0 +1,67 @@
+package mcp
+
+import (
+	"context"
+	"testing"
+)
+
+func TestManager_Resources(t *testing.T) {
+	manager := NewManager()
+	defer manager.Shutdown()
+
+	if err := manager.Start(context.Background(), testServerConfig("test")); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	resources, err := manager.ListResources(context.Background(), "")
+	if err != nil {
+		t.Fatalf("ListResources failed: %v", err)
+	}
+	if len(resources) != 2 || resources[1].URI != "file:///b.txt" {
+		t.Fatalf("Expected both pages of resources, got %+v", resources)
+	}
+	if resources[0].Server != "test" {
+		t.Errorf("Expected resources to record their server, got %q", resources[0].Server)
+	}
+
+	contents, err := manager.ReadResource(context.Background(), "test", "file:///a.txt")
+	if err != nil {
+		t.Fatalf("ReadResource failed: %v", err)
+	}
+	if len(contents) != 1 || contents[0].Text != "contents of file:///a.txt" {
+		t.Errorf("Unexpected contents: %+v", contents)
+	}
+
+	if _, err := manager.ReadResource(context.Background(), "missing", "file:///a.txt"); err == nil {
+		t.Error("Expected error for a server that is not running")
+	}
+}
+
+func TestManager_Prompts(t *testing.T) {
+	manager := NewManager()
+	defer manager.Shutdown()
+
+	if err := manager.Start(context.Background(), testServerConfig("test")); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	prompts, err := manager.ListPrompts(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("ListPrompts failed: %v", err)
+	}
+	if len(prompts) != 1 || prompts[0].Name != "test.greet" || !prompts[0].Arguments[0].Required {
+		t.Fatalf("Expected namespaced prompt with arguments, got %+v", prompts)
+	}
+
+	messages, err := manager.GetPrompt(context.Background(), "test.greet", map[string]string{"who": "sosomi"})
+	if err != nil {
+		t.Fatalf("GetPrompt failed: %v", err)
+	}
+	if len(messages) != 1 || messages[0].Role != "user" || messages[0].Content != "Hello sosomi" {
+		t.Errorf("Unexpected prompt messages: %+v", messages)
+	}
+
+	if _, err := manager.GetPrompt(context.Background(), "greet", nil); err == nil {
+		t.Error("Expected error for prompt without server namespace")
+	}
+}
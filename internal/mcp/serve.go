@@ -0,0 +1,196 @@
+// Package mcp provides Model Context Protocol support
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// JSON-RPC error codes used when serving
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// supportedProtocolVersions lists the protocol versions Serve accepts from clients, newest first
+var supportedProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// ToolHandler runs a served tool. A returned error is reported to the
+// client as a tool result with isError set.
+type ToolHandler func(ctx context.Context, arguments map[string]interface{}) (*types.MCPToolResult, error)
+
+// ServedTool is a tool exposed by Serve
+type ServedTool struct {
+	Tool    types.MCPTool
+	Handler ToolHandler
+}
+
+// Serve runs an MCP server over newline-delimited JSON-RPC, reading requests
+// from r and writing responses to w. Requests are handled concurrently, and
+// notifications/cancelled cancels the context of the request it names.
+// It returns nil when r reaches EOF, after in-flight requests have finished.
+func Serve(ctx context.Context, r io.Reader, w io.Writer, info ServerInfo, tools []ServedTool) error {
+	handlers := make(map[string]ServedTool, len(tools))
+	for _, tool := range tools {
+		handlers[tool.Tool.Name] = tool
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var writeMu sync.Mutex
+	encoder := json.NewEncoder(w)
+	write := func(resp outgoingMessage) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return encoder.Encode(resp)
+	}
+
+	var mu sync.Mutex
+	inFlight := make(map[string]context.CancelFunc)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var msg incomingMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			resp := outgoingMessage{
+				JSONRPC: "2.0",
+				ID:      json.RawMessage("null"),
+				Error:   &RPCError{Code: codeParseError, Message: "parse error: " + err.Error()},
+			}
+			if err := write(resp); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Notifications (no id) never get a response
+		if len(msg.ID) == 0 {
+			if msg.Method == "notifications/cancelled" {
+				var params cancelledParams
+				if json.Unmarshal(msg.Params, &params) == nil {
+					mu.Lock()
+					if cancel, ok := inFlight[string(params.RequestID)]; ok {
+						cancel()
+					}
+					mu.Unlock()
+				}
+			}
+			continue
+		}
+
+		reqCtx, cancel := context.WithCancel(ctx)
+		key := string(msg.ID)
+		mu.Lock()
+		inFlight[key] = cancel
+		mu.Unlock()
+
+		wg.Add(1)
+		go func(msg incomingMessage) {
+			defer wg.Done()
+			result, rpcErr := handleRequest(reqCtx, &msg, info, tools, handlers)
+
+			mu.Lock()
+			delete(inFlight, key)
+			mu.Unlock()
+			cancelled := reqCtx.Err() != nil && ctx.Err() == nil
+			cancel()
+
+			// The client has given up on a cancelled request, so no response is sent
+			if cancelled {
+				return
+			}
+			resp := outgoingMessage{JSONRPC: "2.0", ID: msg.ID, Result: result, Error: rpcErr}
+			if rpcErr == nil && result == nil {
+				resp.Result = struct{}{}
+			}
+			write(resp)
+		}(msg)
+	}
+
+	return scanner.Err()
+}
+
+// handleRequest dispatches a single request to its method
+func handleRequest(ctx context.Context, msg *incomingMessage, info ServerInfo, tools []ServedTool, handlers map[string]ServedTool) (interface{}, *RPCError) {
+	if msg.Method == "" {
+		return nil, &RPCError{Code: codeInvalidRequest, Message: "missing method"}
+	}
+
+	switch msg.Method {
+	case "initialize":
+		var params InitializeParams
+		if len(msg.Params) > 0 {
+			if err := json.Unmarshal(msg.Params, &params); err != nil {
+				return nil, &RPCError{Code: codeInvalidParams, Message: err.Error()}
+			}
+		}
+		return InitializeResult{
+			ProtocolVersion: negotiateProtocolVersion(params.ProtocolVersion),
+			Capabilities:    Capabilities{Tools: &ToolsCapability{}},
+			ServerInfo:      info,
+		}, nil
+
+	case "ping":
+		return nil, nil
+
+	case "tools/list":
+		list := make([]types.MCPTool, len(tools))
+		for i, tool := range tools {
+			list[i] = tool.Tool
+		}
+		return ToolsListResult{Tools: list}, nil
+
+	case "tools/call":
+		var params ToolCallParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &RPCError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		tool, ok := handlers[params.Name]
+		if !ok {
+			return nil, &RPCError{Code: codeInvalidParams, Message: fmt.Sprintf("unknown tool: %s", params.Name)}
+		}
+		if params.Arguments == nil {
+			params.Arguments = map[string]interface{}{}
+		}
+
+		result, err := tool.Handler(ctx, params.Arguments)
+		if err != nil {
+			result = &types.MCPToolResult{Content: err.Error(), IsError: true}
+		}
+		return ToolCallResult{
+			Content: []ContentBlock{{Type: "text", Text: result.Content}},
+			IsError: result.IsError,
+		}, nil
+	}
+
+	return nil, &RPCError{Code: codeMethodNotFound, Message: fmt.Sprintf("method not found: %s", msg.Method)}
+}
+
+// negotiateProtocolVersion accepts the client's version when supported and
+// otherwise answers with the newest version Serve implements
+func negotiateProtocolVersion(requested string) string {
+	for _, version := range supportedProtocolVersions {
+		if version == requested {
+			return version
+		}
+	}
+	return supportedProtocolVersions[0]
+}
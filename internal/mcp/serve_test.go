@@ -0,0 +1,167 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// serveLines runs Serve over the given request lines and decodes every
+// response, keyed by its id ("<nil>" for null). Responses may arrive in any
+// order since requests are handled concurrently.
+func serveLines(t *testing.T, tools []ServedTool, lines ...string) map[string]map[string]interface{} {
+	t.Helper()
+
+	var out bytes.Buffer
+	in := strings.NewReader(strings.Join(lines, "\n") + "\n")
+	if err := Serve(context.Background(), in, &out, ServerInfo{Name: "test", Version: "1"}, tools); err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+
+	responses := make(map[string]map[string]interface{})
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var resp map[string]interface{}
+		if err := decoder.Decode(&resp); err != nil {
+			t.Fatalf("Invalid response: %v", err)
+		}
+		responses[fmt.Sprint(resp["id"])] = resp
+	}
+	return responses
+}
+
+func testServedTools() []ServedTool {
+	return []ServedTool{
+		{
+			Tool: types.MCPTool{Name: "echo", Description: "Echo text"},
+			Handler: func(ctx context.Context, args map[string]interface{}) (*types.MCPToolResult, error) {
+				text, _ := args["text"].(string)
+				return &types.MCPToolResult{Content: text}, nil
+			},
+		},
+		{
+			Tool: types.MCPTool{Name: "fail", Description: "Always fails"},
+			Handler: func(ctx context.Context, args map[string]interface{}) (*types.MCPToolResult, error) {
+				return nil, errors.New("refused")
+			},
+		},
+	}
+}
+
+func TestServe_Handshake(t *testing.T) {
+	responses := serveLines(t, testServedTools(),
+		`{"jsonrpc":"2.0","id":"init-1","method":"initialize","params":{"protocolVersion":"2024-11-05","clientInfo":{"name":"client"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"ping"}`,
+	)
+
+	if len(responses) != 3 {
+		t.Fatalf("Expected 3 responses (no reply to notifications), got %d: %v", len(responses), responses)
+	}
+
+	if _, ok := responses["init-1"]; !ok {
+		t.Fatalf("Expected string id to be echoed, got %v", responses)
+	}
+	result := responses["init-1"]["result"].(map[string]interface{})
+	if result["protocolVersion"] != "2024-11-05" {
+		t.Errorf("Expected requested protocol version, got %v", result["protocolVersion"])
+	}
+	if _, ok := result["capabilities"].(map[string]interface{})["tools"]; !ok {
+		t.Errorf("Expected tools capability, got %v", result["capabilities"])
+	}
+
+	tools := responses["2"]["result"].(map[string]interface{})["tools"].([]interface{})
+	if len(tools) != 2 || tools[0].(map[string]interface{})["name"] != "echo" {
+		t.Errorf("Expected served tools, got %v", tools)
+	}
+
+	if _, ok := responses["3"]["result"]; !ok {
+		t.Errorf("Expected empty result for ping, got %v", responses["3"])
+	}
+}
+
+func TestServe_ToolsCall(t *testing.T) {
+	responses := serveLines(t, testServedTools(),
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hello"}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"fail"}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"missing"}}`,
+	)
+
+	content := responses["1"]["result"].(map[string]interface{})["content"].([]interface{})
+	if text := content[0].(map[string]interface{})["text"]; text != "hello" {
+		t.Errorf("Expected echo result, got %v", text)
+	}
+
+	failed := responses["2"]["result"].(map[string]interface{})
+	if failed["isError"] != true {
+		t.Errorf("Expected handler error as isError result, got %v", failed)
+	}
+
+	rpcErr, ok := responses["3"]["error"].(map[string]interface{})
+	if !ok || rpcErr["code"].(float64) != codeInvalidParams {
+		t.Errorf("Expected invalid params error for unknown tool, got %v", responses["3"])
+	}
+}
+
+func TestServe_Errors(t *testing.T) {
+	responses := serveLines(t, nil,
+		`not json`,
+		`{"jsonrpc":"2.0","id":1,"method":"resources/unknown"}`,
+	)
+
+	if len(responses) != 2 {
+		t.Fatalf("Expected 2 responses, got %d", len(responses))
+	}
+	parseErr, ok := responses["<nil>"]
+	if !ok {
+		t.Fatalf("Expected null id for parse error, got %v", responses)
+	}
+	if code := parseErr["error"].(map[string]interface{})["code"].(float64); code != codeParseError {
+		t.Errorf("Expected parse error, got %v", code)
+	}
+	if code := responses["1"]["error"].(map[string]interface{})["code"].(float64); code != codeMethodNotFound {
+		t.Errorf("Expected method not found, got %v", code)
+	}
+}
+
+func TestServe_Cancelled(t *testing.T) {
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	tools := []ServedTool{{
+		Tool: types.MCPTool{Name: "wait"},
+		Handler: func(ctx context.Context, args map[string]interface{}) (*types.MCPToolResult, error) {
+			close(started)
+			<-ctx.Done()
+			close(cancelled)
+			return nil, ctx.Err()
+		},
+	}}
+
+	in, client := io.Pipe()
+	var out bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(context.Background(), in, &out, ServerInfo{Name: "test"}, tools)
+	}()
+
+	fmt.Fprintln(client, `{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"wait"}}`)
+	<-started
+	fmt.Fprintln(client, `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":7,"reason":"user"}}`)
+	<-cancelled
+	client.Close()
+
+	if err := <-done; err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Expected no response for a cancelled request, got %s", out.String())
+	}
+}
@@ -0,0 +1,409 @@
+// Package mcp provides Model Context Protocol support
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+const (
+	// defaultRestartDelay is the wait before the first restart of a crashed server
+	defaultRestartDelay = time.Second
+	// defaultMaxRestartDelay caps the exponential restart backoff
+	defaultMaxRestartDelay = 30 * time.Second
+	// maxRestartAttempts is how many restarts in a row may fail before a server is given up
+	maxRestartAttempts = 5
+	// stableRunTime resets the backoff once a server has been running this long
+	stableRunTime = time.Minute
+	// startTimeout bounds the initialize handshake and tool listing
+	startTimeout = 15 * time.Second
+)
+
+// ServerConfig describes how to launch or connect to an MCP server
+type ServerConfig struct {
+	Name      string
+	Transport string // stdio, http or sse; defaults to http when URL is set and stdio otherwise
+	Command   string
+	Args      []string
+	Env       map[string]string // added to the inherited environment
+	Cwd       string
+	URL       string            // endpoint of a remote server
+	Headers   map[string]string // sent to remote servers; ${VAR} is read from the environment
+}
+
+// transport returns the configured transport, applying the default
+func (c ServerConfig) transport() string {
+	if c.Transport != "" {
+		return c.Transport
+	}
+	if c.URL != "" {
+		return TransportHTTP
+	}
+	return TransportStdio
+}
+
+// ValidServerName reports whether name can be used as a tool namespace
+func ValidServerName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// SetLogDir sets the directory server stderr and lifecycle events are written to.
+// Each server logs to <dir>/<name>.log; an empty dir disables logging.
+func (m *Manager) SetLogDir(dir string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logDir = dir
+}
+
+// LogPath returns the log file of a server, or "" when logging is disabled
+func (m *Manager) LogPath(name string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.logDir == "" {
+		return ""
+	}
+	return filepath.Join(m.logDir, name+".log")
+}
+
+// Start launches an MCP server and supervises it, restarting it with
+// exponential backoff when it exits. Its tools are exposed as <name>.<tool>.
+// The server is stopped when ctx is cancelled.
+func (m *Manager) Start(ctx context.Context, cfg ServerConfig) error {
+	if !ValidServerName(cfg.Name) {
+		return fmt.Errorf("invalid server name %q: use letters, digits, '_' and '-'", cfg.Name)
+	}
+
+	m.mu.RLock()
+	_, exists := m.servers[cfg.Name]
+	m.mu.RUnlock()
+	if exists {
+		return fmt.Errorf("server %s already running", cfg.Name)
+	}
+
+	server, err := m.launch(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	if _, exists := m.servers[cfg.Name]; exists {
+		m.mu.Unlock()
+		server.stop()
+		server.wait()
+		closeLog(server.log)
+		return fmt.Errorf("server %s already running", cfg.Name)
+	}
+	m.servers[cfg.Name] = server
+	m.mu.Unlock()
+
+	go m.supervise(ctx, cfg, server)
+	return nil
+}
+
+// RunningServers returns the names of the servers currently running
+func (m *Manager) RunningServers() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var names []string
+	for name, server := range m.servers {
+		if server.isRunning() {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// launch connects to the server and performs the initialize handshake
+func (m *Manager) launch(ctx context.Context, cfg ServerConfig) (*Server, error) {
+	server := &Server{
+		name:      cfg.Name,
+		running:   true,
+		pending:   make(map[string]chan *incomingMessage),
+		progress:  make(map[string]func(Progress)),
+		done:      make(chan struct{}),
+		logf:      func(format string, args ...interface{}) { m.logf(cfg.Name, format, args...) },
+		startedAt: time.Now(),
+	}
+	if err := m.connect(ctx, cfg, server); err != nil {
+		m.logf(cfg.Name, "%v", err)
+		return nil, err
+	}
+	go server.readLoop()
+
+	initCtx, cancel := context.WithTimeout(ctx, startTimeout)
+	defer cancel()
+	var err error
+	if err = server.initialize(initCtx); err != nil {
+		err = fmt.Errorf("failed to initialize server: %w", err)
+	} else if err = server.listTools(initCtx); err != nil {
+		err = fmt.Errorf("failed to list tools: %w", err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("server did not respond within %s", startTimeout)
+	}
+	if err != nil {
+		server.stop()
+		server.wait()
+		closeLog(server.log)
+		m.logf(cfg.Name, "%v", err)
+		return nil, err
+	}
+
+	m.logf(cfg.Name, "started with %d tools", len(server.toolList()))
+	return server, nil
+}
+
+// connect starts the server process, or opens the connection to a remote server
+func (m *Manager) connect(ctx context.Context, cfg ServerConfig, server *Server) error {
+	switch transport := cfg.transport(); transport {
+	case TransportStdio:
+		return m.startProcess(ctx, cfg, server)
+
+	case TransportHTTP, TransportSSE:
+		m.logf(cfg.Name, "connecting to %s (%s)", cfg.URL, transport)
+		headers, err := expandHeaders(cfg.Headers)
+		if err != nil {
+			return err
+		}
+		if transport == TransportHTTP {
+			server.transport = newHTTPTransport(ctx, cfg.URL, headers)
+			return nil
+		}
+		t, err := dialSSE(ctx, cfg.URL, headers)
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		server.transport = t
+		return nil
+
+	default:
+		return fmt.Errorf("unknown transport %q: use stdio, http or sse", transport)
+	}
+}
+
+// startProcess launches a local server, talking to it over stdin and stdout
+func (m *Manager) startProcess(ctx context.Context, cfg ServerConfig, server *Server) error {
+	m.logf(cfg.Name, "starting %s", strings.Join(append([]string{cfg.Command}, cfg.Args...), " "))
+
+	cmd := exec.CommandContext(ctx, cfg.Command, cfg.Args...)
+	cmd.Dir = cfg.Cwd
+	if len(cfg.Env) > 0 {
+		cmd.Env = os.Environ()
+		for k, v := range cfg.Env {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+	}
+
+	log := m.openLog(cfg.Name)
+	if log != nil {
+		cmd.Stderr = log
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		closeLog(log)
+		return fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		closeLog(log)
+		return fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		closeLog(log)
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+
+	server.cmd = cmd
+	server.log = log
+	server.transport = &stdioTransport{stdin: stdin, stdout: bufio.NewReader(stdout)}
+	return nil
+}
+
+// supervise waits for a server to exit, or its remote connection to end, and
+// restarts it with exponential backoff. It stops when the server was stopped
+// deliberately, ctx ends, or maxRestartAttempts restarts in a row fail.
+func (m *Manager) supervise(ctx context.Context, cfg ServerConfig, server *Server) {
+	delay := m.restartDelay
+	failures := 0
+
+	for {
+		err := server.wait()
+		server.markStopped()
+		closeLog(server.log)
+
+		if ctx.Err() != nil || !m.isCurrent(cfg.Name, server) {
+			return
+		}
+		if time.Since(server.startedAt) >= stableRunTime {
+			delay = m.restartDelay
+			failures = 0
+		}
+		m.logf(cfg.Name, "server exited: %v", exitReason(err))
+
+		var next *Server
+		for next == nil {
+			if failures >= maxRestartAttempts {
+				m.logf(cfg.Name, "giving up after %d failed restarts", maxRestartAttempts)
+				m.remove(cfg.Name, server)
+				return
+			}
+			failures++
+			m.logf(cfg.Name, "restarting in %s (attempt %d/%d)", delay, failures, maxRestartAttempts)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, m.maxRestartDelay)
+
+			if !m.isCurrent(cfg.Name, server) {
+				return
+			}
+			next, _ = m.launch(ctx, cfg)
+		}
+
+		if !m.replace(cfg.Name, server, next) {
+			next.stop()
+			next.wait()
+			closeLog(next.log)
+			return
+		}
+		server = next
+	}
+}
+
+// isCurrent reports whether server is still the registered instance for name
+func (m *Manager) isCurrent(name string, server *Server) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.servers[name] == server
+}
+
+// replace swaps a crashed server for its restarted instance
+func (m *Manager) replace(name string, old, next *Server) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.servers[name] != old {
+		return false
+	}
+	m.servers[name] = next
+	return true
+}
+
+// remove unregisters a server that could not be restarted
+func (m *Manager) remove(name string, server *Server) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.servers[name] == server {
+		delete(m.servers, name)
+	}
+}
+
+// openLog opens a server's log file for appending, returning nil when logging is disabled
+func (m *Manager) openLog(name string) *os.File {
+	path := m.LogPath(name)
+	if path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil
+	}
+	return f
+}
+
+// logf records a lifecycle event in a server's log file
+func (m *Manager) logf(name, format string, args ...interface{}) {
+	f := m.openLog(name)
+	if f == nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "%s [sosomi] %s\n", time.Now().Format("2006-01-02 15:04:05"), fmt.Sprintf(format, args...))
+}
+
+// closeLog closes a log file opened by openLog
+func closeLog(log *os.File) {
+	if log != nil {
+		log.Close()
+	}
+}
+
+// exitReason describes why a server process ended
+func exitReason(err error) string {
+	if err == nil {
+		return "exit status 0"
+	}
+	return err.Error()
+}
+
+// stop closes the connection and kills the server process, if any
+func (s *Server) stop() {
+	s.transport.Close()
+	if s.cmd != nil && s.cmd.Process != nil {
+		s.cmd.Process.Kill()
+	}
+	s.markStopped()
+}
+
+// wait blocks until the server process exits or, for remote servers, the connection ends
+func (s *Server) wait() error {
+	if s.cmd != nil {
+		return s.cmd.Wait()
+	}
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeErr
+}
+
+// markStopped records that the server process is no longer running
+func (s *Server) markStopped() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = false
+}
+
+// isRunning reports whether the server process is running
+func (s *Server) isRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// namespacedTools returns the server's tools named <server>.<tool>
+func (s *Server) namespacedTools() []types.MCPTool {
+	list := s.toolList()
+	tools := make([]types.MCPTool, len(list))
+	for i, tool := range list {
+		tools[i] = tool
+		tools[i].Name = s.name + "." + tool.Name
+	}
+	return tools
+}
@@ -0,0 +1,365 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// TestMain lets the test binary act as an MCP server for the tests below
+func TestMain(m *testing.M) {
+	if os.Getenv("SOSOMI_TEST_MCP_SERVER") == "1" {
+		runTestServer()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runTestServer serves echo, env, crash, progress, slow, cancelled and
+// add_tool tools, plus resources and prompts, over stdio
+func runTestServer() {
+	var writeMu sync.Mutex
+	write := func(v interface{}) {
+		data, _ := json.Marshal(v)
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		fmt.Println(string(data))
+	}
+
+	tools := []types.MCPTool{
+		{Name: "echo", Description: "Echo text"},
+		{Name: "env", Description: "Show working directory and TEST_VALUE"},
+		{Name: "crash", Description: "Exit immediately"},
+		{Name: "progress", Description: "Report progress, ping the client, then finish"},
+		{Name: "slow", Description: "Block until cancelled"},
+		{Name: "cancelled", Description: "List the request IDs cancelled so far"},
+		{Name: "add_tool", Description: "Add the extra tool and notify the client"},
+	}
+	var mu sync.Mutex
+	var cancelled []string
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var msg struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params struct {
+				Name      string                 `json:"name"`
+				Arguments map[string]interface{} `json:"arguments"`
+				Cursor    string                 `json:"cursor"`
+				URI       string                 `json:"uri"`
+				RequestID json.RawMessage        `json:"requestId"`
+				Meta      struct {
+					ProgressToken json.RawMessage `json:"progressToken"`
+				} `json:"_meta"`
+			} `json:"params"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		if msg.Method == "notifications/cancelled" {
+			mu.Lock()
+			cancelled = append(cancelled, string(msg.Params.RequestID))
+			mu.Unlock()
+			continue
+		}
+		if len(msg.ID) == 0 || msg.Method == "" {
+			continue // notifications and responses to our ping
+		}
+
+		reply := func(result interface{}) {
+			write(map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "result": result})
+		}
+
+		switch msg.Method {
+		case "initialize":
+			reply(InitializeResult{
+				ProtocolVersion: "2024-11-05",
+				Capabilities: Capabilities{
+					Tools:     &ToolsCapability{ListChanged: true},
+					Resources: &ResourcesCapability{},
+					Prompts:   &PromptsCapability{},
+				},
+				ServerInfo: ServerInfo{Name: "test"},
+			})
+		case "tools/list":
+			mu.Lock()
+			reply(ToolsListResult{Tools: tools})
+			mu.Unlock()
+		case "resources/list":
+			// Two pages to exercise pagination
+			if msg.Params.Cursor == "" {
+				reply(map[string]interface{}{
+					"resources":  []types.MCPResource{{URI: "file:///a.txt", Name: "a.txt"}},
+					"nextCursor": "page-2",
+				})
+			} else {
+				reply(map[string]interface{}{"resources": []types.MCPResource{{URI: "file:///b.txt", Name: "b.txt"}}})
+			}
+		case "resources/read":
+			reply(ResourceReadResult{Contents: []types.MCPResourceContent{{URI: msg.Params.URI, Text: "contents of " + msg.Params.URI}}})
+		case "prompts/list":
+			reply(map[string]interface{}{"prompts": []types.MCPPrompt{{Name: "greet", Arguments: []types.MCPPromptArgument{{Name: "who", Required: true}}}}})
+		case "prompts/get":
+			who, _ := msg.Params.Arguments["who"].(string)
+			reply(PromptGetResult{Messages: []PromptMessage{{Role: "user", Content: ContentBlock{Type: "text", Text: "Hello " + who}}}})
+		case "tools/call":
+			var text string
+			switch msg.Params.Name {
+			case "echo":
+				text, _ = msg.Params.Arguments["text"].(string)
+			case "env":
+				cwd, _ := os.Getwd()
+				text = cwd + " " + os.Getenv("TEST_VALUE")
+			case "crash":
+				fmt.Fprintln(os.Stderr, "crashing on request")
+				os.Exit(1)
+			case "progress":
+				// Interleave a server request and notifications with the response
+				write(map[string]interface{}{"jsonrpc": "2.0", "id": "srv-1", "method": "ping"})
+				write(map[string]interface{}{"jsonrpc": "2.0", "method": "notifications/message", "params": map[string]interface{}{"level": "info", "data": "working"}})
+				for i := 1; i <= 2; i++ {
+					write(map[string]interface{}{"jsonrpc": "2.0", "method": "notifications/progress", "params": map[string]interface{}{
+						"progressToken": msg.Params.Meta.ProgressToken, "progress": i, "total": 2,
+					}})
+				}
+				text = "done"
+			case "slow":
+				continue // never answered; the client cancels it
+			case "cancelled":
+				mu.Lock()
+				text = strings.Join(cancelled, ",")
+				mu.Unlock()
+			case "add_tool":
+				mu.Lock()
+				tools = append(tools, types.MCPTool{Name: "extra"})
+				mu.Unlock()
+				write(map[string]interface{}{"jsonrpc": "2.0", "method": "notifications/tools/list_changed"})
+			}
+			reply(ToolCallResult{Content: []ContentBlock{{Type: "text", Text: text}}})
+		}
+	}
+}
+
+func testServerConfig(name string) ServerConfig {
+	return ServerConfig{
+		Name:    name,
+		Command: os.Args[0],
+		Args:    []string{"-test.run=^$"},
+		Env:     map[string]string{"SOSOMI_TEST_MCP_SERVER": "1"},
+	}
+}
+
+func TestValidServerName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"git":         true,
+		"my-server_2": true,
+		"":            false,
+		"a.b":         false,
+		"has space":   false,
+	} {
+		if got := ValidServerName(name); got != want {
+			t.Errorf("ValidServerName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestManager_Start_InvalidName(t *testing.T) {
+	manager := NewManager()
+	if err := manager.Start(context.Background(), ServerConfig{Name: "bad.name", Command: "true"}); err == nil {
+		t.Error("Expected error for invalid server name")
+	}
+}
+
+func TestManager_Start_NamespacesTools(t *testing.T) {
+	manager := NewManager()
+	defer manager.Shutdown()
+
+	cfg := testServerConfig("test")
+	cfg.Cwd = t.TempDir()
+	cfg.Env["TEST_VALUE"] = "configured"
+	if err := manager.Start(context.Background(), cfg); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	tools := manager.GetTools()
+	if len(tools) != 7 || tools[0].Name != "test.echo" {
+		t.Fatalf("Expected namespaced tools, got %+v", tools)
+	}
+
+	result, err := manager.CallTool(context.Background(), "test.echo", map[string]interface{}{"text": "hello"})
+	if err != nil || result.Content != "hello" {
+		t.Errorf("Expected echo result, got %+v, %v", result, err)
+	}
+
+	result, err = manager.CallTool(context.Background(), "test.env", nil)
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	if !strings.HasPrefix(result.Content, cfg.Cwd) || !strings.HasSuffix(result.Content, "configured") {
+		t.Errorf("Expected cwd and env to be applied, got %q", result.Content)
+	}
+
+	if _, err := manager.CallTool(context.Background(), "echo", nil); err == nil {
+		t.Error("Expected error for tool without server namespace")
+	}
+
+	if err := manager.Start(context.Background(), cfg); err == nil {
+		t.Error("Expected error when starting a server twice")
+	}
+}
+
+func TestManager_RestartsCrashedServer(t *testing.T) {
+	manager := NewManager()
+	manager.restartDelay = 10 * time.Millisecond
+	manager.SetLogDir(t.TempDir())
+	defer manager.Shutdown()
+
+	if err := manager.Start(context.Background(), testServerConfig("flaky")); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	if _, err := manager.CallTool(context.Background(), "flaky.crash", nil); err == nil {
+		t.Error("Expected error from crashed server")
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		result, err := manager.CallTool(context.Background(), "flaky.echo", map[string]interface{}{"text": "back"})
+		if err == nil && result.Content == "back" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Server was not restarted: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	log, err := os.ReadFile(filepath.Join(manager.logDir, "flaky.log"))
+	if err != nil {
+		t.Fatalf("Expected log file: %v", err)
+	}
+	for _, want := range []string{"crashing on request", "server exited", "restarting in"} {
+		if !strings.Contains(string(log), want) {
+			t.Errorf("Expected log to contain %q, got:\n%s", want, log)
+		}
+	}
+}
+
+func TestManager_StopServer_NoRestart(t *testing.T) {
+	manager := NewManager()
+	manager.restartDelay = 10 * time.Millisecond
+	defer manager.Shutdown()
+
+	if err := manager.Start(context.Background(), testServerConfig("stopped")); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := manager.StopServer("stopped"); err != nil {
+		t.Fatalf("StopServer failed: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if servers := manager.RunningServers(); len(servers) != 0 {
+		t.Errorf("Expected stopped server to stay stopped, got %v", servers)
+	}
+}
+
+func TestManager_CallTool_Progress(t *testing.T) {
+	manager := NewManager()
+	manager.SetLogDir(t.TempDir())
+	defer manager.Shutdown()
+
+	var mu sync.Mutex
+	var updates []Progress
+	manager.SetProgressHandler(func(tool string, p Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+		if tool != "test.progress" {
+			t.Errorf("Expected progress for test.progress, got %s", tool)
+		}
+		updates = append(updates, p)
+	})
+
+	if err := manager.Start(context.Background(), testServerConfig("test")); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	// The server pings us and sends notifications before responding
+	result, err := manager.CallTool(context.Background(), "test.progress", nil)
+	if err != nil || result.Content != "done" {
+		t.Fatalf("Expected result after notifications, got %+v, %v", result, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(updates) != 2 || updates[1].Progress != 2 || updates[1].Total != 2 {
+		t.Errorf("Expected two progress updates, got %+v", updates)
+	}
+
+	log, _ := os.ReadFile(filepath.Join(manager.logDir, "test.log"))
+	if !strings.Contains(string(log), `info: "working"`) {
+		t.Errorf("Expected server log message in log file, got:\n%s", log)
+	}
+}
+
+func TestManager_CallTool_Cancel(t *testing.T) {
+	manager := NewManager()
+	defer manager.Shutdown()
+
+	if err := manager.Start(context.Background(), testServerConfig("test")); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := manager.CallTool(ctx, "test.slow", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline error, got %v", err)
+	}
+
+	// Later requests still work and the server saw the cancellation
+	result, err := manager.CallTool(context.Background(), "test.cancelled", nil)
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	if result.Content == "" {
+		t.Error("Expected the server to receive notifications/cancelled")
+	}
+}
+
+func TestManager_ToolsListChanged(t *testing.T) {
+	manager := NewManager()
+	defer manager.Shutdown()
+
+	if err := manager.Start(context.Background(), testServerConfig("test")); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if _, err := manager.CallTool(context.Background(), "test.add_tool", nil); err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		tools := manager.GetTools()
+		if tools[len(tools)-1].Name == "test.extra" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Tool list was not refreshed: %+v", tools)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := manager.CallTool(context.Background(), "test.extra", nil); err != nil {
+		t.Errorf("Expected new tool to be callable, got %v", err)
+	}
+}
@@ -0,0 +1,424 @@
+// Package mcp provides Model Context Protocol support
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transport names accepted in ServerConfig.Transport
+const (
+	TransportStdio = "stdio" // spawn a local process and talk over stdin/stdout
+	TransportHTTP  = "http"  // Streamable HTTP
+	TransportSSE   = "sse"   // legacy HTTP+SSE (protocol version 2024-11-05)
+)
+
+// closeTimeout bounds the request ending a Streamable HTTP session
+const closeTimeout = 5 * time.Second
+
+// errTransportClosed is returned by Receive once a transport has been closed
+var errTransportClosed = errors.New("transport closed")
+
+// Transport carries JSON-RPC messages between sosomi and an MCP server
+type Transport interface {
+	// Send delivers a single message to the server
+	Send(msg []byte) error
+	// Receive blocks until the next message from the server arrives and
+	// returns an error once the connection has ended
+	Receive() ([]byte, error)
+	// Close ends the connection
+	Close() error
+}
+
+// stdioTransport talks to a local server process over its stdin and stdout
+type stdioTransport struct {
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	mu     sync.Mutex // serializes writes
+}
+
+func (t *stdioTransport) Send(msg []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := t.stdin.Write(append(msg, '\n'))
+	return err
+}
+
+func (t *stdioTransport) Receive() ([]byte, error) {
+	return t.stdout.ReadBytes('\n')
+}
+
+func (t *stdioTransport) Close() error {
+	return t.stdin.Close()
+}
+
+// remoteTransport holds what the HTTP based transports share: the endpoint,
+// headers and the queue of messages received from the server
+type remoteTransport struct {
+	url      string
+	headers  map[string]string
+	client   *http.Client
+	incoming chan []byte
+	done     chan struct{}
+
+	ctx       context.Context // ends when the transport is closed
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+}
+
+func newRemoteTransport(ctx context.Context, endpoint string, headers map[string]string) *remoteTransport {
+	ctx, cancel := context.WithCancel(ctx)
+	return &remoteTransport{
+		url:      endpoint,
+		headers:  headers,
+		client:   &http.Client{},
+		incoming: make(chan []byte),
+		done:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+func (t *remoteTransport) Receive() ([]byte, error) {
+	select {
+	case msg := <-t.incoming:
+		return msg, nil
+	case <-t.done:
+		return nil, errTransportClosed
+	}
+}
+
+// deliver queues a message body for Receive, splitting JSON-RPC batches
+func (t *remoteTransport) deliver(data []byte) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return
+	}
+
+	messages := []json.RawMessage{data}
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return
+		}
+	}
+	for _, msg := range messages {
+		select {
+		case t.incoming <- msg:
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// shutdown marks the transport closed, releasing Receive and any open streams
+func (t *remoteTransport) shutdown() {
+	t.closeOnce.Do(func() {
+		close(t.done)
+		t.cancel()
+	})
+}
+
+// newRequest builds a request to the server with the configured headers
+func (t *remoteTransport) newRequest(ctx context.Context, method, endpoint string, body []byte) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// httpTransport implements the Streamable HTTP transport: every message is
+// POSTed to the endpoint and answered with JSON or an SSE stream, and an
+// optional GET stream carries messages the server sends on its own
+type httpTransport struct {
+	*remoteTransport
+
+	mu        sync.Mutex
+	sessionID string
+	listening bool
+}
+
+func newHTTPTransport(ctx context.Context, endpoint string, headers map[string]string) *httpTransport {
+	return &httpTransport{remoteTransport: newRemoteTransport(ctx, endpoint, headers)}
+}
+
+func (t *httpTransport) Send(msg []byte) error {
+	req, err := t.newRequest(t.ctx, http.MethodPost, t.url, msg)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	t.setSession(req)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+
+	if resp.StatusCode == http.StatusAccepted {
+		resp.Body.Close()
+		// Notifications are accepted with 202; the first one is
+		// notifications/initialized, after which the server may push messages
+		t.startListening()
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		// The response arrives on the stream, possibly after notifications
+		go func() {
+			defer resp.Body.Close()
+			readSSE(resp.Body, func(event, data string) {
+				if event == "" || event == "message" {
+					t.deliver([]byte(data))
+				}
+			})
+		}()
+		return nil
+	}
+
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	t.deliver(body)
+	return nil
+}
+
+// setSession adds the session ID assigned by the server to a request
+func (t *httpTransport) setSession(req *http.Request) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", t.sessionID)
+	}
+}
+
+// startListening opens the GET stream for server initiated messages once.
+// Servers that do not offer one answer 405, which is not an error.
+func (t *httpTransport) startListening() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.listening {
+		return
+	}
+	t.listening = true
+
+	go func() {
+		req, err := t.newRequest(t.ctx, http.MethodGet, t.url, nil)
+		if err != nil {
+			return
+		}
+		req.Header.Set("Accept", "text/event-stream")
+		t.setSession(req)
+
+		resp, err := t.client.Do(req)
+		if err != nil {
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return
+		}
+		readSSE(resp.Body, func(event, data string) {
+			if event == "" || event == "message" {
+				t.deliver([]byte(data))
+			}
+		})
+	}()
+}
+
+// Close ends the session on the server, if one was assigned, and the transport
+func (t *httpTransport) Close() error {
+	t.mu.Lock()
+	sessionID := t.sessionID
+	t.mu.Unlock()
+
+	if sessionID != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+		defer cancel()
+		if req, err := t.newRequest(ctx, http.MethodDelete, t.url, nil); err == nil {
+			req.Header.Set("Mcp-Session-Id", sessionID)
+			if resp, err := t.client.Do(req); err == nil {
+				resp.Body.Close()
+			}
+		}
+	}
+
+	t.shutdown()
+	return nil
+}
+
+// sseTransport implements the legacy HTTP+SSE transport: a long-lived GET
+// stream announces a POST endpoint and carries every server message
+type sseTransport struct {
+	*remoteTransport
+
+	endpoint string // where messages are POSTed, announced by the server
+}
+
+// dialSSE opens the event stream and waits for the server to announce its
+// message endpoint. The stream ending closes the transport.
+func dialSSE(ctx context.Context, endpoint string, headers map[string]string) (*sseTransport, error) {
+	t := &sseTransport{remoteTransport: newRemoteTransport(ctx, endpoint, headers)}
+
+	req, err := t.newRequest(t.ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		t.shutdown()
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		t.shutdown()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		t.shutdown()
+		return nil, fmt.Errorf("HTTP %d opening event stream", resp.StatusCode)
+	}
+
+	ready := make(chan string, 1)
+	go func() {
+		defer resp.Body.Close()
+		defer t.shutdown()
+		announced := false
+		readSSE(resp.Body, func(event, data string) {
+			switch {
+			case event == "endpoint" && !announced:
+				announced = true
+				ready <- data
+			case event == "" || event == "message":
+				t.deliver([]byte(data))
+			}
+		})
+	}()
+
+	select {
+	case data := <-ready:
+		base, _ := url.Parse(endpoint)
+		ref, err := url.Parse(strings.TrimSpace(data))
+		if err != nil {
+			t.shutdown()
+			return nil, fmt.Errorf("invalid message endpoint %q: %w", data, err)
+		}
+		t.endpoint = base.ResolveReference(ref).String()
+		return t, nil
+	case <-t.done:
+		return nil, fmt.Errorf("event stream ended before the server announced its endpoint")
+	case <-time.After(startTimeout):
+		t.shutdown()
+		return nil, fmt.Errorf("server did not announce its endpoint within %s", startTimeout)
+	}
+}
+
+func (t *sseTransport) Send(msg []byte) error {
+	req, err := t.newRequest(t.ctx, http.MethodPost, t.endpoint, msg)
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (t *sseTransport) Close() error {
+	t.shutdown()
+	return nil
+}
+
+// readSSE parses a server-sent event stream, calling fn for every event
+func readSSE(r io.Reader, fn func(event, data string)) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(data) > 0 {
+				fn(event, strings.Join(data, "\n"))
+			}
+			event, data = "", nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue // comment, often used as a keep-alive
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if len(data) > 0 {
+		fn(event, strings.Join(data, "\n"))
+	}
+}
+
+// expandHeaders replaces ${VAR} references in header values with environment
+// variables, so secrets such as auth tokens need not be stored in the config
+func expandHeaders(headers map[string]string) (map[string]string, error) {
+	expanded := make(map[string]string, len(headers))
+	for name, value := range headers {
+		var missing []string
+		expanded[name] = os.Expand(value, func(key string) string {
+			v, ok := os.LookupEnv(key)
+			if !ok {
+				missing = append(missing, key)
+			}
+			return v
+		})
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("header %s references unset environment variable %s", name, strings.Join(missing, ", "))
+		}
+	}
+	return expanded, nil
+}
@@ -0,0 +1,246 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// testRPCResult answers the requests supported by the remote test servers
+func testRPCResult(msg *incomingMessage) interface{} {
+	switch msg.Method {
+	case "initialize":
+		return InitializeResult{ProtocolVersion: "2025-03-26", ServerInfo: ServerInfo{Name: "remote"}}
+	case "tools/list":
+		return ToolsListResult{Tools: []types.MCPTool{{Name: "echo", Description: "Echo text"}}}
+	case "tools/call":
+		var params ToolCallParams
+		json.Unmarshal(msg.Params, &params)
+		text, _ := params.Arguments["text"].(string)
+		return ToolCallResult{Content: []ContentBlock{{Type: "text", Text: text}}}
+	}
+	return struct{}{}
+}
+
+// newStreamableTestServer stands in for a Streamable HTTP server that requires
+// a bearer token, assigns a session and answers tool calls over SSE
+func newStreamableTestServer(t *testing.T, token string, deleted *atomic.Bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		case http.MethodDelete:
+			if r.Header.Get("Mcp-Session-Id") == "session-1" {
+				deleted.Store(true)
+			}
+			return
+		}
+
+		var msg incomingMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if msg.Method != "initialize" && r.Header.Get("Mcp-Session-Id") != "session-1" {
+			http.Error(w, "missing session", http.StatusBadRequest)
+			return
+		}
+		if len(msg.ID) == 0 {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		data, _ := json.Marshal(outgoingMessage{JSONRPC: "2.0", ID: msg.ID, Result: testRPCResult(&msg)})
+		if msg.Method == "initialize" {
+			w.Header().Set("Mcp-Session-Id", "session-1")
+		}
+		if msg.Method == "tools/call" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, ": keep-alive\n\n")
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", `{"jsonrpc":"2.0","method":"notifications/message","params":{"level":"info","data":"calling"}}`)
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}))
+}
+
+func TestManager_StreamableHTTP(t *testing.T) {
+	var deleted atomic.Bool
+	srv := newStreamableTestServer(t, "secret", &deleted)
+	defer srv.Close()
+
+	t.Setenv("SOSOMI_TEST_MCP_TOKEN", "secret")
+	manager := NewManager()
+	err := manager.Start(context.Background(), ServerConfig{
+		Name:    "remote",
+		URL:     srv.URL,
+		Headers: map[string]string{"Authorization": "Bearer ${SOSOMI_TEST_MCP_TOKEN}"},
+	})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	tools := manager.GetTools()
+	if len(tools) != 1 || tools[0].Name != "remote.echo" {
+		t.Fatalf("Expected remote tools, got %+v", tools)
+	}
+
+	result, err := manager.CallTool(context.Background(), "remote.echo", map[string]interface{}{"text": "over http"})
+	if err != nil || result.Content != "over http" {
+		t.Fatalf("Expected echo over SSE response, got %+v, %v", result, err)
+	}
+
+	manager.Shutdown()
+	if !deleted.Load() {
+		t.Error("Expected the session to be deleted on shutdown")
+	}
+}
+
+func TestManager_StreamableHTTP_AuthErrors(t *testing.T) {
+	var deleted atomic.Bool
+	srv := newStreamableTestServer(t, "secret", &deleted)
+	defer srv.Close()
+
+	manager := NewManager()
+	defer manager.Shutdown()
+
+	err := manager.Start(context.Background(), ServerConfig{
+		Name:    "unset",
+		URL:     srv.URL,
+		Headers: map[string]string{"Authorization": "Bearer ${SOSOMI_TEST_UNSET_TOKEN}"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "SOSOMI_TEST_UNSET_TOKEN") {
+		t.Errorf("Expected error naming the unset variable, got %v", err)
+	}
+
+	err = manager.Start(context.Background(), ServerConfig{
+		Name:    "wrong",
+		URL:     srv.URL,
+		Headers: map[string]string{"Authorization": "Bearer wrong"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected HTTP 401 error, got %v", err)
+	}
+}
+
+// newSSETestServer stands in for a legacy HTTP+SSE server. Sending on drop
+// ends the current event stream.
+func newSSETestServer(t *testing.T, drop chan struct{}) *httptest.Server {
+	events := make(chan []byte, 16)
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/sse", func(w http.ResponseWriter, r *http.Request) {
+		flusher := w.(http.Flusher)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: endpoint\ndata: /messages?session=abc\n\n")
+		flusher.Flush()
+
+		for {
+			select {
+			case data := <-events:
+				fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+				flusher.Flush()
+			case <-drop:
+				return
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+
+	mux.HandleFunc("/messages", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("session") != "abc" || r.Header.Get("X-Api-Key") != "static" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var msg incomingMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(msg.ID) > 0 {
+			data, _ := json.Marshal(outgoingMessage{JSONRPC: "2.0", ID: msg.ID, Result: testRPCResult(&msg)})
+			events <- data
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestManager_LegacySSE(t *testing.T) {
+	drop := make(chan struct{})
+	srv := newSSETestServer(t, drop)
+	defer srv.Close()
+
+	manager := NewManager()
+	manager.restartDelay = 10 * time.Millisecond
+	defer manager.Shutdown()
+
+	err := manager.Start(context.Background(), ServerConfig{
+		Name:      "legacy",
+		Transport: TransportSSE,
+		URL:       srv.URL + "/sse",
+		Headers:   map[string]string{"X-Api-Key": "static"},
+	})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	result, err := manager.CallTool(context.Background(), "legacy.echo", map[string]interface{}{"text": "over sse"})
+	if err != nil || result.Content != "over sse" {
+		t.Fatalf("Expected echo over SSE, got %+v, %v", result, err)
+	}
+
+	// Dropping the event stream reconnects like a crashed local server restarts
+	drop <- struct{}{}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		result, err := manager.CallTool(context.Background(), "legacy.echo", map[string]interface{}{"text": "again"})
+		if err == nil && result.Content == "again" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Server was not reconnected: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestReadSSE(t *testing.T) {
+	stream := ": comment\n" +
+		"event: endpoint\ndata: /messages\n\n" +
+		"data: {\"a\":\ndata: 1}\n\n" +
+		"id: 7\nevent: message\ndata:no-space\n"
+
+	var events []string
+	readSSE(strings.NewReader(stream), func(event, data string) {
+		events = append(events, event+"|"+data)
+	})
+
+	want := []string{"endpoint|/messages", "|{\"a\":\n1}", "message|no-space"}
+	if len(events) != len(want) {
+		t.Fatalf("Expected %d events, got %q", len(want), events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("Event %d: expected %q, got %q", i, want[i], events[i])
+		}
+	}
+}
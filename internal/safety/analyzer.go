@@ -13,17 +13,16 @@ import (
 
 // Analyzer performs safety analysis on shell commands
 type Analyzer struct {
-	parser       *syntax.Parser
-	blockedCmds  []string
-	allowedPaths []string
-}
-
-// CustomRule represents a user-defined safety rule
-type CustomRule struct {
-	Pattern   string          `yaml:"pattern"`
-	Action    string          `yaml:"action"` // warn, block, confirm
-	Message   string          `yaml:"message"`
-	RiskLevel types.RiskLevel `yaml:"risk_level"`
+	parser         *syntax.Parser
+	blockedCmds    []string
+	allowedPaths   []string
+	protectedPaths []string
+	customRules    []CustomRule
+	workDir        string
+
+	environment        types.Environment
+	productionPatterns []string
+	productionAction   string
 }
 
 // NewAnalyzer creates a new command analyzer
@@ -48,20 +47,37 @@ func (a *Analyzer) Analyze(command string) (*types.CommandAnalysis, error) {
 	prog, err := a.parser.Parse(reader, "")
 	if err != nil {
 		// If parsing fails, do pattern-based analysis only
+		a.matchPatterns(command, fallbackPatterns, analysis)
 		return a.patternAnalysis(command, analysis), nil
 	}
 
-	// Walk the AST to extract information
-	syntax.Walk(prog, func(node syntax.Node) bool {
+	// Walk the AST to extract information, including the commands run by
+	// wrappers such as sudo or bash -c
+	a.walkNested(prog, nesting{}, func(node syntax.Node, nest nesting) {
+		reasons, actions, paths := len(analysis.RiskReasons), len(analysis.Actions), len(analysis.AffectedPaths)
+
 		switch n := node.(type) {
 		case *syntax.CallExpr:
 			a.analyzeCallExpr(n, analysis)
+			if nest.input {
+				a.analyzeInputArgs(n, analysis)
+			}
 		case *syntax.Redirect:
 			a.analyzeRedirect(n, analysis)
 		case *syntax.BinaryCmd:
 			a.analyzeBinaryCmd(n, analysis)
 		}
-		return true
+
+		for i := reasons; i < len(analysis.RiskReasons); i++ {
+			analysis.RiskReasons[i] = nest.attribute(analysis.RiskReasons[i])
+		}
+		for i := actions; i < len(analysis.Actions); i++ {
+			analysis.Actions[i] = nest.attribute(analysis.Actions[i])
+		}
+		if nest.remote {
+			// Paths on another host are not checked against local files
+			analysis.AffectedPaths = analysis.AffectedPaths[:paths]
+		}
 	})
 
 	// Pattern matching analysis
@@ -73,6 +89,12 @@ func (a *Analyzer) Analyze(command string) (*types.CommandAnalysis, error) {
 	// Check path restrictions
 	a.checkPathRestrictions(analysis)
 
+	// Check protected paths
+	a.checkProtectedPaths(prog, analysis)
+
+	// Check the environments the command targets
+	a.checkEnvironment(prog, analysis)
+
 	return analysis, nil
 }
 
@@ -83,11 +105,19 @@ func (a *Analyzer) analyzeCallExpr(call *syntax.CallExpr, analysis *types.Comman
 	}
 
 	// Get command name
-	cmdName := a.getLiteral(call.Args[0])
-	if cmdName == "" {
+	cmdName := filepath.Base(a.getLiteral(call.Args[0]))
+	if cmdName == "." {
 		return
 	}
 
+	// Scripts built at run time cannot be unwrapped and analyzed
+	if wrapper := dynamicScript(call); wrapper != "" {
+		if analysis.RiskLevel < types.RiskCaution {
+			analysis.RiskLevel = types.RiskCaution
+		}
+		analysis.RiskReasons = append(analysis.RiskReasons, wrapper+" runs a script only known at run time")
+	}
+
 	// Analyze specific commands
 	switch cmdName {
 	case "rm":
@@ -110,9 +140,67 @@ func (a *Analyzer) analyzeCallExpr(call *syntax.CallExpr, analysis *types.Comman
 		analysis.RiskLevel = types.RiskDangerous
 		analysis.Reversible = false
 		analysis.RiskReasons = append(analysis.RiskReasons, "Direct disk access - potential data loss")
+	case "find":
+		a.analyzeFind(call, analysis)
+	default:
+		a.analyzeTool(call, analysis)
 	}
 }
 
+// destructiveCommands change or remove the files they are given
+var destructiveCommands = map[string]bool{
+	"rm": true, "rmdir": true, "unlink": true, "shred": true, "mv": true, "truncate": true,
+	"chmod": true, "chown": true, "chgrp": true, "dd": true,
+}
+
+// analyzeInputArgs analyzes commands run by xargs or find -exec, which get
+// paths only known at run time
+func (a *Analyzer) analyzeInputArgs(call *syntax.CallExpr, analysis *types.CommandAnalysis) {
+	if !destructiveCommands[filepath.Base(a.getLiteral(call.Args[0]))] {
+		return
+	}
+	if analysis.RiskLevel < types.RiskCaution {
+		analysis.RiskLevel = types.RiskCaution
+	}
+	analysis.RiskReasons = append(analysis.RiskReasons, "Modifies paths only known at run time")
+}
+
+// analyzeFind analyzes the -delete action of find commands; commands run by
+// -exec are analyzed on their own
+func (a *Analyzer) analyzeFind(call *syntax.CallExpr, analysis *types.CommandAnalysis) {
+	words := make([]string, len(call.Args))
+	for i, arg := range call.Args {
+		words[i] = wordText(arg)
+	}
+	if !containsWord(words, "-delete") {
+		return
+	}
+
+	for _, root := range findRoots(words) {
+		analysis.AffectedPaths = append(analysis.AffectedPaths, root)
+		if root == "/" || root == "~" || root == "$HOME" {
+			analysis.RiskLevel = types.RiskCritical
+			analysis.RiskReasons = append(analysis.RiskReasons, "Attempting to delete root or home directory")
+		}
+	}
+	if analysis.RiskLevel < types.RiskCaution {
+		analysis.RiskLevel = types.RiskCaution
+	}
+	analysis.Reversible = false
+	analysis.RiskReasons = append(analysis.RiskReasons, "find -delete removes every match, which cannot be undone")
+	analysis.Actions = append(analysis.Actions, "DELETE files/directories")
+}
+
+// containsWord reports whether words contains word
+func containsWord(words []string, word string) bool {
+	for _, w := range words {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
+
 // analyzeRm analyzes rm commands
 func (a *Analyzer) analyzeRm(call *syntax.CallExpr, analysis *types.CommandAnalysis) {
 	hasRecursive := false
@@ -283,7 +371,31 @@ func (a *Analyzer) analyzeBinaryCmd(cmd *syntax.BinaryCmd, analysis *types.Comma
 
 // patternAnalysis performs regex-based pattern matching
 func (a *Analyzer) patternAnalysis(command string, analysis *types.CommandAnalysis) *types.CommandAnalysis {
-	for _, pattern := range GetDangerousPatterns() {
+	a.matchPatterns(command, GetDangerousPatterns(), analysis)
+	a.applyCustomRules(command, analysis)
+	return analysis
+}
+
+// MatchPatterns returns the built-in patterns a command matches, including
+// the fallback patterns for commands that do not parse
+func (a *Analyzer) MatchPatterns(command string) []DangerPattern {
+	patterns := GetDangerousPatterns()
+	if _, err := a.parser.Parse(strings.NewReader(command), ""); err != nil {
+		patterns = append(append([]DangerPattern{}, fallbackPatterns...), patterns...)
+	}
+
+	var matched []DangerPattern
+	for _, pattern := range patterns {
+		if pattern.Pattern.MatchString(command) {
+			matched = append(matched, pattern)
+		}
+	}
+	return matched
+}
+
+// matchPatterns records the patterns a command matches on the analysis
+func (a *Analyzer) matchPatterns(command string, patterns []DangerPattern, analysis *types.CommandAnalysis) {
+	for _, pattern := range patterns {
 		if pattern.Pattern.MatchString(command) {
 			if pattern.RiskLevel > analysis.RiskLevel {
 				analysis.RiskLevel = pattern.RiskLevel
@@ -300,7 +412,6 @@ func (a *Analyzer) patternAnalysis(command string, analysis *types.CommandAnalys
 			}
 		}
 	}
-	return analysis
 }
 
 // checkBlockedCommands checks if the command contains blocked commands
@@ -0,0 +1,60 @@
+// Package safety provides ranking of candidate commands by risk
+package safety
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// RankCandidates orders candidates from the one to prefer to the one to
+// avoid: valid commands first, then by risk level, then by the model's
+// confidence, then shorter commands first. Candidates repeating an earlier
+// command are dropped, keeping the better ranked one.
+func RankCandidates(candidates []types.Candidate) []types.Candidate {
+	ranked := make([]types.Candidate, len(candidates))
+	copy(ranked, candidates)
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.Valid() != b.Valid() {
+			return a.Valid()
+		}
+		if !a.Valid() {
+			return false
+		}
+		if a.Analysis.RiskLevel != b.Analysis.RiskLevel {
+			return a.Analysis.RiskLevel < b.Analysis.RiskLevel
+		}
+		if a.Response.Confidence != b.Response.Confidence {
+			return a.Response.Confidence > b.Response.Confidence
+		}
+		return len(a.Response.Command) < len(b.Response.Command)
+	})
+
+	seen := make(map[string]bool)
+	unique := ranked[:0]
+	for _, c := range ranked {
+		if c.Response != nil {
+			command := strings.TrimSpace(c.Response.Command)
+			if seen[command] {
+				continue
+			}
+			seen[command] = true
+		}
+		unique = append(unique, c)
+	}
+	return unique
+}
+
+// PreferredCandidate returns the index of the lowest-risk valid candidate
+// in ranked, or -1 when none is valid
+func PreferredCandidate(ranked []types.Candidate) int {
+	for i, c := range ranked {
+		if c.Valid() {
+			return i
+		}
+	}
+	return -1
+}
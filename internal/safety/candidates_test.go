@@ -0,0 +1,72 @@
+// Package safety candidate ranking tests
+package safety
+
+import (
+	"testing"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+func candidate(command string, risk types.RiskLevel, confidence float64) types.Candidate {
+	return types.Candidate{
+		Response: &types.CommandResponse{Command: command, Confidence: confidence},
+		Analysis: &types.CommandAnalysis{Command: command, RiskLevel: risk},
+	}
+}
+
+func TestRankCandidates(t *testing.T) {
+	ranked := RankCandidates([]types.Candidate{
+		candidate("rm -rf ./build", types.RiskDangerous, 0.99),
+		candidate("rm -rf /", types.RiskCritical, 0.9),
+		candidate("find . -name '*.o' -delete", types.RiskCaution, 0.8),
+		candidate("", types.RiskSafe, 1),
+		candidate("make clean", types.RiskCaution, 0.9),
+		candidate("git clean -n", types.RiskCaution, 0.9),
+		candidate("ls build", types.RiskSafe, 0.5),
+	})
+
+	expected := []string{
+		"ls build",
+		"make clean",
+		"git clean -n",
+		"find . -name '*.o' -delete",
+		"rm -rf ./build",
+		"rm -rf /",
+		"",
+	}
+	if len(ranked) != len(expected) {
+		t.Fatalf("Expected %d candidates, got %d", len(expected), len(ranked))
+	}
+	for i, want := range expected {
+		if got := ranked[i].Response.Command; got != want {
+			t.Errorf("Position %d: expected %q, got %q", i, want, got)
+		}
+	}
+	if got := PreferredCandidate(ranked); got != 0 {
+		t.Errorf("Expected the first candidate to be preferred, got %d", got)
+	}
+}
+
+func TestRankCandidates_DropsDuplicates(t *testing.T) {
+	ranked := RankCandidates([]types.Candidate{
+		candidate("ls -la", types.RiskSafe, 0.7),
+		candidate("ls", types.RiskSafe, 0.8),
+		candidate("ls -la ", types.RiskSafe, 0.9),
+	})
+	if len(ranked) != 2 {
+		t.Fatalf("Expected duplicates to be dropped, got %d candidates", len(ranked))
+	}
+	if ranked[0].Response.Confidence != 0.9 {
+		t.Errorf("Expected the most confident duplicate to be kept, got %+v", ranked[0].Response)
+	}
+}
+
+func TestPreferredCandidate_NoneValid(t *testing.T) {
+	ranked := RankCandidates([]types.Candidate{
+		candidate("rm -rf /", types.RiskCritical, 0.9),
+		candidate("", types.RiskSafe, 1),
+	})
+	if got := PreferredCandidate(ranked); got != -1 {
+		t.Errorf("Expected no preferred candidate, got %d", got)
+	}
+}
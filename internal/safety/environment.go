@@ -0,0 +1,180 @@
+// Package safety provides escalation for commands that target production environments
+package safety
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// What to do with commands that target a production environment
+const (
+	ProductionEscalate = "escalate" // raise the risk one level, up to DANGEROUS
+	ProductionConfirm  = "confirm"  // ask to type the risk level before running
+	ProductionWarn     = "warn"     // only name the production targets
+)
+
+// DefaultProductionPatterns mark the environments treated as production
+var DefaultProductionPatterns = []string{"prod*", "*-prod", "*_prod"}
+
+// databaseClients are the tools that connect to a database host
+var databaseClients = map[string]bool{
+	"psql": true, "pg_dump": true, "pg_dumpall": true, "pg_restore": true,
+	"mysql": true, "mysqldump": true, "mariadb": true,
+	"mongosh": true, "mongo": true, "mongodump": true, "mongorestore": true,
+	"redis-cli": true,
+}
+
+// SetEnvironment sets the targets tools use when a command does not name
+// one, the glob patterns, like prod*, that mark production targets, and
+// the production action: escalate, confirm or warn
+func (a *Analyzer) SetEnvironment(env types.Environment, patterns []string, action string) {
+	a.environment = env
+	a.productionPatterns = patterns
+	a.productionAction = action
+}
+
+// checkEnvironment records the environments a command targets and applies
+// the production action when one of them is production
+func (a *Analyzer) checkEnvironment(prog *syntax.File, analysis *types.CommandAnalysis) {
+	seen := make(map[types.Target]bool)
+	a.walkNested(prog, nesting{}, func(node syntax.Node, nest nesting) {
+		call, ok := node.(*syntax.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return
+		}
+		env := a.environment
+		if nest.remote {
+			env = types.Environment{} // another host has its own defaults
+		}
+		words := callWords(call)
+		for _, target := range callTargets(filepath.Base(words[0]), words[1:], env) {
+			target.Production = a.isProduction(target.Name)
+			if !seen[target] {
+				seen[target] = true
+				analysis.Targets = append(analysis.Targets, target)
+			}
+		}
+	})
+
+	var production []string
+	for _, target := range analysis.Targets {
+		if target.Production {
+			production = append(production, target.Kind+" "+target.Name)
+		}
+	}
+	if len(production) == 0 {
+		return
+	}
+
+	analysis.RiskReasons = append(analysis.RiskReasons, "Targets production "+strings.Join(production, ", "))
+	switch strings.ToLower(a.productionAction) {
+	case ProductionWarn:
+	case ProductionConfirm:
+		analysis.RequiresTypedConfirm = true
+	default:
+		if analysis.RiskLevel < types.RiskDangerous {
+			analysis.RiskLevel++
+		}
+	}
+}
+
+// isProduction reports whether a target name, or any part of it separated
+// by "/", ":" or ".", matches a production pattern
+func (a *Analyzer) isProduction(name string) bool {
+	name = strings.ToLower(name)
+	parts := append([]string{name}, strings.FieldsFunc(name, func(r rune) bool {
+		return r == '/' || r == ':' || r == '.'
+	})...)
+
+	for _, pattern := range a.productionPatterns {
+		pattern = strings.ToLower(pattern)
+		for _, part := range parts {
+			if ok, _ := path.Match(pattern, part); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// callTargets returns the environments a call of a tool acts on, from its
+// flags or else from env
+func callTargets(name string, args []string, env types.Environment) []types.Target {
+	var targets []types.Target
+	add := func(kind, value, fallback string) {
+		if value == "" {
+			value = fallback
+		}
+		if value != "" {
+			targets = append(targets, types.Target{Kind: kind, Name: value})
+		}
+	}
+
+	switch {
+	case name == "kubectl" || name == "oc" || name == "helm":
+		context, _ := flagValue(args, "--context", "--kube-context")
+		namespace, _ := flagValue(args, "-n", "--namespace")
+		add("kube context", context, env.KubeContext)
+		add("kube namespace", namespace, env.KubeNamespace)
+	case name == "aws":
+		profile, _ := flagValue(args, "--profile")
+		add("aws profile", profile, env.AWSProfile)
+	case name == "gcloud" || name == "gsutil" || name == "bq":
+		project, _ := flagValue(args, "--project")
+		add("gcloud project", project, env.GCloudProject)
+	case name == "terraform" || name == "tofu" || name == "terragrunt":
+		add("terraform workspace", "", env.TerraformWorkspace)
+	case databaseClients[name]:
+		add("db host", databaseHost(args), env.DBHost)
+	case name == "ssh" || name == "mosh" || name == "sftp":
+		if host := first(positionals(args, sshValueOpts)); host != "" {
+			add("ssh host", remoteHost(host), "")
+		}
+	case name == "scp" || name == "rsync":
+		for _, arg := range positionals(args, sshValueOpts) {
+			if host, _, ok := strings.Cut(arg, ":"); ok && host != "" && !strings.Contains(arg, "://") {
+				add("ssh host", remoteHost(host), "")
+			}
+		}
+	}
+	return targets
+}
+
+// databaseHost returns the host a database client connects to, from -h,
+// --host, a connection URI or a host= connection string
+func databaseHost(args []string) string {
+	if host, ok := flagValue(args, "-h", "--host"); ok && host != "" {
+		return host
+	}
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "-h") && len(arg) > 2:
+			return arg[2:] // mysql -hdb.example.com
+		case strings.Contains(arg, "://"):
+			if u, err := url.Parse(arg); err == nil && u.Hostname() != "" {
+				return u.Hostname()
+			}
+		case strings.Contains(arg, "host="):
+			for _, field := range strings.Fields(arg) {
+				if host, ok := strings.CutPrefix(field, "host="); ok {
+					return host
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// remoteHost strips the user from a user@host destination
+func remoteHost(destination string) string {
+	if i := strings.LastIndexByte(destination, '@'); i >= 0 {
+		return destination[i+1:]
+	}
+	return destination
+}
@@ -0,0 +1,143 @@
+// Package safety production environment tests
+package safety
+
+import (
+	"testing"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+var fixtureEnvironment = types.Environment{
+	KubeContext:        "prod-eu",
+	KubeNamespace:      "payments",
+	AWSProfile:         "sandbox",
+	GCloudProject:      "billing-prod",
+	TerraformWorkspace: "staging",
+	DBHost:             "localhost",
+}
+
+func TestAnalyze_Targets(t *testing.T) {
+	analyzer := NewAnalyzer(nil, nil)
+	analyzer.SetEnvironment(fixtureEnvironment, DefaultProductionPatterns, ProductionEscalate)
+
+	tests := []struct {
+		command string
+		targets []types.Target
+	}{
+		{"ls -la", nil},
+		{"kubectl get pods", []types.Target{
+			{Kind: "kube context", Name: "prod-eu", Production: true},
+			{Kind: "kube namespace", Name: "payments"},
+		}},
+		{"kubectl --context staging -n web get pods", []types.Target{
+			{Kind: "kube context", Name: "staging"},
+			{Kind: "kube namespace", Name: "web"},
+		}},
+		{"aws --profile prod s3 ls", []types.Target{{Kind: "aws profile", Name: "prod", Production: true}}},
+		{"aws s3 ls", []types.Target{{Kind: "aws profile", Name: "sandbox"}}},
+		{"gcloud compute instances list", []types.Target{{Kind: "gcloud project", Name: "billing-prod", Production: true}}},
+		{"terraform plan", []types.Target{{Kind: "terraform workspace", Name: "staging"}}},
+		{"psql -h prod-db.example.com app", []types.Target{{Kind: "db host", Name: "prod-db.example.com", Production: true}}},
+		{"psql postgres://app@db.prod.example.com/app", []types.Target{{Kind: "db host", Name: "db.prod.example.com", Production: true}}},
+		{`psql "host=replica-1 dbname=app"`, []types.Target{{Kind: "db host", Name: "replica-1"}}},
+		{"mysql -hdb-prod -u root", []types.Target{{Kind: "db host", Name: "db-prod", Production: true}}},
+		{"redis-cli", []types.Target{{Kind: "db host", Name: "localhost"}}},
+		{"ssh -p 2222 deploy@web-prod uptime", []types.Target{{Kind: "ssh host", Name: "web-prod", Production: true}}},
+		{"scp build.tar ops@api.prod.example.com:/tmp/", []types.Target{{Kind: "ssh host", Name: "api.prod.example.com", Production: true}}},
+		// The remote host has its own kube context
+		{"ssh bastion kubectl get pods", []types.Target{{Kind: "ssh host", Name: "bastion"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			analysis, err := analyzer.Analyze(tt.command)
+			if err != nil {
+				t.Fatalf("Analyze failed: %v", err)
+			}
+			if len(analysis.Targets) != len(tt.targets) {
+				t.Fatalf("Expected targets %v, got %v", tt.targets, analysis.Targets)
+			}
+			for i, target := range tt.targets {
+				if analysis.Targets[i] != target {
+					t.Errorf("Expected target %v, got %v", target, analysis.Targets[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAnalyze_ProductionActions(t *testing.T) {
+	tests := []struct {
+		action     string
+		command    string
+		risk       types.RiskLevel
+		typed      bool
+		production bool
+	}{
+		{ProductionEscalate, "kubectl get pods", types.RiskCaution, false, true},
+		{ProductionEscalate, "kubectl delete pod web-1", types.RiskDangerous, false, true},
+		{ProductionEscalate, "kubectl delete ns payments", types.RiskDangerous, false, true}, // never blocked by escalation
+		{ProductionEscalate, "kubectl --context staging delete pod web-1", types.RiskCaution, false, false},
+		{ProductionConfirm, "kubectl get pods", types.RiskSafe, true, true},
+		{ProductionConfirm, "aws s3 ls", types.RiskSafe, false, false},
+		{ProductionWarn, "kubectl delete pod web-1", types.RiskCaution, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.action+" "+tt.command, func(t *testing.T) {
+			analyzer := NewAnalyzer(nil, nil)
+			analyzer.SetEnvironment(fixtureEnvironment, DefaultProductionPatterns, tt.action)
+
+			analysis, err := analyzer.Analyze(tt.command)
+			if err != nil {
+				t.Fatalf("Analyze failed: %v", err)
+			}
+			if analysis.RiskLevel != tt.risk {
+				t.Errorf("Expected %v, got %v (%v)", tt.risk, analysis.RiskLevel, analysis.RiskReasons)
+			}
+			if analysis.RequiresTypedConfirm != tt.typed {
+				t.Errorf("Expected RequiresTypedConfirm=%v, got %v", tt.typed, analysis.RequiresTypedConfirm)
+			}
+			if containsReason(analysis.RiskReasons, "Targets production kube context prod-eu") != tt.production {
+				t.Errorf("Expected production reason=%v, got %v", tt.production, analysis.RiskReasons)
+			}
+		})
+	}
+}
+
+func TestIsProduction(t *testing.T) {
+	analyzer := NewAnalyzer(nil, nil)
+	analyzer.SetEnvironment(types.Environment{}, DefaultProductionPatterns, ProductionEscalate)
+
+	for name, production := range map[string]bool{
+		"prod":         true,
+		"Production":   true,
+		"eu-prod":      true,
+		"billing_prod": true,
+		"arn:aws:eks:eu-west-1:123456789012:cluster/prod-eu": true,
+		"db.prod.example.com":                                true,
+		"staging":                                            false,
+		"nonprod":                                            false,
+		"dev-eu":                                             false,
+	} {
+		if got := analyzer.isProduction(name); got != production {
+			t.Errorf("Expected isProduction(%q)=%v, got %v", name, production, got)
+		}
+	}
+}
+
+func TestPolicy_TypedConfirmForProduction(t *testing.T) {
+	analysis := &types.CommandAnalysis{RiskLevel: types.RiskSafe, RequiresTypedConfirm: true}
+
+	for _, level := range []string{"strict", "cautious", "moderate", "normal", "relaxed"} {
+		verdict := Policy{Level: level}.Decide(analysis, true)
+		if verdict.Decision != DecisionTypedConfirm {
+			t.Errorf("Expected %s to ask for typed confirmation, got %s", level, verdict.Decision)
+		}
+	}
+
+	analysis.RiskLevel = types.RiskDangerous
+	if verdict := (Policy{Level: "cautious"}).Decide(analysis, false); verdict.Decision != DecisionDryRunOnly {
+		t.Errorf("Expected a production target to keep dry-run-only, got %s", verdict.Decision)
+	}
+}
@@ -0,0 +1,165 @@
+// Package safety provides command safety analysis
+package safety
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// minCountLimit is the smallest number of files counted before giving up,
+// so the reported count is meaningful even with a low max_affected_files
+const minCountLimit = 10000
+
+// blockMultiplier blocks commands affecting this many times the configured maximum
+const blockMultiplier = 10
+
+// errCountLimit stops a walk once enough files have been counted
+var errCountLimit = errors.New("count limit reached")
+
+// SetWorkingDir sets the directory relative paths are resolved against.
+// Defaults to the process working directory.
+func (a *Analyzer) SetWorkingDir(dir string) {
+	a.workDir = dir
+}
+
+// workingDir returns the directory relative paths are resolved against
+func (a *Analyzer) workingDir() string {
+	if a.workDir != "" {
+		return a.workDir
+	}
+	cwd, _ := os.Getwd()
+	return cwd
+}
+
+// CheckAffectedFiles expands globs and directories for every path the command
+// modifies, records those paths, the real file count and total size on the analysis and
+// escalates when more than maxFiles files would be affected. Commands affecting
+// more than ten times maxFiles are escalated to critical. maxFiles <= 0 only counts.
+func (a *Analyzer) CheckAffectedFiles(analysis *types.CommandAnalysis, maxFiles int) {
+	prog, err := a.parser.Parse(strings.NewReader(analysis.Command), "")
+	if err != nil {
+		return
+	}
+
+	var targets []writeTarget
+	for _, target := range a.writeTargets(prog) {
+		if !target.unknownDir { // paths that cannot be resolved are not counted
+			targets = append(targets, target)
+		}
+	}
+	analysis.WritePaths = nil
+	for _, target := range targets {
+		analysis.WritePaths = append(analysis.WritePaths, target.path)
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	limit := maxFiles*blockMultiplier + 1
+	if limit < minCountLimit {
+		limit = minCountLimit
+	}
+
+	cwd := a.workingDir()
+	seen := make(map[string]bool)
+	analysis.AffectedFiles = nil
+	analysis.FileCount = 0
+	analysis.TotalBytes = 0
+	analysis.FileCountTruncated = false
+
+	for _, target := range targets {
+		for _, path := range expandTarget(target.path, cwd) {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+
+			info, err := os.Lstat(path)
+			if err != nil {
+				continue
+			}
+
+			fileInfo := types.FileInfo{Path: path, Size: info.Size(), IsDir: info.IsDir()}
+			if info.IsDir() {
+				count, size, truncated := countTree(path, limit-analysis.FileCount)
+				fileInfo.FileCount = count
+				fileInfo.Size = size
+				analysis.FileCountTruncated = analysis.FileCountTruncated || truncated
+				analysis.FileCount += count
+			} else {
+				analysis.FileCount++
+			}
+			analysis.TotalBytes += fileInfo.Size
+			analysis.AffectedFiles = append(analysis.AffectedFiles, fileInfo)
+
+			if analysis.FileCount >= limit {
+				analysis.FileCountTruncated = true
+				break
+			}
+		}
+		if analysis.FileCountTruncated {
+			break
+		}
+	}
+
+	if maxFiles <= 0 || analysis.FileCount <= maxFiles {
+		return
+	}
+
+	count := fmt.Sprintf("%d", analysis.FileCount)
+	if analysis.FileCountTruncated {
+		count = "more than " + count
+	}
+
+	if analysis.FileCount > maxFiles*blockMultiplier {
+		analysis.RiskLevel = types.RiskCritical
+		analysis.RiskReasons = append(analysis.RiskReasons,
+			fmt.Sprintf("Affects %s files, far above the limit of %d (max_affected_files)", count, maxFiles))
+		return
+	}
+
+	if analysis.RiskLevel < types.RiskDangerous {
+		analysis.RiskLevel = types.RiskDangerous
+	}
+	analysis.RequiresConfirmation = true
+	analysis.RiskReasons = append(analysis.RiskReasons,
+		fmt.Sprintf("Affects %s files, above the limit of %d (max_affected_files)", count, maxFiles))
+}
+
+// expandTarget resolves a target to the existing absolute paths it refers to
+func expandTarget(path, cwd string) []string {
+	path = expandHome(path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cwd, path)
+	}
+	path = filepath.Clean(path)
+
+	if strings.ContainsAny(path, "*?[") {
+		matches, _ := filepath.Glob(path)
+		return matches
+	}
+	return []string{path}
+}
+
+// countTree counts the files below dir and their total size, stopping after limit files
+func countTree(dir string, limit int) (count int, size int64, truncated bool) {
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		count++
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+		}
+		if count >= limit {
+			return errCountLimit
+		}
+		return nil
+	})
+	return count, size, errors.Is(err, errCountLimit)
+}
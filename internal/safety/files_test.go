@@ -0,0 +1,153 @@
+// Package safety tests
+package safety
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// makeFiles creates n files of size bytes named <prefix><i>.log in dir
+func makeFiles(t *testing.T, dir, prefix string, n, size int) {
+	t.Helper()
+	os.MkdirAll(dir, 0755)
+	for i := 0; i < n; i++ {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%s%d.log", prefix, i)), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCheckAffectedFiles_Counts(t *testing.T) {
+	work := t.TempDir()
+	makeFiles(t, work, "app", 3, 10)
+	makeFiles(t, filepath.Join(work, "cache", "nested"), "c", 4, 100)
+	os.WriteFile(filepath.Join(work, "keep.txt"), []byte("keep"), 0644)
+
+	analyzer := NewAnalyzer(nil, nil)
+	analyzer.SetWorkingDir(work)
+
+	tests := []struct {
+		name    string
+		command string
+		files   int
+		bytes   int64
+	}{
+		{"glob", "rm *.log", 3, 30},
+		{"directory", "rm -rf cache", 4, 400},
+		{"glob and directory", "rm -rf *.log cache", 7, 430},
+		{"duplicate paths", "rm app0.log app0.log", 1, 10},
+		{"missing path", "rm nothing.log", 0, 0},
+		{"read only", "cat *.log", 0, 0},
+		{"copy counts destination only", "cp keep.txt cache", 4, 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analysis, err := analyzer.Analyze(tt.command)
+			if err != nil {
+				t.Fatalf("Analyze failed: %v", err)
+			}
+			analyzer.CheckAffectedFiles(analysis, 100)
+
+			if analysis.FileCount != tt.files {
+				t.Errorf("FileCount = %d, want %d", analysis.FileCount, tt.files)
+			}
+			if analysis.TotalBytes != tt.bytes {
+				t.Errorf("TotalBytes = %d, want %d", analysis.TotalBytes, tt.bytes)
+			}
+		})
+	}
+}
+
+func TestCheckAffectedFiles_WritePaths(t *testing.T) {
+	analyzer := NewAnalyzer(nil, nil)
+	analyzer.SetWorkingDir(t.TempDir())
+
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"cp src.txt dst.txt", "dst.txt"},
+		{"sort < in.txt > out.txt", "out.txt"},
+		{"mv a.txt b.txt", "a.txt,b.txt"},
+		{"cat notes.txt", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			analysis, _ := analyzer.Analyze(tt.command)
+			analyzer.CheckAffectedFiles(analysis, 0)
+			if got := strings.Join(analysis.WritePaths, ","); got != tt.want {
+				t.Errorf("WritePaths = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckAffectedFiles_Threshold(t *testing.T) {
+	work := t.TempDir()
+	makeFiles(t, work, "f", 25, 1)
+
+	analyzer := NewAnalyzer(nil, nil)
+	analyzer.SetWorkingDir(work)
+
+	tests := []struct {
+		name         string
+		maxFiles     int
+		level        types.RiskLevel
+		confirmation bool
+	}{
+		{"under limit", 100, types.RiskCaution, false},
+		{"disabled", 0, types.RiskCaution, false},
+		{"above limit", 10, types.RiskDangerous, true},
+		{"far above limit", 2, types.RiskCritical, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analysis, _ := analyzer.Analyze("rm -f *.log")
+			analyzer.CheckAffectedFiles(analysis, tt.maxFiles)
+
+			if analysis.FileCount != 25 {
+				t.Errorf("FileCount = %d, want 25", analysis.FileCount)
+			}
+			if analysis.RiskLevel != tt.level {
+				t.Errorf("RiskLevel = %v, want %v (reasons: %v)", analysis.RiskLevel, tt.level, analysis.RiskReasons)
+			}
+			if analysis.RequiresConfirmation != tt.confirmation {
+				t.Errorf("RequiresConfirmation = %v, want %v", analysis.RequiresConfirmation, tt.confirmation)
+			}
+			if tt.level > types.RiskCaution {
+				found := false
+				for _, reason := range analysis.RiskReasons {
+					if strings.Contains(reason, "Affects 25 files") {
+						found = true
+					}
+				}
+				if !found {
+					t.Errorf("Expected reason naming the file count, got %v", analysis.RiskReasons)
+				}
+			}
+		})
+	}
+}
+
+func TestCountTree_Limit(t *testing.T) {
+	dir := t.TempDir()
+	makeFiles(t, dir, "f", 20, 1)
+
+	count, size, truncated := countTree(dir, 5)
+	if count != 5 || size != 5 || !truncated {
+		t.Errorf("countTree = %d, %d, %v; want 5, 5, true", count, size, truncated)
+	}
+
+	count, _, truncated = countTree(dir, 100)
+	if count != 20 || truncated {
+		t.Errorf("countTree = %d, %v; want 20, false", count, truncated)
+	}
+}
@@ -0,0 +1,307 @@
+// Package safety provides detection of the uncommitted git work a command discards
+package safety
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// CheckGitChanges records the uncommitted work in the git repository a
+// command runs in that the command would discard: changes reset by git
+// reset --hard, checkout or restore, files removed by git clean or rm,
+// and stashes dropped by git stash. Like CheckAffectedFiles it inspects
+// the working tree, so it is not part of Analyze.
+func (a *Analyzer) CheckGitChanges(analysis *types.CommandAnalysis) {
+	prog, err := a.parser.Parse(strings.NewReader(analysis.Command), "")
+	if err != nil {
+		return
+	}
+
+	cwd := a.workingDir()
+	var loss *types.GitLoss
+	a.walkNested(prog, nesting{}, func(node syntax.Node, nest nesting) {
+		call, ok := node.(*syntax.CallExpr)
+		if !ok || len(call.Args) == 0 || nest.remote {
+			return
+		}
+
+		words := callWords(call)
+		var found *types.GitLoss
+		switch filepath.Base(words[0]) {
+		case "git":
+			found = gitCallLoss(words[1:], cwd)
+		case "rm", "unlink", "shred":
+			found = removeLoss(words[1:], cwd)
+		}
+
+		switch {
+		case found == nil:
+		case loss == nil:
+			loss = found
+		case found.Repo == loss.Repo:
+			// Only the repository of the first discarding call is reported
+			loss.Changes = appendChanges(loss.Changes, found.Changes)
+			loss.Ignored = loss.Ignored || found.Ignored
+			if loss.Stash == "" {
+				loss.Stash = found.Stash
+			}
+		}
+	})
+	if loss == nil || len(loss.Changes) == 0 {
+		return
+	}
+
+	analysis.GitLoss = loss
+	analysis.RiskReasons = append(analysis.RiskReasons,
+		fmt.Sprintf("Discards uncommitted work in %s (%s)", loss.Repo, describeLoss(loss.Changes)))
+	if analysis.RiskLevel < types.RiskCaution {
+		analysis.RiskLevel = types.RiskCaution
+	}
+	analysis.Reversible = false
+}
+
+// gitCallLoss returns the uncommitted work one git call discards
+func gitCallLoss(args []string, cwd string) *types.GitLoss {
+	dir := cwd
+	for i := 0; i < len(args) && strings.HasPrefix(args[i], "-"); i++ {
+		if args[i] == "-C" && i+1 < len(args) {
+			dir = resolveDir(args[i+1], dir)
+		}
+		if gitValueFlags[args[i]] {
+			i++
+		}
+	}
+
+	sub, rest := subcommand(args, gitValueFlags)
+	switch sub {
+	case "reset", "checkout", "restore", "clean", "stash":
+	default:
+		return nil
+	}
+	root, err := gitRoot(dir)
+	if err != nil {
+		return nil
+	}
+	loss := &types.GitLoss{Repo: root}
+
+	switch sub {
+	case "reset":
+		if !hasFlag(rest, "--hard") {
+			return nil
+		}
+		loss.Changes = gitStatus(dir, nil, func(x, y byte) bool { return x != '?' })
+	case "checkout", "restore":
+		pathspecs, staged, ok := gitDiscardedPaths(sub, rest)
+		if !ok {
+			return nil
+		}
+		loss.Changes = gitStatus(dir, pathspecs, func(x, y byte) bool {
+			return x != '?' && (y != ' ' || staged)
+		})
+	case "clean":
+		if hasFlag(rest, "-n", "--dry-run") || !hasFlag(rest, "-f", "--force") {
+			return nil
+		}
+		loss.Changes = gitCleanLoss(dir, root, rest)
+		loss.Ignored = hasFlag(rest, "-x", "-X")
+	case "stash":
+		operands := positionals(rest, nil)
+		switch first(operands) {
+		case "drop":
+			ref := "stash@{0}"
+			if len(operands) > 1 {
+				ref = operands[1]
+			}
+			commit, err := runGit(dir, "rev-parse", "--verify", "--quiet", ref)
+			if err != nil {
+				return nil
+			}
+			loss.Stash = strings.TrimSpace(commit)
+			out, err := runGit(dir, "stash", "show", "--name-only", "--include-untracked", ref)
+			if err != nil {
+				out, _ = runGit(dir, "stash", "show", "--name-only", ref)
+			}
+			for _, path := range strings.Split(strings.TrimSpace(out), "\n") {
+				if path != "" {
+					loss.Changes = append(loss.Changes, types.GitChange{Status: "stash", Path: path})
+				}
+			}
+		case "clear":
+			out, _ := runGit(dir, "stash", "list")
+			for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+				if line != "" {
+					loss.Changes = append(loss.Changes, types.GitChange{Status: "stash", Path: line})
+				}
+			}
+		}
+	}
+	return loss
+}
+
+// gitCleanLoss returns the files git clean removes, from a dry run with
+// the same options
+func gitCleanLoss(dir, root string, args []string) []types.GitChange {
+	dryRun := []string{"clean", "--dry-run"}
+	for _, arg := range args {
+		switch {
+		case arg == "-f" || arg == "--force" || arg == "-i" || arg == "--interactive":
+		case isShortCluster(arg):
+			if flags := strings.NewReplacer("f", "", "i", "").Replace(arg[1:]); flags != "" {
+				dryRun = append(dryRun, "-"+flags)
+			}
+		default:
+			dryRun = append(dryRun, arg)
+		}
+	}
+
+	out, err := runGit(dir, dryRun...)
+	if err != nil {
+		return nil
+	}
+	var changes []types.GitChange
+	for _, line := range strings.Split(out, "\n") {
+		path, ok := strings.CutPrefix(line, "Would remove ")
+		if !ok {
+			continue
+		}
+		if rel, err := filepath.Rel(root, filepath.Join(dir, path)); err == nil {
+			path = filepath.ToSlash(rel)
+			if strings.HasSuffix(line, "/") {
+				path += "/"
+			}
+		}
+		changes = append(changes, types.GitChange{Status: "??", Path: path})
+	}
+	return changes
+}
+
+// removeLoss returns the untracked and modified files inside a repository
+// that an rm call deletes. Unmodified tracked files can be checked out again.
+func removeLoss(args []string, cwd string) *types.GitLoss {
+	var loss *types.GitLoss
+	for _, operand := range positionals(args, nil) {
+		for _, path := range expandTarget(operand, cwd) {
+			dir := path
+			if info, err := os.Stat(path); err != nil || !info.IsDir() {
+				dir = filepath.Dir(path)
+			}
+			root, err := gitRoot(dir)
+			if err != nil || loss != nil && root != loss.Repo {
+				continue
+			}
+			if loss == nil {
+				loss = &types.GitLoss{Repo: root}
+			}
+			loss.Changes = appendChanges(loss.Changes, gitStatus(root, []string{path}, func(x, y byte) bool {
+				return y != ' ' || x == '?'
+			}))
+		}
+	}
+	return loss
+}
+
+// gitStatus returns the changes in git status for pathspecs (all for none)
+// that keep returns true for, given the index and working tree status
+func gitStatus(dir string, pathspecs []string, keep func(x, y byte) bool) []types.GitChange {
+	args := append([]string{"status", "--porcelain", "-z", "--untracked-files=all", "--"}, pathspecs...)
+	out, err := runGit(dir, args...)
+	if err != nil {
+		return nil
+	}
+
+	var changes []types.GitChange
+	entries := strings.Split(out, "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		x, y := entry[0], entry[1]
+		if x == 'R' || x == 'C' {
+			i++ // the original path of a rename or copy follows
+		}
+		if keep(x, y) {
+			changes = append(changes, types.GitChange{Status: entry[:2], Path: entry[3:]})
+		}
+	}
+	return changes
+}
+
+// appendChanges appends the changes that are not in changes yet
+func appendChanges(changes, more []types.GitChange) []types.GitChange {
+	seen := make(map[types.GitChange]bool, len(changes))
+	for _, c := range changes {
+		seen[c] = true
+	}
+	for _, c := range more {
+		if !seen[c] {
+			seen[c] = true
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// describeLoss summarizes changes like "2 modified, 1 untracked"
+func describeLoss(changes []types.GitChange) string {
+	var modified, untracked, stashed int
+	for _, c := range changes {
+		switch c.Status {
+		case "stash":
+			stashed++
+		case "??", "!!":
+			untracked++
+		default:
+			modified++
+		}
+	}
+
+	var parts []string
+	for _, part := range []struct {
+		count int
+		label string
+	}{{modified, "modified"}, {untracked, "untracked"}, {stashed, "stashed"}} {
+		if part.count > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", part.count, part.label))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// gitRoot returns the top-level directory of the repository containing dir
+func gitRoot(dir string) (string, error) {
+	out, err := runGit(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// runGit runs a read-only git command in dir and returns its output
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_OPTIONAL_LOCKS=0", "LC_ALL=C")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// resolveDir resolves a directory argument against cwd
+func resolveDir(dir, cwd string) string {
+	dir = expandHome(dir)
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(cwd, dir)
+	}
+	return dir
+}
@@ -0,0 +1,159 @@
+// Package safety git working tree tests
+package safety
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// initRepo creates a repository with one commit of tracked.txt and
+// docs/guide.md, then modifies tracked.txt and adds untracked notes.txt
+func initRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir := t.TempDir()
+	files := map[string]string{"tracked.txt": "v1\n", "docs/guide.md": "guide\n"}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "init"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "tracked.txt"), []byte("v2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("draft\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resolve symlinks so paths compare with git's output
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestCheckGitChanges(t *testing.T) {
+	dir := initRepo(t)
+
+	tests := []struct {
+		command string
+		changes []types.GitChange
+	}{
+		{"git status", nil},
+		{"git reset --soft HEAD~1", nil},
+		{"git reset --hard", []types.GitChange{{Status: " M", Path: "tracked.txt"}}},
+		{"git checkout .", []types.GitChange{{Status: " M", Path: "tracked.txt"}}},
+		{"git checkout -- docs", nil},
+		{"git restore tracked.txt", []types.GitChange{{Status: " M", Path: "tracked.txt"}}},
+		{"git restore --staged tracked.txt", nil},
+		{"git clean -n", nil},
+		{"git clean -fd", []types.GitChange{{Status: "??", Path: "notes.txt"}}},
+		{"rm notes.txt docs/guide.md", []types.GitChange{{Status: "??", Path: "notes.txt"}}},
+		{"rm -rf .", []types.GitChange{{Status: " M", Path: "tracked.txt"}, {Status: "??", Path: "notes.txt"}}},
+		{"cd /tmp && git -C " + dir + " reset --hard", []types.GitChange{{Status: " M", Path: "tracked.txt"}}},
+		{"ssh host git reset --hard", nil},
+		{"git stash drop", nil},
+	}
+
+	analyzer := NewAnalyzer(nil, nil)
+	analyzer.SetWorkingDir(dir)
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			analysis, err := analyzer.Analyze(tt.command)
+			if err != nil {
+				t.Fatalf("Analyze failed: %v", err)
+			}
+			analyzer.CheckGitChanges(analysis)
+
+			if tt.changes == nil {
+				if analysis.GitLoss != nil {
+					t.Errorf("Expected no git loss, got %+v", analysis.GitLoss)
+				}
+				return
+			}
+			if analysis.GitLoss == nil {
+				t.Fatalf("Expected git loss %v, got none", tt.changes)
+			}
+			if analysis.GitLoss.Repo != dir {
+				t.Errorf("Expected repo %s, got %s", dir, analysis.GitLoss.Repo)
+			}
+			if len(analysis.GitLoss.Changes) != len(tt.changes) {
+				t.Fatalf("Expected changes %v, got %v", tt.changes, analysis.GitLoss.Changes)
+			}
+			for i, change := range tt.changes {
+				if analysis.GitLoss.Changes[i] != change {
+					t.Errorf("Expected change %v, got %v", change, analysis.GitLoss.Changes[i])
+				}
+			}
+			if analysis.RiskLevel < types.RiskCaution {
+				t.Errorf("Expected at least caution, got %v", analysis.RiskLevel)
+			}
+		})
+	}
+}
+
+func TestCheckGitChanges_StashDrop(t *testing.T) {
+	dir := initRepo(t)
+	if out, err := exec.Command("git", "-C", dir, "stash", "push", "-q", "--include-untracked").CombinedOutput(); err != nil {
+		t.Fatalf("git stash: %v\n%s", err, out)
+	}
+	commit, err := runGit(dir, "rev-parse", "stash@{0}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	analyzer := NewAnalyzer(nil, nil)
+	analyzer.SetWorkingDir(dir)
+	analysis, err := analyzer.Analyze("git stash drop")
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	analyzer.CheckGitChanges(analysis)
+
+	loss := analysis.GitLoss
+	if loss == nil {
+		t.Fatal("Expected the dropped stash to be reported")
+	}
+	if loss.Stash+"\n" != commit {
+		t.Errorf("Expected stash commit %s, got %s", commit, loss.Stash)
+	}
+	if describeLoss(loss.Changes) != "2 stashed" {
+		t.Errorf("Expected 2 stashed files, got %v", loss.Changes)
+	}
+}
+
+func TestCheckGitChanges_OutsideRepo(t *testing.T) {
+	analyzer := NewAnalyzer(nil, nil)
+	analyzer.SetWorkingDir(t.TempDir())
+
+	analysis, err := analyzer.Analyze("git reset --hard")
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	analyzer.CheckGitChanges(analysis)
+	if analysis.GitLoss != nil {
+		t.Errorf("Expected no git loss outside a repository, got %+v", analysis.GitLoss)
+	}
+}
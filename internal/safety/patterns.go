@@ -155,7 +155,30 @@ var dangerousPatterns = []DangerPattern{
 		Category:    "filesystem",
 	},
 	{
-		Pattern:     regexp.MustCompile(`git\s+push.*--force`),
+		Pattern:     regexp.MustCompile(`history\s+-c|>\s*~/\.(bash_history|zsh_history)`),
+		Description: "Clear command history",
+		RiskLevel:   types.RiskCaution,
+		Category:    "system",
+	},
+	{
+		Pattern:     regexp.MustCompile(`truncate\s+`),
+		Description: "Truncate file (data loss)",
+		RiskLevel:   types.RiskCaution,
+		Category:    "filesystem",
+	},
+	{
+		Pattern:     regexp.MustCompile(`shred\s+`),
+		Description: "Secure delete (unrecoverable)",
+		RiskLevel:   types.RiskCaution,
+		Category:    "filesystem",
+	},
+}
+
+// fallbackPatterns cover tools whose analyzers need a parsed command. They
+// only apply to commands that do not parse, which the analyzers never see.
+var fallbackPatterns = []DangerPattern{
+	{
+		Pattern:     regexp.MustCompile(`git\s+push.*(--force|\s-f\b)`),
 		Description: "Force push can overwrite history",
 		RiskLevel:   types.RiskCaution,
 		Category:    "git",
@@ -179,29 +202,11 @@ var dangerousPatterns = []DangerPattern{
 		Category:    "docker",
 	},
 	{
-		Pattern:     regexp.MustCompile(`brew\s+uninstall|apt\s+remove|yum\s+remove`),
+		Pattern:     regexp.MustCompile(`brew\s+uninstall|apt(-get)?\s+(remove|purge)|(yum|dnf)\s+remove`),
 		Description: "Package removal",
 		RiskLevel:   types.RiskCaution,
 		Category:    "packages",
 	},
-	{
-		Pattern:     regexp.MustCompile(`history\s+-c|>\s*~/\.(bash_history|zsh_history)`),
-		Description: "Clear command history",
-		RiskLevel:   types.RiskCaution,
-		Category:    "system",
-	},
-	{
-		Pattern:     regexp.MustCompile(`truncate\s+`),
-		Description: "Truncate file (data loss)",
-		RiskLevel:   types.RiskCaution,
-		Category:    "filesystem",
-	},
-	{
-		Pattern:     regexp.MustCompile(`shred\s+`),
-		Description: "Secure delete (unrecoverable)",
-		RiskLevel:   types.RiskCaution,
-		Category:    "filesystem",
-	},
 }
 
 // GetDangerousPatterns returns all dangerous patterns
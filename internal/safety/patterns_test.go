@@ -268,3 +268,56 @@ func TestDangerPattern_StructFields(t *testing.T) {
 		t.Errorf("Expected Category 'test', got '%s'", pattern.Category)
 	}
 }
+
+func TestFallbackPatterns_Unparseable(t *testing.T) {
+	analyzer := NewAnalyzer(nil, nil)
+
+	tests := []struct {
+		command string
+		reason  string
+	}{
+		{`git reset --hard && echo "done`, "Hard reset discards changes"},
+		{`git push --force origin main; echo 'pushed`, "Force push can overwrite history"},
+		{`docker rm -f web $(`, "Force remove container"},
+		{`docker system prune -af; echo "pruned`, "Remove all unused Docker data"},
+		{`sudo apt-get purge nginx && echo "gone`, "Package removal"},
+		{`brew uninstall wget "`, "Package removal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			analysis, _ := analyzer.Analyze(tt.command)
+			if analysis.RiskLevel < types.RiskCaution {
+				t.Errorf("Expected at least CAUTION, got %v", analysis.RiskLevel)
+			}
+			if !containsReason(analysis.RiskReasons, tt.reason) {
+				t.Errorf("Expected reason %q, got %v", tt.reason, analysis.RiskReasons)
+			}
+			if !containsPattern(analyzer.MatchPatterns(tt.command), tt.reason) {
+				t.Errorf("Expected MatchPatterns to list %q", tt.reason)
+			}
+		})
+	}
+}
+
+func TestFallbackPatterns_ParsedCommands(t *testing.T) {
+	analyzer := NewAnalyzer(nil, nil)
+
+	// Parsed commands are left to the tool analyzers
+	analysis, _ := analyzer.Analyze("git reset --hard")
+	if containsReason(analysis.RiskReasons, "Hard reset discards changes") {
+		t.Errorf("Expected no fallback pattern for a parsed command, got %v", analysis.RiskReasons)
+	}
+	if containsPattern(analyzer.MatchPatterns("git reset --hard"), "Hard reset discards changes") {
+		t.Error("Expected MatchPatterns to skip fallback patterns for a parsed command")
+	}
+}
+
+func containsPattern(patterns []DangerPattern, description string) bool {
+	for _, p := range patterns {
+		if p.Description == description {
+			return true
+		}
+	}
+	return false
+}
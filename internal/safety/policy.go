@@ -0,0 +1,161 @@
+// Package safety provides the execution policy applied to analyzed commands
+package safety
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// Decision is what may be done with an analyzed command
+type Decision int
+
+const (
+	DecisionAllow        Decision = iota // run without asking when running unprompted was requested
+	DecisionConfirm                      // ask before running
+	DecisionTypedConfirm                 // ask to type the risk level before running
+	DecisionDryRunOnly                   // only simulate
+	DecisionBlock                        // never run
+)
+
+func (d Decision) String() string {
+	switch d {
+	case DecisionAllow:
+		return "allow"
+	case DecisionConfirm:
+		return "confirm"
+	case DecisionTypedConfirm:
+		return "typed-confirm"
+	case DecisionDryRunOnly:
+		return "dry-run-only"
+	case DecisionBlock:
+		return "block"
+	default:
+		return "unknown"
+	}
+}
+
+// Verdict is the decision for a command and why it was taken
+type Verdict struct {
+	Decision Decision
+	Reason   string // empty for commands allowed to run
+}
+
+// Runs reports whether the command may run without asking
+func (v Verdict) Runs() bool {
+	return v.Decision == DecisionAllow
+}
+
+// levelDecisions are the decisions of each safety level for SAFE, CAUTION,
+// DANGEROUS and CRITICAL commands. Critical commands are always blocked.
+var levelDecisions = map[string][4]Decision{
+	"strict":     {DecisionConfirm, DecisionTypedConfirm, DecisionDryRunOnly, DecisionBlock},
+	"cautious":   {DecisionAllow, DecisionConfirm, DecisionDryRunOnly, DecisionBlock},
+	"moderate":   {DecisionAllow, DecisionConfirm, DecisionTypedConfirm, DecisionBlock},
+	"normal":     {DecisionAllow, DecisionAllow, DecisionConfirm, DecisionBlock},
+	"relaxed":    {DecisionAllow, DecisionAllow, DecisionAllow, DecisionBlock},
+	"permissive": {DecisionAllow, DecisionAllow, DecisionAllow, DecisionBlock},
+	"dangerous":  {DecisionAllow, DecisionAllow, DecisionAllow, DecisionBlock},
+}
+
+// DefaultLevel is used when the safety level is not set or unknown
+const DefaultLevel = "cautious"
+
+// Policy decides what may be done with analyzed commands, from the safety
+// settings. Every execution path consults it, so that a command gets the
+// same treatment in one-shot mode, chat sessions and tool calls.
+type Policy struct {
+	Level               string // strict, cautious, moderate, normal, relaxed or dangerous
+	ConfirmThreshold    string // risks at or above always ask; "" or none leaves it to the level
+	RequireConfirmation bool   // ask even for allowed commands unless running unprompted was requested
+	DryRunDefault       bool   // simulate every command that is not blocked
+	MaxAffectedFiles    int    // affected files above which commands always ask; 0 for no limit
+}
+
+// Decide returns the verdict for an analyzed command. auto is set when
+// running commands unprompted was requested, by --auto, auto_execute_safe
+// or a client with no one to ask.
+func (p Policy) Decide(analysis *types.CommandAnalysis, auto bool) Verdict {
+	level := p.level()
+	risk := analysis.RiskLevel
+	if risk < types.RiskSafe || risk > types.RiskCritical {
+		risk = types.RiskCritical
+	}
+
+	decision := levelDecisions[level][risk]
+	switch {
+	case decision == DecisionBlock:
+		return Verdict{DecisionBlock, withReasons("critical risk", analysis)}
+	case p.DryRunDefault:
+		// Checked before anything that asks, so riskier commands cannot
+		// escape the simulation through a confirmation prompt
+		return Verdict{DecisionDryRunOnly, withReasons("dry_run_default is on", analysis)}
+	}
+
+	var reason string
+	switch decision {
+	case DecisionDryRunOnly:
+		return Verdict{DecisionDryRunOnly, withReasons(fmt.Sprintf("safety level %s only simulates %s commands", level, risk), analysis)}
+	case DecisionTypedConfirm:
+		reason = fmt.Sprintf("safety level %s asks to type the risk level of %s commands", level, risk)
+	case DecisionConfirm:
+		reason = fmt.Sprintf("%s risk is above what safety level %s runs without confirmation", risk, level)
+		if level == "strict" {
+			reason = "safety level strict confirms every command"
+		}
+	}
+	if analysis.RequiresTypedConfirm && decision < DecisionTypedConfirm {
+		return Verdict{DecisionTypedConfirm, withReasons("the command targets a production environment", analysis)}
+	}
+	if decision != DecisionAllow {
+		return Verdict{decision, withReasons(reason, analysis)}
+	}
+
+	// Allowed by the level; the other settings can still ask
+	switch {
+	case p.MaxAffectedFiles > 0 && analysis.FileCount > p.MaxAffectedFiles:
+		return Verdict{DecisionConfirm, fmt.Sprintf("affects %d files, above the limit of %d (max_affected_files)", analysis.FileCount, p.MaxAffectedFiles)}
+	case analysis.RequiresConfirmation:
+		return Verdict{DecisionConfirm, "a safety rule requires interactive confirmation"}
+	case p.threshold() <= risk:
+		return Verdict{DecisionConfirm, fmt.Sprintf("%s risk is at or above confirm_threshold %s", risk, strings.ToLower(p.ConfirmThreshold))}
+	case !auto && p.RequireConfirmation:
+		return Verdict{DecisionConfirm, "require_confirmation is on"}
+	}
+	return Verdict{Decision: DecisionAllow}
+}
+
+// level returns the normalized safety level
+func (p Policy) level() string {
+	level := strings.ToLower(strings.TrimSpace(p.Level))
+	if _, ok := levelDecisions[level]; !ok {
+		return DefaultLevel
+	}
+	return level
+}
+
+// threshold returns the lowest risk that always asks, above critical when
+// no threshold is set
+func (p Policy) threshold() types.RiskLevel {
+	switch strings.ToLower(p.ConfirmThreshold) {
+	case "safe":
+		return types.RiskSafe
+	case "caution":
+		return types.RiskCaution
+	case "dangerous":
+		return types.RiskDangerous
+	case "critical":
+		return types.RiskCritical
+	default:
+		return types.RiskCritical + 1
+	}
+}
+
+// withReasons appends the analysis' risk reasons to a reason
+func withReasons(reason string, analysis *types.CommandAnalysis) string {
+	if len(analysis.RiskReasons) > 0 {
+		reason += ": " + strings.Join(analysis.RiskReasons, "; ")
+	}
+	return reason
+}
@@ -0,0 +1,109 @@
+// Package safety execution policy tests
+package safety
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+func TestPolicy_Levels(t *testing.T) {
+	const (
+		allow  = DecisionAllow
+		ask    = DecisionConfirm
+		typed  = DecisionTypedConfirm
+		dryRun = DecisionDryRunOnly
+		block  = DecisionBlock
+	)
+
+	tests := []struct {
+		level string
+		want  [4]Decision // SAFE, CAUTION, DANGEROUS, CRITICAL
+	}{
+		{"strict", [4]Decision{ask, typed, dryRun, block}},
+		{"cautious", [4]Decision{allow, ask, dryRun, block}},
+		{"moderate", [4]Decision{allow, ask, typed, block}},
+		{"normal", [4]Decision{allow, allow, ask, block}},
+		{"relaxed", [4]Decision{allow, allow, allow, block}},
+		{"permissive", [4]Decision{allow, allow, allow, block}},
+		{"dangerous", [4]Decision{allow, allow, allow, block}},
+		{"", [4]Decision{allow, ask, dryRun, block}},
+		{"Moderate", [4]Decision{allow, ask, typed, block}},
+		{"unknown", [4]Decision{allow, ask, dryRun, block}},
+	}
+
+	for _, tt := range tests {
+		policy := Policy{Level: tt.level}
+		for risk, want := range tt.want {
+			analysis := &types.CommandAnalysis{RiskLevel: types.RiskLevel(risk)}
+			verdict := policy.Decide(analysis, true)
+			if verdict.Decision != want {
+				t.Errorf("level %q, %s: got %s, want %s", tt.level, types.RiskLevel(risk), verdict.Decision, want)
+			}
+			if (verdict.Reason == "") != (want == allow) {
+				t.Errorf("level %q, %s: unexpected reason %q", tt.level, types.RiskLevel(risk), verdict.Reason)
+			}
+		}
+	}
+}
+
+func TestPolicy_DryRunDefault(t *testing.T) {
+	for level := range levelDecisions {
+		policy := Policy{Level: level, DryRunDefault: true, RequireConfirmation: true}
+		for _, risk := range []types.RiskLevel{types.RiskSafe, types.RiskCaution, types.RiskDangerous, types.RiskCritical} {
+			want := DecisionDryRunOnly
+			if risk == types.RiskCritical {
+				want = DecisionBlock
+			}
+			for _, auto := range []bool{false, true} {
+				verdict := policy.Decide(&types.CommandAnalysis{RiskLevel: risk}, auto)
+				if verdict.Decision != want {
+					t.Errorf("level %s, %s, auto=%v: got %s, want %s (%s)", level, risk, auto, verdict.Decision, want, verdict.Reason)
+				}
+			}
+		}
+	}
+}
+
+func TestPolicy_Settings(t *testing.T) {
+	safe := &types.CommandAnalysis{RiskLevel: types.RiskSafe}
+	caution := &types.CommandAnalysis{RiskLevel: types.RiskCaution}
+
+	tests := []struct {
+		name     string
+		policy   Policy
+		analysis *types.CommandAnalysis
+		auto     bool
+		want     Decision
+		reason   string
+	}{
+		{"require confirmation", Policy{Level: "normal", RequireConfirmation: true}, caution, false, DecisionConfirm, "require_confirmation"},
+		{"require confirmation with auto", Policy{Level: "normal", RequireConfirmation: true}, caution, true, DecisionAllow, ""},
+		{"threshold", Policy{Level: "normal", ConfirmThreshold: "caution"}, caution, true, DecisionConfirm, "confirm_threshold caution"},
+		{"threshold below risk", Policy{Level: "normal", ConfirmThreshold: "dangerous"}, caution, true, DecisionAllow, ""},
+		{"threshold none", Policy{Level: "normal", ConfirmThreshold: "none"}, caution, true, DecisionAllow, ""},
+		{"threshold safe", Policy{Level: "relaxed", ConfirmThreshold: "safe"}, safe, true, DecisionConfirm, "confirm_threshold safe"},
+		{"threshold cannot loosen", Policy{Level: "moderate", ConfirmThreshold: "critical"}, caution, true, DecisionConfirm, "safety level moderate"},
+		{"dry run default", Policy{Level: "moderate", DryRunDefault: true}, safe, true, DecisionDryRunOnly, "dry_run_default"},
+		{"dry run default before confirmation", Policy{Level: "moderate", DryRunDefault: true, RequireConfirmation: true}, safe, false, DecisionDryRunOnly, "dry_run_default"},
+		{"dry run default before threshold", Policy{Level: "normal", DryRunDefault: true, ConfirmThreshold: "caution"}, caution, true, DecisionDryRunOnly, "dry_run_default"},
+		{"dry run default before production", Policy{Level: "relaxed", DryRunDefault: true}, &types.CommandAnalysis{RiskLevel: types.RiskSafe, RequiresTypedConfirm: true}, true, DecisionDryRunOnly, "dry_run_default"},
+		{"rule requires confirmation", Policy{Level: "relaxed"}, &types.CommandAnalysis{RiskLevel: types.RiskSafe, RequiresConfirmation: true}, true, DecisionConfirm, "safety rule"},
+		{"too many files", Policy{Level: "relaxed", MaxAffectedFiles: 10}, &types.CommandAnalysis{RiskLevel: types.RiskDangerous, FileCount: 11}, true, DecisionConfirm, "max_affected_files"},
+		{"critical reasons", Policy{Level: "dangerous"}, &types.CommandAnalysis{RiskLevel: types.RiskCritical, RiskReasons: []string{"Deletes root"}}, true, DecisionBlock, "critical risk: Deletes root"},
+	}
+
+	for _, tt := range tests {
+		verdict := tt.policy.Decide(tt.analysis, tt.auto)
+		if verdict.Decision != tt.want {
+			t.Errorf("%s: got %s, want %s (%s)", tt.name, verdict.Decision, tt.want, verdict.Reason)
+		}
+		if !strings.Contains(verdict.Reason, tt.reason) {
+			t.Errorf("%s: expected %q in reason %q", tt.name, tt.reason, verdict.Reason)
+		}
+		if verdict.Runs() != (tt.want == DecisionAllow) {
+			t.Errorf("%s: Runs() = %v", tt.name, verdict.Runs())
+		}
+	}
+}
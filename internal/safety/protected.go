@@ -0,0 +1,484 @@
+// Package safety provides command safety analysis
+package safety
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// writeTarget is a path a command writes to, deletes, moves or changes permissions on
+type writeTarget struct {
+	path string
+	// ancestors is true when the operation also affects everything below the path
+	// (deleting or moving a directory), so protected paths inside it are touched too
+	ancestors bool
+	// unknownDir is true for a relative path after a cd to a directory that
+	// is only known at run time, so the path cannot be resolved
+	unknownDir bool
+}
+
+// SetProtectedPaths sets the paths that must never be modified.
+// "~" and "$HOME" are expanded; "/" protects only the root directory itself.
+func (a *Analyzer) SetProtectedPaths(paths []string) {
+	a.protectedPaths = paths
+}
+
+// checkProtectedPaths escalates to critical when a write touches a protected subtree
+func (a *Analyzer) checkProtectedPaths(prog *syntax.File, analysis *types.CommandAnalysis) {
+	if len(a.protectedPaths) == 0 {
+		return
+	}
+
+	cwd := a.workingDir()
+	protected := make([]string, 0, len(a.protectedPaths))
+	for _, p := range a.protectedPaths {
+		if p = expandHome(p); p != "" {
+			protected = append(protected, filepath.Clean(p))
+		}
+	}
+
+	reported := make(map[string]bool)
+	for _, target := range a.writeTargets(prog) {
+		if target.unknownDir {
+			// The directory may well be protected
+			if reported[target.path] {
+				continue
+			}
+			reported[target.path] = true
+			if analysis.RiskLevel < types.RiskDangerous {
+				analysis.RiskLevel = types.RiskDangerous
+			}
+			analysis.RequiresConfirmation = true
+			analysis.Reversible = false
+			analysis.RiskReasons = append(analysis.RiskReasons,
+				"Modifies '"+target.path+"' after cd to a directory only known at run time, which may be protected")
+			continue
+		}
+		for _, resolved := range resolvePaths(target.path, cwd) {
+			for _, p := range protected {
+				if !touchesProtected(resolved, p, target.ancestors) {
+					continue
+				}
+				if reported[resolved] {
+					break
+				}
+				reported[resolved] = true
+				analysis.RiskLevel = types.RiskCritical
+				analysis.Reversible = false
+				reason := "Modifies protected path '" + resolved + "'"
+				if resolved != p {
+					reason += " (protected: " + p + ")"
+				}
+				analysis.RiskReasons = append(analysis.RiskReasons, reason)
+				break
+			}
+		}
+	}
+}
+
+// CredentialPaths hold keys and tokens. Reading them is confirmed like
+// reading a protected path, since the contents are sent to the model.
+var CredentialPaths = []string{
+	"~/.ssh",
+	"~/.aws",
+	"~/.azure",
+	"~/.gnupg",
+	"~/.kube",
+	"~/.docker/config.json",
+	"~/.config/gcloud",
+	"~/.config/gh",
+	"~/.netrc",
+	"~/.pgpass",
+	"~/.git-credentials",
+	"/etc/shadow",
+	"/etc/gshadow",
+	"/etc/sudoers",
+}
+
+// CheckSensitiveRead requires confirmation for reading a path inside the
+// protected paths or CredentialPaths, as agent tools do to hand the
+// contents to the model
+func (a *Analyzer) CheckSensitiveRead(analysis *types.CommandAnalysis, path string) {
+	if path == "" {
+		return
+	}
+
+	for _, resolved := range resolvePaths(path, a.workingDir()) {
+		for _, p := range append(append([]string{}, a.protectedPaths...), CredentialPaths...) {
+			if p = expandHome(p); p == "" || !touchesProtected(resolved, filepath.Clean(p), false) {
+				continue
+			}
+			if analysis.RiskLevel < types.RiskCaution {
+				analysis.RiskLevel = types.RiskCaution
+			}
+			analysis.RequiresConfirmation = true
+			analysis.RiskReasons = append(analysis.RiskReasons, "Reads sensitive path '"+resolved+"'")
+			return
+		}
+	}
+}
+
+// writeTargets collects every path the command would modify. Relative
+// paths after a cd are made absolute, or marked unknownDir when the cd
+// goes to a directory only known at run time. A cd is assumed to last
+// until the end of the command, even when it runs in a subshell.
+func (a *Analyzer) writeTargets(prog *syntax.File) []writeTarget {
+	var targets []writeTarget
+	dir, unknownDir := "", false // set by the last cd
+
+	add := func(target writeTarget) {
+		if !filepath.IsAbs(expandHome(target.path)) {
+			switch {
+			case unknownDir:
+				target.unknownDir = true
+			case dir != "":
+				target.path = filepath.Join(dir, target.path)
+			}
+		}
+		targets = append(targets, target)
+	}
+
+	a.walkNested(prog, nesting{}, func(node syntax.Node, nest nesting) {
+		if nest.remote {
+			return // paths on another host
+		}
+		switch n := node.(type) {
+		case *syntax.Redirect:
+			switch n.Op {
+			case syntax.RdrOut, syntax.AppOut, syntax.RdrAll, syntax.AppAll, syntax.ClbOut, syntax.RdrInOut:
+				if path := wordPath(n.Word); path != "" {
+					add(writeTarget{path: path})
+				}
+			}
+		case *syntax.CallExpr:
+			if next, ok := changedDir(n.Args); ok {
+				switch {
+				case next == "":
+					unknownDir = true
+				case filepath.IsAbs(next):
+					dir, unknownDir = next, false
+				case !unknownDir:
+					if dir == "" {
+						dir = a.workingDir()
+					}
+					dir = filepath.Join(dir, next)
+				}
+				return
+			}
+			for _, target := range callWriteTargets(n.Args) {
+				add(target)
+			}
+		}
+	})
+
+	return targets
+}
+
+// changedDir returns the directory a cd, pushd or popd call changes to, with
+// ~ expanded, and whether the call changes directory at all. The directory
+// is "" when it is only known at run time.
+func changedDir(args []*syntax.Word) (string, bool) {
+	if len(args) == 0 {
+		return "", false
+	}
+	switch wordPath(args[0]) {
+	case "cd", "pushd":
+	case "popd":
+		return "", true
+	default:
+		return "", false
+	}
+
+	for _, arg := range args[1:] {
+		path := wordPath(arg)
+		switch {
+		case path == "-P" || path == "-L" || path == "-e" || path == "-@" || path == "--":
+			continue
+		case path == "" || path == "-" || strings.HasPrefix(path, "+") || strings.ContainsAny(path, "*?["):
+			return "", true
+		}
+		return expandHome(path), true
+	}
+	return expandHome("~"), true
+}
+
+// callWriteTargets returns the paths a single command call modifies
+func callWriteTargets(args []*syntax.Word) []writeTarget {
+	var words []string
+	for _, arg := range args {
+		words = append(words, wordPath(arg))
+	}
+
+	// Commands run by wrappers such as sudo are unwrapped by the caller
+	if len(words) == 0 {
+		return nil
+	}
+
+	cmdName := filepath.Base(words[0])
+	var operands []string
+	for _, w := range words[1:] {
+		if w != "" && !strings.HasPrefix(w, "-") {
+			operands = append(operands, w)
+		}
+	}
+
+	var targets []writeTarget
+	add := func(paths []string, ancestors bool) {
+		for _, p := range paths {
+			targets = append(targets, writeTarget{path: p, ancestors: ancestors})
+		}
+	}
+
+	switch cmdName {
+	case "rm", "rmdir", "unlink", "shred":
+		add(operands, true)
+	case "mv":
+		add(operands, true)
+		if dir, ok := targetDirectory(words[1:]); ok {
+			add([]string{dir}, false)
+		}
+	case "cp", "ln", "install", "rsync":
+		// Only the destination is written, the last operand unless -t names it
+		if dir, ok := targetDirectory(words[1:]); ok {
+			add([]string{dir}, false)
+		} else if len(operands) > 1 {
+			add(operands[len(operands)-1:], false)
+		}
+	case "chmod", "chown", "chgrp":
+		// The first operand is the mode or owner; -R changes everything below
+		if len(operands) > 1 {
+			add(operands[1:], hasFlag(words[1:], "-R", "--recursive"))
+		}
+	case "sed", "perl":
+		add(inPlaceFiles(cmdName, words[1:]), false)
+	case "touch", "truncate", "mkdir", "tee":
+		add(operands, false)
+	case "find":
+		if containsWord(words, "-delete") {
+			add(findRoots(words), true)
+		}
+	case "dd":
+		for _, w := range words[1:] {
+			if strings.HasPrefix(w, "of=") {
+				add([]string{strings.TrimPrefix(w, "of=")}, false)
+			}
+		}
+	}
+
+	return targets
+}
+
+// targetDirectory returns the directory given by -t or --target-directory,
+// which cp, mv, ln and install write into instead of the last operand
+func targetDirectory(args []string) (string, bool) {
+	if dir, ok := flagValue(args, "-t", "--target-directory"); ok {
+		return dir, dir != ""
+	}
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if strings.HasPrefix(arg, "-t") && len(arg) > 2 {
+			return arg[2:], true
+		}
+	}
+	return "", false
+}
+
+// inPlaceFiles returns the files sed -i or perl -i edit in place, or nil
+// when the call does not edit in place. Without -e or -f the first operand
+// is the script.
+func inPlaceFiles(cmdName string, args []string) []string {
+	scriptFlags := "ef"
+	if cmdName == "perl" {
+		scriptFlags = "eE"
+	}
+
+	inPlace, scripted := false, false
+	var operands []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			operands = append(operands, args[i+1:]...)
+			i = len(args)
+		case arg == "--in-place" || strings.HasPrefix(arg, "--in-place="):
+			inPlace = true
+		case arg == "--expression" || arg == "--file":
+			scripted = true
+			i++
+		case strings.HasPrefix(arg, "--expression=") || strings.HasPrefix(arg, "--file="):
+			scripted = true
+		case strings.HasPrefix(arg, "-") && len(arg) > 1 && !strings.HasPrefix(arg, "--"):
+			// A cluster like -pi.bak or -ne: -i takes the rest as a backup
+			// suffix, a script flag the rest or the next argument
+			for j := 1; j < len(arg); j++ {
+				if arg[j] == 'i' {
+					inPlace = true
+					break
+				}
+				if strings.IndexByte(scriptFlags, arg[j]) >= 0 {
+					scripted = true
+					if j == len(arg)-1 {
+						i++
+					}
+					break
+				}
+			}
+		default:
+			operands = append(operands, arg)
+		}
+	}
+	if !inPlace {
+		return nil
+	}
+	if !scripted && len(operands) > 0 {
+		operands = operands[1:]
+	}
+
+	var files []string
+	for _, operand := range operands {
+		if operand != "" {
+			files = append(files, operand)
+		}
+	}
+	return files
+}
+
+// wordPath renders a word as a path, expanding $HOME and other environment
+// variables. Returns "" when the word contains parts that cannot be resolved
+// statically, such as command substitutions.
+func wordPath(word *syntax.Word) string {
+	if word == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	if !writeWordParts(&b, word.Parts) {
+		return ""
+	}
+	return b.String()
+}
+
+// writeWordParts appends the static value of word parts to b
+func writeWordParts(b *strings.Builder, parts []syntax.WordPart) bool {
+	for _, part := range parts {
+		switch p := part.(type) {
+		case *syntax.Lit:
+			b.WriteString(p.Value)
+		case *syntax.SglQuoted:
+			b.WriteString(p.Value)
+		case *syntax.DblQuoted:
+			if !writeWordParts(b, p.Parts) {
+				return false
+			}
+		case *syntax.ParamExp:
+			if p.Param == nil || p.Exp != nil || p.Slice != nil || p.Repl != nil || p.Length {
+				return false
+			}
+			value, ok := os.LookupEnv(p.Param.Value)
+			if !ok {
+				return false
+			}
+			b.WriteString(value)
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// expandHome expands a leading ~ or $HOME
+func expandHome(path string) string {
+	home, _ := os.UserHomeDir()
+	switch {
+	case path == "~" || path == "$HOME":
+		return home
+	case strings.HasPrefix(path, "~/"):
+		return filepath.Join(home, path[2:])
+	case strings.HasPrefix(path, "$HOME/"):
+		return filepath.Join(home, path[6:])
+	}
+	return path
+}
+
+// resolvePaths turns a target into absolute paths: the literal path, any glob
+// matches, and the symlink-resolved location of each
+func resolvePaths(path, cwd string) []string {
+	path = expandHome(path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cwd, path)
+	}
+	path = filepath.Clean(path)
+
+	candidates := []string{path}
+	if strings.ContainsAny(path, "*?[") {
+		matches, _ := filepath.Glob(path)
+		candidates = append(candidates, matches...)
+	}
+
+	seen := make(map[string]bool)
+	var result []string
+	for _, c := range candidates {
+		for _, r := range []string{c, resolveSymlinks(c)} {
+			if r != "" && !seen[r] {
+				seen[r] = true
+				result = append(result, r)
+			}
+		}
+	}
+	return result
+}
+
+// resolveSymlinks follows symlinks in path. When the path does not exist yet,
+// its parent directory is resolved instead.
+func resolveSymlinks(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	if parent, err := filepath.EvalSymlinks(filepath.Dir(path)); err == nil {
+		return filepath.Join(parent, filepath.Base(path))
+	}
+	return ""
+}
+
+// touchesProtected reports whether modifying path affects the protected path
+func touchesProtected(path, protected string, ancestors bool) bool {
+	candidates := []string{protected}
+	if resolved, err := filepath.EvalSymlinks(protected); err == nil && resolved != protected {
+		candidates = append(candidates, resolved)
+	}
+
+	for _, p := range candidates {
+		// The root directory only protects itself, otherwise every path would match
+		if p == string(filepath.Separator) {
+			if path == p {
+				return true
+			}
+			continue
+		}
+		if isWithin(path, p) {
+			return true
+		}
+		if ancestors && isWithin(p, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// isWithin reports whether path equals dir or lies below it
+func isWithin(path, dir string) bool {
+	if path == dir {
+		return true
+	}
+	if dir == string(filepath.Separator) {
+		return true
+	}
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
@@ -0,0 +1,210 @@
+// Package safety tests
+package safety
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+func TestCheckProtectedPaths(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	os.MkdirAll(filepath.Join(home, ".ssh"), 0700)
+	os.WriteFile(filepath.Join(home, ".ssh", "id_rsa"), []byte("key"), 0600)
+	os.WriteFile(filepath.Join(home, ".ssh", "config"), []byte("cfg"), 0600)
+
+	work := t.TempDir()
+	t.Chdir(work)
+	os.Symlink(filepath.Join(home, ".ssh"), filepath.Join(work, "keys"))
+
+	analyzer := NewAnalyzer(nil, nil)
+	analyzer.SetProtectedPaths([]string{"~/.ssh", "/etc", "/", filepath.Join(work, "secrets")})
+
+	tests := []struct {
+		name      string
+		command   string
+		protected bool
+	}{
+		{"delete with tilde", "rm ~/.ssh/id_rsa", true},
+		{"delete with $HOME", "rm -f $HOME/.ssh/id_rsa", true},
+		{"delete with quoted $HOME", `rm "$HOME/.ssh/config"`, true},
+		{"delete protected dir", "rm -rf ~/.ssh", true},
+		{"delete parent of protected dir", "rm -rf ~", true},
+		{"relative path", "rm secrets/token", true},
+		{"relative parent path", "rm ../" + filepath.Base(work) + "/secrets/token", true},
+		{"symlink into protected dir", "rm keys/id_rsa", true},
+		{"glob", "rm ~/.s*/id_*", true},
+		{"redirect", "echo x > /etc/hosts", true},
+		{"append redirect", "echo x >> ~/.ssh/authorized_keys", true},
+		{"move", "mv /etc/hosts /tmp/hosts", true},
+		{"copy destination", "cp evil ~/.ssh/authorized_keys", true},
+		{"copy source only", "cp /etc/hosts ./hosts", false},
+		{"chmod", "chmod 600 /etc/passwd", true},
+		{"chmod mode operand only", "chmod 644 notes.txt", false},
+		{"recursive chmod of parent", "chmod -R 777 ~", true},
+		{"recursive chown of root", "chown -R nobody /", true},
+		{"recursive chgrp long flag", "chgrp --recursive staff " + home, true},
+		{"chmod of parent without -R", "chmod 755 ~", false},
+		{"sed in place", "sed -i s/a/b/ /etc/hosts", true},
+		{"sed in place with suffix and script flag", "sed -i.bak -e s/a/b/ /etc/hosts", true},
+		{"sed in place long flag", "sed --in-place 's/a/b/' ~/.ssh/config", true},
+		{"sed script is not a file", "sed -i /etc/d notes.txt", false},
+		{"sed without in place", "sed s/a/b/ /etc/hosts", false},
+		{"perl in place", "perl -pi -e 's/a/b/' /etc/hosts", true},
+		{"perl without in place", "perl -ne print /etc/hosts", false},
+		{"copy target directory", "cp -t /etc evil", true},
+		{"copy target directory attached", "cp --target-directory=/etc evil", true},
+		{"install target directory", "install -m 644 -t ~/.ssh key", true},
+		{"copy target directory elsewhere", "cp -t /tmp /etc/hosts", false},
+		{"tee", "echo x | sudo tee /etc/motd", true},
+		{"sudo", "sudo rm /etc/hosts", true},
+		{"dd output", "dd if=/dev/zero of=/etc/fstab", true},
+		{"root itself", "rm -rf /", true},
+		{"root does not protect everything", "touch /tmp/sosomi-test", false},
+		{"read protected path", "cat /etc/hosts", false},
+		{"prefix is not a subtree", "touch /etcetera", false},
+		{"unrelated write", "echo hi > out.txt", false},
+		{"glob after cd", "cd /etc && rm -rf *", true},
+		{"redirect after cd", "cd ~/.ssh; echo x > authorized_keys", true},
+		{"relative cd", "cd secrets && rm token", true},
+		{"cd home", "cd && rm -rf .ssh", true},
+		{"cd in wrapped script", `sh -c "cd /etc && rm hosts"`, true},
+		{"cd elsewhere", "cd /tmp && rm -rf secrets", false},
+		{"absolute path after cd", "cd /etc && rm " + filepath.Join(work, "notes.txt"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analysis, err := analyzer.Analyze(tt.command)
+			if err != nil {
+				t.Fatalf("Analyze failed: %v", err)
+			}
+
+			found := false
+			for _, reason := range analysis.RiskReasons {
+				if strings.HasPrefix(reason, "Modifies protected path") {
+					found = true
+				}
+			}
+
+			if found != tt.protected {
+				t.Errorf("protected = %v, want %v (reasons: %v)", found, tt.protected, analysis.RiskReasons)
+			}
+			if tt.protected && analysis.RiskLevel != types.RiskCritical {
+				t.Errorf("Expected RiskCritical, got %v", analysis.RiskLevel)
+			}
+		})
+	}
+}
+
+func TestCheckProtectedPaths_UnknownDir(t *testing.T) {
+	analyzer := NewAnalyzer(nil, nil)
+	analyzer.SetProtectedPaths([]string{"/etc"})
+
+	for _, command := range []string{`cd "$(dirname /etc/x)" && rm -rf *`, "cd - && rm hosts", "cd $UNSET_SOSOMI_DIR/sub; rm hosts"} {
+		analysis, _ := analyzer.Analyze(command)
+		if analysis.RiskLevel < types.RiskDangerous || !analysis.RequiresConfirmation {
+			t.Errorf("%s: expected a confirmed dangerous command, got %s", command, analysis.RiskLevel)
+		}
+	}
+
+	// Absolute paths do not depend on the directory
+	analysis, _ := analyzer.Analyze(`cd "$(mktemp -d)" && touch /tmp/sosomi-test`)
+	if analysis.RequiresConfirmation {
+		t.Errorf("Expected absolute paths to be resolved, got %v", analysis.RiskReasons)
+	}
+}
+
+func TestCheckProtectedPaths_ReasonNamesPath(t *testing.T) {
+	analyzer := NewAnalyzer(nil, nil)
+	analyzer.SetProtectedPaths([]string{"/etc"})
+
+	analysis, _ := analyzer.Analyze("rm /etc/hosts")
+
+	want := "Modifies protected path '/etc/hosts' (protected: /etc)"
+	for _, reason := range analysis.RiskReasons {
+		if reason == want {
+			return
+		}
+	}
+	t.Errorf("Expected reason %q, got %v", want, analysis.RiskReasons)
+}
+
+func TestCheckProtectedPaths_None(t *testing.T) {
+	analyzer := NewAnalyzer(nil, nil)
+
+	analysis, _ := analyzer.Analyze("echo x > /etc/hosts")
+	if analysis.RiskLevel == types.RiskCritical {
+		t.Error("Expected no protected path escalation without configuration")
+	}
+}
+
+func TestCheckSensitiveRead(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	work := t.TempDir()
+	t.Chdir(work)
+
+	analyzer := NewAnalyzer(nil, nil)
+	analyzer.SetProtectedPaths([]string{"/", "/etc", filepath.Join(work, "secrets")})
+
+	tests := []struct {
+		path      string
+		sensitive bool
+	}{
+		{"~/.ssh/id_rsa", true},
+		{"$HOME/.aws/credentials", true},
+		{filepath.Join(home, ".kube", "config"), true},
+		{"~/.netrc", true},
+		{"/etc/hosts", true},
+		{"/etc/shadow", true},
+		{"secrets/token", true},
+		{"~/.sshrc", false},
+		{"~/notes.txt", false},
+		{"README.md", false},
+		{"/usr/share/dict/words", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			analysis, _ := analyzer.Analyze("cat " + tt.path)
+			analyzer.CheckSensitiveRead(analysis, tt.path)
+			if analysis.RequiresConfirmation != tt.sensitive {
+				t.Errorf("RequiresConfirmation = %v, want %v (reasons: %v)", analysis.RequiresConfirmation, tt.sensitive, analysis.RiskReasons)
+			}
+			if tt.sensitive && analysis.RiskLevel < types.RiskCaution {
+				t.Errorf("Expected at least caution, got %s", analysis.RiskLevel)
+			}
+		})
+	}
+}
+
+func TestTouchesProtected(t *testing.T) {
+	tests := []struct {
+		path      string
+		protected string
+		ancestors bool
+		want      bool
+	}{
+		{"/etc", "/etc", false, true},
+		{"/etc/hosts", "/etc", false, true},
+		{"/etcetera", "/etc", false, false},
+		{"/", "/etc", false, false},
+		{"/", "/etc", true, true},
+		{"/home/user", "/home/user/.ssh", true, true},
+		{"/home/user", "/home/user/.ssh", false, false},
+		{"/tmp/x", "/", false, false},
+		{"/", "/", false, true},
+	}
+
+	for _, tt := range tests {
+		if got := touchesProtected(tt.path, tt.protected, tt.ancestors); got != tt.want {
+			t.Errorf("touchesProtected(%q, %q, %v) = %v, want %v", tt.path, tt.protected, tt.ancestors, got, tt.want)
+		}
+	}
+}
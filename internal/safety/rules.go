@@ -0,0 +1,211 @@
+// Package safety provides command safety analysis
+package safety
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// Custom rule actions
+const (
+	ActionWarn    = "warn"
+	ActionBlock   = "block"
+	ActionConfirm = "confirm"
+)
+
+// CustomRule represents a user-defined safety rule
+type CustomRule struct {
+	Pattern   string          `yaml:"pattern"`
+	Action    string          `yaml:"action"` // warn, block, confirm
+	Message   string          `yaml:"message"`
+	RiskLevel types.RiskLevel `yaml:"risk_level"`
+
+	re *regexp.Regexp
+}
+
+// rulesFile is the on-disk format of a custom rules file. Rules are
+// decoded one by one so that an invalid rule does not hide the others.
+type rulesFile struct {
+	Rules []yaml.Node `yaml:"rules"`
+}
+
+// UnmarshalYAML accepts risk levels by name (safe, caution, dangerous, critical)
+func (r *CustomRule) UnmarshalYAML(value *yaml.Node) error {
+	var raw struct {
+		Pattern   string `yaml:"pattern"`
+		Action    string `yaml:"action"`
+		Message   string `yaml:"message"`
+		RiskLevel string `yaml:"risk_level"`
+	}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+
+	r.Pattern = raw.Pattern
+	r.Action = strings.ToLower(strings.TrimSpace(raw.Action))
+	r.Message = raw.Message
+
+	switch strings.ToLower(strings.TrimSpace(raw.RiskLevel)) {
+	case "":
+		r.RiskLevel = defaultRuleRisk(r.Action)
+	case "safe", "0":
+		r.RiskLevel = types.RiskSafe
+	case "caution", "1":
+		r.RiskLevel = types.RiskCaution
+	case "dangerous", "2":
+		r.RiskLevel = types.RiskDangerous
+	case "critical", "3":
+		r.RiskLevel = types.RiskCritical
+	default:
+		return fmt.Errorf("line %d: invalid risk_level %q (use safe, caution, dangerous or critical)", value.Line, raw.RiskLevel)
+	}
+
+	return nil
+}
+
+// defaultRuleRisk returns the risk level used when a rule doesn't set one
+func defaultRuleRisk(action string) types.RiskLevel {
+	if action == ActionBlock {
+		return types.RiskCritical
+	}
+	return types.RiskCaution
+}
+
+// Compile validates the rule and compiles its pattern
+func (r *CustomRule) Compile() error {
+	if r.Pattern == "" {
+		return fmt.Errorf("pattern is required")
+	}
+
+	switch r.Action {
+	case ActionWarn, ActionBlock, ActionConfirm:
+	case "":
+		r.Action = ActionWarn
+	default:
+		return fmt.Errorf("invalid action %q (use warn, block or confirm)", r.Action)
+	}
+
+	re, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", r.Pattern, err)
+	}
+	r.re = re
+	return nil
+}
+
+// Matches reports whether the rule matches a command
+func (r *CustomRule) Matches(command string) bool {
+	return r.re != nil && r.re.MatchString(command)
+}
+
+// Description returns the rule message, falling back to the pattern
+func (r *CustomRule) Description() string {
+	if r.Message != "" {
+		return r.Message
+	}
+	return "Custom rule: " + r.Pattern
+}
+
+// LoadCustomRules reads and compiles a YAML rules file.
+// A missing file is not an error and yields no rules. See ParseCustomRules
+// for invalid rules.
+func LoadCustomRules(path string) ([]CustomRule, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(path, "~") {
+		home, _ := os.UserHomeDir()
+		path = home + path[1:]
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read rules file: %w", err)
+	}
+
+	return ParseCustomRules(data)
+}
+
+// ParseCustomRules parses and compiles rules from YAML.
+// Both a top-level "rules:" key and a bare list are accepted. Invalid rules
+// are skipped and reported in the error, which comes with the valid rules;
+// the rules are nil only when the file cannot be parsed at all.
+func ParseCustomRules(data []byte) ([]CustomRule, error) {
+	var file rulesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		var list []yaml.Node
+		if listErr := yaml.Unmarshal(data, &list); listErr != nil {
+			return nil, fmt.Errorf("failed to parse rules file: %w", err)
+		}
+		file.Rules = list
+	}
+
+	rules := []CustomRule{}
+	var errs []error
+	for i := range file.Rules {
+		var rule CustomRule
+		err := file.Rules[i].Decode(&rule)
+		if err == nil {
+			err = rule.Compile()
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule %d: %w", i+1, err))
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, errors.Join(errs...)
+}
+
+// SetCustomRules sets the user-defined rules applied alongside the built-in patterns
+func (a *Analyzer) SetCustomRules(rules []CustomRule) {
+	a.customRules = rules
+}
+
+// MatchCustomRules returns the custom rules that match a command
+func (a *Analyzer) MatchCustomRules(command string) []CustomRule {
+	var matched []CustomRule
+	for _, rule := range a.customRules {
+		if rule.Matches(command) {
+			matched = append(matched, rule)
+		}
+	}
+	return matched
+}
+
+// applyCustomRules applies matching custom rules to the analysis
+func (a *Analyzer) applyCustomRules(command string, analysis *types.CommandAnalysis) {
+	for _, rule := range a.MatchCustomRules(command) {
+		level := rule.RiskLevel
+		reason := rule.Description()
+
+		switch rule.Action {
+		case ActionBlock:
+			level = types.RiskCritical
+			reason = "Blocked by custom rule: " + reason
+		case ActionConfirm:
+			analysis.RequiresConfirmation = true
+		}
+
+		if level > analysis.RiskLevel {
+			analysis.RiskLevel = level
+		}
+		analysis.Patterns = append(analysis.Patterns, types.MatchedPattern{
+			Pattern:     rule.Pattern,
+			Description: rule.Description(),
+			RiskLevel:   level,
+		})
+		analysis.RiskReasons = append(analysis.RiskReasons, reason)
+	}
+}
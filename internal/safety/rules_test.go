@@ -0,0 +1,189 @@
+// Package safety tests
+package safety
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+const testRules = `
+rules:
+  - pattern: 'kubectl\s+delete'
+    action: confirm
+    message: Deleting Kubernetes resources
+    risk_level: dangerous
+  - pattern: 'terraform\s+destroy'
+    action: block
+    message: Terraform destroy is not allowed
+  - pattern: 'git\s+push\s+--force'
+    action: warn
+    message: Force push rewrites remote history
+  - pattern: '^make\s+deploy'
+    action: confirm
+    risk_level: safe
+`
+
+func TestParseCustomRules(t *testing.T) {
+	rules, err := ParseCustomRules([]byte(testRules))
+	if err != nil {
+		t.Fatalf("ParseCustomRules failed: %v", err)
+	}
+
+	if len(rules) != 4 {
+		t.Fatalf("Expected 4 rules, got %d", len(rules))
+	}
+
+	if rules[0].RiskLevel != types.RiskDangerous {
+		t.Errorf("Expected RiskDangerous, got %v", rules[0].RiskLevel)
+	}
+	if rules[1].RiskLevel != types.RiskCritical {
+		t.Errorf("Expected block rule to default to RiskCritical, got %v", rules[1].RiskLevel)
+	}
+	if rules[2].RiskLevel != types.RiskCaution {
+		t.Errorf("Expected warn rule to default to RiskCaution, got %v", rules[2].RiskLevel)
+	}
+	if rules[3].Description() != "Custom rule: ^make\\s+deploy" {
+		t.Errorf("Unexpected fallback description: %s", rules[3].Description())
+	}
+}
+
+func TestParseCustomRules_BareList(t *testing.T) {
+	rules, err := ParseCustomRules([]byte(`
+- pattern: 'npm\s+publish'
+  message: Publishing a package
+`))
+	if err != nil {
+		t.Fatalf("ParseCustomRules failed: %v", err)
+	}
+	if len(rules) != 1 || rules[0].Action != ActionWarn {
+		t.Errorf("Expected one warn rule, got %+v", rules)
+	}
+}
+
+func TestParseCustomRules_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"bad regex", "rules:\n  - pattern: '(unclosed'\n"},
+		{"bad action", "rules:\n  - pattern: 'x'\n    action: explode\n"},
+		{"missing pattern", "rules:\n  - action: warn\n"},
+		{"bad risk level", "rules:\n  - pattern: 'x'\n    risk_level: extreme\n"},
+		{"not yaml", "rules: [unclosed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseCustomRules([]byte(tt.data)); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestParseCustomRules_SkipsInvalidRule(t *testing.T) {
+	rules, err := ParseCustomRules([]byte(`
+rules:
+  - pattern: 'kubectl\s+delete'
+    action: block
+  - pattern: '(unclosed'
+    action: block
+  - pattern: 'terraform destroy'
+    risk_level: extreme
+`))
+	if err == nil || !strings.Contains(err.Error(), "rule 2") || !strings.Contains(err.Error(), "rule 3") {
+		t.Errorf("Expected rules 2 and 3 to be reported, got %v", err)
+	}
+	if len(rules) != 1 || rules[0].Action != ActionBlock {
+		t.Fatalf("Expected the valid block rule to be kept, got %+v", rules)
+	}
+
+	analyzer := NewAnalyzer(nil, nil)
+	analyzer.SetCustomRules(rules)
+	analysis, _ := analyzer.Analyze("kubectl delete ns staging")
+	if analysis.RiskLevel != types.RiskCritical {
+		t.Errorf("Expected the valid block rule to apply, got %s", analysis.RiskLevel)
+	}
+
+	if rules, err := ParseCustomRules([]byte("rules: [unclosed")); err == nil || rules != nil {
+		t.Errorf("Expected no rules for a file that does not parse, got %v, %v", rules, err)
+	}
+}
+
+func TestLoadCustomRules(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	rules, err := LoadCustomRules(filepath.Join(tmpDir, "missing.yaml"))
+	if err != nil || rules != nil {
+		t.Errorf("Expected no rules and no error for missing file, got %v, %v", rules, err)
+	}
+
+	path := filepath.Join(tmpDir, "rules.yaml")
+	os.WriteFile(path, []byte(testRules), 0644)
+
+	rules, err = LoadCustomRules(path)
+	if err != nil {
+		t.Fatalf("LoadCustomRules failed: %v", err)
+	}
+	if len(rules) != 4 {
+		t.Errorf("Expected 4 rules, got %d", len(rules))
+	}
+}
+
+func TestAnalyze_CustomRules(t *testing.T) {
+	rules, err := ParseCustomRules([]byte(testRules))
+	if err != nil {
+		t.Fatalf("ParseCustomRules failed: %v", err)
+	}
+
+	analyzer := NewAnalyzer(nil, nil)
+	analyzer.SetCustomRules(rules)
+
+	tests := []struct {
+		name         string
+		command      string
+		level        types.RiskLevel
+		confirmation bool
+	}{
+		{"confirm", "kubectl delete pod web-1", types.RiskDangerous, true},
+		{"block", "terraform destroy -auto-approve", types.RiskCritical, false},
+		{"warn", "git push --force origin main", types.RiskCaution, false},
+		{"confirm safe", "make deploy", types.RiskSafe, true},
+		{"no match", "kubectl get pods", types.RiskSafe, false},
+		{"unparseable command", "kubectl delete pod 'x", types.RiskDangerous, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analysis, err := analyzer.Analyze(tt.command)
+			if err != nil {
+				t.Fatalf("Analyze failed: %v", err)
+			}
+			if analysis.RiskLevel != tt.level {
+				t.Errorf("Expected %v, got %v (reasons: %v)", tt.level, analysis.RiskLevel, analysis.RiskReasons)
+			}
+			if analysis.RequiresConfirmation != tt.confirmation {
+				t.Errorf("Expected RequiresConfirmation %v, got %v", tt.confirmation, analysis.RequiresConfirmation)
+			}
+		})
+	}
+}
+
+func TestMatchCustomRules(t *testing.T) {
+	rules, _ := ParseCustomRules([]byte(testRules))
+
+	analyzer := NewAnalyzer(nil, nil)
+	analyzer.SetCustomRules(rules)
+
+	matched := analyzer.MatchCustomRules("kubectl delete ns x && terraform destroy")
+	if len(matched) != 2 {
+		t.Fatalf("Expected 2 matches, got %d", len(matched))
+	}
+	if matched[0].Action != ActionConfirm || matched[1].Action != ActionBlock {
+		t.Errorf("Unexpected match order: %+v", matched)
+	}
+}
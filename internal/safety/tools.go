@@ -0,0 +1,312 @@
+// Package safety provides the registry of tool analyzers
+package safety
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"mvdan.cc/sh/v3/syntax"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// Finding is a risk a tool analyzer found in a command
+type Finding struct {
+	Risk         types.RiskLevel
+	Reason       string
+	Action       string // what the command does, such as "DELETE namespace"; optional
+	Irreversible bool
+}
+
+// CorpusCase is a labeled example command for testing a tool analyzer
+type CorpusCase struct {
+	Command string
+	Risk    types.RiskLevel // the highest risk of its findings, RiskSafe for none
+}
+
+// ToolAnalyzer understands the subcommands and flags of a tool, such as
+// git or kubectl, that the generic analysis only sees as a command name
+type ToolAnalyzer struct {
+	// Names are the binaries the analyzer handles, such as "apt" and "apt-get"
+	Names []string
+
+	// Analyze returns the findings for one call of the tool. args are the
+	// arguments after the binary name, with quotes removed.
+	Analyze func(args []string) []Finding
+
+	// Corpus labels example commands with the risk Analyze must find.
+	// Every analyzer carries one; CheckCorpus verifies it.
+	Corpus []CorpusCase
+}
+
+var (
+	toolsMu sync.RWMutex
+	tools   = make(map[string]ToolAnalyzer)
+)
+
+func init() {
+	for _, tool := range []ToolAnalyzer{
+		gitTool, dockerTool, kubectlTool, helmTool, terraformTool,
+		aptTool, dnfTool, brewTool, systemctlTool, iptablesTool,
+	} {
+		RegisterTool(tool)
+	}
+}
+
+// RegisterTool adds an analyzer for its binaries, replacing any analyzer
+// registered earlier for the same names, including built-in ones. It
+// panics when the analyzer has no names, Analyze function or corpus.
+func RegisterTool(tool ToolAnalyzer) {
+	if len(tool.Names) == 0 || tool.Analyze == nil || len(tool.Corpus) == 0 {
+		panic("safety: RegisterTool needs names, an Analyze function and a corpus")
+	}
+
+	toolsMu.Lock()
+	defer toolsMu.Unlock()
+	for _, name := range tool.Names {
+		tools[name] = tool
+	}
+}
+
+// Tools returns the registered analyzers, ordered by their first name
+func Tools() []ToolAnalyzer {
+	toolsMu.RLock()
+	defer toolsMu.RUnlock()
+
+	seen := make(map[string]bool)
+	var result []ToolAnalyzer
+	for name, tool := range tools {
+		if name == tool.Names[0] && !seen[name] {
+			seen[name] = true
+			result = append(result, tool)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Names[0] < result[j].Names[0]
+	})
+	return result
+}
+
+// lookupTool returns the analyzer registered for a binary
+func lookupTool(name string) (ToolAnalyzer, bool) {
+	toolsMu.RLock()
+	defer toolsMu.RUnlock()
+	tool, ok := tools[name]
+	return tool, ok
+}
+
+// analyzeTool applies the registered analyzer of the called binary, if any
+func (a *Analyzer) analyzeTool(call *syntax.CallExpr, analysis *types.CommandAnalysis) {
+	words := callWords(call)
+	tool, ok := lookupTool(filepath.Base(words[0]))
+	if !ok {
+		return
+	}
+
+	for _, f := range tool.Analyze(words[1:]) {
+		if f.Risk > analysis.RiskLevel {
+			analysis.RiskLevel = f.Risk
+		}
+		analysis.RiskReasons = append(analysis.RiskReasons, f.Reason)
+		if f.Action != "" {
+			analysis.Actions = append(analysis.Actions, f.Action)
+		}
+		if f.Irreversible {
+			analysis.Reversible = false
+		}
+	}
+}
+
+// ToolMatch is a finding of the analyzer registered for a binary
+type ToolMatch struct {
+	Tool string
+	Finding
+}
+
+// MatchTools returns the findings of tool analyzers for every call in a
+// command, including nested ones, whose reasons name the wrappers
+func (a *Analyzer) MatchTools(command string) []ToolMatch {
+	prog, err := a.parser.Parse(strings.NewReader(command), "")
+	if err != nil {
+		return nil
+	}
+
+	var matches []ToolMatch
+	a.walkNested(prog, nesting{}, func(node syntax.Node, nest nesting) {
+		call, ok := node.(*syntax.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return
+		}
+		words := callWords(call)
+		name := filepath.Base(words[0])
+		tool, ok := lookupTool(name)
+		if !ok {
+			return
+		}
+		for _, f := range tool.Analyze(words[1:]) {
+			f.Reason = nest.attribute(f.Reason)
+			matches = append(matches, ToolMatch{Tool: name, Finding: f})
+		}
+	})
+	return matches
+}
+
+// CheckCorpus runs an analyzer on its corpus and returns an error listing
+// the commands whose highest finding differs from their label
+func CheckCorpus(tool ToolAnalyzer) error {
+	parser := syntax.NewParser()
+
+	var errs []error
+	for _, c := range tool.Corpus {
+		args, err := corpusArgs(parser, c.Command, tool.Names)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%q: %w", c.Command, err))
+			continue
+		}
+
+		risk := types.RiskSafe
+		for _, f := range tool.Analyze(args) {
+			if f.Risk > risk {
+				risk = f.Risk
+			}
+		}
+		if risk != c.Risk {
+			errs = append(errs, fmt.Errorf("%q: found %s, labeled %s", c.Command, risk, c.Risk))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// corpusArgs returns the arguments of the first call of one of names
+func corpusArgs(parser *syntax.Parser, command string, names []string) ([]string, error) {
+	prog, err := parser.Parse(strings.NewReader(command), "")
+	if err != nil {
+		return nil, err
+	}
+
+	var args []string
+	found := false
+	syntax.Walk(prog, func(node syntax.Node) bool {
+		call, ok := node.(*syntax.CallExpr)
+		if found || !ok || len(call.Args) == 0 {
+			return !found
+		}
+		words := callWords(call)
+		if containsWord(names, filepath.Base(words[0])) {
+			args, found = words[1:], true
+		}
+		return !found
+	})
+	if !found {
+		return nil, fmt.Errorf("does not call %s", strings.Join(names, " or "))
+	}
+	return args, nil
+}
+
+// callWords returns the words of a call with their quotes removed
+func callWords(call *syntax.CallExpr) []string {
+	words := make([]string, len(call.Args))
+	for i, arg := range call.Args {
+		words[i] = wordText(arg)
+	}
+	return words
+}
+
+// positionals returns the arguments that are not flags, skipping the
+// values of the flags in values. Everything after "--" is positional.
+func positionals(args []string, values map[string]bool) []string {
+	var result []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return append(result, args[i+1:]...)
+		case values[arg]:
+			i++
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+		default:
+			result = append(result, arg)
+		}
+	}
+	return result
+}
+
+// hasFlag reports whether args contain one of flags before "--", alone or
+// as --flag=value. Single-letter flags also match inside clusters like -fdx.
+func hasFlag(args []string, flags ...string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			return false
+		}
+		for _, flag := range flags {
+			if arg == flag || strings.HasPrefix(flag, "--") && strings.HasPrefix(arg, flag+"=") {
+				return true
+			}
+			if len(flag) == 2 && flag[0] == '-' && flag[1] != '-' && isShortCluster(arg) &&
+				strings.IndexByte(arg[1:], flag[1]) >= 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isShortCluster reports whether arg is a group of single-letter flags
+func isShortCluster(arg string) bool {
+	if len(arg) < 3 || arg[0] != '-' || arg[1] == '-' {
+		return false
+	}
+	for _, r := range arg[1:] {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// flagValue returns the value of a flag given as "--flag=value" or
+// "--flag value", and whether the flag is present
+func flagValue(args []string, flags ...string) (string, bool) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		for _, flag := range flags {
+			if arg == flag {
+				if i+1 < len(args) {
+					return args[i+1], true
+				}
+				return "", true
+			}
+			if strings.HasPrefix(arg, flag+"=") {
+				return strings.TrimPrefix(arg, flag+"="), true
+			}
+		}
+	}
+	return "", false
+}
+
+// subcommand returns the first positional argument and the arguments
+// after it, skipping the values of the flags in values
+func subcommand(args []string, values map[string]bool) (string, []string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			if i+1 < len(args) {
+				return args[i+1], args[i+2:]
+			}
+			return "", nil
+		case values[arg]:
+			i++
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+		default:
+			return arg, args[i+1:]
+		}
+	}
+	return "", nil
+}
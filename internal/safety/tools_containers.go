@@ -0,0 +1,241 @@
+// Package safety provides the docker, kubectl and helm tool analyzers
+package safety
+
+import (
+	"strings"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// dockerValueFlags are the global docker flags that take a separate value
+var dockerValueFlags = optionSet("-H", "--host", "-c", "--context", "--config", "-l", "--log-level")
+
+// composeValueFlags are the docker compose flags that take a separate value
+var composeValueFlags = optionSet("-f", "--file", "-p", "--project-name", "--profile", "--env-file", "--project-directory")
+
+var dockerTool = ToolAnalyzer{
+	Names:   []string{"docker", "podman"},
+	Analyze: analyzeDocker,
+	Corpus: []CorpusCase{
+		{"docker ps -a", types.RiskSafe},
+		{"docker logs -f web", types.RiskSafe},
+		{"docker run --rm alpine echo hi", types.RiskSafe},
+		{"docker rm web", types.RiskSafe},
+		{"docker rm -f web", types.RiskCaution},
+		{"docker container rm --force web", types.RiskCaution},
+		{"docker rmi -f app:latest", types.RiskCaution},
+		{"docker system prune", types.RiskCaution},
+		{"docker system prune -a --volumes", types.RiskDangerous},
+		{"docker image prune -a", types.RiskCaution},
+		{"docker volume rm pgdata", types.RiskDangerous},
+		{"docker volume prune -f", types.RiskDangerous},
+		{"docker compose down", types.RiskSafe},
+		{"docker compose down -v", types.RiskDangerous},
+		{"docker compose -f prod.yml down --volumes", types.RiskDangerous},
+		{"docker run --privileged -it alpine sh", types.RiskDangerous},
+		{"docker run -v /:/host alpine", types.RiskDangerous},
+		{"docker run --net=host nginx", types.RiskCaution},
+		{"podman rm -f web", types.RiskCaution},
+	},
+}
+
+// analyzeDocker analyzes docker commands that delete data or grant a
+// container access to the host
+func analyzeDocker(args []string) []Finding {
+	sub, rest := subcommand(args, dockerValueFlags)
+
+	// Management commands such as "docker container rm" and "docker
+	// volume prune" name the object first
+	object := ""
+	switch sub {
+	case "compose":
+		object = sub
+		sub, rest = subcommand(rest, composeValueFlags)
+	case "container", "image", "volume", "network", "system", "builder":
+		object = sub
+		sub, rest = subcommand(rest, nil)
+	}
+
+	switch object + " " + sub {
+	case " rm", "container rm":
+		if hasFlag(rest, "-f", "--force") {
+			return []Finding{{Risk: types.RiskCaution, Reason: "Force removes containers, even running ones"}}
+		}
+	case " rmi", "image rm":
+		if hasFlag(rest, "-f", "--force") {
+			return []Finding{{Risk: types.RiskCaution, Reason: "Force removes images used by containers"}}
+		}
+	case "system prune":
+		if hasFlag(rest, "--volumes") {
+			return []Finding{{Risk: types.RiskDangerous, Reason: "Removes all unused Docker data, including volumes",
+				Action: "DELETE Docker volumes", Irreversible: true}}
+		}
+		return []Finding{{Risk: types.RiskCaution, Reason: "Removes all unused Docker data", Irreversible: true}}
+	case "image prune", "container prune", "network prune", "builder prune":
+		return []Finding{{Risk: types.RiskCaution, Reason: "Removes unused Docker " + object + "s", Irreversible: true}}
+	case "volume rm", "volume prune":
+		return []Finding{{Risk: types.RiskDangerous, Reason: "Deletes Docker volumes and the data in them",
+			Action: "DELETE Docker volumes", Irreversible: true}}
+	case "compose down":
+		if hasFlag(rest, "-v", "--volumes") {
+			return []Finding{{Risk: types.RiskDangerous, Reason: "Deletes the project's volumes and the data in them",
+				Action: "DELETE Docker volumes", Irreversible: true}}
+		}
+	case " run", "container run", " create", "container create":
+		return analyzeDockerRun(rest)
+	}
+	return nil
+}
+
+// analyzeDockerRun analyzes the host access of a new container
+func analyzeDockerRun(args []string) []Finding {
+	var findings []Finding
+	if hasFlag(args, "--privileged") {
+		findings = append(findings, Finding{Risk: types.RiskDangerous,
+			Reason: "Privileged containers have full access to the host"})
+	}
+	for i, arg := range args {
+		var mount string
+		switch {
+		case (arg == "-v" || arg == "--volume") && i+1 < len(args):
+			mount = args[i+1]
+		case strings.HasPrefix(arg, "--volume="):
+			mount = strings.TrimPrefix(arg, "--volume=")
+		case strings.HasPrefix(arg, "-v") && len(arg) > 2:
+			mount = arg[2:]
+		}
+		if strings.HasPrefix(mount, "/:") || strings.HasPrefix(mount, "/var/run/docker.sock:") {
+			findings = append(findings, Finding{Risk: types.RiskDangerous,
+				Reason: "Mounts " + strings.SplitN(mount, ":", 2)[0] + " of the host into the container"})
+		}
+	}
+	for _, flag := range []string{"--net", "--network", "--pid", "--ipc"} {
+		if value, ok := flagValue(args, flag); ok && value == "host" {
+			findings = append(findings, Finding{Risk: types.RiskCaution,
+				Reason: "Shares the host " + strings.TrimPrefix(flag, "--") + " namespace"})
+		}
+	}
+	return findings
+}
+
+// kubectlValueFlags are the kubectl flags that take a separate value
+var kubectlValueFlags = optionSet("-n", "--namespace", "--context", "--cluster", "--user", "--kubeconfig",
+	"-s", "--server", "-l", "--selector", "-f", "--filename", "-o", "--output", "-c", "--container",
+	"--field-selector", "--token", "--as", "-k", "--kustomize")
+
+// kubectlDataKinds are resources whose deletion loses data or whole workloads
+var kubectlDataKinds = map[string]bool{
+	"ns": true, "namespace": true, "namespaces": true,
+	"pv": true, "persistentvolume": true, "persistentvolumes": true,
+	"pvc": true, "persistentvolumeclaim": true, "persistentvolumeclaims": true,
+	"crd": true, "crds": true, "customresourcedefinition": true, "customresourcedefinitions": true,
+	"node": true, "nodes": true, "no": true,
+}
+
+var kubectlTool = ToolAnalyzer{
+	Names:   []string{"kubectl", "oc"},
+	Analyze: analyzeKubectl,
+	Corpus: []CorpusCase{
+		{"kubectl get pods -A", types.RiskSafe},
+		{"kubectl -n prod describe deploy web", types.RiskSafe},
+		{"kubectl logs -f web-1", types.RiskSafe},
+		{"kubectl delete pod web-1", types.RiskCaution},
+		{"kubectl delete ns staging", types.RiskDangerous},
+		{"kubectl -n prod delete namespace prod", types.RiskDangerous},
+		{"kubectl delete pvc --all", types.RiskDangerous},
+		{"kubectl delete pods --all -n default", types.RiskDangerous},
+		{"kubectl delete -f app.yaml", types.RiskCaution},
+		{"kubectl delete pod web-1 --force --grace-period=0", types.RiskCaution},
+		{"kubectl drain node-1 --ignore-daemonsets", types.RiskCaution},
+		{"kubectl scale deploy web --replicas=0", types.RiskCaution},
+		{"kubectl scale deploy web --replicas 3", types.RiskSafe},
+		{"kubectl apply -f app.yaml", types.RiskCaution},
+		{"kubectl exec -it web-1 -- sh", types.RiskCaution},
+		{"kubectl rollout undo deploy/web", types.RiskCaution},
+		{"kubectl config use-context prod", types.RiskSafe},
+	},
+}
+
+// analyzeKubectl analyzes kubectl commands that change or delete cluster resources
+func analyzeKubectl(args []string) []Finding {
+	sub, rest := subcommand(args, kubectlValueFlags)
+	operands := positionals(rest, kubectlValueFlags)
+
+	switch sub {
+	case "delete":
+		var findings []Finding
+		kind := strings.ToLower(strings.SplitN(first(operands), "/", 2)[0])
+		if i := strings.IndexByte(kind, '.'); i > 0 {
+			kind = kind[:i] // such as pvc.v1
+		}
+		switch {
+		case kubectlDataKinds[kind]:
+			findings = append(findings, Finding{Risk: types.RiskDangerous,
+				Reason: "Deletes " + kind + " resources and everything that depends on them",
+				Action: "DELETE Kubernetes " + kind, Irreversible: true})
+		case hasFlag(rest, "--all", "-A", "--all-namespaces"):
+			findings = append(findings, Finding{Risk: types.RiskDangerous,
+				Reason: "Deletes every resource of the kind", Action: "DELETE Kubernetes resources", Irreversible: true})
+		default:
+			findings = append(findings, Finding{Risk: types.RiskCaution,
+				Reason: "Deletes Kubernetes resources", Action: "DELETE Kubernetes resources"})
+		}
+		if value, ok := flagValue(rest, "--grace-period"); hasFlag(rest, "--force") || ok && value == "0" {
+			findings = append(findings, Finding{Risk: types.RiskCaution, Reason: "Skips graceful termination"})
+		}
+		return findings
+	case "drain", "cordon", "taint":
+		return []Finding{{Risk: types.RiskCaution, Reason: "Keeps workloads off the node"}}
+	case "scale":
+		if value, ok := flagValue(rest, "--replicas"); ok && value == "0" {
+			return []Finding{{Risk: types.RiskCaution, Reason: "Scales the workload down to zero replicas"}}
+		}
+	case "apply", "create", "replace", "patch", "edit", "set", "label", "annotate":
+		return []Finding{{Risk: types.RiskCaution, Reason: "Changes cluster resources"}}
+	case "rollout":
+		if first(operands) == "undo" || first(operands) == "restart" {
+			return []Finding{{Risk: types.RiskCaution, Reason: "Rolls workloads back or restarts them"}}
+		}
+	case "exec", "cp", "debug", "port-forward":
+		return []Finding{{Risk: types.RiskCaution, Reason: "Reaches into running containers"}}
+	}
+	return nil
+}
+
+// helmValueFlags are the helm flags that take a separate value
+var helmValueFlags = optionSet("-n", "--namespace", "--kube-context", "--kubeconfig", "-f", "--values",
+	"--set", "--set-string", "--version", "--timeout", "-o", "--output")
+
+var helmTool = ToolAnalyzer{
+	Names:   []string{"helm"},
+	Analyze: analyzeHelm,
+	Corpus: []CorpusCase{
+		{"helm list -A", types.RiskSafe},
+		{"helm template web ./chart", types.RiskSafe},
+		{"helm uninstall web -n prod", types.RiskDangerous},
+		{"helm delete web", types.RiskDangerous},
+		{"helm upgrade --install web ./chart -f values.yaml", types.RiskCaution},
+		{"helm rollback web 3", types.RiskCaution},
+		{"helm upgrade web ./chart --force", types.RiskCaution},
+	},
+}
+
+// analyzeHelm analyzes helm commands that change or remove releases
+func analyzeHelm(args []string) []Finding {
+	sub, rest := subcommand(args, helmValueFlags)
+
+	switch sub {
+	case "uninstall", "delete", "del", "un":
+		return []Finding{{Risk: types.RiskDangerous, Reason: "Uninstalls the release and deletes its resources",
+			Action: "DELETE Helm release", Irreversible: true}}
+	case "install", "upgrade":
+		findings := []Finding{{Risk: types.RiskCaution, Reason: "Changes cluster resources"}}
+		if hasFlag(rest, "--force") {
+			findings = append(findings, Finding{Risk: types.RiskCaution, Reason: "Forced upgrades recreate resources"})
+		}
+		return findings
+	case "rollback":
+		return []Finding{{Risk: types.RiskCaution, Reason: "Rolls the release back to an earlier revision"}}
+	}
+	return nil
+}
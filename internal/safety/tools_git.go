@@ -0,0 +1,195 @@
+// Package safety provides the git tool analyzer
+package safety
+
+import (
+	"strings"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// gitValueFlags are the global git flags that take a separate value
+var gitValueFlags = optionSet("-C", "-c", "--git-dir", "--work-tree", "--namespace", "--exec-path")
+
+var gitTool = ToolAnalyzer{
+	Names:   []string{"git"},
+	Analyze: analyzeGit,
+	Corpus: []CorpusCase{
+		{"git status", types.RiskSafe},
+		{"git log --oneline -5", types.RiskSafe},
+		{"git -C repo diff", types.RiskSafe},
+		{"git clean -n", types.RiskSafe},
+		{"git clean -fd", types.RiskDangerous},
+		{"git clean -fdx", types.RiskDangerous},
+		{"git checkout main", types.RiskSafe},
+		{"git checkout -- .", types.RiskDangerous},
+		{"git checkout .", types.RiskDangerous},
+		{"git checkout -- README.md", types.RiskCaution},
+		{"git checkout -f main", types.RiskCaution},
+		{"git restore .", types.RiskDangerous},
+		{"git restore --staged .", types.RiskSafe},
+		{"git reset HEAD~1", types.RiskSafe},
+		{"git reset --hard origin/main", types.RiskDangerous},
+		{"git push origin main", types.RiskSafe},
+		{"git push --force origin main", types.RiskCaution},
+		{"git push -f", types.RiskCaution},
+		{"git push --force-with-lease", types.RiskCaution},
+		{"git push origin +main", types.RiskCaution},
+		{"git push origin --delete feature", types.RiskCaution},
+		{"git push --mirror backup", types.RiskDangerous},
+		{"git stash", types.RiskSafe},
+		{"git stash drop", types.RiskCaution},
+		{"git stash clear", types.RiskDangerous},
+		{"git branch -d feature", types.RiskSafe},
+		{"git branch -D feature", types.RiskCaution},
+		{"git rebase -i HEAD~3", types.RiskCaution},
+		{"git commit --amend", types.RiskCaution},
+		{"git filter-branch --tree-filter 'rm -f secrets' HEAD", types.RiskDangerous},
+		{"git reflog expire --expire=now --all", types.RiskDangerous},
+		{"git gc --prune=now", types.RiskCaution},
+	},
+}
+
+// analyzeGit analyzes git subcommands that discard work or rewrite history
+func analyzeGit(args []string) []Finding {
+	sub, rest := subcommand(args, gitValueFlags)
+	paths := positionals(rest, nil)
+
+	switch sub {
+	case "clean":
+		if hasFlag(rest, "-n", "--dry-run") || !hasFlag(rest, "-f", "--force") {
+			return nil
+		}
+		reason := "Deletes untracked files"
+		if hasFlag(rest, "-x") {
+			reason = "Deletes untracked and ignored files"
+		}
+		return []Finding{{Risk: types.RiskDangerous, Reason: reason + ", which cannot be undone",
+			Action: "DELETE untracked files", Irreversible: true}}
+	case "checkout", "restore":
+		pathspecs, _, ok := gitDiscardedPaths(sub, rest)
+		switch {
+		case !ok:
+		case len(pathspecs) == 0:
+			return []Finding{{Risk: types.RiskCaution, Reason: "Forced checkout discards local changes", Irreversible: true}}
+		default:
+			risk := types.RiskCaution
+			if containsWord(pathspecs, ".") || containsWord(pathspecs, ":/") {
+				risk = types.RiskDangerous
+			}
+			return []Finding{{Risk: risk, Reason: "Discards uncommitted changes to " + strings.Join(pathspecs, " "),
+				Action: "DISCARD working tree changes", Irreversible: true}}
+		}
+	case "reset":
+		if hasFlag(rest, "--hard") {
+			return []Finding{{Risk: types.RiskDangerous, Reason: "Hard reset discards uncommitted changes",
+				Action: "DISCARD working tree changes", Irreversible: true}}
+		}
+	case "push":
+		return analyzeGitPush(rest, paths)
+	case "stash":
+		switch first(paths) {
+		case "drop":
+			return []Finding{{Risk: types.RiskCaution, Reason: "Drops a stash", Irreversible: true}}
+		case "clear":
+			return []Finding{{Risk: types.RiskDangerous, Reason: "Deletes every stash", Irreversible: true}}
+		}
+	case "branch":
+		if hasFlag(rest, "-D") || hasFlag(rest, "-d", "--delete") && hasFlag(rest, "-f", "--force") {
+			return []Finding{{Risk: types.RiskCaution, Reason: "Deletes a branch even if it is not merged"}}
+		}
+	case "rebase":
+		return []Finding{{Risk: types.RiskCaution, Reason: "Rebasing rewrites commit history"}}
+	case "commit":
+		if hasFlag(rest, "--amend") {
+			return []Finding{{Risk: types.RiskCaution, Reason: "Amending rewrites the last commit"}}
+		}
+	case "filter-branch", "filter-repo":
+		return []Finding{{Risk: types.RiskDangerous, Reason: "Rewrites the whole repository history", Irreversible: true}}
+	case "reflog":
+		if first(paths) == "expire" || first(paths) == "delete" {
+			return []Finding{{Risk: types.RiskDangerous, Reason: "Deletes reflog entries, the last way to recover lost commits", Irreversible: true}}
+		}
+	case "gc", "prune":
+		if value, ok := flagValue(rest, "--prune"); sub == "prune" || ok && value == "now" {
+			return []Finding{{Risk: types.RiskCaution, Reason: "Prunes unreachable commits immediately", Irreversible: true}}
+		}
+	}
+	return nil
+}
+
+// gitDiscardedPaths returns the pathspecs whose uncommitted changes a git
+// checkout or restore discards, whether staged changes are lost too, and
+// whether it discards anything. A forced checkout discards every change and
+// has no pathspecs.
+func gitDiscardedPaths(sub string, args []string) ([]string, bool, bool) {
+	if sub == "restore" {
+		staged, worktree := hasFlag(args, "-S", "--staged"), hasFlag(args, "-W", "--worktree")
+		if staged && !worktree {
+			return nil, false, false // only unstages
+		}
+		pathspecs := positionals(args, optionSet("-s", "--source"))
+		return pathspecs, staged, len(pathspecs) > 0
+	}
+
+	// git checkout [<tree-ish>] -- <pathspec>... also discards staged
+	// changes when restoring from a tree-ish
+	for i, arg := range args {
+		if arg == "--" {
+			treeish := positionals(args[:i], nil)
+			pathspecs := args[i+1:]
+			return pathspecs, len(treeish) > 0, len(pathspecs) > 0
+		}
+	}
+	if paths := positionals(args, nil); containsWord(paths, ".") {
+		return paths, false, true
+	}
+	if hasFlag(args, "-f", "--force") {
+		return nil, true, true
+	}
+	return nil, false, false
+}
+
+// analyzeGitPush analyzes pushes that overwrite or delete remote refs
+func analyzeGitPush(args, refs []string) []Finding {
+	var findings []Finding
+	switch {
+	case hasFlag(args, "--mirror"):
+		findings = append(findings, Finding{Risk: types.RiskDangerous,
+			Reason: "Mirror push overwrites and deletes remote refs", Irreversible: true})
+	case hasFlag(args, "-f", "--force", "--force-with-lease", "--force-if-includes") || hasForcedRefspec(refs):
+		findings = append(findings, Finding{Risk: types.RiskCaution, Reason: "Force push can overwrite remote history"})
+	}
+	if hasFlag(args, "-d", "--delete") || hasDeleteRefspec(refs) {
+		findings = append(findings, Finding{Risk: types.RiskCaution, Reason: "Deletes remote branches or tags"})
+	}
+	return findings
+}
+
+// hasForcedRefspec reports whether a refspec after the remote starts with +
+func hasForcedRefspec(refs []string) bool {
+	for i, ref := range refs {
+		if i > 0 && strings.HasPrefix(ref, "+") {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDeleteRefspec reports whether a refspec after the remote has an
+// empty source, like :branch
+func hasDeleteRefspec(refs []string) bool {
+	for i, ref := range refs {
+		if i > 0 && strings.HasPrefix(ref, ":") && len(ref) > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// first returns the first element of s, or ""
+func first(s []string) string {
+	if len(s) == 0 {
+		return ""
+	}
+	return s[0]
+}
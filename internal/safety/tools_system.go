@@ -0,0 +1,270 @@
+// Package safety provides the terraform, package manager, systemctl and
+// iptables tool analyzers
+package safety
+
+import (
+	"strings"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+var terraformTool = ToolAnalyzer{
+	Names:   []string{"terraform", "tofu"},
+	Analyze: analyzeTerraform,
+	Corpus: []CorpusCase{
+		{"terraform plan -out plan.tfplan", types.RiskSafe},
+		{"terraform -chdir=infra validate", types.RiskSafe},
+		{"terraform apply", types.RiskCaution},
+		{"terraform apply plan.tfplan", types.RiskCaution},
+		{"terraform apply -auto-approve", types.RiskDangerous},
+		{"terraform apply -destroy", types.RiskDangerous},
+		{"terraform destroy", types.RiskDangerous},
+		{"terraform destroy -target=aws_instance.web", types.RiskDangerous},
+		{"terraform state rm aws_instance.web", types.RiskCaution},
+		{"terraform state push -force terraform.tfstate", types.RiskDangerous},
+		{"terraform workspace delete staging", types.RiskCaution},
+		{"terraform workspace select prod", types.RiskSafe},
+		{"tofu destroy -auto-approve", types.RiskDangerous},
+	},
+}
+
+// analyzeTerraform analyzes terraform commands that change or destroy infrastructure
+func analyzeTerraform(args []string) []Finding {
+	sub, rest := subcommand(args, nil)
+	operands := positionals(rest, nil)
+	autoApprove := hasFlag(rest, "-auto-approve", "--auto-approve")
+
+	switch sub {
+	case "destroy", "apply":
+		var findings []Finding
+		if sub == "destroy" || hasFlag(rest, "-destroy", "--destroy") {
+			findings = append(findings, Finding{Risk: types.RiskDangerous, Reason: "Destroys managed infrastructure",
+				Action: "DESTROY infrastructure", Irreversible: true})
+		} else {
+			findings = append(findings, Finding{Risk: types.RiskCaution, Reason: "Changes managed infrastructure",
+				Action: "APPLY infrastructure changes"})
+		}
+		if autoApprove {
+			findings = append(findings, Finding{Risk: types.RiskDangerous,
+				Reason: "-auto-approve skips reviewing the plan"})
+		}
+		return findings
+	case "state":
+		switch first(operands) {
+		case "rm", "mv", "replace-provider":
+			return []Finding{{Risk: types.RiskCaution, Reason: "Edits the state of managed resources"}}
+		case "push":
+			risk := types.RiskCaution
+			if hasFlag(rest, "-force", "--force") {
+				risk = types.RiskDangerous
+			}
+			return []Finding{{Risk: risk, Reason: "Overwrites the remote state", Irreversible: true}}
+		}
+	case "import", "taint", "untaint", "force-unlock":
+		return []Finding{{Risk: types.RiskCaution, Reason: "Edits the state of managed resources"}}
+	case "workspace":
+		if first(operands) == "delete" {
+			return []Finding{{Risk: types.RiskCaution, Reason: "Deletes a workspace and its state"}}
+		}
+	}
+	return nil
+}
+
+// essentialPackages break the system or remote access when removed
+var essentialPackages = map[string]bool{
+	"libc6": true, "glibc": true, "systemd": true, "apt": true, "dpkg": true, "dnf": true, "yum": true,
+	"rpm": true, "sudo": true, "bash": true, "coreutils": true, "openssh-server": true,
+	"linux-image-generic": true, "kernel": true, "kernel-core": true, "grub2": true, "grub-pc": true,
+}
+
+// packageFindings analyzes installing, removing and upgrading packages
+func packageFindings(action string, packages []string, assumeYes bool) []Finding {
+	var findings []Finding
+	switch action {
+	case "remove", "purge", "autoremove", "erase", "uninstall":
+		reason := "Removes packages"
+		if action == "purge" {
+			reason = "Removes packages and their configuration files"
+		}
+		findings = append(findings, Finding{Risk: types.RiskCaution, Reason: reason, Action: "REMOVE packages"})
+		for _, pkg := range packages {
+			name := strings.SplitN(pkg, "=", 2)[0]
+			if essentialPackages[name] || strings.HasPrefix(name, "linux-image") {
+				findings = append(findings, Finding{Risk: types.RiskDangerous,
+					Reason: "Removes " + name + ", which the system needs to run", Irreversible: true})
+			}
+		}
+	case "install", "reinstall", "upgrade", "full-upgrade", "dist-upgrade", "update", "downgrade":
+		findings = append(findings, Finding{Risk: types.RiskCaution, Reason: "Changes installed packages",
+			Action: "INSTALL/UPGRADE packages"})
+	default:
+		return nil
+	}
+	if assumeYes {
+		findings = append(findings, Finding{Risk: types.RiskCaution, Reason: "Answers yes to every package manager prompt"})
+	}
+	return findings
+}
+
+var aptTool = ToolAnalyzer{
+	Names:   []string{"apt", "apt-get"},
+	Analyze: analyzeApt,
+	Corpus: []CorpusCase{
+		{"apt update", types.RiskSafe},
+		{"apt search ripgrep", types.RiskSafe},
+		{"apt list --installed", types.RiskSafe},
+		{"apt install -y ripgrep", types.RiskCaution},
+		{"apt-get upgrade", types.RiskCaution},
+		{"apt remove nginx", types.RiskCaution},
+		{"apt purge -y nginx", types.RiskCaution},
+		{"apt-get autoremove --purge", types.RiskCaution},
+		{"apt remove openssh-server", types.RiskDangerous},
+		{"apt-get purge -y linux-image-6.1.0-13-amd64", types.RiskDangerous},
+	},
+}
+
+// analyzeApt analyzes apt and apt-get
+func analyzeApt(args []string) []Finding {
+	sub, rest := subcommand(args, optionSet("-o", "-c", "-t", "--target-release"))
+	// apt update only refreshes the package lists
+	if sub == "update" {
+		return nil
+	}
+	return packageFindings(sub, positionals(rest, nil), hasFlag(rest, "-y", "--yes", "--assume-yes"))
+}
+
+var dnfTool = ToolAnalyzer{
+	Names:   []string{"dnf", "yum"},
+	Analyze: analyzeDnf,
+	Corpus: []CorpusCase{
+		{"dnf search htop", types.RiskSafe},
+		{"dnf check-update", types.RiskSafe},
+		{"dnf install htop", types.RiskCaution},
+		{"yum update -y", types.RiskCaution},
+		{"yum remove httpd", types.RiskCaution},
+		{"dnf erase -y sudo", types.RiskDangerous},
+	},
+}
+
+// analyzeDnf analyzes dnf and yum, where update upgrades packages
+func analyzeDnf(args []string) []Finding {
+	sub, rest := subcommand(args, optionSet("-c", "--config", "--releasever", "--repo", "--enablerepo", "--disablerepo"))
+	return packageFindings(sub, positionals(rest, nil), hasFlag(rest, "-y", "--assumeyes"))
+}
+
+var brewTool = ToolAnalyzer{
+	Names:   []string{"brew"},
+	Analyze: analyzeBrew,
+	Corpus: []CorpusCase{
+		{"brew list", types.RiskSafe},
+		{"brew update", types.RiskSafe},
+		{"brew install jq", types.RiskCaution},
+		{"brew uninstall --zap firefox", types.RiskCaution},
+		{"brew rm node", types.RiskCaution},
+	},
+}
+
+// analyzeBrew analyzes Homebrew, where update only refreshes Homebrew itself
+func analyzeBrew(args []string) []Finding {
+	sub, rest := subcommand(args, nil)
+	switch sub {
+	case "update":
+		return nil
+	case "rm", "remove":
+		sub = "uninstall"
+	}
+	return packageFindings(sub, positionals(rest, nil), false)
+}
+
+// accessUnits are services whose loss can cut off remote access to the machine
+var accessUnits = map[string]bool{
+	"ssh": true, "sshd": true, "networking": true, "network": true, "NetworkManager": true,
+	"systemd-networkd": true, "systemd-resolved": true, "dbus": true, "firewalld": true,
+}
+
+var systemctlTool = ToolAnalyzer{
+	Names:   []string{"systemctl"},
+	Analyze: analyzeSystemctl,
+	Corpus: []CorpusCase{
+		{"systemctl status nginx", types.RiskSafe},
+		{"systemctl list-units --failed", types.RiskSafe},
+		{"systemctl --user start app", types.RiskSafe},
+		{"systemctl restart nginx", types.RiskCaution},
+		{"systemctl disable --now nginx", types.RiskCaution},
+		{"systemctl mask bluetooth.service", types.RiskCaution},
+		{"systemctl stop sshd", types.RiskDangerous},
+		{"systemctl disable ssh.service", types.RiskDangerous},
+		{"systemctl isolate rescue.target", types.RiskDangerous},
+		{"systemctl poweroff", types.RiskDangerous},
+	},
+}
+
+// analyzeSystemctl analyzes systemctl commands that stop services or the system
+func analyzeSystemctl(args []string) []Finding {
+	sub, rest := subcommand(args, optionSet("-H", "--host", "-M", "--machine", "-t", "--type",
+		"-p", "--property", "-n", "--lines", "-o", "--output", "-s", "--signal"))
+	units := positionals(rest, nil)
+
+	switch sub {
+	case "poweroff", "reboot", "halt", "kexec", "suspend", "hibernate", "emergency", "rescue", "isolate", "default":
+		return []Finding{{Risk: types.RiskDangerous, Reason: "Shuts the system down or changes its state",
+			Action: "CHANGE system state"}}
+	case "stop", "restart", "try-restart", "reload-or-restart", "kill", "disable", "mask":
+		var findings []Finding
+		for _, unit := range units {
+			if accessUnits[strings.TrimSuffix(unit, ".service")] {
+				findings = append(findings, Finding{Risk: types.RiskDangerous,
+					Reason: "Stopping " + unit + " can cut off remote access"})
+			}
+		}
+		reason := "Stops or restarts services"
+		if sub == "disable" || sub == "mask" {
+			reason = "Keeps services from starting"
+		}
+		return append(findings, Finding{Risk: types.RiskCaution, Reason: reason, Action: "CHANGE services"})
+	}
+	return nil
+}
+
+var iptablesTool = ToolAnalyzer{
+	Names:   []string{"iptables", "ip6tables"},
+	Analyze: analyzeIptables,
+	Corpus: []CorpusCase{
+		{"iptables -L -n", types.RiskSafe},
+		{"iptables -nvL", types.RiskSafe},
+		{"iptables -S", types.RiskSafe},
+		{"iptables -A INPUT -p tcp --dport 80 -j ACCEPT", types.RiskCaution},
+		{"iptables -D INPUT 3", types.RiskCaution},
+		{"iptables -F", types.RiskDangerous},
+		{"iptables -t nat --flush", types.RiskDangerous},
+		{"iptables -X", types.RiskCaution},
+		{"iptables -P INPUT DROP", types.RiskDangerous},
+		{"iptables -P FORWARD ACCEPT", types.RiskCaution},
+		{"ip6tables -F", types.RiskDangerous},
+	},
+}
+
+// analyzeIptables analyzes firewall rule changes
+func analyzeIptables(args []string) []Finding {
+	var findings []Finding
+	for i, arg := range args {
+		switch arg {
+		case "-F", "--flush":
+			findings = append(findings, Finding{Risk: types.RiskDangerous,
+				Reason: "Flushes firewall rules, which can lock out remote access or open the machine", Irreversible: true})
+		case "-X", "--delete-chain", "-Z", "--zero":
+			findings = append(findings, Finding{Risk: types.RiskCaution, Reason: "Deletes firewall chains or counters"})
+		case "-P", "--policy":
+			if i+2 < len(args) && strings.EqualFold(args[i+2], "DROP") {
+				findings = append(findings, Finding{Risk: types.RiskDangerous,
+					Reason: "A default DROP policy can lock out remote access"})
+			} else {
+				findings = append(findings, Finding{Risk: types.RiskCaution, Reason: "Changes a default firewall policy"})
+			}
+		case "-A", "--append", "-I", "--insert", "-D", "--delete", "-R", "--replace", "-N", "--new-chain":
+			findings = append(findings, Finding{Risk: types.RiskCaution, Reason: "Changes firewall rules",
+				Action: "MODIFY firewall rules"})
+		}
+	}
+	return findings
+}
@@ -0,0 +1,158 @@
+// Package safety tool analyzer tests
+package safety
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+func TestTools_Corpus(t *testing.T) {
+	tools := Tools()
+	if len(tools) < 10 {
+		t.Fatalf("Expected the built-in analyzers, got %d", len(tools))
+	}
+	for _, tool := range tools {
+		t.Run(tool.Names[0], func(t *testing.T) {
+			if err := CheckCorpus(tool); err != nil {
+				t.Errorf("Corpus mismatch:\n%v", err)
+			}
+		})
+	}
+}
+
+func TestCheckCorpus_Mismatch(t *testing.T) {
+	tool := ToolAnalyzer{
+		Names:   []string{"deploy"},
+		Analyze: func(args []string) []Finding { return nil },
+		Corpus: []CorpusCase{
+			{"deploy prod", types.RiskDangerous},
+			{"echo deploy", types.RiskSafe},
+		},
+	}
+
+	err := CheckCorpus(tool)
+	if err == nil {
+		t.Fatal("Expected corpus mismatches")
+	}
+	if !strings.Contains(err.Error(), `"deploy prod": found SAFE, labeled DANGEROUS`) {
+		t.Errorf("Expected the mislabeled command, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `"echo deploy": does not call deploy`) {
+		t.Errorf("Expected the command that does not call the tool, got %v", err)
+	}
+}
+
+func TestRegisterTool(t *testing.T) {
+	tool := ToolAnalyzer{
+		Names: []string{"shipit"},
+		Analyze: func(args []string) []Finding {
+			if hasFlag(args, "--prod") {
+				return []Finding{{Risk: types.RiskDangerous, Reason: "Deploys to production", Action: "DEPLOY"}}
+			}
+			return nil
+		},
+		Corpus: []CorpusCase{
+			{"shipit", types.RiskSafe},
+			{"shipit --prod", types.RiskDangerous},
+		},
+	}
+	RegisterTool(tool)
+	defer func() {
+		toolsMu.Lock()
+		delete(tools, "shipit")
+		toolsMu.Unlock()
+	}()
+
+	if err := CheckCorpus(tool); err != nil {
+		t.Errorf("Corpus mismatch: %v", err)
+	}
+
+	analysis, err := NewAnalyzer(nil, nil).Analyze("./bin/shipit --prod")
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if analysis.RiskLevel != types.RiskDangerous {
+		t.Errorf("Expected DANGEROUS, got %v", analysis.RiskLevel)
+	}
+	if !containsReason(analysis.Actions, "DEPLOY") {
+		t.Errorf("Expected the DEPLOY action, got %v", analysis.Actions)
+	}
+}
+
+func TestRegisterTool_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		tool ToolAnalyzer
+	}{
+		{"no names", ToolAnalyzer{Analyze: func([]string) []Finding { return nil }, Corpus: []CorpusCase{{"x", types.RiskSafe}}}},
+		{"no analyze", ToolAnalyzer{Names: []string{"x"}, Corpus: []CorpusCase{{"x", types.RiskSafe}}}},
+		{"no corpus", ToolAnalyzer{Names: []string{"x"}, Analyze: func([]string) []Finding { return nil }}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("Expected RegisterTool to panic")
+				}
+			}()
+			RegisterTool(tt.tool)
+		})
+	}
+}
+
+func TestAnalyze_Tools(t *testing.T) {
+	analyzer := NewAnalyzer(nil, nil)
+
+	tests := []struct {
+		command string
+		risk    types.RiskLevel
+		reason  string
+	}{
+		{"git clean -fdx", types.RiskDangerous, "Deletes untracked and ignored files"},
+		{"git checkout -- .", types.RiskDangerous, "Discards uncommitted changes"},
+		{"kubectl delete ns staging", types.RiskDangerous, "Deletes ns resources"},
+		{"terraform apply -auto-approve", types.RiskDangerous, "-auto-approve skips reviewing the plan"},
+		{"helm uninstall web", types.RiskDangerous, "Uninstalls the release"},
+		{"sudo apt purge -y nginx", types.RiskCaution, "via sudo: Removes packages and their configuration files"},
+		{"sudo systemctl disable nginx", types.RiskCaution, "Keeps services from starting"},
+		{"sudo iptables -F", types.RiskDangerous, "Flushes firewall rules"},
+		{"cd infra && terraform destroy", types.RiskDangerous, "Destroys managed infrastructure"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			analysis, err := analyzer.Analyze(tt.command)
+			if err != nil {
+				t.Fatalf("Analyze failed: %v", err)
+			}
+			if analysis.RiskLevel != tt.risk {
+				t.Errorf("Expected %v, got %v (%v)", tt.risk, analysis.RiskLevel, analysis.RiskReasons)
+			}
+			if !containsReason(analysis.RiskReasons, tt.reason) {
+				t.Errorf("Expected a reason containing %q, got %v", tt.reason, analysis.RiskReasons)
+			}
+		})
+	}
+}
+
+func TestMatchTools(t *testing.T) {
+	analyzer := NewAnalyzer(nil, nil)
+
+	matches := analyzer.MatchTools(`ssh host "git reset --hard" && ls`)
+	if len(matches) != 1 {
+		t.Fatalf("Expected 1 match, got %v", matches)
+	}
+	if matches[0].Tool != "git" || matches[0].Risk != types.RiskDangerous {
+		t.Errorf("Expected a dangerous git finding, got %+v", matches[0])
+	}
+	if !strings.HasPrefix(matches[0].Reason, "via ssh host: ") {
+		t.Errorf("Expected the reason to name the wrapper, got %q", matches[0].Reason)
+	}
+
+	if matches := analyzer.MatchTools("git status && ls -la"); len(matches) != 0 {
+		t.Errorf("Expected no matches, got %v", matches)
+	}
+}
@@ -0,0 +1,401 @@
+// Package safety provides unwrapping of commands run by other commands
+package safety
+
+import (
+	"path/filepath"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// maxNesting bounds how deep wrapped commands are unwrapped, so payloads
+// that run themselves cannot recurse forever
+const maxNesting = 8
+
+// nesting describes the wrappers a command runs through
+type nesting struct {
+	path   []string // outermost first, such as "sudo" then "bash -c"
+	remote bool     // runs on another host, so local paths do not apply
+	input  bool     // gets its arguments at run time, from xargs or find
+}
+
+// enter returns the nesting of a command run by wrapper
+func (n nesting) enter(w wrapped) nesting {
+	path := make([]string, len(n.path), len(n.path)+1)
+	copy(path, n.path)
+	return nesting{
+		path:   append(path, w.wrapper),
+		remote: n.remote || w.remote,
+		input:  w.input,
+	}
+}
+
+// attribute prefixes a reason with the wrappers it was found in
+func (n nesting) attribute(reason string) string {
+	if len(n.path) == 0 {
+		return reason
+	}
+	return "via " + strings.Join(n.path, " › ") + ": " + reason
+}
+
+// wrapped is a command run by a wrapper command, either made of the
+// wrapper's own arguments or parsed from a script it runs
+type wrapped struct {
+	wrapper string           // how it is run, such as "sudo -u bob" or "bash -c"
+	call    *syntax.CallExpr // the command, from the wrapper's arguments
+	prog    *syntax.File     // or the parsed script
+	remote  bool             // runs on another host
+	input   bool             // arguments are added at run time
+}
+
+// walkNested walks node like syntax.Walk, including the commands run by
+// wrappers such as sudo, bash -c, xargs, find -exec or ssh, and command
+// and process substitutions. fn gets every node with the wrappers it
+// runs through.
+func (a *Analyzer) walkNested(node syntax.Node, nest nesting, fn func(syntax.Node, nesting)) {
+	syntax.Walk(node, func(node syntax.Node) bool {
+		switch n := node.(type) {
+		case *syntax.CmdSubst:
+			a.walkSubst(n.Stmts, "$(...)", nest, fn)
+			return false
+		case *syntax.ProcSubst:
+			a.walkSubst(n.Stmts, "<(...)", nest, fn)
+			return false
+		case *syntax.CallExpr:
+			fn(n, nest)
+			a.walkWrapped(n, nest, fn)
+			return true
+		}
+		fn(node, nest)
+		return true
+	})
+}
+
+// walkSubst walks the statements of a substitution
+func (a *Analyzer) walkSubst(stmts []*syntax.Stmt, wrapper string, nest nesting, fn func(syntax.Node, nesting)) {
+	if len(nest.path) >= maxNesting {
+		return
+	}
+	inner := nest.enter(wrapped{wrapper: wrapper})
+	for _, stmt := range stmts {
+		a.walkNested(stmt, inner, fn)
+	}
+}
+
+// walkWrapped walks the commands a call runs. Commands made of the call's
+// own arguments are not walked again, since their words were walked
+// with the call.
+func (a *Analyzer) walkWrapped(call *syntax.CallExpr, nest nesting, fn func(syntax.Node, nesting)) {
+	if len(nest.path) >= maxNesting {
+		return
+	}
+	for _, w := range a.unwrap(call) {
+		inner := nest.enter(w)
+		if w.prog != nil {
+			a.walkNested(w.prog, inner, fn)
+			continue
+		}
+		fn(w.call, inner)
+		a.walkWrapped(w.call, inner, fn)
+	}
+}
+
+// Options of wrapper commands that take a separate value
+var (
+	sudoValueOpts  = optionSet("-u", "-g", "-h", "-p", "-C", "-D", "-r", "-t", "-U", "-T", "-R")
+	envValueOpts   = optionSet("-u", "-C", "--unset", "--chdir")
+	timeValueOpts  = optionSet("-o", "-f", "--output", "--format")
+	niceValueOpts  = optionSet("-n", "--adjustment")
+	xargsValueOpts = optionSet("-a", "-d", "-E", "-I", "-L", "-n", "-P", "-s",
+		"--arg-file", "--delimiter", "--max-args", "--max-lines", "--max-procs", "--max-chars")
+	timeoutValueOpts = optionSet("-s", "-k", "--signal", "--kill-after")
+	sshValueOpts     = optionSet("-B", "-b", "-c", "-D", "-E", "-e", "-F", "-I", "-i", "-J", "-L",
+		"-l", "-m", "-O", "-o", "-p", "-Q", "-R", "-S", "-W", "-w")
+)
+
+func optionSet(opts ...string) map[string]bool {
+	set := make(map[string]bool, len(opts))
+	for _, opt := range opts {
+		set[opt] = true
+	}
+	return set
+}
+
+// unwrap returns the commands a call runs on behalf of its command
+func (a *Analyzer) unwrap(call *syntax.CallExpr) []wrapped {
+	if len(call.Args) < 2 {
+		return nil
+	}
+
+	words := make([]string, len(call.Args))
+	for i, arg := range call.Args {
+		words[i] = wordText(arg)
+	}
+
+	// prefix runs the arguments from i on as a command
+	prefix := func(i int, input bool) []wrapped {
+		if i >= len(call.Args) {
+			return nil
+		}
+		return []wrapped{{
+			wrapper: strings.Join(words[:i], " "),
+			call:    &syntax.CallExpr{Args: call.Args[i:]},
+			input:   input,
+		}}
+	}
+
+	switch name := filepath.Base(words[0]); name {
+	case "sudo", "doas":
+		return prefix(skipOptions(words, 1, sudoValueOpts), false)
+	case "nohup":
+		return prefix(1, false)
+	case "nice":
+		return prefix(skipOptions(words, 1, niceValueOpts), false)
+	case "time":
+		return prefix(skipOptions(words, 1, timeValueOpts), false)
+	case "timeout":
+		// The duration comes before the command
+		return prefix(skipOptions(words, 1, timeoutValueOpts)+1, false)
+	case "command":
+		for _, w := range words[1:] {
+			if w == "-v" || w == "-V" {
+				return nil // only looks the command up
+			}
+		}
+		return prefix(skipOptions(words, 1, nil), false)
+	case "exec":
+		return prefix(skipOptions(words, 1, optionSet("-a")), false)
+	case "env":
+		i := 1
+		for ; i < len(words); i++ {
+			w := words[i]
+			if w == "-S" || w == "--split-string" || strings.HasPrefix(w, "--split-string=") {
+				// The string is split into a command like a script
+				source := strings.TrimPrefix(w, "--split-string=")
+				if source == w && i+1 < len(words) {
+					source = words[i+1]
+				}
+				return a.script("env -S", source, false)
+			}
+			if envValueOpts[w] {
+				i++
+			} else if !strings.HasPrefix(w, "-") && !strings.Contains(w, "=") {
+				break
+			}
+		}
+		return prefix(i, false)
+	case "xargs":
+		return prefix(skipOptions(words, 1, xargsValueOpts), true)
+	case "find":
+		return a.unwrapFind(call, words)
+	case "eval":
+		return a.script("eval", strings.Join(words[1:], " "), false)
+	case "bash", "sh", "zsh", "dash", "ksh", "ash":
+		if i := shellScriptArg(words); i > 0 {
+			return a.script(name+" -c", words[i], false)
+		}
+	case "ssh":
+		i := skipOptions(words, 1, sshValueOpts)
+		if i+1 >= len(words) {
+			return nil // interactive session
+		}
+		// ssh joins its remaining arguments into the remote command
+		return a.script("ssh "+words[i], strings.Join(words[i+1:], " "), true)
+	}
+	return nil
+}
+
+// shellScriptArg returns the index of the script a shell runs with -c, or
+// 0 when it runs a script file or reads stdin
+func shellScriptArg(words []string) int {
+	for i := 1; i < len(words); i++ {
+		w := words[i]
+		if w == "--" || !strings.HasPrefix(w, "-") && !strings.HasPrefix(w, "+") {
+			return 0
+		}
+		if len(w) == 2 && strings.ContainsRune("oO", rune(w[1])) {
+			i++ // shell option name
+			continue
+		}
+		if !strings.HasPrefix(w, "--") && strings.HasPrefix(w, "-") && strings.Contains(w, "c") {
+			for j := i + 1; j < len(words); j++ {
+				if !strings.HasPrefix(words[j], "-") {
+					return j
+				}
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// dynamicScript returns how a call runs a script that the shell builds at
+// run time, such as eval "$CMD" or sh -c "$(cat cmd)", or "" when the
+// script is written out in the command. Such scripts cannot be analyzed.
+func dynamicScript(call *syntax.CallExpr) string {
+	if len(call.Args) < 2 {
+		return ""
+	}
+	words := make([]string, len(call.Args))
+	for i, arg := range call.Args {
+		words[i] = wordText(arg)
+	}
+
+	switch name := filepath.Base(words[0]); name {
+	case "eval":
+		for _, arg := range call.Args[1:] {
+			if !literalWord(arg) {
+				return "eval"
+			}
+		}
+	case "bash", "sh", "zsh", "dash", "ksh", "ash":
+		if i := shellScriptArg(words); i > 0 && !literalWord(call.Args[i]) {
+			return name + " -c"
+		}
+	}
+	return ""
+}
+
+// literalWord reports whether a word has no expansions, so its value is
+// known before the command runs
+func literalWord(word *syntax.Word) bool {
+	for _, part := range word.Parts {
+		switch p := part.(type) {
+		case *syntax.Lit, *syntax.SglQuoted:
+		case *syntax.DblQuoted:
+			if !literalWord(&syntax.Word{Parts: p.Parts}) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// unwrapFind returns the commands run by the -exec, -execdir, -ok and
+// -okdir actions of find. -delete is analyzed as a write of its own.
+func (a *Analyzer) unwrapFind(call *syntax.CallExpr, words []string) []wrapped {
+	var cmds []wrapped
+	for i := 1; i < len(words); i++ {
+		switch action := words[i]; action {
+		case "-exec", "-execdir", "-ok", "-okdir":
+			end := i + 1
+			for end < len(words) && words[end] != ";" && words[end] != `\;` && words[end] != "+" {
+				end++
+			}
+			if end > i+1 {
+				cmds = append(cmds, wrapped{
+					wrapper: "find " + action,
+					call:    &syntax.CallExpr{Args: call.Args[i+1 : end]},
+					input:   true,
+				})
+			}
+			i = end
+		}
+	}
+	return cmds
+}
+
+// findRoots returns the paths find searches, which come before the
+// expression. find searches the current directory when none is given.
+func findRoots(words []string) []string {
+	var roots []string
+	for _, w := range words[1:] {
+		if w == "-H" || w == "-L" || w == "-P" {
+			continue
+		}
+		if w == "" || strings.HasPrefix(w, "-") || w == "(" || w == "!" {
+			break
+		}
+		roots = append(roots, w)
+	}
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	return roots
+}
+
+// script parses a script run by a wrapper. Scripts that do not parse are
+// left to the pattern analysis of the whole command.
+func (a *Analyzer) script(wrapper, source string, remote bool) []wrapped {
+	if strings.TrimSpace(source) == "" {
+		return nil
+	}
+	prog, err := a.parser.Parse(strings.NewReader(source), "")
+	if err != nil {
+		return nil
+	}
+	return []wrapped{{wrapper: wrapper, prog: prog, remote: remote}}
+}
+
+// skipOptions returns the index of the first argument from i on that is
+// not an option. Options in values take the following argument as well;
+// "--" ends the options.
+func skipOptions(words []string, i int, values map[string]bool) int {
+	for i < len(words) {
+		w := words[i]
+		switch {
+		case w == "--":
+			return i + 1
+		case values[w]:
+			i += 2
+		case strings.HasPrefix(w, "-") && len(w) > 1:
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// wordText returns a word with its quotes removed. Expansions are kept as
+// written, so a script passed in a word parses the same as it would run.
+func wordText(word *syntax.Word) string {
+	var b strings.Builder
+	writeWordText(&b, word.Parts, false)
+	return b.String()
+}
+
+func writeWordText(b *strings.Builder, parts []syntax.WordPart, quoted bool) {
+	printer := syntax.NewPrinter()
+	for _, part := range parts {
+		switch p := part.(type) {
+		case *syntax.Lit:
+			if quoted {
+				b.WriteString(unescapeDouble(p.Value))
+			} else {
+				b.WriteString(p.Value)
+			}
+		case *syntax.SglQuoted:
+			b.WriteString(p.Value)
+		case *syntax.DblQuoted:
+			writeWordText(b, p.Parts, true)
+		default:
+			printer.Print(b, p)
+		}
+	}
+}
+
+// unescapeDouble removes the backslashes that escape ", \, $ and ` and
+// the escaped newlines in double quotes, as the shell does. Other
+// backslashes are kept.
+func unescapeDouble(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case '"', '\\', '$', '`':
+				i++
+			case '\n':
+				i++
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,170 @@
+// Package safety nested command tests
+package safety
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+func TestAnalyze_NestedCommands(t *testing.T) {
+	analyzer := NewAnalyzer(nil, nil)
+
+	tests := []struct {
+		command string
+		risk    types.RiskLevel
+		reason  string // expected in one of the risk reasons
+	}{
+		{`bash -c "rm -rf ~"`, types.RiskCritical, "via bash -c: Attempting to delete root or home directory"},
+		{`sh -c 'rm -rf ~'`, types.RiskCritical, "via sh -c: Attempting to delete root"},
+		{`bash -lc "rm -rf build"`, types.RiskDangerous, "via bash -c: Recursive force deletion"},
+		{`eval "rm -rf ~"`, types.RiskCritical, "via eval: Attempting to delete root"},
+		{`ls | xargs rm -rf`, types.RiskDangerous, "via xargs: Recursive force deletion"},
+		{`ls | xargs -0 -n 1 rm`, types.RiskCaution, "via xargs -0 -n 1: Modifies paths only known at run time"},
+		{`find . -name '*.tmp' -delete`, types.RiskCaution, "find -delete removes every match"},
+		{`find ~ -delete`, types.RiskCritical, "Attempting to delete root or home directory"},
+		{`find . -type d -exec rm -rf {} +`, types.RiskDangerous, "via find -exec: Recursive force deletion"},
+		{`find . -exec chmod 777 {} \;`, types.RiskDangerous, "via find -exec: World-writable permissions"},
+		{`sudo -u bob rm -rf ~`, types.RiskCritical, "via sudo -u bob: Attempting to delete root"},
+		{`env FOO=1 rm -rf ~`, types.RiskCritical, "via env FOO=1: Attempting to delete root"},
+		{`env -S "rm -rf ~"`, types.RiskCritical, "via env -S: Attempting to delete root"},
+		{`timeout 5 rm -rf ~`, types.RiskCritical, "via timeout 5: Attempting to delete root"},
+		{`timeout -s KILL 5 chown -R bob .`, types.RiskDangerous, "via timeout -s KILL 5: Recursive ownership change"},
+		{`nohup rm -rf ~ &`, types.RiskCritical, "via nohup: Attempting to delete root"},
+		{`echo $(rm -rf ~)`, types.RiskCritical, "via $(...): Attempting to delete root"},
+		{`ssh host 'rm -rf /'`, types.RiskCritical, "via ssh host: Attempting to delete root"},
+		{`ssh -p 2222 host dd if=/dev/zero of=x`, types.RiskDangerous, "via ssh host: Direct disk access"},
+		{`sudo bash -c "nohup rm -rf ~"`, types.RiskCritical, "via sudo › bash -c › nohup: Attempting to delete root"},
+		{`sh -c 'sh -c "sh -c \"rm -rf /\""'`, types.RiskCritical, "via sh -c › sh -c › sh -c: Attempting to delete root"},
+		{`bash -c "bash -c \"echo \\\$HOME; rm -rf ~\""`, types.RiskCritical, "via bash -c › bash -c: Attempting to delete root"},
+		{`eval "$CMD"`, types.RiskCaution, "eval runs a script only known at run time"},
+		{`eval $(ssh-agent -s)`, types.RiskCaution, "eval runs a script only known at run time"},
+		{`sh -c "$1"`, types.RiskCaution, "sh -c runs a script only known at run time"},
+		{`sudo bash -c "$(curl -fsSL https://example.com/install.sh)"`, types.RiskCaution, "via sudo: bash -c runs a script only known at run time"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			analysis, err := analyzer.Analyze(tt.command)
+			if err != nil {
+				t.Fatalf("Analyze failed: %v", err)
+			}
+			if analysis.RiskLevel != tt.risk {
+				t.Errorf("Expected %v, got %v (%v)", tt.risk, analysis.RiskLevel, analysis.RiskReasons)
+			}
+			if !containsReason(analysis.RiskReasons, tt.reason) {
+				t.Errorf("Expected a reason containing %q, got %v", tt.reason, analysis.RiskReasons)
+			}
+		})
+	}
+}
+
+func TestAnalyze_NotUnwrapped(t *testing.T) {
+	analyzer := NewAnalyzer(nil, nil)
+
+	for _, command := range []string{
+		"bash script.sh",
+		"command -v rm",
+		"ssh host",
+		"xargs echo",
+		"find . -name '*.go'",
+		"sudo ls /root",
+		`sh -c 'echo "$HOME"'`,
+		`eval "echo hi"`,
+	} {
+		analysis, err := analyzer.Analyze(command)
+		if err != nil {
+			t.Fatalf("Analyze failed: %v", err)
+		}
+		if analysis.RiskLevel > types.RiskCaution {
+			t.Errorf("Expected at most CAUTION for %q, got %v (%v)", command, analysis.RiskLevel, analysis.RiskReasons)
+		}
+		for _, reason := range analysis.RiskReasons {
+			if strings.Contains(reason, "Deletion") || strings.Contains(reason, "delete") {
+				t.Errorf("Unexpected deletion reason for %q: %s", command, reason)
+			}
+		}
+	}
+}
+
+func TestAnalyze_NestingLimit(t *testing.T) {
+	analyzer := NewAnalyzer(nil, nil)
+
+	command := "rm -rf ~"
+	for i := 0; i < maxNesting+2; i++ {
+		command = "nohup " + command
+	}
+	analysis, err := analyzer.Analyze(command)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	for _, reason := range analysis.RiskReasons {
+		if strings.Count(reason, "nohup") > maxNesting {
+			t.Errorf("Expected unwrapping to stop after %d levels, got %s", maxNesting, reason)
+		}
+	}
+}
+
+func TestCheckProtectedPaths_Nested(t *testing.T) {
+	dir := t.TempDir()
+	protected := filepath.Join(dir, "protected")
+	if err := os.Mkdir(protected, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	analyzer := NewAnalyzer(nil, nil)
+	analyzer.SetProtectedPaths([]string{protected})
+	analyzer.SetWorkingDir(dir)
+
+	tests := []struct {
+		command  string
+		critical bool
+	}{
+		{`sudo bash -c "rm -rf protected"`, true},
+		{`bash -c "echo x > protected/file"`, true},
+		{`find protected -delete`, true},
+		{`timeout 5 mv protected elsewhere`, true},
+		{`ssh host rm -rf protected`, false}, // a path on the remote host
+		{`bash -c "rm -rf other"`, false},
+	}
+
+	for _, tt := range tests {
+		analysis, err := analyzer.Analyze(tt.command)
+		if err != nil {
+			t.Fatalf("Analyze failed: %v", err)
+		}
+		if critical := analysis.RiskLevel == types.RiskCritical; critical != tt.critical {
+			t.Errorf("%q: expected critical=%v, got %v (%v)", tt.command, tt.critical, analysis.RiskLevel, analysis.RiskReasons)
+		}
+	}
+}
+
+func TestCheckAffectedFiles_Nested(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 5; i++ {
+		if err := os.WriteFile(filepath.Join(dir, "f"+string(rune('a'+i))), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	analyzer := NewAnalyzer(nil, nil)
+	analyzer.SetWorkingDir(dir)
+	analysis, _ := analyzer.Analyze(`sudo sh -c "rm -f *"`)
+	analyzer.CheckAffectedFiles(analysis, 0)
+
+	if analysis.FileCount != 5 {
+		t.Errorf("Expected 5 affected files, got %d", analysis.FileCount)
+	}
+}
+
+func containsReason(reasons []string, want string) bool {
+	for _, reason := range reasons {
+		if strings.Contains(reason, want) {
+			return true
+		}
+	}
+	return false
+}
@@ -62,7 +62,10 @@ func (s *Store) initialize() error {
 		exit_code INTEGER DEFAULT 0,
 		risk_level INTEGER DEFAULT 0,
 		duration_ms INTEGER DEFAULT 0,
-		executed INTEGER DEFAULT 0
+		executed INTEGER DEFAULT 0,
+		prompt_tokens INTEGER DEFAULT 0,
+		completion_tokens INTEGER DEFAULT 0,
+		summary_of INTEGER DEFAULT 0
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_sessions_updated ON sessions(updated_at);
@@ -77,6 +80,12 @@ func (s *Store) initialize() error {
 	// Ignore error if column already exists (migration already applied)
 	_ = err
 
+	// Migration: Add billed token and summary columns to messages
+	for _, column := range []string{"prompt_tokens", "completion_tokens", "summary_of"} {
+		_, err = s.db.Exec(`ALTER TABLE session_messages ADD COLUMN ` + column + ` INTEGER DEFAULT 0`)
+		_ = err
+	}
+
 	return nil
 }
 
@@ -205,21 +214,82 @@ func (s *Store) AddMessage(sessionID, role, content string, tokens int) (*types.
 	return msg, nil
 }
 
-// AddExecutionMessage adds an execution message (command + output) to the session
-func (s *Store) AddExecutionMessage(sessionID, userPrompt, command, output string, exitCode int, riskLevel types.RiskLevel, durationMs int64, executed bool, tokens int) error {
+// AddReply adds an assistant message together with the tokens billed for
+// the request that produced it. The message itself counts for its
+// completion tokens.
+func (s *Store) AddReply(sessionID, content string, usage types.TokenUsage) (*types.SessionMessage, error) {
+	msg := &types.SessionMessage{
+		ID:               uuid.New().String(),
+		SessionID:        sessionID,
+		Role:             "assistant",
+		Content:          content,
+		CreatedAt:        time.Now(),
+		Tokens:           usage.CompletionTokens,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO session_messages (id, session_id, role, content, created_at, tokens, prompt_tokens, completion_tokens)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, msg.ID, msg.SessionID, msg.Role, msg.Content, msg.CreatedAt, msg.Tokens, msg.PromptTokens, msg.CompletionTokens)
+	if err != nil {
+		return nil, err
+	}
+
+	// Update session stats
+	s.db.Exec(`UPDATE sessions SET message_count = message_count + 1, total_tokens = total_tokens + ?, updated_at = ? WHERE id = ?`,
+		msg.Tokens, time.Now(), sessionID)
+
+	return msg, nil
+}
+
+// AddSummary adds a "summary" message replacing the first summaryOf
+// messages of the session in the context sent to the model. The replaced
+// messages are kept.
+func (s *Store) AddSummary(sessionID, content string, summaryOf int) (*types.SessionMessage, error) {
 	msg := &types.SessionMessage{
 		ID:        uuid.New().String(),
 		SessionID: sessionID,
-		Role:      "execution",
-		Content:   userPrompt,
+		Role:      "summary",
+		Content:   content,
 		CreatedAt: time.Now(),
-		Tokens:    tokens,
-		Command:   command,
-		Output:    output,
-		ExitCode:  exitCode,
-		RiskLevel: riskLevel,
-		Duration:  durationMs,
-		Executed:  executed,
+		SummaryOf: summaryOf,
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO session_messages (id, session_id, role, content, created_at, summary_of)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, msg.ID, msg.SessionID, msg.Role, msg.Content, msg.CreatedAt, msg.SummaryOf)
+	if err != nil {
+		return nil, err
+	}
+
+	// Update session stats
+	s.db.Exec(`UPDATE sessions SET message_count = message_count + 1, updated_at = ? WHERE id = ?`, time.Now(), sessionID)
+
+	return msg, nil
+}
+
+// AddExecutionMessage adds an execution message (command + output) to the
+// session. tokens is the message's share of the context, usage the tokens
+// billed for the request that produced the command.
+func (s *Store) AddExecutionMessage(sessionID, userPrompt, command, output string, exitCode int, riskLevel types.RiskLevel, durationMs int64, executed bool, tokens int, usage types.TokenUsage) error {
+	msg := &types.SessionMessage{
+		ID:               uuid.New().String(),
+		SessionID:        sessionID,
+		Role:             "execution",
+		Content:          userPrompt,
+		CreatedAt:        time.Now(),
+		Tokens:           tokens,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		Command:          command,
+		Output:           output,
+		ExitCode:         exitCode,
+		RiskLevel:        riskLevel,
+		Duration:         durationMs,
+		Executed:         executed,
 	}
 
 	executedInt := 0
@@ -228,9 +298,9 @@ func (s *Store) AddExecutionMessage(sessionID, userPrompt, command, output strin
 	}
 
 	_, err := s.db.Exec(`
-		INSERT INTO session_messages (id, session_id, role, content, created_at, tokens, command, output, exit_code, risk_level, duration_ms, executed)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, msg.ID, msg.SessionID, msg.Role, msg.Content, msg.CreatedAt, msg.Tokens, msg.Command, msg.Output, msg.ExitCode, int(msg.RiskLevel), msg.Duration, executedInt)
+		INSERT INTO session_messages (id, session_id, role, content, created_at, tokens, command, output, exit_code, risk_level, duration_ms, executed, prompt_tokens, completion_tokens)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, msg.ID, msg.SessionID, msg.Role, msg.Content, msg.CreatedAt, msg.Tokens, msg.Command, msg.Output, msg.ExitCode, int(msg.RiskLevel), msg.Duration, executedInt, msg.PromptTokens, msg.CompletionTokens)
 	if err != nil {
 		return err
 	}
@@ -250,7 +320,8 @@ func (s *Store) AddExecutionMessage(sessionID, userPrompt, command, output strin
 // GetMessages retrieves all messages for a session
 func (s *Store) GetMessages(sessionID string) ([]*types.SessionMessage, error) {
 	rows, err := s.db.Query(`
-		SELECT id, session_id, role, content, created_at, tokens, command, output, exit_code, risk_level, duration_ms, executed
+		SELECT id, session_id, role, content, created_at, tokens, command, output, exit_code, risk_level, duration_ms, executed,
+		       COALESCE(prompt_tokens, 0), COALESCE(completion_tokens, 0), COALESCE(summary_of, 0)
 		FROM session_messages WHERE session_id = ? ORDER BY created_at ASC
 	`, sessionID)
 	if err != nil {
@@ -265,7 +336,7 @@ func (s *Store) GetMessages(sessionID string) ([]*types.SessionMessage, error) {
 		var riskLevel int
 		var executed int
 		if err := rows.Scan(&msg.ID, &msg.SessionID, &msg.Role, &msg.Content, &msg.CreatedAt, &msg.Tokens,
-			&command, &output, &msg.ExitCode, &riskLevel, &msg.Duration, &executed); err != nil {
+			&command, &output, &msg.ExitCode, &riskLevel, &msg.Duration, &executed, &msg.PromptTokens, &msg.CompletionTokens, &msg.SummaryOf); err != nil {
 			return nil, err
 		}
 		if command.Valid {
@@ -420,9 +491,9 @@ func (s *Store) ImportSession(data []byte) (*types.Session, error) {
 			executedInt = 1
 		}
 		_, err := s.db.Exec(`
-			INSERT INTO session_messages (id, session_id, role, content, created_at, tokens, command, output, exit_code, risk_level, duration_ms, executed)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-		`, uuid.New().String(), sess.ID, msg.Role, msg.Content, msg.CreatedAt, msg.Tokens, msg.Command, msg.Output, msg.ExitCode, int(msg.RiskLevel), msg.Duration, executedInt)
+			INSERT INTO session_messages (id, session_id, role, content, created_at, tokens, command, output, exit_code, risk_level, duration_ms, executed, prompt_tokens, completion_tokens, summary_of)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, uuid.New().String(), sess.ID, msg.Role, msg.Content, msg.CreatedAt, msg.Tokens, msg.Command, msg.Output, msg.ExitCode, int(msg.RiskLevel), msg.Duration, executedInt, msg.PromptTokens, msg.CompletionTokens, msg.SummaryOf)
 		if err != nil {
 			return nil, err
 		}
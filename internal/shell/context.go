@@ -49,6 +49,9 @@ func GetSystemContext() types.SystemContext {
 	// Get recent commands from history
 	ctx.RecentCmds = getRecentCommands(5)
 
+	// Kube context, cloud profiles and other infrastructure targets
+	ctx.Environment = GetEnvironment(ctx.CurrentDir)
+
 	return ctx
 }
 
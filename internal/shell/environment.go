@@ -0,0 +1,201 @@
+// Package shell provides detection of the infrastructure tools target by default
+package shell
+
+import (
+	"bufio"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/sonemaro/sosomi/internal/types"
+)
+
+// GetEnvironment detects the kube context, cloud profiles, terraform
+// workspace and database host that commands run in dir use by default
+func GetEnvironment(dir string) types.Environment {
+	var env types.Environment
+	env.KubeContext, env.KubeNamespace = getKubeContext()
+	env.AWSProfile = getAWSProfile()
+	env.GCloudProject = getGCloudProject()
+	env.TerraformWorkspace = getTerraformWorkspace(dir)
+	env.DBHost = getDBHost()
+	return env
+}
+
+// kubeconfig is the part of a kubeconfig file that selects the context
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Contexts       []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+}
+
+// getKubeContext returns the current kube context and its namespace. Like
+// kubectl, it merges the files in KUBECONFIG, where the first file to set a
+// value wins.
+func getKubeContext() (string, string) {
+	var paths []string
+	if list := os.Getenv("KUBECONFIG"); list != "" {
+		paths = filepath.SplitList(list)
+	} else if home, err := os.UserHomeDir(); err == nil {
+		paths = []string{filepath.Join(home, ".kube", "config")}
+	}
+
+	current := ""
+	namespaces := make(map[string]string)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var cfg kubeconfig
+		if yaml.Unmarshal(data, &cfg) != nil {
+			continue
+		}
+		if current == "" {
+			current = cfg.CurrentContext
+		}
+		for _, c := range cfg.Contexts {
+			if _, ok := namespaces[c.Name]; !ok {
+				namespaces[c.Name] = c.Context.Namespace
+			}
+		}
+	}
+
+	if current == "" {
+		return "", ""
+	}
+	namespace := namespaces[current]
+	if namespace == "" {
+		namespace = "default"
+	}
+	return current, namespace
+}
+
+// getAWSProfile returns the AWS profile, or "default" when the shared
+// credentials or config file has a default profile
+func getAWSProfile() string {
+	for _, name := range []string{"AWS_PROFILE", "AWS_DEFAULT_PROFILE"} {
+		if profile := os.Getenv(name); profile != "" {
+			return profile
+		}
+	}
+
+	home, _ := os.UserHomeDir()
+	for _, file := range []struct{ env, path string }{
+		{"AWS_SHARED_CREDENTIALS_FILE", filepath.Join(home, ".aws", "credentials")},
+		{"AWS_CONFIG_FILE", filepath.Join(home, ".aws", "config")},
+	} {
+		path := file.path
+		if value := os.Getenv(file.env); value != "" {
+			path = value
+		}
+		if _, ok := readINI(path)["default"]; ok {
+			return "default"
+		}
+	}
+	return ""
+}
+
+// getGCloudProject returns the project of the active gcloud configuration
+func getGCloudProject() string {
+	if project := os.Getenv("CLOUDSDK_CORE_PROJECT"); project != "" {
+		return project
+	}
+
+	dir := os.Getenv("CLOUDSDK_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config", "gcloud")
+	}
+
+	active := os.Getenv("CLOUDSDK_ACTIVE_CONFIG_NAME")
+	if active == "" {
+		data, err := os.ReadFile(filepath.Join(dir, "active_config"))
+		active = strings.TrimSpace(string(data))
+		if err != nil || active == "" {
+			active = "default"
+		}
+	}
+	return readINI(filepath.Join(dir, "configurations", "config_"+active))["core"]["project"]
+}
+
+// getTerraformWorkspace returns the selected terraform workspace when dir
+// is an initialized terraform working directory
+func getTerraformWorkspace(dir string) string {
+	if workspace := os.Getenv("TF_WORKSPACE"); workspace != "" {
+		return workspace
+	}
+
+	data := os.Getenv("TF_DATA_DIR")
+	if data == "" {
+		data = ".terraform"
+	}
+	if !filepath.IsAbs(data) {
+		data = filepath.Join(dir, data)
+	}
+	if _, err := os.Stat(data); err != nil {
+		return ""
+	}
+	workspace, err := os.ReadFile(filepath.Join(data, "environment"))
+	if err != nil || strings.TrimSpace(string(workspace)) == "" {
+		return "default"
+	}
+	return strings.TrimSpace(string(workspace))
+}
+
+// getDBHost returns the database host from the connection settings in the
+// environment
+func getDBHost() string {
+	for _, name := range []string{"DATABASE_URL", "PGHOST", "MYSQL_HOST", "MONGODB_URI", "MONGO_URL", "REDIS_URL"} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "://") {
+			return value
+		}
+		if u, err := url.Parse(value); err == nil && u.Hostname() != "" {
+			return u.Hostname()
+		}
+	}
+	return ""
+}
+
+// readINI reads the key/value pairs of each section of an INI file, as used
+// by AWS and gcloud. Sections named "profile x" are stored as "x".
+func readINI(path string) map[string]map[string]string {
+	sections := make(map[string]map[string]string)
+	file, err := os.Open(path)
+	if err != nil {
+		return sections
+	}
+	defer file.Close()
+
+	var section map[string]string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			name := strings.TrimSpace(strings.TrimPrefix(line[1:len(line)-1], "profile "))
+			section = make(map[string]string)
+			sections[name] = section
+		case section != nil:
+			if key, value, ok := strings.Cut(line, "="); ok {
+				section[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+	}
+	return sections
+}
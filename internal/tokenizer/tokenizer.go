@@ -0,0 +1,242 @@
+// Package tokenizer counts tokens locally and knows the context window of
+// common models
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// Counter counts the tokens of a text
+type Counter interface {
+	Count(text string) int
+}
+
+// Heuristic estimates tokens without a vocabulary: about four bytes of
+// ASCII per token, and a token for every other character, which errs on
+// the high side for accented text so that estimates stay conservative
+type Heuristic struct{}
+
+func (Heuristic) Count(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// BPE counts tokens exactly with an OpenAI tiktoken encoding
+type BPE struct {
+	encoding *tiktoken.Tiktoken
+}
+
+func (b BPE) Count(text string) int {
+	return len(b.encoding.EncodeOrdinary(text))
+}
+
+// encodingPrefixes maps OpenAI model name prefixes to their encoding; the
+// longest matching prefix wins
+var encodingPrefixes = map[string]string{
+	"gpt-4o":         "o200k_base",
+	"gpt-4.1":        "o200k_base",
+	"gpt-4.5":        "o200k_base",
+	"gpt-5":          "o200k_base",
+	"chatgpt-4o":     "o200k_base",
+	"o1":             "o200k_base",
+	"o3":             "o200k_base",
+	"o4":             "o200k_base",
+	"gpt-4":          "cl100k_base",
+	"gpt-3.5":        "cl100k_base",
+	"gpt-35":         "cl100k_base", // Azure deployment names
+	"text-embedding": "cl100k_base",
+}
+
+// EncodingFor returns the tiktoken encoding of an OpenAI-family model, or
+// "" for other models
+func EncodingFor(model string) string {
+	model = strings.ToLower(model)
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:] // e.g. openai/gpt-4o on routers
+	}
+	var best string
+	for prefix := range encodingPrefixes {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	return encodingPrefixes[best]
+}
+
+// vocabularyURL is where encoding vocabularies are downloaded from
+var vocabularyURL = "https://openaipublic.blob.core.windows.net/encodings/"
+
+// retryAfter is how long a failed vocabulary download is not retried
+const retryAfter = 10 * time.Minute
+
+var (
+	mu        sync.Mutex
+	cacheDir  string
+	downloads bool
+	encodings = map[string]*tiktoken.Tiktoken{}
+	fetching  = map[string]bool{}      // vocabularies being downloaded
+	failed    = map[string]time.Time{} // when a vocabulary download last failed
+
+	// setLoader makes tiktoken load vocabularies from the cache directory
+	setLoader sync.Once
+)
+
+// SetCacheDir sets where encoding vocabularies are kept
+func SetCacheDir(dir string) {
+	mu.Lock()
+	defer mu.Unlock()
+	cacheDir = dir
+}
+
+// SetDownload sets whether missing vocabularies are downloaded from OpenAI
+// in the background the first time they are needed. Without downloads
+// only vocabularies already in the cache directory are used.
+func SetDownload(enabled bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	downloads = enabled
+}
+
+// ForModel returns an exact BPE counter for OpenAI-family models and the
+// heuristic for any other model. Until the vocabulary is in the cache
+// directory the heuristic is used too, while it is downloaded in the
+// background if downloads are enabled.
+func ForModel(model string) Counter {
+	name := EncodingFor(model)
+	if name == "" {
+		return Heuristic{}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if encoding := encodings[name]; encoding != nil {
+		return BPE{encoding: encoding}
+	}
+	if cacheDir == "" {
+		return Heuristic{}
+	}
+
+	setLoader.Do(func() { tiktoken.SetBpeLoader(cachedLoader{}) })
+	if encoding, err := tiktoken.GetEncoding(name); err == nil {
+		encodings[name] = encoding
+		return BPE{encoding: encoding}
+	}
+	if downloads {
+		fetch(name)
+	}
+	return Heuristic{}
+}
+
+// fetch downloads a vocabulary into the cache directory in the background,
+// unless it is already being downloaded or recently failed. mu must be held.
+func fetch(name string) {
+	if fetching[name] || time.Since(failed[name]) < retryAfter {
+		return
+	}
+	fetching[name] = true
+
+	go func(dir string) {
+		err := download(vocabularyURL+name+".tiktoken", filepath.Join(dir, name+".tiktoken"))
+
+		mu.Lock()
+		defer mu.Unlock()
+		delete(fetching, name)
+		if err != nil {
+			failed[name] = time.Now()
+		}
+	}(cacheDir)
+}
+
+// cachedLoader loads vocabularies from the cache directory. tiktoken only
+// calls it from ForModel, with mu held.
+type cachedLoader struct{}
+
+func (cachedLoader) LoadTiktokenBpe(url string) (map[string]int, error) {
+	data, err := os.ReadFile(filepath.Join(cacheDir, path.Base(url)))
+	if err != nil {
+		return nil, err
+	}
+	return parseRanks(data)
+}
+
+// download saves url to file, renaming it into place so that a partial
+// download is never loaded
+func download(url, file string) error {
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if _, err := parseRanks(data); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// parseRanks parses a .tiktoken file: a base64 token and its rank per line
+func parseRanks(data []byte) (map[string]int, error) {
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		token, rank, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token %q: %w", token, err)
+		}
+		n, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rank %q: %w", rank, err)
+		}
+		ranks[string(decoded)] = n
+	}
+	return ranks, scanner.Err()
+}
@@ -0,0 +1,275 @@
+// Package tokenizer tests
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+func TestHeuristic(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"ls", 1},
+		{"list all files", 4},
+		{"héllo", 2},
+		{"日本語", 3},
+	}
+	for _, tt := range tests {
+		if got := (Heuristic{}).Count(tt.text); got != tt.want {
+			t.Errorf("Count(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestEncodingFor(t *testing.T) {
+	tests := map[string]string{
+		"gpt-4o-mini":   "o200k_base",
+		"gpt-4.1-nano":  "o200k_base",
+		"o3-mini":       "o200k_base",
+		"gpt-4-turbo":   "cl100k_base",
+		"gpt-35-turbo":  "cl100k_base",
+		"openai/gpt-4o": "o200k_base",
+		"claude-sonnet": "",
+		"llama3.2":      "",
+	}
+	for model, want := range tests {
+		if got := EncodingFor(model); got != want {
+			t.Errorf("EncodingFor(%s) = %q, want %q", model, got, want)
+		}
+	}
+}
+
+// vocabulary returns a tiny vocabulary: every byte, and merges up to "hello"
+func vocabulary() string {
+	var sb strings.Builder
+	rank := 0
+	for b := 0; b < 256; b++ {
+		fmt.Fprintf(&sb, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(b)}), rank)
+		rank++
+	}
+	for _, merged := range []string{"he", "ll", "hell", "hello"} {
+		fmt.Fprintf(&sb, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(merged)), rank)
+		rank++
+	}
+	return sb.String()
+}
+
+// writeVocabulary writes the tiny vocabulary as cl100k_base
+func writeVocabulary(t *testing.T, dir string) {
+	if err := os.WriteFile(filepath.Join(dir, "cl100k_base.tiktoken"), []byte(vocabulary()), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func resetEncodings() {
+	mu.Lock()
+	defer mu.Unlock()
+	encodings = map[string]*tiktoken.Tiktoken{}
+	resetFetches()
+}
+
+// resetFetches forgets downloads; mu must be held
+func resetFetches() {
+	fetching = map[string]bool{}
+	failed = map[string]time.Time{}
+}
+
+// serveVocabulary points downloads at a test server answering with status,
+// and counts its requests
+func serveVocabulary(t *testing.T, status int) *atomic.Int32 {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(status)
+		fmt.Fprint(w, vocabulary())
+	}))
+	t.Cleanup(server.Close)
+
+	saved := vocabularyURL
+	vocabularyURL = server.URL + "/"
+	t.Cleanup(func() { vocabularyURL = saved })
+	return &requests
+}
+
+// waitFetched waits for background downloads to finish
+func waitFetched(t *testing.T) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		done := len(fetching) == 0
+		mu.Unlock()
+		if done {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for the vocabulary download")
+}
+
+func TestForModel_BPE(t *testing.T) {
+	dir := t.TempDir()
+	writeVocabulary(t, dir)
+	SetCacheDir(dir)
+	resetEncodings()
+	defer SetCacheDir("")
+	defer resetEncodings()
+
+	counter := ForModel("gpt-4")
+	if _, ok := counter.(BPE); !ok {
+		t.Fatalf("Expected a BPE counter, got %T", counter)
+	}
+	if got := counter.Count("hello hello"); got != 3 {
+		t.Errorf("Expected hello, space and hello to be 3 tokens, got %d", got)
+	}
+
+	if _, ok := ForModel("llama3.2").(Heuristic); !ok {
+		t.Error("Expected the heuristic for a non-OpenAI model")
+	}
+}
+
+func TestForModel_NoCacheDir(t *testing.T) {
+	SetCacheDir("")
+	resetEncodings()
+	defer resetEncodings()
+
+	if _, ok := ForModel("gpt-4o").(Heuristic); !ok {
+		t.Error("Expected the heuristic when the vocabulary cannot be loaded")
+	}
+}
+
+func TestForModel_NoDownload(t *testing.T) {
+	requests := serveVocabulary(t, http.StatusOK)
+	SetCacheDir(t.TempDir())
+	SetDownload(false)
+	resetEncodings()
+	defer SetCacheDir("")
+	defer resetEncodings()
+
+	ForModel("gpt-4o")
+	ForModel("gpt-35-turbo")
+	waitFetched(t)
+	if n := requests.Load(); n != 0 {
+		t.Errorf("Expected no downloads unless enabled, got %d", n)
+	}
+}
+
+func TestForModel_FetchesInBackground(t *testing.T) {
+	requests := serveVocabulary(t, http.StatusOK)
+	SetCacheDir(t.TempDir())
+	SetDownload(true)
+	resetEncodings()
+	defer SetCacheDir("")
+	defer SetDownload(false)
+	defer resetEncodings()
+
+	// tiktoken keeps loaded encodings, so this test has o200k_base to itself
+	if _, ok := ForModel("gpt-4o").(Heuristic); !ok {
+		t.Error("Expected the heuristic while the vocabulary is downloaded")
+	}
+	waitFetched(t)
+
+	counter := ForModel("gpt-4o")
+	if _, ok := counter.(BPE); !ok {
+		t.Fatalf("Expected a BPE counter once downloaded, got %T", counter)
+	}
+	if got := counter.Count("hello hello"); got != 3 {
+		t.Errorf("Expected 3 tokens, got %d", got)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("Expected one download, got %d", n)
+	}
+}
+
+func TestForModel_FailedFetch(t *testing.T) {
+	requests := serveVocabulary(t, http.StatusInternalServerError)
+	dir := t.TempDir()
+	SetCacheDir(dir)
+	defer SetCacheDir("")
+	defer resetEncodings()
+
+	// Downloads are tested without loading, as tiktoken keeps loaded encodings
+	mu.Lock()
+	resetFetches()
+	fetch("cl100k_base")
+	mu.Unlock()
+	waitFetched(t)
+
+	mu.Lock()
+	fetch("cl100k_base")
+	mu.Unlock()
+	waitFetched(t)
+	if n := requests.Load(); n != 1 {
+		t.Errorf("Expected a failed download not to be retried right away, got %d requests", n)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cl100k_base.tiktoken")); !os.IsNotExist(err) {
+		t.Error("Expected nothing to be cached after a failed download")
+	}
+
+	// Retried once the failure is old enough
+	serveVocabulary(t, http.StatusOK)
+	mu.Lock()
+	failed["cl100k_base"] = time.Now().Add(-retryAfter)
+	fetch("cl100k_base")
+	mu.Unlock()
+	waitFetched(t)
+	if _, err := os.Stat(filepath.Join(dir, "cl100k_base.tiktoken")); err != nil {
+		t.Errorf("Expected the vocabulary to be cached after a retry: %v", err)
+	}
+}
+
+func TestLookupWindow(t *testing.T) {
+	overrides := map[string]int{"llama3.2": 16384, "my-finetune": 4096}
+	tests := []struct {
+		model string
+		want  int
+	}{
+		{"gpt-4o-mini", 128000},
+		{"gpt-4-0613", 8192},
+		{"gpt-4-turbo-preview", 128000},
+		{"claude-sonnet-4-20250514", 200000},
+		{"llama3.2:latest", 16384},
+		{"llama3:8b", 8192},
+		{"my-finetune-v2", 4096},
+		{"meta-llama/Llama-3.3-70B", 131072},
+		{"unknown", 0},
+	}
+	for _, tt := range tests {
+		if got := LookupWindow(tt.model, overrides); got != tt.want {
+			t.Errorf("LookupWindow(%s) = %d, want %d", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestResolveWindow(t *testing.T) {
+	overrides := map[string]int{"llama3.2": 16384}
+	reported := func() int { return 4096 }
+
+	if got := ResolveWindow("llama3.2:latest", overrides, func() int {
+		t.Error("Expected the server not to be asked when an override matches")
+		return 0
+	}); got != 16384 {
+		t.Errorf("Expected the override, got %d", got)
+	}
+	if got := ResolveWindow("qwen2.5-coder", overrides, reported); got != 4096 {
+		t.Errorf("Expected the reported window, got %d", got)
+	}
+	if got := ResolveWindow("gpt-4o", nil, func() int { return 0 }); got != 128000 {
+		t.Errorf("Expected the built-in window, got %d", got)
+	}
+	if got := ResolveWindow("unknown", nil, nil); got != DefaultWindow {
+		t.Errorf("Expected the default window, got %d", got)
+	}
+}
@@ -0,0 +1,90 @@
+// Package tokenizer provides the context window of common models
+package tokenizer
+
+import "strings"
+
+// DefaultWindow is assumed for models whose window is unknown
+const DefaultWindow = 8192
+
+// Windows are the context windows, in tokens, of common models matched by
+// name prefix; the longest matching prefix wins
+var Windows = map[string]int{
+	"gpt-4o":        128000,
+	"chatgpt-4o":    128000,
+	"gpt-4.1":       1047576,
+	"gpt-4.5":       128000,
+	"gpt-5":         400000,
+	"gpt-4-turbo":   128000,
+	"gpt-4-32k":     32768,
+	"gpt-4":         8192,
+	"gpt-3.5-turbo": 16385,
+	"gpt-35-turbo":  16385,
+	"o1":            200000,
+	"o3":            200000,
+	"o4-mini":       200000,
+	"claude-":       200000,
+	"llama3.1":      131072,
+	"llama3.2":      131072,
+	"llama3.3":      131072,
+	"llama3":        8192,
+	"llama-3.1":     131072,
+	"llama-3.2":     131072,
+	"llama-3.3":     131072,
+	"qwen2.5":       32768,
+	"qwen3":         40960,
+	"mistral":       32768,
+	"mixtral":       32768,
+	"gemma2":        8192,
+	"gemma3":        131072,
+	"phi3":          4096,
+	"phi4":          16384,
+	"deepseek-r1":   131072,
+	"deepseek-v3":   131072,
+	"codellama":     16384,
+}
+
+// LookupWindow returns the context window of a model from the overrides,
+// keyed by model name or prefix, or else from Windows. It returns 0 when
+// the model is in neither.
+func LookupWindow(model string, overrides map[string]int) int {
+	if window := longestPrefix(model, overrides); window > 0 {
+		return window
+	}
+	name := strings.ToLower(model)
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return longestPrefix(name, Windows)
+}
+
+// ResolveWindow returns the context window of a model: from the overrides
+// if configured, else as reported by the server, else from Windows, and
+// DefaultWindow as the last resort. reported may be nil, and is only
+// called when no override matches.
+func ResolveWindow(model string, overrides map[string]int, reported func() int) int {
+	if window := longestPrefix(model, overrides); window > 0 {
+		return window
+	}
+	if reported != nil {
+		if window := reported(); window > 0 {
+			return window
+		}
+	}
+	if window := LookupWindow(model, nil); window > 0 {
+		return window
+	}
+	return DefaultWindow
+}
+
+func longestPrefix(model string, windows map[string]int) int {
+	var best string
+	for prefix := range windows {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return 0
+	}
+	return windows[best]
+}
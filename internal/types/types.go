@@ -60,17 +60,29 @@ func (r RiskLevel) Emoji() string {
 
 // SystemContext contains information about the current system state
 type SystemContext struct {
-	OS               string   `json:"os"`
-	Shell            string   `json:"shell"`
-	CurrentDir       string   `json:"current_dir"`
-	HomeDir          string   `json:"home_dir"`
-	Username         string   `json:"username"`
-	GitBranch        string   `json:"git_branch,omitempty"`
-	GitStatus        string   `json:"git_status,omitempty"`
-	GitRemote        string   `json:"git_remote,omitempty"`
-	EnvVars          []string `json:"env_vars,omitempty"`
-	RecentCmds       []string `json:"recent_cmds,omitempty"`
-	InstalledPkgMgrs []string `json:"installed_pkg_mgrs,omitempty"`
+	OS               string      `json:"os"`
+	Shell            string      `json:"shell"`
+	CurrentDir       string      `json:"current_dir"`
+	HomeDir          string      `json:"home_dir"`
+	Username         string      `json:"username"`
+	GitBranch        string      `json:"git_branch,omitempty"`
+	GitStatus        string      `json:"git_status,omitempty"`
+	GitRemote        string      `json:"git_remote,omitempty"`
+	EnvVars          []string    `json:"env_vars,omitempty"`
+	RecentCmds       []string    `json:"recent_cmds,omitempty"`
+	InstalledPkgMgrs []string    `json:"installed_pkg_mgrs,omitempty"`
+	Environment      Environment `json:"environment"`
+}
+
+// Environment contains the infrastructure that tools target when a command
+// does not name one, such as the current kube context
+type Environment struct {
+	KubeContext        string `json:"kube_context,omitempty"`
+	KubeNamespace      string `json:"kube_namespace,omitempty"`
+	AWSProfile         string `json:"aws_profile,omitempty"`
+	GCloudProject      string `json:"gcloud_project,omitempty"`
+	TerraformWorkspace string `json:"terraform_workspace,omitempty"`
+	DBHost             string `json:"db_host,omitempty"`
 }
 
 // CommandResponse represents the AI-generated command response
@@ -81,19 +93,86 @@ type CommandResponse struct {
 	Confidence   float64   `json:"confidence"`
 	Alternatives []string  `json:"alternatives,omitempty"`
 	Warnings     []string  `json:"warnings,omitempty"`
+
+	// Provider and model that generated the response, which can differ from
+	// the configured ones when a fallback answered
+	Provider string `json:"-"`
+	Model    string `json:"-"`
+
+	// Tokens billed for the request that generated the response
+	Usage TokenUsage `json:"-"`
+}
+
+// TokenUsage represents token usage statistics from an API call
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
 }
 
 // CommandAnalysis contains the safety analysis of a command
 type CommandAnalysis struct {
-	Command       string           `json:"command"`
-	RiskLevel     RiskLevel        `json:"risk_level"`
-	RiskReasons   []string         `json:"risk_reasons"`
-	AffectedPaths []string         `json:"affected_paths"`
-	AffectedFiles []FileInfo       `json:"affected_files"`
-	Actions       []string         `json:"actions"`
-	Reversible    bool             `json:"reversible"`
-	RequiresSudo  bool             `json:"requires_sudo"`
-	Patterns      []MatchedPattern `json:"matched_patterns"`
+	Command              string           `json:"command"`
+	RiskLevel            RiskLevel        `json:"risk_level"`
+	RiskReasons          []string         `json:"risk_reasons"`
+	AffectedPaths        []string         `json:"affected_paths"`
+	AffectedFiles        []FileInfo       `json:"affected_files"`
+	WritePaths           []string         `json:"write_paths,omitempty"` // paths the command writes, moves or deletes
+	FileCount            int              `json:"file_count,omitempty"`
+	TotalBytes           int64            `json:"total_bytes,omitempty"`
+	FileCountTruncated   bool             `json:"file_count_truncated,omitempty"` // counting stopped early
+	Actions              []string         `json:"actions"`
+	Reversible           bool             `json:"reversible"`
+	RequiresSudo         bool             `json:"requires_sudo"`
+	Patterns             []MatchedPattern `json:"matched_patterns"`
+	RequiresConfirmation bool             `json:"requires_confirmation,omitempty"` // never auto-execute
+	Targets              []Target         `json:"targets,omitempty"`
+	RequiresTypedConfirm bool             `json:"requires_typed_confirm,omitempty"` // type the risk level before running
+	GitLoss              *GitLoss         `json:"git_loss,omitempty"`               // uncommitted git work the command discards
+}
+
+// GitLoss is the uncommitted work in a git repository that a command would
+// discard, such as changes reset by git reset --hard or files removed by
+// git clean
+type GitLoss struct {
+	Repo    string      `json:"repo"` // top-level directory of the repository
+	Changes []GitChange `json:"changes"`
+	Ignored bool        `json:"ignored,omitempty"` // changes include ignored files (git clean -x)
+	Stash   string      `json:"stash,omitempty"`   // commit of the stash the command drops
+}
+
+// GitChange is a file with uncommitted work, or a stash
+type GitChange struct {
+	Status string `json:"status"` // git status --short code, like "M " or "??", or "stash"
+	Path   string `json:"path"`   // relative to the repository
+}
+
+// GitSafetyRef is a git ref keeping the uncommitted work a command discarded
+type GitSafetyRef struct {
+	Repo  string   `json:"repo"`
+	Ref   string   `json:"ref"`             // under refs/sosomi/
+	Stash bool     `json:"stash,omitempty"` // the ref is a stash, restored with git stash apply
+	Paths []string `json:"paths,omitempty"` // paths restored from a snapshot ref
+}
+
+// Target is an environment a command acts on, such as a kube context or an
+// ssh host
+type Target struct {
+	Kind       string `json:"kind"` // kube context, kube namespace, aws profile, gcloud project, terraform workspace, db host or ssh host
+	Name       string `json:"name"`
+	Production bool   `json:"production,omitempty"` // matches safety.production_patterns
+}
+
+// Candidate is one of several generated commands together with its analysis
+type Candidate struct {
+	Response *CommandResponse
+	Analysis *CommandAnalysis
+}
+
+// Valid reports whether the candidate has a command that is not blocked
+func (c Candidate) Valid() bool {
+	return c.Response != nil && c.Response.Command != "" &&
+		c.Analysis != nil && c.Analysis.RiskLevel < RiskCritical
 }
 
 // FileInfo contains information about a file that may be affected
@@ -129,6 +208,34 @@ type HistoryEntry struct {
 	TotalTokens      int       `json:"total_tokens,omitempty"`
 }
 
+// BackupFile describes a single filesystem entry captured before execution
+type BackupFile struct {
+	Path    string    `json:"path"`
+	Hash    string    `json:"hash,omitempty"` // content hash in the backup store (regular files only)
+	Mode    uint32    `json:"mode"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	IsDir   bool      `json:"is_dir,omitempty"`
+	Link    string    `json:"link,omitempty"`    // symlink target
+	Created bool      `json:"created,omitempty"` // did not exist before the command, removed on undo
+}
+
+// Backup represents a pre-execution snapshot of the files a command touches
+type Backup struct {
+	ID         string       `json:"id"`
+	CommandID  string       `json:"command_id"`
+	CreatedAt  time.Time    `json:"created_at"`
+	RestoredAt *time.Time   `json:"restored_at,omitempty"`
+	Command    string       `json:"command"`
+	WorkingDir string       `json:"working_dir"`
+	Files      []BackupFile `json:"files"`
+	TotalSize  int64        `json:"total_size"`
+
+	// Uncommitted git work kept under a safety ref, when the command
+	// discarded some
+	Git *GitSafetyRef `json:"git,omitempty"`
+}
+
 // MCPTool represents a tool exposed via MCP
 type MCPTool struct {
 	Name        string                 `json:"name"`
@@ -138,6 +245,7 @@ type MCPTool struct {
 
 // MCPToolCall represents a call to an MCP tool
 type MCPToolCall struct {
+	ID        string                 `json:"id,omitempty"`
 	Name      string                 `json:"name"`
 	Arguments map[string]interface{} `json:"arguments"`
 }
@@ -148,6 +256,43 @@ type MCPToolResult struct {
 	IsError bool   `json:"isError,omitempty"`
 }
 
+// MCPResource describes a resource offered by an MCP server
+type MCPResource struct {
+	Server      string `json:"server,omitempty"` // the server offering it, set by sosomi
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// MCPResourceContent is the content of a resource read from an MCP server
+type MCPResourceContent struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"` // base64 encoded binary content
+}
+
+// MCPPrompt describes a prompt template offered by an MCP server
+type MCPPrompt struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description,omitempty"`
+	Arguments   []MCPPromptArgument `json:"arguments,omitempty"`
+}
+
+// MCPPromptArgument describes an argument of an MCP prompt
+type MCPPromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// MCPPromptMessage is a message produced by an MCP prompt
+type MCPPromptMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
 // ExecutionMode represents how commands should be executed
 type ExecutionMode int
 
@@ -176,10 +321,23 @@ type Conversation struct {
 type ConversationMessage struct {
 	ID             string    `json:"id"`
 	ConversationID string    `json:"conversation_id"`
-	Role           string    `json:"role"` // "system", "user", "assistant", "tool"
+	Role           string    `json:"role"` // "system", "user", "assistant", "tool", "summary"
 	Content        string    `json:"content"`
 	CreatedAt      time.Time `json:"created_at"`
 	Tokens         int       `json:"tokens,omitempty"`
+
+	// Tokens billed for the request that produced an assistant message
+	PromptTokens     int `json:"prompt_tokens,omitempty"`
+	CompletionTokens int `json:"completion_tokens,omitempty"`
+
+	ToolCalls  []MCPToolCall `json:"tool_calls,omitempty"`   // Tools requested by an assistant message
+	ToolCallID string        `json:"tool_call_id,omitempty"` // Call answered by a "tool" message
+	ToolName   string        `json:"tool_name,omitempty"`    // Tool that produced a "tool" message
+	ToolError  bool          `json:"tool_error,omitempty"`   // The "tool" message reports a failed call
+
+	// Number of messages, from the start of the conversation, that a
+	// "summary" message replaces in the context sent to the model
+	SummaryOf int `json:"summary_of,omitempty"`
 }
 
 // ConversationExport represents a conversation for export/import
@@ -209,11 +367,15 @@ type Session struct {
 type SessionMessage struct {
 	ID        string    `json:"id"`
 	SessionID string    `json:"session_id"`
-	Role      string    `json:"role"` // "user", "assistant", "system", "execution"
+	Role      string    `json:"role"` // "user", "assistant", "system", "execution", "summary"
 	Content   string    `json:"content"`
 	CreatedAt time.Time `json:"created_at"`
 	Tokens    int       `json:"tokens,omitempty"`
 
+	// Tokens billed for the request that produced an assistant message
+	PromptTokens     int `json:"prompt_tokens,omitempty"`
+	CompletionTokens int `json:"completion_tokens,omitempty"`
+
 	// Execution-specific fields (when Role == "execution")
 	Command   string    `json:"command,omitempty"`
 	Output    string    `json:"output,omitempty"`
@@ -221,6 +383,10 @@ type SessionMessage struct {
 	RiskLevel RiskLevel `json:"risk_level,omitempty"`
 	Duration  int64     `json:"duration_ms,omitempty"`
 	Executed  bool      `json:"executed,omitempty"`
+
+	// Number of messages, from the start of the session, that a "summary"
+	// message replaces in the context sent to the model
+	SummaryOf int `json:"summary_of,omitempty"`
 }
 
 // SessionExport represents a session for export/import
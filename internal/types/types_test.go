@@ -306,3 +306,23 @@ func TestExecutionMode_Values(t *testing.T) {
 		t.Errorf("Expected ModeInteractive to be 0, got %d", ModeInteractive)
 	}
 }
+
+func TestCandidate_Valid(t *testing.T) {
+	tests := []struct {
+		name      string
+		candidate Candidate
+		expected  bool
+	}{
+		{"safe command", Candidate{&CommandResponse{Command: "ls"}, &CommandAnalysis{RiskLevel: RiskSafe}}, true},
+		{"dangerous command", Candidate{&CommandResponse{Command: "rm -r build"}, &CommandAnalysis{RiskLevel: RiskDangerous}}, true},
+		{"critical command", Candidate{&CommandResponse{Command: "rm -rf /"}, &CommandAnalysis{RiskLevel: RiskCritical}}, false},
+		{"empty command", Candidate{&CommandResponse{}, &CommandAnalysis{}}, false},
+		{"not analyzed", Candidate{&CommandResponse{Command: "ls"}, nil}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.candidate.Valid(); got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
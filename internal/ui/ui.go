@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/fatih/color"
 
@@ -99,6 +100,41 @@ func PrintRiskLevel(level types.RiskLevel, reasons []string) {
 	}
 }
 
+// PrintTargets displays the environments a command targets on one line,
+// with production ones highlighted
+func PrintTargets(targets []types.Target) {
+	if len(targets) == 0 {
+		return
+	}
+	parts := make([]string, len(targets))
+	for i, target := range targets {
+		parts[i] = target.Kind + " " + Bold(target.Name)
+		if target.Production {
+			parts[i] = target.Kind + " " + Bold(Red(target.Name)) + " " + Red("PRODUCTION")
+		}
+	}
+	fmt.Printf("   🎯 %s\n", strings.Join(parts, Dim(" · ")))
+}
+
+// maxGitChanges is how many uncommitted changes are listed before the rest
+// are summarized
+const maxGitChanges = 10
+
+// PrintGitLoss lists the uncommitted git work a command discards, if any
+func PrintGitLoss(loss *types.GitLoss) {
+	if loss == nil || len(loss.Changes) == 0 {
+		return
+	}
+	fmt.Printf("   🌿 %s %s\n", Warning("Discards uncommitted work in"), Bold(loss.Repo))
+	for i, change := range loss.Changes {
+		if i == maxGitChanges {
+			fmt.Printf("      %s\n", Dim(fmt.Sprintf("... and %d more", len(loss.Changes)-maxGitChanges)))
+			break
+		}
+		fmt.Printf("      %s %s\n", Yellow(fmt.Sprintf("%-5s", change.Status)), change.Path)
+	}
+}
+
 // PrintAnalysis displays the full command analysis
 func PrintAnalysis(analysis *types.CommandAnalysis) {
 	width := 60
@@ -132,6 +168,25 @@ func PrintAnalysis(analysis *types.CommandAnalysis) {
 	// Empty line
 	fmt.Printf("%s%s%s\n", BoxVertical, strings.Repeat(" ", width), BoxVertical)
 
+	// Environments the command targets, production ones highlighted
+	if len(analysis.Targets) > 0 {
+		fmt.Printf("%s  🎯 Environment:%s%s\n", BoxVertical, strings.Repeat(" ", width-16), BoxVertical)
+		for _, target := range analysis.Targets {
+			tag := ""
+			if target.Production {
+				tag = "  PRODUCTION"
+			}
+			prefix := fmt.Sprintf("     • %s ", target.Kind)
+			targetLine := prefix + truncate(target.Name, width-len(prefix)-len(tag))
+			padding := width - len(targetLine) - len(tag) + 2
+			if target.Production {
+				targetLine = prefix + Bold(Red(strings.TrimPrefix(targetLine, prefix))) + "  " + Red("PRODUCTION")
+			}
+			fmt.Printf("%s%s%s%s\n", BoxVertical, targetLine, strings.Repeat(" ", padding), BoxVertical)
+		}
+		fmt.Printf("%s%s%s\n", BoxVertical, strings.Repeat(" ", width), BoxVertical)
+	}
+
 	// Affected files
 	if len(analysis.AffectedPaths) > 0 {
 		fmt.Printf("%s  📁 Affected Files:%s%s\n", BoxVertical, strings.Repeat(" ", width-19), BoxVertical)
@@ -142,6 +197,29 @@ func PrintAnalysis(analysis *types.CommandAnalysis) {
 		fmt.Printf("%s%s%s\n", BoxVertical, strings.Repeat(" ", width), BoxVertical)
 	}
 
+	// Uncommitted git work the command discards
+	if loss := analysis.GitLoss; loss != nil && len(loss.Changes) > 0 {
+		fmt.Printf("%s  🌿 Uncommitted Work:%s%s\n", BoxVertical, strings.Repeat(" ", width-21), BoxVertical)
+		for i, change := range loss.Changes {
+			changeLine := fmt.Sprintf("     • %-5s %s", change.Status, truncate(change.Path, 44))
+			if i == maxGitChanges {
+				changeLine = fmt.Sprintf("     ... and %d more", len(loss.Changes)-maxGitChanges)
+			}
+			fmt.Printf("%s%s%s%s\n", BoxVertical, changeLine, strings.Repeat(" ", width-len(changeLine)+2), BoxVertical)
+			if i == maxGitChanges {
+				break
+			}
+		}
+		fmt.Printf("%s%s%s\n", BoxVertical, strings.Repeat(" ", width), BoxVertical)
+	}
+
+	// Real file count after expanding globs and directories
+	if analysis.FileCount > 0 {
+		scopeLine := "  📊 Scope:     " + FormatFileScope(analysis)
+		fmt.Printf("%s%s%s%s\n", BoxVertical, scopeLine, strings.Repeat(" ", width-len(scopeLine)+2), BoxVertical)
+		fmt.Printf("%s%s%s\n", BoxVertical, strings.Repeat(" ", width), BoxVertical)
+	}
+
 	// Actions
 	if len(analysis.Actions) > 0 {
 		fmt.Printf("%s  ⚡ Actions:%s%s\n", BoxVertical, strings.Repeat(" ", width-12), BoxVertical)
@@ -175,6 +253,19 @@ func PrintConfirmPrompt() {
 	fmt.Print("\n  Choice: ")
 }
 
+// PrintTypedConfirmPrompt asks to type the risk level of a command to run it
+func PrintTypedConfirmPrompt(risk types.RiskLevel) {
+	fmt.Printf("\n  %s Type %s to run this command: ", risk.Emoji(), Bold(strings.ToLower(risk.String())))
+}
+
+// PrintGitSafetyPrompt asks how to keep uncommitted git work before a
+// command discards it
+func PrintGitSafetyPrompt() {
+	fmt.Println()
+	fmt.Println("  🛟 Keep these changes first?  [r] Safety ref  [s] Stash  [n] No")
+	fmt.Print("\n  Choice [r]: ")
+}
+
 // PrintRetryPrompt displays the post-execution retry prompt
 func PrintRetryPrompt() {
 	fmt.Println()
@@ -262,6 +353,16 @@ func (s *Spinner) Frame() string {
 	return fmt.Sprintf("\r%s %s", Cyan(frame), s.message)
 }
 
+// SetMessage changes the message shown next to the spinner
+func (s *Spinner) SetMessage(message string) {
+	s.message = message
+}
+
+// Clear returns the sequence erasing the spinner line
+func (s *Spinner) Clear() string {
+	return "\r" + strings.Repeat(" ", utf8.RuneCountInString(s.message)+2) + "\r"
+}
+
 // Helper functions
 
 func getRiskColor(level types.RiskLevel) func(a ...interface{}) string {
@@ -281,6 +382,29 @@ func getRiskColor(level types.RiskLevel) func(a ...interface{}) string {
 	}
 }
 
+// FormatSize converts bytes to a human-readable size string
+func FormatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// FormatFileScope describes how many files a command affects
+func FormatFileScope(analysis *types.CommandAnalysis) string {
+	count := fmt.Sprintf("%d", analysis.FileCount)
+	if analysis.FileCountTruncated {
+		count += "+"
+	}
+	return fmt.Sprintf("%s files, %s", count, FormatSize(analysis.TotalBytes))
+}
+
 func truncate(s string, maxLen int) string {
 	if len(s) <= maxLen {
 		return s
@@ -575,3 +699,68 @@ func FilterSessions(sessions []*types.Session, query string) []*types.Session {
 	}
 	return result
 }
+
+// RiskBadge returns the emoji and colored name of a risk level
+func RiskBadge(level types.RiskLevel) string {
+	return fmt.Sprintf("%s %s", level.Emoji(), getRiskColor(level)(fmt.Sprintf("%-9s", level.String())))
+}
+
+// CandidatePicker lets the user choose among ranked candidate commands.
+// selected is the candidate used when the user just presses Enter, -1 for
+// none. Returns the index of the chosen candidate, or -1 if canceled.
+func CandidatePicker(candidates []types.Candidate, selected int) (int, error) {
+	return pickCandidate(bufio.NewReader(os.Stdin), candidates, selected)
+}
+
+func pickCandidate(reader *bufio.Reader, candidates []types.Candidate, selected int) (int, error) {
+	for {
+		fmt.Println()
+		fmt.Printf("🎲 %s\n", Bold(fmt.Sprintf("%d candidate commands:", len(candidates))))
+		fmt.Println()
+
+		for i, c := range candidates {
+			marker := " "
+			if i == selected {
+				marker = Cyan("›")
+			}
+			level := c.Response.RiskLevel
+			if c.Analysis != nil {
+				level = c.Analysis.RiskLevel
+			}
+			command := c.Response.Command
+			if command == "" {
+				command = Dim("(no command)")
+			}
+			fmt.Printf(" %s %s  %s  %s\n", marker, Cyan(fmt.Sprintf("%-2d", i+1)), RiskBadge(level), command)
+			if c.Response.Explanation != "" {
+				fmt.Printf("       %s\n", Dim(truncate(strings.Split(c.Response.Explanation, "\n")[0], 70)))
+			}
+		}
+
+		fmt.Println()
+		if selected >= 0 {
+			fmt.Printf("  [1-%d] Select  [Enter] Use %d  [q] Cancel\n", len(candidates), selected+1)
+		} else {
+			fmt.Printf("  [1-%d] Select  [q] Cancel\n", len(candidates))
+		}
+		fmt.Print("\n  Choice: ")
+
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			return -1, err
+		}
+		input = strings.TrimSpace(strings.ToLower(input))
+
+		switch {
+		case input == "":
+			return selected, nil
+		case input == "q" || input == "quit":
+			return -1, nil
+		default:
+			if num, err := strconv.Atoi(input); err == nil && num >= 1 && num <= len(candidates) {
+				return num - 1, nil
+			}
+			fmt.Printf("  Invalid option. Please enter a number from 1 to %d\n", len(candidates))
+		}
+	}
+}
@@ -2,7 +2,9 @@
 package ui
 
 import (
+	"bufio"
 	"bytes"
+	"fmt"
 	"io"
 	"os"
 	"strings"
@@ -167,6 +169,61 @@ func TestPrintAnalysis(t *testing.T) {
 	}
 }
 
+func TestPrintAnalysis_Targets(t *testing.T) {
+	analysis := &types.CommandAnalysis{
+		Command:   "kubectl delete pod web-1",
+		RiskLevel: types.RiskDangerous,
+		Targets: []types.Target{
+			{Kind: "kube context", Name: "prod-eu", Production: true},
+			{Kind: "kube namespace", Name: "payments"},
+		},
+		Reversible: true,
+	}
+
+	output := captureOutput(func() {
+		PrintAnalysis(analysis)
+	})
+
+	for _, expected := range []string{"Environment:", "kube context prod-eu", "PRODUCTION", "kube namespace payments"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("PrintAnalysis should contain '%s'", expected)
+		}
+	}
+	if strings.Count(output, "PRODUCTION") != 1 {
+		t.Errorf("Expected only the production target to be tagged, got:\n%s", output)
+	}
+}
+
+func TestPrintGitLoss(t *testing.T) {
+	loss := &types.GitLoss{Repo: "/src/app"}
+	for i := 0; i < maxGitChanges+3; i++ {
+		loss.Changes = append(loss.Changes, types.GitChange{Status: "??", Path: fmt.Sprintf("draft-%d.txt", i)})
+	}
+
+	output := captureOutput(func() {
+		PrintGitLoss(loss)
+	})
+	for _, expected := range []string{"/src/app", "draft-0.txt", "... and 3 more"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("PrintGitLoss should contain '%s', got:\n%s", expected, output)
+		}
+	}
+	if strings.Contains(output, fmt.Sprintf("draft-%d.txt", maxGitChanges)) {
+		t.Errorf("Expected changes past the limit to be summarized, got:\n%s", output)
+	}
+
+	analysisOutput := captureOutput(func() {
+		PrintAnalysis(&types.CommandAnalysis{Command: "git clean -f", GitLoss: loss})
+	})
+	if !strings.Contains(analysisOutput, "Uncommitted Work:") || !strings.Contains(analysisOutput, "... and 3 more") {
+		t.Errorf("PrintAnalysis should list uncommitted work, got:\n%s", analysisOutput)
+	}
+
+	if output := captureOutput(func() { PrintGitLoss(nil) }); output != "" {
+		t.Errorf("Expected no output without a loss, got %q", output)
+	}
+}
+
 func TestPrintConfirmPrompt(t *testing.T) {
 	output := captureOutput(func() {
 		PrintConfirmPrompt()
@@ -266,6 +323,14 @@ func TestSpinner(t *testing.T) {
 	if spinner == nil {
 		t.Error("NewSpinner returned nil")
 	}
+
+	spinner.SetMessage("Almost done")
+	if !strings.Contains(spinner.Frame(), "Almost done") {
+		t.Error("Expected the new message in the frame")
+	}
+	if clear := spinner.Clear(); clear != "\r"+strings.Repeat(" ", 13)+"\r" {
+		t.Errorf("Expected the line to be blanked, got %q", clear)
+	}
 }
 
 func TestFormatDuration(t *testing.T) {
@@ -280,6 +345,31 @@ func TestFormatDuration(t *testing.T) {
 	}
 }
 
+func TestFormatSize(t *testing.T) {
+	tests := map[int64]string{
+		0:           "0 B",
+		1023:        "1023 B",
+		1536:        "1.5 KB",
+		5 * 1 << 20: "5.0 MB",
+	}
+	for bytes, want := range tests {
+		if got := FormatSize(bytes); got != want {
+			t.Errorf("FormatSize(%d) = %q, want %q", bytes, got, want)
+		}
+	}
+}
+
+func TestFormatFileScope(t *testing.T) {
+	analysis := &types.CommandAnalysis{FileCount: 12, TotalBytes: 2048}
+	if got := FormatFileScope(analysis); got != "12 files, 2.0 KB" {
+		t.Errorf("Unexpected scope %q", got)
+	}
+	analysis.FileCountTruncated = true
+	if got := FormatFileScope(analysis); got != "12+ files, 2.0 KB" {
+		t.Errorf("Unexpected truncated scope %q", got)
+	}
+}
+
 func TestTruncate(t *testing.T) {
 	// Test the truncate function indirectly through PrintAnalysis
 	analysis := &types.CommandAnalysis{
@@ -477,3 +567,46 @@ func TestFilterSessions(t *testing.T) {
 		t.Errorf("Expected all 3 sessions with empty filter, got %d", len(filtered))
 	}
 }
+
+func TestPickCandidate(t *testing.T) {
+	candidates := []types.Candidate{
+		{
+			Response: &types.CommandResponse{Command: "ls build", Explanation: "List the build directory"},
+			Analysis: &types.CommandAnalysis{RiskLevel: types.RiskSafe},
+		},
+		{
+			Response: &types.CommandResponse{Command: "rm -rf ./build"},
+			Analysis: &types.CommandAnalysis{RiskLevel: types.RiskDangerous},
+		},
+	}
+
+	tests := []struct {
+		input    string
+		selected int
+		expected int
+	}{
+		{"\n", 0, 0},
+		{"2\n", 0, 1},
+		{"7\n1\n", 0, 0},
+		{"q\n", 0, -1},
+		{"\n", -1, -1},
+	}
+	for _, tt := range tests {
+		var got int
+		output := captureOutput(func() {
+			got, _ = pickCandidate(bufio.NewReader(strings.NewReader(tt.input)), candidates, tt.selected)
+		})
+		if got != tt.expected {
+			t.Errorf("Input %q: expected %d, got %d", tt.input, tt.expected, got)
+		}
+		for _, want := range []string{"ls build", "List the build directory", "DANGEROUS"} {
+			if !strings.Contains(output, want) {
+				t.Errorf("Expected %q in picker output", want)
+			}
+		}
+	}
+
+	if _, err := pickCandidate(bufio.NewReader(strings.NewReader("")), candidates, 0); err == nil {
+		t.Error("Expected an error when input ends")
+	}
+}
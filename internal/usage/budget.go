@@ -0,0 +1,65 @@
+// Package usage provides daily and monthly spending budgets
+package usage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrBudgetExceeded is returned when a hard budget has been used up
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// Budget limits spending in USD. A soft limit warns once reached, a hard
+// limit refuses further requests. Zero disables a limit.
+type Budget struct {
+	DailySoft   float64
+	DailyHard   float64
+	MonthlySoft float64
+	MonthlyHard float64
+}
+
+// Enabled reports whether any limit is set
+func (b Budget) Enabled() bool {
+	return b.DailySoft > 0 || b.DailyHard > 0 || b.MonthlySoft > 0 || b.MonthlyHard > 0
+}
+
+// Spending is what has been spent today and this month
+type Spending struct {
+	Today     float64
+	ThisMonth float64
+}
+
+// CurrentSpending returns what the ledger has recorded for the day and the
+// month of now
+func CurrentSpending(ledger *Ledger, now time.Time) (Spending, error) {
+	now = now.Local()
+	today, err := ledger.Spent(now)
+	if err != nil {
+		return Spending{}, err
+	}
+	month, err := ledger.Spent(time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()))
+	if err != nil {
+		return Spending{}, err
+	}
+	return Spending{Today: today, ThisMonth: month}, nil
+}
+
+// Check compares spending to the budget. It returns an error wrapping
+// ErrBudgetExceeded once a hard limit is reached, and otherwise a warning
+// once a soft limit is reached.
+func (b Budget) Check(spent Spending) (warning string, err error) {
+	if b.DailyHard > 0 && spent.Today >= b.DailyHard {
+		return "", fmt.Errorf("%w: spent $%.2f of the $%.2f daily limit", ErrBudgetExceeded, spent.Today, b.DailyHard)
+	}
+	if b.MonthlyHard > 0 && spent.ThisMonth >= b.MonthlyHard {
+		return "", fmt.Errorf("%w: spent $%.2f of the $%.2f monthly limit", ErrBudgetExceeded, spent.ThisMonth, b.MonthlyHard)
+	}
+	if b.DailySoft > 0 && spent.Today >= b.DailySoft {
+		return fmt.Sprintf("spent $%.2f today, over the $%.2f daily budget", spent.Today, b.DailySoft), nil
+	}
+	if b.MonthlySoft > 0 && spent.ThisMonth >= b.MonthlySoft {
+		return fmt.Sprintf("spent $%.2f this month, over the $%.2f monthly budget", spent.ThisMonth, b.MonthlySoft), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,160 @@
+// Package usage provides a ledger of the tokens used and their cost
+package usage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// dayFormat is how days are stored, in local time so that daily budgets
+// reset at the user's midnight
+const dayFormat = "2006-01-02"
+
+// Entry is the usage of a single request
+type Entry struct {
+	Timestamp        time.Time
+	Provider         string
+	Model            string
+	Profile          string
+	Mode             string
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64
+}
+
+// Row is a line of a usage report
+type Row struct {
+	Key              string  `json:"key"`
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// Groupings a report can be broken down by
+var Groupings = []string{"day", "model", "profile", "mode"}
+
+// Ledger records the usage of every request
+type Ledger struct {
+	db *sql.DB
+}
+
+// NewLedger opens or creates a usage ledger
+func NewLedger(dbPath string) (*Ledger, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	ledger := &Ledger{db: db}
+	if err := ledger.initialize(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+
+	return ledger, nil
+}
+
+// initialize creates the database schema
+func (l *Ledger) initialize() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS usage (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+		day TEXT NOT NULL,
+		provider TEXT,
+		model TEXT,
+		profile TEXT,
+		mode TEXT,
+		prompt_tokens INTEGER DEFAULT 0,
+		completion_tokens INTEGER DEFAULT 0,
+		cost REAL DEFAULT 0
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_usage_day ON usage(day);
+	`
+
+	_, err := l.db.Exec(schema)
+	return err
+}
+
+// Add records the usage of a request
+func (l *Ledger) Add(entry Entry) error {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+
+	_, err := l.db.Exec(`
+		INSERT INTO usage (timestamp, day, provider, model, profile, mode, prompt_tokens, completion_tokens, cost)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		entry.Timestamp,
+		entry.Timestamp.Local().Format(dayFormat),
+		entry.Provider,
+		entry.Model,
+		entry.Profile,
+		entry.Mode,
+		entry.PromptTokens,
+		entry.CompletionTokens,
+		entry.Cost,
+	)
+	return err
+}
+
+// Spent returns the cost of the requests made on or after the day of since
+func (l *Ledger) Spent(since time.Time) (float64, error) {
+	var spent float64
+	err := l.db.QueryRow(
+		"SELECT COALESCE(SUM(cost), 0) FROM usage WHERE day >= ?",
+		since.Local().Format(dayFormat),
+	).Scan(&spent)
+	return spent, err
+}
+
+// Report sums the requests made on or after the day of since, broken down
+// by one of Groupings. Days are listed in order, everything else by cost.
+func (l *Ledger) Report(since time.Time, by string) ([]Row, error) {
+	var column, order string
+	switch by {
+	case "day":
+		column, order = "day", "day"
+	case "model":
+		column, order = "provider || '/' || model", "cost DESC"
+	case "profile":
+		column, order = "COALESCE(NULLIF(profile, ''), '(none)')", "cost DESC"
+	case "mode":
+		column, order = "mode", "cost DESC"
+	default:
+		return nil, fmt.Errorf("unknown grouping %q (use day, model, profile or mode)", by)
+	}
+
+	rows, err := l.db.Query(fmt.Sprintf(`
+		SELECT %s AS key, COUNT(*), COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0), COALESCE(SUM(cost), 0) AS cost
+		FROM usage
+		WHERE day >= ?
+		GROUP BY key
+		ORDER BY %s
+	`, column, order), since.Local().Format(dayFormat))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var report []Row
+	for rows.Next() {
+		var row Row
+		if err := rows.Scan(&row.Key, &row.Requests, &row.PromptTokens, &row.CompletionTokens, &row.Cost); err != nil {
+			return nil, err
+		}
+		report = append(report, row)
+	}
+	return report, rows.Err()
+}
+
+// Close closes the database connection
+func (l *Ledger) Close() error {
+	return l.db.Close()
+}
@@ -0,0 +1,102 @@
+// Package usage provides token pricing, a ledger of spending and budgets
+package usage
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Price is the cost of a model in USD per million tokens
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// Cost returns the cost in USD of a request
+func (p Price) Cost(promptTokens, completionTokens int) float64 {
+	return (float64(promptTokens)*p.Input + float64(completionTokens)*p.Output) / 1e6
+}
+
+// DefaultPrices are the list prices of common models. A model matches its
+// family exactly or as a dated snapshot such as gpt-4o-2024-08-06, so that
+// o3 does not price o3-pro and claude-opus-4 does not price later releases.
+var DefaultPrices = map[string]Price{
+	"gpt-4o":            {Input: 2.5, Output: 10},
+	"gpt-4o-mini":       {Input: 0.15, Output: 0.6},
+	"gpt-4.1":           {Input: 2, Output: 8},
+	"gpt-4.1-mini":      {Input: 0.4, Output: 1.6},
+	"gpt-4.1-nano":      {Input: 0.1, Output: 0.4},
+	"gpt-4-turbo":       {Input: 10, Output: 30},
+	"gpt-3.5-turbo":     {Input: 0.5, Output: 1.5},
+	"o3":                {Input: 2, Output: 8},
+	"o3-pro":            {Input: 20, Output: 80},
+	"o3-mini":           {Input: 1.1, Output: 4.4},
+	"o4-mini":           {Input: 1.1, Output: 4.4},
+	"claude-opus-4":     {Input: 15, Output: 75},
+	"claude-opus-4-1":   {Input: 15, Output: 75},
+	"claude-3-opus":     {Input: 15, Output: 75},
+	"claude-sonnet-4":   {Input: 3, Output: 15},
+	"claude-sonnet-4-5": {Input: 3, Output: 15},
+	"claude-3-7-sonnet": {Input: 3, Output: 15},
+	"claude-3-5-sonnet": {Input: 3, Output: 15},
+	"claude-3-5-haiku":  {Input: 0.8, Output: 4},
+	"claude-haiku-4-5":  {Input: 1, Output: 5},
+}
+
+// snapshotSuffix matches what follows a family name in the name of one of
+// its snapshots or aliases: a date (-2024-08-06, -20250514, -0125), -0 as
+// in claude-sonnet-4-0, -latest or -preview
+var snapshotSuffix = regexp.MustCompile(`^-(\d{4}(-\d{2}-\d{2})?|\d{8}|0|latest|preview)$`)
+
+// defaultPrice returns the list price of the family model belongs to
+func defaultPrice(model string) (Price, bool) {
+	model = strings.ToLower(model)
+	if price, ok := DefaultPrices[model]; ok {
+		return price, true
+	}
+	for family, price := range DefaultPrices {
+		if strings.HasPrefix(model, family) && snapshotSuffix.MatchString(model[len(family):]) {
+			return price, true
+		}
+	}
+	return Price{}, false
+}
+
+// localProviders run models on the user's machine and cost nothing
+var localProviders = map[string]bool{
+	"ollama":   true,
+	"lmstudio": true,
+	"llamacpp": true,
+}
+
+// Pricing looks up prices, preferring the user's overrides to the defaults
+type Pricing struct {
+	overrides map[string]Price
+}
+
+// NewPricing creates a pricing table. Override keys are either a model
+// name or "provider/model" to price a model only for one provider.
+func NewPricing(overrides map[string]Price) *Pricing {
+	return &Pricing{overrides: overrides}
+}
+
+// Lookup returns the price of a model and whether it is known
+func (p *Pricing) Lookup(provider, model string) (Price, bool) {
+	if price, ok := p.overrides[provider+"/"+model]; ok {
+		return price, true
+	}
+	if price, ok := p.overrides[model]; ok {
+		return price, true
+	}
+	if localProviders[provider] {
+		return Price{}, true
+	}
+	return defaultPrice(model)
+}
+
+// Cost returns the cost in USD of a request, which is zero for models
+// without a known price
+func (p *Pricing) Cost(provider, model string, promptTokens, completionTokens int) float64 {
+	price, _ := p.Lookup(provider, model)
+	return price.Cost(promptTokens, completionTokens)
+}
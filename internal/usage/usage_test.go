@@ -0,0 +1,142 @@
+// Package usage tests
+package usage
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPricing_Lookup(t *testing.T) {
+	pricing := NewPricing(map[string]Price{
+		"gpt-4o":               {Input: 1, Output: 2},
+		"openrouter/llama-3.3": {Input: 0.1, Output: 0.2},
+	})
+
+	tests := []struct {
+		provider, model string
+		want            Price
+		known           bool
+	}{
+		{"openai", "gpt-4o", Price{1, 2}, true},
+		{"openai", "gpt-4o-mini-2024-07-18", DefaultPrices["gpt-4o-mini"], true},
+		{"anthropic", "claude-sonnet-4-20250514", DefaultPrices["claude-sonnet-4"], true},
+		{"openrouter", "llama-3.3", Price{0.1, 0.2}, true},
+		{"ollama", "llama3.2", Price{}, true},
+		{"openai", "mystery-model", Price{}, false},
+		{"openai", "gpt-4-turbo-2024-04-09", DefaultPrices["gpt-4-turbo"], true},
+		{"openai", "gpt-3.5-turbo-0125", DefaultPrices["gpt-3.5-turbo"], true},
+		{"openai", "o3-2025-04-16", DefaultPrices["o3"], true},
+		{"openai", "o3-pro", DefaultPrices["o3-pro"], true},
+		{"openai", "o3-deep-research", Price{}, false},
+		{"anthropic", "claude-opus-4-0", DefaultPrices["claude-opus-4"], true},
+		{"anthropic", "claude-opus-4-1-20250805", DefaultPrices["claude-opus-4-1"], true},
+		{"anthropic", "claude-opus-4-7", Price{}, false},
+		{"anthropic", "claude-3-5-sonnet-latest", DefaultPrices["claude-3-5-sonnet"], true},
+		{"azure", "prod-gpt4o", Price{}, false},
+		{"azure", "gpt-4o", Price{1, 2}, true},
+	}
+	for _, tt := range tests {
+		got, known := pricing.Lookup(tt.provider, tt.model)
+		if got != tt.want || known != tt.known {
+			t.Errorf("Lookup(%s, %s) = %+v, %v; want %+v, %v", tt.provider, tt.model, got, known, tt.want, tt.known)
+		}
+	}
+
+	if cost := pricing.Cost("openai", "gpt-4o", 1000000, 500000); cost != 2 {
+		t.Errorf("Expected $2, got %v", cost)
+	}
+}
+
+func newTestLedger(t *testing.T) *Ledger {
+	ledger, err := NewLedger(filepath.Join(t.TempDir(), "usage.db"))
+	if err != nil {
+		t.Fatalf("NewLedger failed: %v", err)
+	}
+	t.Cleanup(func() { ledger.Close() })
+	return ledger
+}
+
+func TestLedger_Report(t *testing.T) {
+	ledger := newTestLedger(t)
+	now := time.Now()
+	entries := []Entry{
+		{Timestamp: now, Provider: "openai", Model: "gpt-4o", Profile: "work", Mode: "command", PromptTokens: 100, CompletionTokens: 10, Cost: 0.5},
+		{Timestamp: now, Provider: "openai", Model: "gpt-4o", Mode: "chat", PromptTokens: 200, CompletionTokens: 20, Cost: 1},
+		{Timestamp: now.AddDate(0, 0, -40), Provider: "anthropic", Model: "claude-sonnet-4", Mode: "chat", Cost: 3},
+	}
+	for _, e := range entries {
+		if err := ledger.Add(e); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	byModel, err := ledger.Report(now.AddDate(0, 0, -30), "model")
+	if err != nil {
+		t.Fatalf("Report failed: %v", err)
+	}
+	if len(byModel) != 1 || byModel[0].Key != "openai/gpt-4o" || byModel[0].Requests != 2 || byModel[0].PromptTokens != 300 {
+		t.Errorf("Unexpected report by model %+v", byModel)
+	}
+
+	byProfile, _ := ledger.Report(now.AddDate(0, 0, -30), "profile")
+	if len(byProfile) != 2 || byProfile[0].Key != "(none)" || byProfile[1].Key != "work" {
+		t.Errorf("Unexpected report by profile %+v", byProfile)
+	}
+
+	byDay, _ := ledger.Report(now.AddDate(0, 0, -60), "day")
+	if len(byDay) != 2 || byDay[1].Key != now.Format(dayFormat) {
+		t.Errorf("Expected days in order, got %+v", byDay)
+	}
+
+	if _, err := ledger.Report(now, "week"); err == nil {
+		t.Error("Expected an error for an unknown grouping")
+	}
+
+	spent, _ := ledger.Spent(now)
+	if math.Abs(spent-1.5) > 1e-9 {
+		t.Errorf("Expected $1.50 spent today, got %v", spent)
+	}
+}
+
+func TestBudget_Check(t *testing.T) {
+	budget := Budget{DailySoft: 1, DailyHard: 2, MonthlySoft: 10, MonthlyHard: 20}
+
+	if warning, err := budget.Check(Spending{Today: 0.5, ThisMonth: 5}); warning != "" || err != nil {
+		t.Errorf("Expected no warning under budget, got %q, %v", warning, err)
+	}
+	if warning, err := budget.Check(Spending{Today: 1.2, ThisMonth: 5}); !strings.Contains(warning, "daily budget") || err != nil {
+		t.Errorf("Expected a daily warning, got %q, %v", warning, err)
+	}
+	if warning, err := budget.Check(Spending{Today: 0.5, ThisMonth: 12}); !strings.Contains(warning, "monthly budget") || err != nil {
+		t.Errorf("Expected a monthly warning, got %q, %v", warning, err)
+	}
+	if _, err := budget.Check(Spending{Today: 2, ThisMonth: 5}); !errors.Is(err, ErrBudgetExceeded) || !strings.Contains(err.Error(), "daily limit") {
+		t.Errorf("Expected the daily limit to refuse, got %v", err)
+	}
+	if _, err := budget.Check(Spending{Today: 0, ThisMonth: 25}); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Expected the monthly limit to refuse, got %v", err)
+	}
+	if (Budget{}).Enabled() {
+		t.Error("Expected an empty budget to be disabled")
+	}
+}
+
+func TestCurrentSpending(t *testing.T) {
+	ledger := newTestLedger(t)
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.Local)
+	ledger.Add(Entry{Timestamp: now, Cost: 1})
+	ledger.Add(Entry{Timestamp: now.AddDate(0, 0, -3), Cost: 2})
+	ledger.Add(Entry{Timestamp: now.AddDate(0, -1, 0), Cost: 4})
+
+	spent, err := CurrentSpending(ledger, now)
+	if err != nil {
+		t.Fatalf("CurrentSpending failed: %v", err)
+	}
+	if spent.Today != 1 || spent.ThisMonth != 3 {
+		t.Errorf("Unexpected spending %+v", spent)
+	}
+}